@@ -0,0 +1,65 @@
+// Утилита переводит секреты приложений, приватные ключи и TOTP секреты в БД на текущий мастер ключ.
+// Запускается после добавления первого мастер ключа (шифрует записи, сохраненные открытым текстом)
+// и после смены мастер ключа (перешифровывает записи, зашифрованные старыми ключами).
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"sso/internal/app"
+	"sso/internal/config"
+	"sso/internal/lib/envelope"
+	"sso/internal/storage/sqlite"
+)
+
+func main() {
+	var configPath string
+	var generateKey bool
+
+	flag.StringVar(&configPath, "config", "", "path to config file")
+	flag.BoolVar(&generateKey, "generate-key", false, "print a new master key and exit")
+	flag.Parse()
+
+	// Новый ключ нужен до того, как он попадет в конфиг, поэтому конфиг тут не читаем
+	if generateKey {
+		key, err := envelope.GenerateKey()
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(key)
+		return
+	}
+
+	if configPath == "" {
+		configPath = os.Getenv("CONFIG_PATH")
+	}
+	if configPath == "" {
+		panic("config is required")
+	}
+	cfg := config.MustLoadByPath(configPath)
+
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	cipher := app.MustLoadCipher(log, cfg.Encryption)
+	if cipher == nil {
+		panic("master keys are not configured")
+	}
+
+	storage, err := sqlite.New(cfg.StoragePath, cipher)
+	if err != nil {
+		panic(err)
+	}
+
+	// Все записи перешифровываются в одной транзакции, при ошибке в БД ничего не меняется
+	count, err := storage.ReencryptSecrets(context.Background())
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("secrets reencrypted: %d\n", count)
+}
@@ -34,10 +34,16 @@ func main()  {
 )
 
 	// 3 - Инициализация приложения (app)
-	application := app.New(log, cfg.GRPC.Port, cfg.StoragePath, cfg.TokenTTL)
+	application := app.New(log, cfg)
 	// 4 - Запустим наш сервер в отдельной горутине, 
 	// пока мы будем в низу ждать записи в канал stop, эта рутина будет обрабатывать запросы
 	go application.GRPCServer.MustRun()
+	// Рядом с gRPC поднимаем HTTP сервер, на нем публикуются ключи для проверки токенов
+	go application.HTTPServer.MustRun()
+	// Плановая ротация ключей подписи
+	go application.KeyRotator.Run()
+	// Фоновая очистка протухших записей об отозванных токенах
+	go application.Denylist.Run()
 
 	// Слушаем сигналы ОС для реализации Graceful shutdown
 	stop := make(chan os.Signal, 1) // Создаем канал в который будем писать сигналы ОС
@@ -48,6 +54,9 @@ func main()  {
 	// ОС послала нам один из сигналов SIGTERM или SIGINT, мы записали его в канал и прочитали в sysSignal
 	log.Info("Stopping application", slog.String("signal", sysSignal.String()))
 	// Корректно завершаем работу сервера
+	application.Denylist.Stop()
+	application.KeyRotator.Stop()
+	application.HTTPServer.Stop()
 	application.GRPCServer.Stop()
 
 	log.Info("Application stopped")
@@ -1,34 +1,209 @@
 package app
 
 import (
+	"context"
 	"log/slog"
-	"time"
+	"os"
 
 	grpcapp "sso/internal/app/grpc"
+	httpapp "sso/internal/app/http"
+	"sso/internal/config"
+	"sso/internal/grpc/ratelimit"
+	httpratelimit "sso/internal/http/ratelimit"
+	"sso/internal/lib/breach"
+	"sso/internal/lib/keys"
+	"sso/internal/lib/mail"
+	"sso/internal/lib/passhash"
+	"sso/internal/lib/password"
+	"sso/internal/lib/tokenbucket"
+	"sso/internal/lib/webauthn"
 	auth "sso/internal/services"
+	"sso/internal/services/admin"
+	"sso/internal/services/apps"
+	"sso/internal/services/keystore"
+	"sso/internal/services/lockout"
+	"sso/internal/services/revocation"
 	"sso/internal/storage/sqlite"
 )
 
 type App struct {
 	GRPCServer *grpcapp.App
+	HTTPServer *httpapp.App
+	KeyRotator *keystore.Rotator
+	Denylist   *revocation.Denylist
 }
 
 func New(
 	log *slog.Logger,
-	grpcPort int,
-	storagePath string,
-	tokenTTL time.Duration,
+	cfg *config.Config,
 ) *App {
-	storage, err := sqlite.New(storagePath)
+	storage, err := sqlite.New(cfg.StoragePath, MustLoadCipher(log, cfg.Encryption))
 	if err != nil {
 		panic(err)
 	}
 
-	authService := auth.New(log, storage, storage, storage, tokenTTL)
+	keyStore := keystore.New(log, storage, storage, storage, keys.NewFileProvider(cfg.KeysPath), cfg.KeyRotation.Period, cfg.TokenTTL)
 
-	grpcApp := grpcapp.New(log, authService, grpcPort)
+	denylist := revocation.New(log, storage, cfg.Revocation.CleanupInterval)
+	// Отозванные токены должны быть в памяти до первого запроса
+	if err := denylist.Load(context.Background()); err != nil {
+		panic(err)
+	}
+
+	loginGuard := lockout.New(log, storage, lockout.Policy{
+		MaxFailures:   cfg.Lockout.MaxFailures,
+		IPMaxFailures: cfg.Lockout.IPMaxFailures,
+		Window:        cfg.Lockout.Window,
+		LockDuration:  cfg.Lockout.LockDuration,
+		BaseDelay:     cfg.Lockout.BaseDelay,
+	})
+
+	authService := auth.New(log,
+		auth.Deps{
+			UserSaver:              storage,
+			UserProvider:           storage,
+			AppProvider:            storage,
+			RefreshTokenSaver:      storage,
+			RefreshTokenProvider:   storage,
+			KeyProvider:            keyStore,
+			TokenRevoker:           denylist,
+			RoleProvider:           storage,
+			LoginGuard:             loginGuard,
+			BreachChecker:          breachChecker(cfg.BreachedPasswords),
+			PasswordHasher:         passwordHasher(cfg.PasswordHashing),
+			PasswordResetStore:     storage,
+			Mailer:                 mailer(cfg.Mail),
+			EmailVerificationStore: storage,
+			MFAStore:               storage,
+			WebAuthnStore:          storage,
+			AuthorizationCodeStore: storage,
+			ClientAssertionStore:   storage,
+			DeviceCodeStore:        storage,
+			UserCodeLimiter:        tokenbucket.New(cfg.OAuth.UserCodeMaxFailures, cfg.OAuth.UserCodeFailureWindow, 0),
+			ImpersonationStore:     storage,
+		},
+		auth.TTLs{
+			Token:             cfg.TokenTTL,
+			RefreshToken:      cfg.RefreshTokenTTL,
+			PasswordReset:     cfg.PasswordReset.TokenTTL,
+			EmailVerification: cfg.EmailVerification.TokenTTL,
+			WebAuthnSession:   cfg.WebAuthn.SessionTTL,
+			AuthorizationCode: cfg.OAuth.AuthorizationCodeTTL,
+			DeviceCode:        cfg.OAuth.DeviceCodeTTL,
+			Impersonation:     cfg.Impersonation.TokenTTL,
+		},
+		auth.Settings{
+			Issuer:               cfg.Issuer,
+			PasswordPolicy:       passwordPolicy(cfg.PasswordPolicy),
+			MFAPolicy:            mfaPolicy(cfg.MFA),
+			RelyingParty:         relyingParty(cfg.WebAuthn),
+			DeviceCodeInterval:   cfg.OAuth.DeviceCodeInterval,
+			RequireVerifiedEmail: cfg.EmailVerification.RequireForLogin,
+			AdminAppID:           cfg.Admin.AppID,
+		},
+	)
+
+	adminService := admin.New(log, storage, storage, storage, storage, storage, loginGuard)
+
+	appsService := apps.New(log, storage, storage)
+
+	grpcApp := grpcapp.New(log, authService, keyStore, adminService, appsService, authService, rateLimits(cfg.GRPC.RateLimits), cfg.GRPC.Port)
+
+	httpApp := httpapp.New(log, keyStore, authService, authService, authService, authService, cfg.Issuer, httpRateLimits(cfg.HTTP.RateLimits), cfg.HTTP.Port, cfg.HTTP.Timeout)
 
 	return &App{
 		GRPCServer: grpcApp,
+		HTTPServer: httpApp,
+		KeyRotator: keystore.NewRotator(log, keyStore, cfg.KeyRotation.CheckInterval),
+		Denylist:   denylist,
+	}
+}
+
+func rateLimits(cfg map[string]config.RateLimitConfig) map[string]ratelimit.MethodLimit {
+	limits := make(map[string]ratelimit.MethodLimit, len(cfg))
+	for method, limit := range cfg {
+		limits[method] = ratelimit.MethodLimit{
+			IP:    ratelimit.Limit{Requests: limit.Requests, Per: limit.Per, Burst: limit.Burst},
+			Email: ratelimit.Limit{Requests: limit.Email.Requests, Per: limit.Email.Per, Burst: limit.Email.Burst},
+		}
+	}
+
+	return limits
+}
+
+func httpRateLimits(cfg map[string]config.RateConfig) map[string]httpratelimit.Limit {
+	limits := make(map[string]httpratelimit.Limit, len(cfg))
+	for route, limit := range cfg {
+		limits[route] = httpratelimit.Limit{Requests: limit.Requests, Per: limit.Per, Burst: limit.Burst}
+	}
+
+	return limits
+}
+
+func passwordPolicy(cfg config.PasswordPolicyConfig) password.Policy {
+	return password.Policy{
+		MinLength:           cfg.MinLength,
+		MaxLength:           cfg.MaxLength,
+		RequireLower:        cfg.RequireLower,
+		RequireUpper:        cfg.RequireUpper,
+		RequireDigit:        cfg.RequireDigit,
+		RequireSymbol:       cfg.RequireSymbol,
+		MinCharacterClasses: cfg.MinCharacterClasses,
+		RejectEmail:         cfg.RejectEmail,
 	}
-}
\ No newline at end of file
+}
+
+// breachChecker возвращает nil, если база утечек не настроена: тогда auth пароли по ней не проверяет
+func breachChecker(cfg config.BreachedPasswordsConfig) auth.BreachChecker {
+	if cfg.Path == "" {
+		return nil
+	}
+
+	return breach.New(breach.NewDir(cfg.Path), cfg.MinCount)
+}
+
+func passwordHasher(cfg config.PasswordHashingConfig) auth.PasswordHasher {
+	switch cfg.Algorithm {
+	case "bcrypt":
+		return passhash.Bcrypt{Cost: cfg.Bcrypt.Cost}
+	case "argon2id":
+		return passhash.Argon2id{Memory: cfg.Argon2id.MemoryKiB, Iterations: cfg.Argon2id.Iterations, Parallelism: cfg.Argon2id.Parallelism}
+	case "scrypt":
+		return passhash.Scrypt{LogN: cfg.Scrypt.LogN, R: cfg.Scrypt.R, P: cfg.Scrypt.P}
+	}
+
+	panic("unknown password hashing algorithm: " + cfg.Algorithm)
+}
+
+func mfaPolicy(cfg config.MFAConfig) auth.MFAPolicy {
+	return auth.MFAPolicy{
+		Issuer:       cfg.Issuer,
+		ChallengeTTL: cfg.ChallengeTTL,
+		MaxAttempts:  cfg.MaxAttempts,
+		Skew:         cfg.Skew,
+	}
+}
+
+func relyingParty(cfg config.WebAuthnConfig) *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{
+		ID:                      cfg.RPID,
+		Name:                    cfg.RPName,
+		Origins:                 cfg.Origins,
+		RequireUserVerification: cfg.RequireUserVerification,
+	}
+}
+
+func mailer(cfg config.MailConfig) auth.Mailer {
+	switch cfg.Driver {
+	case "smtp":
+		return mail.NewSMTP(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.From)
+	case "file":
+		return mail.NewDir(cfg.Dir, cfg.From)
+	case "stdout":
+		return mail.NewWriter(os.Stdout, cfg.From)
+	case "memory":
+		return mail.NewMemory()
+	}
+
+	panic("unknown mail driver: " + cfg.Driver)
+}
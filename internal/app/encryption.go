@@ -0,0 +1,34 @@
+package app
+
+import (
+	"log/slog"
+
+	"sso/internal/config"
+	"sso/internal/lib/envelope"
+	"sso/internal/storage/sqlite"
+)
+
+// MustLoadCipher собирает мастер ключи из конфига и файла.
+// Без ключей возвращает nil, тогда секреты приложений, приватные ключи и TOTP секреты хранятся открытым текстом
+func MustLoadCipher(log *slog.Logger, cfg config.EncryptionConfig) sqlite.Cipher {
+	specs := cfg.MasterKeys
+	if cfg.MasterKeysFile != "" {
+		fileSpecs, err := envelope.LoadKeys(cfg.MasterKeysFile)
+		if err != nil {
+			panic("failed to read master keys: " + err.Error())
+		}
+		specs = append(specs, fileSpecs...)
+	}
+
+	if len(specs) == 0 {
+		log.Warn("master keys are not configured, app secrets are stored unencrypted")
+		return nil
+	}
+
+	keyring, err := envelope.NewKeyring(specs)
+	if err != nil {
+		panic("failed to load master keys: " + err.Error())
+	}
+
+	return keyring
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
+	admingrpc "sso/internal/grpc/admin"
 	authgrpc "sso/internal/grpc/auth"
+	"sso/internal/grpc/ratelimit"
 
 	"google.golang.org/grpc"
 )
@@ -18,11 +20,22 @@ type App struct {
 func New(
 	log *slog.Logger,
 	authService authgrpc.Auth,
+	keySet authgrpc.KeySet,
+	adminService admingrpc.Admin,
+	appsService admingrpc.Apps,
+	authenticator admingrpc.Authenticator,
+	rateLimits map[string]ratelimit.MethodLimit,
 	port int,
 ) *App {
-	gRPCServer := grpc.NewServer()
-
-	authgrpc.Register(gRPCServer, authService)
+	gRPCServer := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		// Лимиты проверяем первыми, чтобы лишние запросы не доходили до БД
+		ratelimit.Interceptor(rateLimits),
+		// Сервис Admin доступен только администраторам
+		admingrpc.AuthInterceptor(authenticator),
+	))
+
+	authgrpc.Register(gRPCServer, authService, keySet)
+	admingrpc.Register(gRPCServer, adminService, appsService)
 
 	return &App{
 		log:        log,
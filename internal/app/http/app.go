@@ -0,0 +1,100 @@
+package httpapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"sso/internal/http/oauth"
+	"sso/internal/http/ratelimit"
+	"sso/internal/http/wellknown"
+	"sso/internal/lib/logger/sl"
+)
+
+type App struct {
+	log        *slog.Logger
+	httpServer *http.Server
+	port       int
+}
+
+func New(
+	log *slog.Logger,
+	keySet wellknown.KeySet,
+	authorizer oauth.Authorizer,
+	tokenIssuer oauth.TokenIssuer,
+	deviceAuthorizer oauth.DeviceAuthorizer,
+	userInfoProvider oauth.UserInfoProvider,
+	issuer string,
+	rateLimits map[string]ratelimit.Limit,
+	port int,
+	timeout time.Duration,
+) *App {
+	mux := http.NewServeMux()
+
+	// Лимит ищется по шаблону маршрута, маршруты без лимита ratelimit.Handler пропускает как есть
+	handle := func(pattern string, handler http.HandlerFunc) {
+		mux.Handle(pattern, ratelimit.Handler(pattern, rateLimits[pattern], handler))
+	}
+
+	handle("GET /.well-known/jwks.json", wellknown.JWKS(log, keySet))
+	handle("GET /.well-known/openid-configuration", wellknown.OpenIDConfiguration(log, issuer))
+	handle("GET /authorize", oauth.AuthorizePage(log, authorizer))
+	handle("POST /authorize", oauth.AuthorizeSubmit(log, authorizer))
+	handle("POST /token", oauth.Token(log, tokenIssuer))
+	handle("POST /device_authorization", oauth.DeviceAuthorization(log, deviceAuthorizer, issuer))
+	handle("GET /device", oauth.DevicePage(log, deviceAuthorizer))
+	handle("POST /device", oauth.DeviceSubmit(log, deviceAuthorizer))
+	handle("GET /userinfo", oauth.UserInfo(log, userInfoProvider))
+	handle("POST /userinfo", oauth.UserInfo(log, userInfoProvider))
+
+	return &App{
+		log: log,
+		httpServer: &http.Server{
+			Handler:      mux,
+			ReadTimeout:  timeout,
+			WriteTimeout: timeout,
+		},
+		port: port,
+	}
+}
+
+func (a *App) MustRun() {
+	if err := a.Run(); err != nil {
+		panic(err)
+	}
+}
+
+func (a *App) Run() error {
+	const op = "httpapp.Run"
+
+	log := a.log.With(slog.String("op", op), slog.Int("port", a.port))
+
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", a.port))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("HTTP server is running", slog.String("addr", l.Addr().String()))
+
+	// После Shutdown Serve возвращает http.ErrServerClosed, это штатное завершение
+	if err := a.httpServer.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Graceful shutdown
+func (a *App) Stop() {
+	const op = "httpapp.Stop"
+
+	a.log.With(slog.String("op", op)).Info("Stopping HTTP server", slog.Int("port", a.port))
+
+	if err := a.httpServer.Shutdown(context.Background()); err != nil {
+		a.log.Error("failed to stop HTTP server", slog.String("op", op), sl.Err(err))
+	}
+}
@@ -11,13 +11,188 @@ import (
 type Config struct {
 	Env 				string 					`yaml:"env" end-default:"local"`
 	StoragePath string 					`yaml:"storage_path" env-required:"true"`
-	TokenTTL 		time.Duration		`yaml:"token_ttl" env-required:"true"`
+	KeysPath string `yaml:"keys_path" env-default:"./keys"`
+	Issuer string `yaml:"issuer" env-required:"true"`
+	TokenTTL 		time.Duration		`yaml:"token_ttl" env-required:"true"` // По умолчанию, приложение может задать свой в apps.token_ttl
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env-default:"720h"`
 	GRPC 				GRPCConfig 			`yaml:"grpc"`
+	HTTP HTTPConfig `yaml:"http"`
+	KeyRotation KeyRotationConfig `yaml:"key_rotation"`
+	Revocation RevocationConfig `yaml:"revocation"`
+	Encryption EncryptionConfig `yaml:"encryption"`
+	Lockout LockoutConfig `yaml:"lockout"`
+	PasswordPolicy PasswordPolicyConfig `yaml:"password_policy"`
+	BreachedPasswords BreachedPasswordsConfig `yaml:"breached_passwords"`
+	PasswordHashing PasswordHashingConfig `yaml:"password_hashing"`
+	PasswordReset PasswordResetConfig `yaml:"password_reset"`
+	Mail MailConfig `yaml:"mail"`
+	EmailVerification EmailVerificationConfig `yaml:"email_verification"`
+	MFA MFAConfig `yaml:"mfa"`
+	WebAuthn WebAuthnConfig `yaml:"webauthn"`
+	OAuth OAuthConfig `yaml:"oauth"`
+	Impersonation ImpersonationConfig `yaml:"impersonation"`
+	Admin AdminConfig `yaml:"admin"`
 }
 
 type GRPCConfig struct {
 	Port 		int 					`yaml:"port"`
 	Timeout time.Duration `yaml:"timeout"`
+	// Лимиты запросов по полному имени метода, например /auth.Auth/Register. Методы без лимита не ограничиваются
+	RateLimits map[string]RateLimitConfig `yaml:"rate_limits"`
+}
+
+// RateLimitConfig - лимит запросов к методу с одного IP адреса и, если задан email, на один email из запроса
+type RateLimitConfig struct {
+	RateConfig `yaml:",inline"`
+	Email RateConfig `yaml:"email"`
+}
+
+// RateConfig - не больше requests запросов за per, подряд можно сделать burst (по умолчанию равен requests)
+type RateConfig struct {
+	Requests int           `yaml:"requests"`
+	Per      time.Duration `yaml:"per"`
+	Burst    int           `yaml:"burst"`
+}
+
+type HTTPConfig struct {
+	Port    int           `yaml:"port" env-default:"8080"`
+	Timeout time.Duration `yaml:"timeout" env-default:"5s"`
+	// Лимиты запросов с одного IP адреса по шаблону маршрута, например "POST /device". Маршруты без лимита не ограничиваются
+	RateLimits map[string]RateConfig `yaml:"rate_limits"`
+}
+
+type RevocationConfig struct {
+	CleanupInterval time.Duration `yaml:"cleanup_interval" env-default:"1h"`
+}
+
+// EncryptionConfig - мастер ключи, которыми шифруются секреты приложений, приватные ключи и TOTP секреты в БД.
+// Ключи задаются как "id:base64" (32 байта), первый ключ шифрует, остальные нужны только чтобы расшифровать старые записи
+type EncryptionConfig struct {
+	// json:"-" - конфиг целиком пишется в лог при старте, ключи туда попадать не должны
+	MasterKeys     []string `yaml:"master_keys" env:"MASTER_KEYS" env-separator:"," json:"-"`
+	MasterKeysFile string   `yaml:"master_keys_file" env:"MASTER_KEYS_FILE"` // По ключу в строке, читается после master_keys
+}
+
+// LockoutConfig - защита входа по паролю от перебора
+type LockoutConfig struct {
+	MaxFailures   int           `yaml:"max_failures" env-default:"5"`
+	IPMaxFailures int           `yaml:"ip_max_failures" env-default:"100"`
+	Window        time.Duration `yaml:"window" env-default:"15m"`
+	LockDuration  time.Duration `yaml:"lock_duration" env-default:"15m"`
+	BaseDelay     time.Duration `yaml:"base_delay" env-default:"1s"`
+}
+
+// PasswordPolicyConfig - требования к паролю при регистрации, нулевые значения правило отключают
+type PasswordPolicyConfig struct {
+	MinLength           int  `yaml:"min_length" env-default:"8"`
+	MaxLength           int  `yaml:"max_length" env-default:"72"` // В байтах, bcrypt не учитывает байты после 72
+	RequireLower        bool `yaml:"require_lower"`
+	RequireUpper        bool `yaml:"require_upper"`
+	RequireDigit        bool `yaml:"require_digit"`
+	RequireSymbol       bool `yaml:"require_symbol"`
+	MinCharacterClasses int  `yaml:"min_character_classes"`
+	RejectEmail         bool `yaml:"reject_email"`
+}
+
+// BreachedPasswordsConfig - база паролей из утечек в формате Have I Been Pwned
+type BreachedPasswordsConfig struct {
+	Path     string `yaml:"path" env:"BREACHED_PASSWORDS_PATH"` // Директория с файлами PREFIX.txt, пусто - проверка выключена
+	MinCount int    `yaml:"min_count" env-default:"1"`         // Сколько раз пароль должен встретиться в утечках, чтобы его запретить
+}
+
+// PasswordHashingConfig - чем хешировать новые пароли. Хеши других алгоритмов и параметров продолжают проверяться
+// и перехешируются текущими настройками, когда пользователь входит
+type PasswordHashingConfig struct {
+	Algorithm string         `yaml:"algorithm" env-default:"bcrypt"` // bcrypt, argon2id или scrypt
+	Bcrypt    BcryptConfig   `yaml:"bcrypt"`
+	Argon2id  Argon2idConfig `yaml:"argon2id"`
+	Scrypt    ScryptConfig   `yaml:"scrypt"`
+}
+
+type BcryptConfig struct {
+	Cost int `yaml:"cost" env-default:"10"`
+}
+
+type Argon2idConfig struct {
+	MemoryKiB   uint32 `yaml:"memory_kib" env-default:"65536"`
+	Iterations  uint32 `yaml:"iterations" env-default:"3"`
+	Parallelism uint8  `yaml:"parallelism" env-default:"2"`
+}
+
+type ScryptConfig struct {
+	LogN int `yaml:"ln" env-default:"15"` // N = 2^ln
+	R    int `yaml:"r" env-default:"8"`
+	P    int `yaml:"p" env-default:"1"`
+}
+
+type PasswordResetConfig struct {
+	TokenTTL time.Duration `yaml:"token_ttl" env-default:"1h"` // Сколько действует токен из письма
+}
+
+// EmailVerificationConfig - подтверждение email после регистрации
+type EmailVerificationConfig struct {
+	TokenTTL        time.Duration `yaml:"token_ttl" env-default:"24h"` // Сколько действует токен из письма
+	RequireForLogin bool          `yaml:"require_for_login"`           // Не пускать пользователей с неподтвержденным email
+}
+
+// MFAConfig - второй фактор TOTP (RFC 6238)
+type MFAConfig struct {
+	Issuer       string        `yaml:"issuer" env-default:"sso"`      // Название сервиса в приложении-аутентификаторе
+	ChallengeTTL time.Duration `yaml:"challenge_ttl" env-default:"5m"` // Сколько после пароля ждать код
+	MaxAttempts  int           `yaml:"max_attempts" env-default:"5"`   // Неверных кодов за один вход
+	Skew         int           `yaml:"skew" env-default:"1"`           // Сколько соседних 30-секундных шагов принимать
+}
+
+// WebAuthnConfig - вход по passkey (WebAuthn)
+type WebAuthnConfig struct {
+	RPID    string   `yaml:"rp_id" env-default:"localhost"` // Домен, к которому привязываются passkey
+	RPName  string   `yaml:"rp_name" env-default:"sso"`     // Название сервиса, которое покажет браузер
+	Origins []string `yaml:"origins"`                       // Страницы, с которых браузер может присылать ответы
+	// Требовать PIN или биометрию. Тогда passkey заменяет и пароль, и TOTP
+	RequireUserVerification bool          `yaml:"require_user_verification"`
+	SessionTTL              time.Duration `yaml:"session_ttl" env-default:"5m"` // Сколько ждать ответа аутентификатора
+}
+
+// OAuthConfig - сервер авторизации OAuth2 на HTTP сервере (/authorize, /token, /device_authorization)
+type OAuthConfig struct {
+	AuthorizationCodeTTL time.Duration `yaml:"authorization_code_ttl" env-default:"1m"` // Сколько действует код из /authorize
+	DeviceCodeTTL        time.Duration `yaml:"device_code_ttl" env-default:"10m"`       // Сколько ждать, пока пользователь подтвердит устройство
+	DeviceCodeInterval   time.Duration `yaml:"device_code_interval" env-default:"5s"`   // Как часто устройство может спрашивать /token
+	// Неверные user_code на странице /device с одного IP адреса: не больше UserCodeMaxFailures за UserCodeFailureWindow
+	UserCodeMaxFailures   int           `yaml:"user_code_max_failures" env-default:"10"`
+	UserCodeFailureWindow time.Duration `yaml:"user_code_failure_window" env-default:"10m"`
+}
+
+// ImpersonationConfig - вход администраторов от имени пользователей через TokenExchange
+type ImpersonationConfig struct {
+	TokenTTL time.Duration `yaml:"token_ttl" env-default:"15m"` // Не дольше обычного токена приложения
+}
+
+// AdminConfig - приложение, через которое входят администраторы SSO
+type AdminConfig struct {
+	// Сервис Admin и TokenExchange принимают токены администраторов только этого приложения.
+	// Оно должно подписывать токены асимметричным ключом. 0 - приложение самого SSO, по нему не войти никому
+	AppID int `yaml:"app_id"`
+}
+
+// MailConfig - как отправлять письма пользователям
+type MailConfig struct {
+	Driver string     `yaml:"driver" env-default:"file"` // smtp, file - файлами в dir, stdout или memory - только в памяти процесса
+	From   string     `yaml:"from" env-default:"sso@localhost"`
+	Dir    string     `yaml:"dir" env-default:"./storage/outbox"`
+	SMTP   SMTPConfig `yaml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host" env:"SMTP_HOST"`
+	Port     int    `yaml:"port" env:"SMTP_PORT" env-default:"587"`
+	Username string `yaml:"username" env:"SMTP_USERNAME"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD" json:"-"` // Конфиг пишется в лог при старте, пароль туда попадать не должен
+}
+
+type KeyRotationConfig struct {
+	Period        time.Duration `yaml:"period" env-default:"720h"`
+	CheckInterval time.Duration `yaml:"check_interval" env-default:"1h"`
 }
 
 // По негласной договоренности функции которые не возвращают ошибок называются с прификсом Must
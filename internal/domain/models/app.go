@@ -1,7 +1,67 @@
 package models
 
+import (
+	"slices"
+	"time"
+)
+
+// Необязательные поля access токена, которые приложение включает в колонке apps.claims
+const (
+	ClaimEmail   = "email"
+	ClaimIsAdmin = "is_admin"
+	ClaimRoles   = "roles"
+)
+
+// Способы получения токенов (OAuth2 grant types), которые можно разрешить приложению
+const (
+	GrantPassword          = "password"                                     // Login по email и паролю, вход по passkey
+	GrantRefreshToken      = "refresh_token"                                // Refresh
+	GrantAuthorizationCode = "authorization_code"                           // /authorize и /token с PKCE
+	GrantClientCredentials = "client_credentials"                           // ClientLogin и /token: токен самого приложения, без пользователя
+	GrantDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code" // /device_authorization: вход на устройстве без браузера
+)
+
 type App struct {
 	ID int
 	Name string
 	Secret string
-}
\ No newline at end of file
+	SigningAlg string // HS256, RS256, ES256 или EdDSA
+	SigningKey string // Ссылка на приватный ключ для асимметричных алгоритмов
+	TokenTTL time.Duration // 0 - время жизни access токена из конфига
+	RefreshTokenTTL time.Duration // 0 - время жизни refresh токена из конфига
+	Claims []string // Необязательные поля access токена
+	RedirectURIs []string // Куда можно возвращать пользователя после входа
+	GrantTypes []string
+	Scopes []string // Права, которые приложение может получить через client_credentials
+	ClientPublicKey string // PEM публичного ключа для входа по private_key_jwt, пусто - только по секрету
+	Public bool // Публичный клиент не может хранить секрет и входит на /token только по client_id (RFC 6749, раздел 2.1)
+	Enabled bool
+}
+
+// AccessTTL возвращает время жизни access токенов приложения, если оно не задано - defaultTTL
+func (a App) AccessTTL(defaultTTL time.Duration) time.Duration {
+	if a.TokenTTL > 0 {
+		return a.TokenTTL
+	}
+
+	return defaultTTL
+}
+
+// RefreshTTL возвращает время жизни refresh токенов приложения, если оно не задано - defaultTTL
+func (a App) RefreshTTL(defaultTTL time.Duration) time.Duration {
+	if a.RefreshTokenTTL > 0 {
+		return a.RefreshTokenTTL
+	}
+
+	return defaultTTL
+}
+
+// HasClaim сообщает, нужно ли класть необязательное поле в токены приложения
+func (a App) HasClaim(claim string) bool {
+	return slices.Contains(a.Claims, claim)
+}
+
+// AllowsGrant сообщает, может ли приложение получать токены этим способом
+func (a App) AllowsGrant(grantType string) bool {
+	return slices.Contains(a.GrantTypes, grantType)
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// LoginFailures - неудачные попытки входа подряд для учетной записи или IP адреса
+type LoginFailures struct {
+	Subject      string
+	Count        int
+	LastFailedAt time.Time
+}
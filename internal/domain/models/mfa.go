@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// MFA - TOTP второй фактор пользователя
+type MFA struct {
+	UserID       int64
+	Secret       string    // base32, в БД зашифрован
+	ConfirmedAt  time.Time // Нулевое значение - подключение не подтверждено кодом, вход второй фактор не требует
+	LastUsedStep int64     // Шаг последнего принятого кода, коды этого и более ранних шагов не принимаются
+}
+
+// Enabled сообщает, требует ли вход второй фактор
+func (m MFA) Enabled() bool {
+	return !m.ConfirmedAt.IsZero()
+}
+
+// MFAChallenge - вход, который ждет второй фактор, в БД лежит только хэш токена
+type MFAChallenge struct {
+	TokenHash string
+	UserID    int64
+	AppID     int
+	ExpiresAt time.Time
+	Attempts  int // Неверные коды
+}
@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// Права OpenID Connect, которые приложение может запросить в scope. Остальные значения scope игнорируются
+const (
+	ScopeOpenID  = "openid"  // Выдать id_token и открыть /userinfo
+	ScopeEmail   = "email"   // email и email_verified
+	ScopeProfile = "profile" // preferred_username
+)
+
+// AuthorizationRequest - параметры запроса к /authorize (RFC 6749, PKCE - RFC 7636)
+type AuthorizationRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string // OpenID Connect: возвращается приложению в id_token
+}
+
+// AuthorizationCode - одноразовый код OAuth2, в БД лежит только его хэш
+type AuthorizationCode struct {
+	CodeHash      string
+	AppID         int
+	UserID        int64
+	RedirectURI   string
+	Scope         string
+	CodeChallenge string // base64url(sha256(code_verifier))
+	FamilyID      string // Семейство refresh токенов, которое начнет обмен кода
+	Nonce         string
+	AuthTime      time.Time // Когда пользователь ввел пароль, попадает в id_token
+	ExpiresAt     time.Time
+	UsedAt        time.Time // Нулевое значение - код еще не обменивали
+}
+
+// Состояния кода устройства
+const (
+	DeviceCodePending  = "pending"  // Пользователь еще не ввел код
+	DeviceCodeApproved = "approved" // Пользователь разрешил вход, устройство может забрать токены
+	DeviceCodeDenied   = "denied"
+)
+
+// DeviceCode - код входа устройства (RFC 8628). device_code знает только устройство, в БД лежит его хэш,
+// user_code пользователь вводит на странице /device
+type DeviceCode struct {
+	DeviceCodeHash string
+	UserCode       string // Без дефиса, заглавными буквами
+	AppID          int
+	Scope          string
+	Status         string
+	UserID         int64     // Заполняется, когда пользователь разрешил вход
+	AuthTime       time.Time // Когда пользователь ввел пароль, попадает в id_token
+	Interval       time.Duration
+	LastPolledAt   time.Time // Нулевое значение - устройство еще не спрашивало /token
+	ExpiresAt      time.Time
+}
+
+// DeviceAuthorization - ответ устройству на /device_authorization
+type DeviceAuthorization struct {
+	DeviceCode string
+	UserCode   string // Для показа пользователю, с дефисом: XXXX-XXXX
+	ExpiresIn  time.Duration
+	Interval   time.Duration
+}
+
+// UserInfo - ответ /userinfo, поля заполняются по правам access токена
+type UserInfo struct {
+	UserID            int64
+	Email             string // Пусто без scope email
+	EmailVerified     bool
+	PreferredUsername string // Пусто без scope profile
+}
@@ -0,0 +1,18 @@
+package models
+
+// Role - роль пользователя в приложении, роли разных приложений между собой не связаны
+type Role struct {
+	ID          int64
+	AppID       int
+	Name        string
+	Permissions []string // Например "articles:write"
+}
+
+// Права администратора SSO - это роль RoleAdmin с разрешением PermissionAdmin.
+// Роль принадлежит приложению самого SSO с ID SystemAppID: оно выключено, токенов по нему не выдать,
+// и через API приложений его не видно и не изменить
+const (
+	SystemAppID     = 0
+	RoleAdmin       = "admin"
+	PermissionAdmin = "sso:admin"
+)
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Состояния ключа подписи в процессе ротации
+const (
+	SigningKeyNext    = "next"
+	SigningKeyActive  = "active"
+	SigningKeyRetired = "retired"
+)
+
+type SigningKey struct {
+	ID          string // kid, по нему проверяющий находит публичный ключ в JWKS
+	AppID       int
+	Alg         string
+	PrivateKey  []byte // PEM PKCS8
+	Status      string
+	CreatedAt   time.Time
+	ActivatedAt time.Time
+	RetiredAt   time.Time
+	ExpiresAt   time.Time // До какого момента retired ключ публикуется в JWKS
+}
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// TokenPair - то что получает клиент после успешного входа
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	IDToken      string        // OpenID Connect, только при обмене кода с scope openid
+	MFAToken     string        // Если не пустой, токенов нет: у пользователя второй фактор и вход нужно завершить VerifyMFA
+	ExpiresIn    time.Duration // Время жизни access токена
+	Scope        string        // Выданные права OAuth2, только для токенов, полученных через /token
+}
+
+type RefreshToken struct {
+	ID        int64
+	TokenHash string
+	FamilyID  string
+	UserID    int64
+	AppID     int
+	Scope     string // Права OAuth2 через пробел, пусто для входа через Login
+	ExpiresAt time.Time
+	RotatedAt time.Time // Нулевое значение - токен еще не обменивали
+	RevokedAt time.Time // Нулевое значение - токен не отозван
+}
+
+// PasswordResetToken - одноразовый токен сброса пароля, в БД лежит только его хэш
+type PasswordResetToken struct {
+	TokenHash string
+	UserID    int64
+	ExpiresAt time.Time
+	UsedAt    time.Time // Нулевое значение - токен еще не использован
+}
+
+// EmailVerificationToken - токен подтверждения email из письма, в БД лежит только его хэш
+type EmailVerificationToken struct {
+	TokenHash string
+	UserID    int64
+	ExpiresAt time.Time
+}
+
+// Impersonation - запись журнала: администратор получил через TokenExchange токен пользователя
+type Impersonation struct {
+	ID        int64
+	ActorID   int64 // Администратор
+	UserID    int64 // Пользователь, от имени которого он действует
+	AppID     int
+	Reason    string // Зачем понадобился вход, например номер обращения в поддержку
+	CreatedAt time.Time
+	ExpiresAt time.Time // Когда протухнет выданный токен
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// TokenInfo - результат интроспекции токена (RFC 7662)
+type TokenInfo struct {
+	Active    bool   // false если токен невалиден, протух или отозван, остальные поля тогда пустые
+	UserID    int64  // 0 для токена приложения (client_credentials)
+	Subject   string // sub: ID пользователя или client_id приложения
+	Email     string
+	AppID     int
+	ExpiresAt time.Time
+	IssuedAt  time.Time
+	NotBefore time.Time
+	Issuer    string
+	Audience  []string
+	TokenID   string // jti
+	Scope     string // Права OAuth2 через пробел
+	ActorID   int64  // Администратор, действующий от имени пользователя (act), 0 - токен выдан самому пользователю
+	Revoked   bool   // Токен валиден, но отозван через Logout или RevokeToken
+}
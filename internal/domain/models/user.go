@@ -1,8 +1,23 @@
 package models
 
+import "time"
+
 type User struct {
 	ID int64
 	Email string
 	PassHash []byte
+	IsAdmin bool // Есть роль администратора SSO (RoleAdmin)
+	Disabled bool
+	PasswordResetRequired bool
+	PasswordChangedAt time.Time // Нулевое значение - пароль не меняли
+	EmailVerified bool
 }
 
+// UserFilter - условия выборки пользователей для администратора, пустые поля не фильтруют
+type UserFilter struct {
+	Email    string // Часть email
+	IsAdmin  *bool
+	Disabled *bool
+	AfterID  int64 // Пользователи с ID больше этого, так листаются страницы
+	Limit    int
+}
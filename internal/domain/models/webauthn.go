@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Для чего начата сессия WebAuthn
+const (
+	WebAuthnRegistration = "registration"
+	WebAuthnLogin        = "login"
+)
+
+// WebAuthnCredential - учетные данные WebAuthn (passkey) пользователя
+type WebAuthnCredential struct {
+	ID         []byte
+	UserID     int64
+	PublicKey  []byte // COSE_Key
+	SignCount  uint32
+	Name       string
+	CreatedAt  time.Time
+	LastUsedAt time.Time // Нулевое значение - по ним еще не входили
+}
+
+// WebAuthnSession - начатая регистрация или вход, которые ждут ответа аутентификатора. В БД лежит только хэш вызова
+type WebAuthnSession struct {
+	ChallengeHash string
+	Kind          string
+	UserID        int64 // 0 - вход без email, пользователя назовет аутентификатор
+	AppID         int   // Куда входит пользователь, только для входа
+	ExpiresAt     time.Time
+}
+
+// WebAuthnOptions - параметры для navigator.credentials.create() или navigator.credentials.get()
+type WebAuthnOptions struct {
+	Challenge     []byte
+	RPID          string
+	RPName        string
+	UserHandle    []byte   // user.id для аутентификатора, только при регистрации
+	UserName      string   // Только при регистрации
+	CredentialIDs [][]byte // При регистрации - excludeCredentials, при входе - allowCredentials
+	Algorithms    []int64  // pubKeyCredParams, только при регистрации
+	Timeout       time.Duration
+	// "required" или "preferred"
+	UserVerification string
+}
@@ -0,0 +1,168 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/services/apps"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Apps управляет приложениями (клиентами)
+type Apps interface {
+	CreateApp(ctx context.Context, app models.App) (models.App, error)
+	Apps(ctx context.Context) ([]models.App, error)
+	App(ctx context.Context, appID int) (models.App, error)
+	UpdateApp(ctx context.Context, app models.App) (models.App, error)
+	RotateSecret(ctx context.Context, appID int) (secret string, err error)
+	DeleteApp(ctx context.Context, appID int) error
+}
+
+func (s *serverAPI) CreateApp(ctx context.Context, req *ssov1.CreateAppRequest) (*ssov1.CreateAppResponse, error) {
+	// Валидация
+	if req.GetSettings().GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "settings.name is required")
+	}
+
+	app := fromAppSettings(req.GetSettings())
+	app.SigningAlg = req.GetSigningAlg()
+
+	app, err := s.apps.CreateApp(ctx, app)
+	if err != nil {
+		return nil, appsError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.CreateAppResponse{App: toApp(app), Secret: app.Secret}, nil
+}
+
+func (s *serverAPI) ListApps(ctx context.Context, req *ssov1.ListAppsRequest) (*ssov1.ListAppsResponse, error) {
+	list, err := s.apps.Apps(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list apps")
+	}
+
+	resp := &ssov1.ListAppsResponse{Apps: make([]*ssov1.App, 0, len(list))}
+	for _, app := range list {
+		resp.Apps = append(resp.Apps, toApp(app))
+	}
+
+	// Отдаем клиенту ответ
+	return resp, nil
+}
+
+func (s *serverAPI) GetApp(ctx context.Context, req *ssov1.GetAppRequest) (*ssov1.GetAppResponse, error) {
+	// Валидация
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	app, err := s.apps.App(ctx, int(req.GetAppId()))
+	if err != nil {
+		return nil, appsError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.GetAppResponse{App: toApp(app)}, nil
+}
+
+func (s *serverAPI) UpdateApp(ctx context.Context, req *ssov1.UpdateAppRequest) (*ssov1.UpdateAppResponse, error) {
+	// Валидация
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetSettings().GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "settings.name is required")
+	}
+
+	app := fromAppSettings(req.GetSettings())
+	app.ID = int(req.GetAppId())
+
+	app, err := s.apps.UpdateApp(ctx, app)
+	if err != nil {
+		return nil, appsError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.UpdateAppResponse{App: toApp(app)}, nil
+}
+
+func (s *serverAPI) RotateAppSecret(ctx context.Context, req *ssov1.RotateAppSecretRequest) (*ssov1.RotateAppSecretResponse, error) {
+	// Валидация
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	secret, err := s.apps.RotateSecret(ctx, int(req.GetAppId()))
+	if err != nil {
+		return nil, appsError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.RotateAppSecretResponse{Secret: secret}, nil
+}
+
+func (s *serverAPI) DeleteApp(ctx context.Context, req *ssov1.DeleteAppRequest) (*ssov1.DeleteAppResponse, error) {
+	// Валидация
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	if err := s.apps.DeleteApp(ctx, int(req.GetAppId())); err != nil {
+		return nil, appsError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.DeleteAppResponse{}, nil
+}
+
+func fromAppSettings(settings *ssov1.AppSettings) models.App {
+	return models.App{
+		Name:            settings.GetName(),
+		RedirectURIs:    settings.GetRedirectUris(),
+		GrantTypes:      settings.GetGrantTypes(),
+		Enabled:         settings.GetEnabled(),
+		TokenTTL:        time.Duration(settings.GetTokenTtlSeconds()) * time.Second,
+		RefreshTokenTTL: time.Duration(settings.GetRefreshTokenTtlSeconds()) * time.Second,
+		Claims:          settings.GetClaims(),
+		Scopes:          settings.GetScopes(),
+		ClientPublicKey: settings.GetClientPublicKey(),
+		Public:          settings.GetPublic(),
+	}
+}
+
+func toApp(app models.App) *ssov1.App {
+	return &ssov1.App{
+		Id:                     int32(app.ID),
+		Name:                   app.Name,
+		SigningAlg:             app.SigningAlg,
+		RedirectUris:           app.RedirectURIs,
+		GrantTypes:             app.GrantTypes,
+		Enabled:                app.Enabled,
+		TokenTtlSeconds:        int64(app.TokenTTL.Seconds()),
+		RefreshTokenTtlSeconds: int64(app.RefreshTokenTTL.Seconds()),
+		Claims:                 app.Claims,
+		Scopes:                 app.Scopes,
+		ClientPublicKey:        app.ClientPublicKey,
+		Public:                 app.Public,
+	}
+}
+
+func appsError(err error) error {
+	var validationErr *apps.ValidationError
+	if errors.As(err, &validationErr) {
+		return status.Error(codes.InvalidArgument, validationErr.Error())
+	}
+	if errors.Is(err, apps.ErrAppNotFound) {
+		return status.Error(codes.NotFound, "app not found")
+	}
+	if errors.Is(err, apps.ErrAppExists) {
+		return status.Error(codes.AlreadyExists, "app already exists")
+	}
+	return status.Error(codes.Internal, "internal error")
+}
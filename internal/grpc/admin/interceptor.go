@@ -0,0 +1,65 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"sso/internal/domain/models"
+	auth "sso/internal/services"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Authenticator проверяет access токен администратора SSO
+type Authenticator interface {
+	AuthenticateAdmin(ctx context.Context, token string) (models.TokenInfo, error)
+}
+
+// AuthInterceptor пускает к методам сервиса Admin только с access токеном администратора, выданным
+// приложению администраторов, в метаданных authorization: Bearer <token>. Остальные сервисы перехватчик пропускает как есть
+func AuthInterceptor(authenticator Authenticator) grpc.UnaryServerInterceptor {
+	prefix := "/" + ssov1.Admin_ServiceDesc.ServiceName + "/"
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !strings.HasPrefix(info.FullMethod, prefix) {
+			return handler(ctx, req)
+		}
+
+		token := bearerToken(ctx)
+		if token == "" {
+			return nil, status.Error(codes.Unauthenticated, "admin token is required")
+		}
+
+		if _, err := authenticator.AuthenticateAdmin(ctx, token); err != nil {
+			if errors.Is(err, auth.ErrInvalidToken) {
+				return nil, status.Error(codes.Unauthenticated, "invalid token")
+			}
+			if errors.Is(err, auth.ErrNotAdmin) {
+				return nil, status.Error(codes.PermissionDenied, "admin rights required")
+			}
+			return nil, status.Error(codes.Internal, "failed to check token")
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func bearerToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	for _, value := range md.Get("authorization") {
+		if token, ok := strings.CutPrefix(value, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+
+	return ""
+}
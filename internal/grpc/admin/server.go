@@ -0,0 +1,219 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"sso/internal/domain/models"
+	"sso/internal/services/admin"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Описываем интерфейс в месте его использования
+type Admin interface {
+	ListUsers(ctx context.Context, filter models.UserFilter) (users []models.User, lastID int64, err error)
+	User(ctx context.Context, userID int64) (models.User, error)
+	SetUserDisabled(ctx context.Context, userID int64, disabled bool) error
+	ForcePasswordReset(ctx context.Context, userID int64) error
+	UnlockUser(ctx context.Context, userID int64) error
+	SetAdmin(ctx context.Context, userID int64, isAdmin bool) error
+	SetUserRole(ctx context.Context, userID int64, appID int, role string, assigned bool) error
+	DeleteUser(ctx context.Context, userID int64) error
+}
+
+type serverAPI struct {
+	ssov1.UnimplementedAdminServer
+	admin Admin
+	apps  Apps
+}
+
+// Register регистрирует сервис Admin, проверку токена администратора делает AuthInterceptor
+func Register(gRPCServer *grpc.Server, admin Admin, apps Apps) {
+	ssov1.RegisterAdminServer(gRPCServer, &serverAPI{admin: admin, apps: apps})
+}
+
+func (s *serverAPI) ListUsers(ctx context.Context, req *ssov1.ListUsersRequest) (*ssov1.ListUsersResponse, error) {
+	// Валидация
+	if req.GetPageSize() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	}
+
+	filter := models.UserFilter{
+		Email:    req.GetEmail(),
+		IsAdmin:  req.IsAdmin,
+		Disabled: req.Disabled,
+		Limit:    int(req.GetPageSize()),
+	}
+	if req.GetPageToken() != "" {
+		afterID, err := strconv.ParseInt(req.GetPageToken(), 10, 64)
+		if err != nil || afterID <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+		filter.AfterID = afterID
+	}
+
+	users, lastID, err := s.admin.ListUsers(ctx, filter)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to list users")
+	}
+
+	resp := &ssov1.ListUsersResponse{Users: make([]*ssov1.User, 0, len(users))}
+	for _, user := range users {
+		resp.Users = append(resp.Users, toUser(user))
+	}
+	if lastID != 0 {
+		resp.NextPageToken = strconv.FormatInt(lastID, 10)
+	}
+
+	// Отдаем клиенту ответ
+	return resp, nil
+}
+
+func (s *serverAPI) GetUser(ctx context.Context, req *ssov1.GetUserRequest) (*ssov1.GetUserResponse, error) {
+	// Валидация
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	user, err := s.admin.User(ctx, req.GetUserId())
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.GetUserResponse{User: toUser(user)}, nil
+}
+
+func (s *serverAPI) DisableUser(ctx context.Context, req *ssov1.DisableUserRequest) (*ssov1.DisableUserResponse, error) {
+	// Валидация
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	if err := s.admin.SetUserDisabled(ctx, req.GetUserId(), true); err != nil {
+		return nil, adminError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.DisableUserResponse{}, nil
+}
+
+func (s *serverAPI) EnableUser(ctx context.Context, req *ssov1.EnableUserRequest) (*ssov1.EnableUserResponse, error) {
+	// Валидация
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	if err := s.admin.SetUserDisabled(ctx, req.GetUserId(), false); err != nil {
+		return nil, adminError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.EnableUserResponse{}, nil
+}
+
+func (s *serverAPI) ForcePasswordReset(ctx context.Context, req *ssov1.ForcePasswordResetRequest) (*ssov1.ForcePasswordResetResponse, error) {
+	// Валидация
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	if err := s.admin.ForcePasswordReset(ctx, req.GetUserId()); err != nil {
+		return nil, adminError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.ForcePasswordResetResponse{}, nil
+}
+
+func (s *serverAPI) UnlockUser(ctx context.Context, req *ssov1.UnlockUserRequest) (*ssov1.UnlockUserResponse, error) {
+	// Валидация
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	if err := s.admin.UnlockUser(ctx, req.GetUserId()); err != nil {
+		return nil, adminError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.UnlockUserResponse{}, nil
+}
+
+func (s *serverAPI) SetAdmin(ctx context.Context, req *ssov1.SetAdminRequest) (*ssov1.SetAdminResponse, error) {
+	// Валидация
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	if err := s.admin.SetAdmin(ctx, req.GetUserId(), req.GetIsAdmin()); err != nil {
+		return nil, adminError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.SetAdminResponse{}, nil
+}
+
+func (s *serverAPI) SetUserRole(ctx context.Context, req *ssov1.SetUserRoleRequest) (*ssov1.SetUserRoleResponse, error) {
+	// Валидация
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetRole() == "" {
+		return nil, status.Error(codes.InvalidArgument, "role is required")
+	}
+
+	err := s.admin.SetUserRole(ctx, req.GetUserId(), int(req.GetAppId()), req.GetRole(), req.GetAssigned())
+	if err != nil {
+		return nil, adminError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.SetUserRoleResponse{}, nil
+}
+
+func (s *serverAPI) DeleteUser(ctx context.Context, req *ssov1.DeleteUserRequest) (*ssov1.DeleteUserResponse, error) {
+	// Валидация
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	if err := s.admin.DeleteUser(ctx, req.GetUserId()); err != nil {
+		return nil, adminError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.DeleteUserResponse{}, nil
+}
+
+func toUser(user models.User) *ssov1.User {
+	return &ssov1.User{
+		Id:                    user.ID,
+		Email:                 user.Email,
+		IsAdmin:               user.IsAdmin,
+		Disabled:              user.Disabled,
+		PasswordResetRequired: user.PasswordResetRequired,
+		EmailVerified:         user.EmailVerified,
+	}
+}
+
+func adminError(err error) error {
+	if errors.Is(err, admin.ErrUserNotFound) {
+		return status.Error(codes.NotFound, "user not found")
+	}
+	if errors.Is(err, admin.ErrInvalidAppID) {
+		return status.Error(codes.InvalidArgument, "invalid app_id")
+	}
+	if errors.Is(err, admin.ErrRoleNotFound) {
+		return status.Error(codes.NotFound, "role not found")
+	}
+	return status.Error(codes.Internal, "internal error")
+}
@@ -3,13 +3,22 @@ package auth
 import (
 	"context"
 	"errors"
+	"strconv"
+	"strings"
+	"time"
 
+	"sso/internal/domain/models"
+	"sso/internal/lib/clientip"
+	"sso/internal/lib/jwks"
+	"sso/internal/lib/password"
 	auth "sso/internal/services"
 
 	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"  // Набор статус кодов
 	"google.golang.org/grpc/status" // Статус ответа
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 const (
@@ -18,9 +27,34 @@ const (
 
 // Описываем интерфейс в месте его использования
 type Auth interface {
-	Login(ctx context.Context, email string, password string, appID int) (token string, err error)
+	Login(ctx context.Context, email string, password string, appID int, ip string) (tokens models.TokenPair, err error)
 	RegisterNewUser(ctx context.Context, email string, password string) (userID int64, err error)
 	IsAdmin(ctx context.Context, userID int64) (bool, error)
+	Refresh(ctx context.Context, refreshToken string) (tokens models.TokenPair, err error)
+	IntrospectToken(ctx context.Context, appID int, clientSecret string, clientAssertion string, token string) (models.TokenInfo, error)
+	Logout(ctx context.Context, accessToken string, refreshToken string) error
+	RevokeToken(ctx context.Context, appID int, clientSecret string, clientAssertion string, token string, tokenTypeHint string) error
+	CheckPermission(ctx context.Context, userID int64, appID int, permission string) (bool, error)
+	ListUserRoles(ctx context.Context, userID int64, appID int) ([]models.Role, error)
+	ChangePassword(ctx context.Context, email string, oldPassword string, newPassword string, ip string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ConfirmPasswordReset(ctx context.Context, token string, newPassword string) error
+	VerifyEmail(ctx context.Context, token string) error
+	EnrollTOTP(ctx context.Context, accessToken string) (secret string, uri string, err error)
+	ConfirmTOTP(ctx context.Context, accessToken string, code string) (recoveryCodes []string, err error)
+	DisableTOTP(ctx context.Context, accessToken string, code string, recoveryCode string, ip string) error
+	VerifyMFA(ctx context.Context, mfaToken string, code string, recoveryCode string, ip string) (tokens models.TokenPair, err error)
+	BeginWebAuthnRegistration(ctx context.Context, accessToken string) (models.WebAuthnOptions, error)
+	FinishWebAuthnRegistration(ctx context.Context, accessToken string, name string, clientDataJSON []byte, attestationObject []byte) (credentialID []byte, err error)
+	BeginWebAuthnLogin(ctx context.Context, email string, appID int) (models.WebAuthnOptions, error)
+	FinishWebAuthnLogin(ctx context.Context, credentialID []byte, clientDataJSON []byte, authenticatorData []byte, signature []byte, userHandle []byte) (tokens models.TokenPair, err error)
+	ClientLogin(ctx context.Context, appID int, clientSecret string, clientAssertion string, scope string) (tokens models.TokenPair, err error)
+	TokenExchange(ctx context.Context, actorToken string, userID int64, appID int, reason string) (tokens models.TokenPair, err error)
+}
+
+// KeySet отдает публичные ключи приложений
+type KeySet interface {
+	JWKS(ctx context.Context, appID int) (jwks.Set, error)
 }
 
 type serverAPI struct {
@@ -28,10 +62,11 @@ type serverAPI struct {
 	 // По сути получаем временные заглушки наших методов IsAdmin, Login, Register
 	ssov1.UnimplementedAuthServer
 	auth Auth
+	keySet KeySet
 }
 
-func Register(gRPCServer *grpc.Server, auth Auth) {
-	ssov1.RegisterAuthServer(gRPCServer, &serverAPI{auth: auth})
+func Register(gRPCServer *grpc.Server, auth Auth, keySet KeySet) {
+	ssov1.RegisterAuthServer(gRPCServer, &serverAPI{auth: auth, keySet: keySet})
 }
 
 // req - Данные от клиента идущие в запрос. Например email := req.GetEmail()
@@ -51,16 +86,38 @@ func (s *serverAPI) Login(ctx context.Context, req *ssov1.LoginRequest) (*ssov1.
 	}
 
 	// Отрабатывает сервисный слой (слой бизнеслогики)
-	token, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), int(req.GetAppId()))
+	tokens, err := s.auth.Login(ctx, req.GetEmail(), req.GetPassword(), int(req.GetAppId()), clientip.FromContext(ctx))
 	if err != nil {
+		var lockedErr *auth.LockedError
+		if errors.As(err, &lockedErr) {
+			return nil, lockedStatus(lockedErr.RetryAfter)
+		}
 		if errors.Is(err, auth.ErrInvalidCredentials) {
 			return nil, status.Error(codes.InvalidArgument, "invalid email or password")
 		}
+		if errors.Is(err, auth.ErrInvalidAppID) {
+			return nil, status.Error(codes.InvalidArgument, "invalid app_id")
+		}
+		if errors.Is(err, auth.ErrUserDisabled) {
+			return nil, status.Error(codes.PermissionDenied, "user is disabled")
+		}
+		if errors.Is(err, auth.ErrPasswordResetRequired) {
+			return nil, status.Error(codes.FailedPrecondition, "password reset required")
+		}
+		if errors.Is(err, auth.ErrEmailNotVerified) {
+			return nil, emailNotVerifiedStatus()
+		}
+		if errors.Is(err, auth.ErrAppDisabled) {
+			return nil, status.Error(codes.PermissionDenied, "app is disabled")
+		}
+		if errors.Is(err, auth.ErrGrantNotAllowed) {
+			return nil, status.Error(codes.PermissionDenied, "password grant is not allowed for app")
+		}
 		return nil, status.Error(codes.Internal, "failed to login")
 	}
 
 	// Отдаем клиенту ответ
-	return &ssov1.LoginResponse{Token: token}, nil
+	return &ssov1.LoginResponse{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken, MfaToken: tokens.MFAToken}, nil
 }
 
 func (s *serverAPI) Register(ctx context.Context, req *ssov1.RegisterRequest,) (*ssov1.RegisterResponse, error) {
@@ -77,6 +134,10 @@ func (s *serverAPI) Register(ctx context.Context, req *ssov1.RegisterRequest,) (
 	userID, err := s.auth.RegisterNewUser(ctx, req.GetEmail(), req.GetPassword())
 
 	if err != nil {
+		var policyErr *auth.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			return nil, passwordPolicyStatus("password", policyErr.Violations)
+		}
 		if errors.Is(err, auth.ErrUserExists) {
 			return nil, status.Error(codes.AlreadyExists, "user already exists")
 		}
@@ -103,4 +164,672 @@ func (s *serverAPI) IsAdmin(ctx context.Context, req *ssov1.IsAdminRequest,) (*s
 
 	// Отдаем клиенту ответ
 	return &ssov1.IsAdminResponse{IsAdmin: isAdmin}, nil
-}
\ No newline at end of file
+}
+
+func (s *serverAPI) Refresh(ctx context.Context, req *ssov1.RefreshRequest) (*ssov1.RefreshResponse, error) {
+	// Валидация
+	if req.GetRefreshToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "refresh_token is required")
+	}
+
+	tokens, err := s.auth.Refresh(ctx, req.GetRefreshToken())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidRefreshToken) {
+			return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
+		}
+		return nil, status.Error(codes.Internal, "failed to refresh token")
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.RefreshResponse{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken}, nil
+}
+
+func (s *serverAPI) JWKS(ctx context.Context, req *ssov1.JWKSRequest) (*ssov1.JWKSResponse, error) {
+	set, err := s.keySet.JWKS(ctx, int(req.GetAppId()))
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to get keys")
+	}
+
+	keys := make([]*ssov1.JWK, 0, len(set.Keys))
+	for _, key := range set.Keys {
+		keys = append(keys, &ssov1.JWK{
+			Kty: key.Kty,
+			Kid: key.Kid,
+			Use: key.Use,
+			Alg: key.Alg,
+			N:   key.N,
+			E:   key.E,
+			Crv: key.Crv,
+			X:   key.X,
+			Y:   key.Y,
+		})
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.JWKSResponse{Keys: keys}, nil
+}
+
+func (s *serverAPI) Introspect(ctx context.Context, req *ssov1.IntrospectRequest) (*ssov1.IntrospectResponse, error) {
+	// Валидация
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetClientSecret() == "" && req.GetClientAssertion() == "" {
+		return nil, status.Error(codes.InvalidArgument, "client_secret or client_assertion is required")
+	}
+	if req.GetClientSecret() != "" && req.GetClientAssertion() != "" {
+		return nil, status.Error(codes.InvalidArgument, "pass only one of client_secret and client_assertion")
+	}
+
+	info, err := s.auth.IntrospectToken(ctx, int(req.GetAppId()), req.GetClientSecret(), req.GetClientAssertion(), req.GetToken())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidClientCredentials) {
+			return nil, status.Error(codes.Unauthenticated, "invalid client credentials")
+		}
+		return nil, status.Error(codes.Internal, "failed to introspect token")
+	}
+
+	if !info.Active {
+		return &ssov1.IntrospectResponse{Active: false, Revoked: info.Revoked}, nil
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.IntrospectResponse{
+		Active:    true,
+		TokenType: "Bearer",
+		ClientId:  strconv.Itoa(info.AppID),
+		Username:  info.Email,
+		Sub:       info.Subject,
+		Exp:       info.ExpiresAt.Unix(),
+		Iat:       unixOrZero(info.IssuedAt),
+		Nbf:       unixOrZero(info.NotBefore),
+		Iss:       info.Issuer,
+		Aud:       info.Audience,
+		Jti:       info.TokenID,
+		Uid:       info.UserID,
+		Email:     info.Email,
+		AppId:     int32(info.AppID),
+		Scope:     info.Scope,
+		ActUid:    info.ActorID,
+	}, nil
+}
+
+func (s *serverAPI) Logout(ctx context.Context, req *ssov1.LogoutRequest) (*ssov1.LogoutResponse, error) {
+	// Валидация
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	err := s.auth.Logout(ctx, req.GetToken(), req.GetRefreshToken())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		if errors.Is(err, auth.ErrInvalidRefreshToken) {
+			return nil, status.Error(codes.InvalidArgument, "invalid refresh token")
+		}
+		return nil, status.Error(codes.Internal, "failed to logout")
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.LogoutResponse{}, nil
+}
+
+func (s *serverAPI) RevokeToken(ctx context.Context, req *ssov1.RevokeTokenRequest) (*ssov1.RevokeTokenResponse, error) {
+	// Валидация
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	hint := req.GetTokenTypeHint()
+	if hint != "" && hint != auth.TokenTypeAccessToken && hint != auth.TokenTypeRefreshToken {
+		return nil, status.Error(codes.InvalidArgument, "token_type_hint must be access_token or refresh_token")
+	}
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetClientSecret() != "" && req.GetClientAssertion() != "" {
+		return nil, status.Error(codes.InvalidArgument, "pass only one of client_secret and client_assertion")
+	}
+
+	err := s.auth.RevokeToken(ctx, int(req.GetAppId()), req.GetClientSecret(), req.GetClientAssertion(), req.GetToken(), hint)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidClientCredentials) {
+			return nil, status.Error(codes.Unauthenticated, "invalid client credentials")
+		}
+		if errors.Is(err, auth.ErrForeignToken) {
+			return nil, status.Error(codes.PermissionDenied, "token was issued to another app")
+		}
+		return nil, status.Error(codes.Internal, "failed to revoke token")
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.RevokeTokenResponse{}, nil
+}
+
+func (s *serverAPI) CheckPermission(ctx context.Context, req *ssov1.CheckPermissionRequest) (*ssov1.CheckPermissionResponse, error) {
+	// Валидация
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetPermission() == "" {
+		return nil, status.Error(codes.InvalidArgument, "permission is required")
+	}
+
+	allowed, err := s.auth.CheckPermission(ctx, req.GetUserId(), int(req.GetAppId()), req.GetPermission())
+	if err != nil {
+		return nil, rbacError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.CheckPermissionResponse{Allowed: allowed}, nil
+}
+
+func (s *serverAPI) ListUserRoles(ctx context.Context, req *ssov1.ListUserRolesRequest) (*ssov1.ListUserRolesResponse, error) {
+	// Валидация
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	roles, err := s.auth.ListUserRoles(ctx, req.GetUserId(), int(req.GetAppId()))
+	if err != nil {
+		return nil, rbacError(err)
+	}
+
+	resp := &ssov1.ListUserRolesResponse{Roles: make([]*ssov1.Role, 0, len(roles))}
+	for _, role := range roles {
+		resp.Roles = append(resp.Roles, &ssov1.Role{
+			Id:          role.ID,
+			Name:        role.Name,
+			Permissions: role.Permissions,
+		})
+	}
+
+	// Отдаем клиенту ответ
+	return resp, nil
+}
+
+func (s *serverAPI) ChangePassword(ctx context.Context, req *ssov1.ChangePasswordRequest) (*ssov1.ChangePasswordResponse, error) {
+	// Валидация
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+	if req.GetOldPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "old_password is required")
+	}
+	if req.GetNewPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "new_password is required")
+	}
+
+	err := s.auth.ChangePassword(ctx, req.GetEmail(), req.GetOldPassword(), req.GetNewPassword(), clientip.FromContext(ctx))
+	if err != nil {
+		var lockedErr *auth.LockedError
+		if errors.As(err, &lockedErr) {
+			return nil, lockedStatus(lockedErr.RetryAfter)
+		}
+		var policyErr *auth.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			return nil, passwordPolicyStatus("new_password", policyErr.Violations)
+		}
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return nil, status.Error(codes.InvalidArgument, "invalid email or password")
+		}
+		if errors.Is(err, auth.ErrUserDisabled) {
+			return nil, status.Error(codes.PermissionDenied, "user is disabled")
+		}
+		return nil, status.Error(codes.Internal, "failed to change password")
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.ChangePasswordResponse{}, nil
+}
+
+func (s *serverAPI) RequestPasswordReset(ctx context.Context, req *ssov1.RequestPasswordResetRequest) (*ssov1.RequestPasswordResetResponse, error) {
+	// Валидация
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	if err := s.auth.RequestPasswordReset(ctx, req.GetEmail()); err != nil {
+		return nil, status.Error(codes.Internal, "failed to request password reset")
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.RequestPasswordResetResponse{}, nil
+}
+
+func (s *serverAPI) ConfirmPasswordReset(ctx context.Context, req *ssov1.ConfirmPasswordResetRequest) (*ssov1.ConfirmPasswordResetResponse, error) {
+	// Валидация
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+	if req.GetNewPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "new_password is required")
+	}
+
+	err := s.auth.ConfirmPasswordReset(ctx, req.GetToken(), req.GetNewPassword())
+	if err != nil {
+		var policyErr *auth.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			return nil, passwordPolicyStatus("new_password", policyErr.Violations)
+		}
+		if errors.Is(err, auth.ErrInvalidResetToken) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired password reset token")
+		}
+		if errors.Is(err, auth.ErrUserDisabled) {
+			return nil, status.Error(codes.PermissionDenied, "user is disabled")
+		}
+		return nil, status.Error(codes.Internal, "failed to reset password")
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.ConfirmPasswordResetResponse{}, nil
+}
+
+func (s *serverAPI) VerifyEmail(ctx context.Context, req *ssov1.VerifyEmailRequest) (*ssov1.VerifyEmailResponse, error) {
+	// Валидация
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	if err := s.auth.VerifyEmail(ctx, req.GetToken()); err != nil {
+		if errors.Is(err, auth.ErrInvalidVerificationToken) {
+			return nil, status.Error(codes.InvalidArgument, "invalid or expired email verification token")
+		}
+		return nil, status.Error(codes.Internal, "failed to verify email")
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.VerifyEmailResponse{}, nil
+}
+
+func (s *serverAPI) EnrollTOTP(ctx context.Context, req *ssov1.EnrollTOTPRequest) (*ssov1.EnrollTOTPResponse, error) {
+	// Валидация
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	secret, uri, err := s.auth.EnrollTOTP(ctx, req.GetToken())
+	if err != nil {
+		return nil, mfaError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.EnrollTOTPResponse{Secret: secret, Uri: uri}, nil
+}
+
+func (s *serverAPI) ConfirmTOTP(ctx context.Context, req *ssov1.ConfirmTOTPRequest) (*ssov1.ConfirmTOTPResponse, error) {
+	// Валидация
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	recoveryCodes, err := s.auth.ConfirmTOTP(ctx, req.GetToken(), req.GetCode())
+	if err != nil {
+		return nil, mfaError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.ConfirmTOTPResponse{RecoveryCodes: recoveryCodes}, nil
+}
+
+func (s *serverAPI) DisableTOTP(ctx context.Context, req *ssov1.DisableTOTPRequest) (*ssov1.DisableTOTPResponse, error) {
+	// Валидация
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	if err := s.auth.DisableTOTP(ctx, req.GetToken(), req.GetCode(), req.GetRecoveryCode(), clientip.FromContext(ctx)); err != nil {
+		var lockedErr *auth.LockedError
+		if errors.As(err, &lockedErr) {
+			return nil, lockedStatus(lockedErr.RetryAfter)
+		}
+		return nil, mfaError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.DisableTOTPResponse{}, nil
+}
+
+func (s *serverAPI) VerifyMFA(ctx context.Context, req *ssov1.VerifyMFARequest) (*ssov1.VerifyMFAResponse, error) {
+	// Валидация
+	if req.GetMfaToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "mfa_token is required")
+	}
+	if req.GetCode() == "" && req.GetRecoveryCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code or recovery_code is required")
+	}
+
+	tokens, err := s.auth.VerifyMFA(ctx, req.GetMfaToken(), req.GetCode(), req.GetRecoveryCode(), clientip.FromContext(ctx))
+	if err != nil {
+		var lockedErr *auth.LockedError
+		if errors.As(err, &lockedErr) {
+			return nil, lockedStatus(lockedErr.RetryAfter)
+		}
+		if errors.Is(err, auth.ErrInvalidAppID) {
+			return nil, status.Error(codes.InvalidArgument, "invalid app_id")
+		}
+		if errors.Is(err, auth.ErrUserDisabled) {
+			return nil, status.Error(codes.PermissionDenied, "user is disabled")
+		}
+		if errors.Is(err, auth.ErrAppDisabled) {
+			return nil, status.Error(codes.PermissionDenied, "app is disabled")
+		}
+		return nil, mfaError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.VerifyMFAResponse{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken}, nil
+}
+
+// mfaError переводит общие ошибки второго фактора в статусы gRPC
+func mfaError(err error) error {
+	if errors.Is(err, auth.ErrInvalidToken) {
+		return status.Error(codes.Unauthenticated, "invalid token")
+	}
+	if errors.Is(err, auth.ErrInvalidMFAToken) {
+		return status.Error(codes.InvalidArgument, "invalid or expired mfa token")
+	}
+	if errors.Is(err, auth.ErrInvalidMFACode) {
+		return status.Error(codes.InvalidArgument, "invalid mfa code")
+	}
+	if errors.Is(err, auth.ErrMFAAlreadyEnabled) {
+		return status.Error(codes.FailedPrecondition, "mfa is already enabled")
+	}
+	if errors.Is(err, auth.ErrMFANotEnabled) {
+		return status.Error(codes.FailedPrecondition, "mfa is not enabled")
+	}
+	return status.Error(codes.Internal, "internal error")
+}
+
+func (s *serverAPI) BeginWebAuthnRegistration(ctx context.Context, req *ssov1.BeginWebAuthnRegistrationRequest) (*ssov1.BeginWebAuthnRegistrationResponse, error) {
+	// Валидация
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	options, err := s.auth.BeginWebAuthnRegistration(ctx, req.GetToken())
+	if err != nil {
+		return nil, webAuthnError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.BeginWebAuthnRegistrationResponse{Options: webAuthnOptionsToProto(options)}, nil
+}
+
+func (s *serverAPI) FinishWebAuthnRegistration(ctx context.Context, req *ssov1.FinishWebAuthnRegistrationRequest) (*ssov1.FinishWebAuthnRegistrationResponse, error) {
+	// Валидация
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+	if len(req.GetClientDataJson()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "client_data_json is required")
+	}
+	if len(req.GetAttestationObject()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "attestation_object is required")
+	}
+
+	credentialID, err := s.auth.FinishWebAuthnRegistration(ctx, req.GetToken(), req.GetName(), req.GetClientDataJson(), req.GetAttestationObject())
+	if err != nil {
+		if errors.Is(err, auth.ErrWebAuthnCredentialExists) {
+			return nil, status.Error(codes.AlreadyExists, "webauthn credential already registered")
+		}
+		return nil, webAuthnError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.FinishWebAuthnRegistrationResponse{CredentialId: credentialID}, nil
+}
+
+func (s *serverAPI) BeginWebAuthnLogin(ctx context.Context, req *ssov1.BeginWebAuthnLoginRequest) (*ssov1.BeginWebAuthnLoginResponse, error) {
+	// Валидация
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+
+	options, err := s.auth.BeginWebAuthnLogin(ctx, req.GetEmail(), int(req.GetAppId()))
+	if err != nil {
+		return nil, webAuthnError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.BeginWebAuthnLoginResponse{Options: webAuthnOptionsToProto(options)}, nil
+}
+
+func (s *serverAPI) FinishWebAuthnLogin(ctx context.Context, req *ssov1.FinishWebAuthnLoginRequest) (*ssov1.FinishWebAuthnLoginResponse, error) {
+	// Валидация
+	if len(req.GetCredentialId()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "credential_id is required")
+	}
+	if len(req.GetClientDataJson()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "client_data_json is required")
+	}
+	if len(req.GetAuthenticatorData()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "authenticator_data is required")
+	}
+	if len(req.GetSignature()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "signature is required")
+	}
+
+	tokens, err := s.auth.FinishWebAuthnLogin(
+		ctx, req.GetCredentialId(), req.GetClientDataJson(), req.GetAuthenticatorData(), req.GetSignature(), req.GetUserHandle(),
+	)
+	if err != nil {
+		if errors.Is(err, auth.ErrUserDisabled) {
+			return nil, status.Error(codes.PermissionDenied, "user is disabled")
+		}
+		if errors.Is(err, auth.ErrEmailNotVerified) {
+			return nil, emailNotVerifiedStatus()
+		}
+		return nil, webAuthnError(err)
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.FinishWebAuthnLoginResponse{Token: tokens.AccessToken, RefreshToken: tokens.RefreshToken, MfaToken: tokens.MFAToken}, nil
+}
+
+func (s *serverAPI) ClientLogin(ctx context.Context, req *ssov1.ClientLoginRequest) (*ssov1.ClientLoginResponse, error) {
+	// Валидация
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	if req.GetClientSecret() == "" && req.GetClientAssertion() == "" {
+		return nil, status.Error(codes.InvalidArgument, "client_secret or client_assertion is required")
+	}
+	if req.GetClientSecret() != "" && req.GetClientAssertion() != "" {
+		return nil, status.Error(codes.InvalidArgument, "pass only one of client_secret and client_assertion")
+	}
+
+	tokens, err := s.auth.ClientLogin(ctx, int(req.GetAppId()), req.GetClientSecret(), req.GetClientAssertion(), req.GetScope())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidClientCredentials) {
+			return nil, status.Error(codes.Unauthenticated, "invalid client credentials")
+		}
+		if errors.Is(err, auth.ErrGrantNotAllowed) {
+			return nil, status.Error(codes.PermissionDenied, "client_credentials grant is not allowed for app")
+		}
+		if errors.Is(err, auth.ErrInvalidScope) {
+			return nil, status.Error(codes.InvalidArgument, "requested scope is not granted to app")
+		}
+		return nil, status.Error(codes.Internal, "failed to login app")
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.ClientLoginResponse{
+		Token:     tokens.AccessToken,
+		ExpiresIn: int64(tokens.ExpiresIn.Seconds()),
+		Scope:     tokens.Scope,
+	}, nil
+}
+
+func (s *serverAPI) TokenExchange(ctx context.Context, req *ssov1.TokenExchangeRequest) (*ssov1.TokenExchangeResponse, error) {
+	// Валидация
+	if req.GetActorToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "actor_token is required")
+	}
+	if req.GetUserId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+	if req.GetAppId() == 0 {
+		return nil, status.Error(codes.InvalidArgument, "app_id is required")
+	}
+	// Без причины вход в журнале ничего не объясняет
+	if strings.TrimSpace(req.GetReason()) == "" {
+		return nil, status.Error(codes.InvalidArgument, "reason is required")
+	}
+
+	tokens, err := s.auth.TokenExchange(ctx, req.GetActorToken(), req.GetUserId(), int(req.GetAppId()), strings.TrimSpace(req.GetReason()))
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, "invalid actor token")
+		}
+		if errors.Is(err, auth.ErrImpersonationDenied) {
+			return nil, status.Error(codes.PermissionDenied, "impersonation is not allowed")
+		}
+		if errors.Is(err, auth.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, "user not found")
+		}
+		if errors.Is(err, auth.ErrUserDisabled) {
+			return nil, status.Error(codes.PermissionDenied, "user is disabled")
+		}
+		if errors.Is(err, auth.ErrInvalidAppID) {
+			return nil, status.Error(codes.InvalidArgument, "invalid app_id")
+		}
+		if errors.Is(err, auth.ErrAppDisabled) {
+			return nil, status.Error(codes.PermissionDenied, "app is disabled")
+		}
+		return nil, status.Error(codes.Internal, "failed to exchange token")
+	}
+
+	// Отдаем клиенту ответ
+	return &ssov1.TokenExchangeResponse{
+		Token:     tokens.AccessToken,
+		ExpiresIn: int64(tokens.ExpiresIn.Seconds()),
+	}, nil
+}
+
+// webAuthnError переводит общие ошибки WebAuthn в статусы gRPC
+func webAuthnError(err error) error {
+	if errors.Is(err, auth.ErrInvalidToken) {
+		return status.Error(codes.Unauthenticated, "invalid token")
+	}
+	if errors.Is(err, auth.ErrInvalidWebAuthnResponse) {
+		return status.Error(codes.InvalidArgument, "invalid or expired webauthn response")
+	}
+	if errors.Is(err, auth.ErrWebAuthnSignCount) {
+		return status.Error(codes.PermissionDenied, "authenticator sign count did not increase")
+	}
+	if errors.Is(err, auth.ErrInvalidAppID) {
+		return status.Error(codes.InvalidArgument, "invalid app_id")
+	}
+	if errors.Is(err, auth.ErrAppDisabled) {
+		return status.Error(codes.PermissionDenied, "app is disabled")
+	}
+	if errors.Is(err, auth.ErrGrantNotAllowed) {
+		return status.Error(codes.PermissionDenied, "password grant is not allowed for app")
+	}
+	return status.Error(codes.Internal, "internal error")
+}
+
+func webAuthnOptionsToProto(options models.WebAuthnOptions) *ssov1.WebAuthnOptions {
+	algorithms := make([]int32, 0, len(options.Algorithms))
+	for _, alg := range options.Algorithms {
+		algorithms = append(algorithms, int32(alg))
+	}
+
+	return &ssov1.WebAuthnOptions{
+		Challenge:        options.Challenge,
+		RpId:             options.RPID,
+		RpName:           options.RPName,
+		UserId:           options.UserHandle,
+		UserName:         options.UserName,
+		CredentialIds:    options.CredentialIDs,
+		Algorithms:       algorithms,
+		TimeoutMs:        options.Timeout.Milliseconds(),
+		UserVerification: options.UserVerification,
+	}
+}
+
+func rbacError(err error) error {
+	if errors.Is(err, auth.ErrUserNotFound) {
+		return status.Error(codes.NotFound, "user not found")
+	}
+	if errors.Is(err, auth.ErrInvalidAppID) {
+		return status.Error(codes.InvalidArgument, "invalid app_id")
+	}
+	return status.Error(codes.Internal, "internal error")
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.Unix()
+}
+
+// lockedStatus отличает блокировку от остальных ошибок входа: в деталях причина ACCOUNT_LOCKED
+// и RetryInfo, через сколько клиенту можно попробовать снова.
+// ResourceExhausted не подходит: его возвращает rate limit, а блокировка - состояние учетной записи
+func lockedStatus(retryAfter time.Duration) error {
+	st := status.New(codes.FailedPrecondition, "too many failed login attempts, try again later")
+	st, err := st.WithDetails(
+		&errdetails.ErrorInfo{Reason: "ACCOUNT_LOCKED", Domain: "sso"},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)},
+	)
+	if err != nil {
+		return status.Error(codes.FailedPrecondition, "too many failed login attempts, try again later")
+	}
+
+	return st.Err()
+}
+
+// emailNotVerifiedStatus отличает неподтвержденный email от требования сменить пароль: у обоих FailedPrecondition,
+// но клиенту нужно показать разные экраны, поэтому в деталях причина EMAIL_NOT_VERIFIED
+func emailNotVerifiedStatus() error {
+	st := status.New(codes.FailedPrecondition, "email is not verified")
+	st, err := st.WithDetails(&errdetails.ErrorInfo{Reason: "EMAIL_NOT_VERIFIED", Domain: "sso"})
+	if err != nil {
+		return status.Error(codes.FailedPrecondition, "email is not verified")
+	}
+
+	return st.Err()
+}
+
+// passwordPolicyStatus перечисляет нарушенные правила политики паролей: описания в BadRequest
+// для пользователя, коды правил через запятую в ErrorInfo.metadata["rules"] для клиентского кода.
+// field - поле запроса с паролем
+func passwordPolicyStatus(field string, violations []password.Violation) error {
+	badRequest := &errdetails.BadRequest{}
+	rules := make([]string, 0, len(violations))
+	for _, v := range violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       field,
+			Description: v.Rule + ": " + v.Description,
+		})
+		rules = append(rules, v.Rule)
+	}
+
+	st := status.New(codes.InvalidArgument, "password does not meet policy")
+	st, err := st.WithDetails(
+		badRequest,
+		&errdetails.ErrorInfo{Reason: "WEAK_PASSWORD", Domain: "sso", Metadata: map[string]string{"rules": strings.Join(rules, ",")}},
+	)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "password does not meet policy")
+	}
+
+	return st.Err()
+}
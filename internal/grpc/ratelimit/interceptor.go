@@ -0,0 +1,102 @@
+// Package ratelimit ограничивает частоту запросов к методам gRPC сервера
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"sso/internal/lib/clientip"
+	"sso/internal/lib/tokenbucket"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Limit - не больше Requests запросов за Per, подряд можно сделать Burst запросов (0 - столько же, сколько Requests)
+type Limit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// MethodLimit - лимиты одного метода. Нулевой Requests - по этому признаку метод не ограничивается
+type MethodLimit struct {
+	IP    Limit // На IP адрес клиента
+	Email Limit // На email из запроса, чтобы одну учетную запись нельзя было атаковать с разных адресов
+}
+
+type limiters struct {
+	ip    *tokenbucket.Limiter
+	email *tokenbucket.Limiter
+}
+
+// Interceptor ограничивает запросы к методам из limits, ключ - полное имя метода (/auth.Auth/Register).
+// Остальные методы перехватчик пропускает как есть. Паникует, если лимит задан с неположительным периодом
+func Interceptor(limits map[string]MethodLimit) grpc.UnaryServerInterceptor {
+	methods := make(map[string]limiters, len(limits))
+	for method, limit := range limits {
+		methods[method] = limiters{
+			ip:    newLimiter(method, limit.IP),
+			email: newLimiter(method, limit.Email),
+		}
+	}
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		l, ok := methods[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		if l.ip != nil {
+			if ok, retryAfter := l.ip.Allow(clientip.FromContext(ctx)); !ok {
+				return nil, limitedStatus(ctx, retryAfter)
+			}
+		}
+
+		// Email есть не во всех запросах, у остальных методов лимит по email не действует
+		if r, ok := req.(interface{ GetEmail() string }); ok && l.email != nil && r.GetEmail() != "" {
+			if ok, retryAfter := l.email.Allow(strings.ToLower(r.GetEmail())); !ok {
+				return nil, limitedStatus(ctx, retryAfter)
+			}
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func newLimiter(method string, limit Limit) *tokenbucket.Limiter {
+	if limit.Requests <= 0 {
+		return nil
+	}
+	if limit.Per <= 0 {
+		panic(fmt.Sprintf("rate limit for %s: period must be positive", method))
+	}
+
+	return tokenbucket.New(limit.Requests, limit.Per, limit.Burst)
+}
+
+// limitedStatus пишет время ожидания в метаданные retry-after (секунды, как HTTP заголовок Retry-After)
+// и в детали ответа RetryInfo
+func limitedStatus(ctx context.Context, retryAfter time.Duration) error {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.FormatInt(seconds, 10)))
+
+	st := status.New(codes.ResourceExhausted, "too many requests, try again later")
+	st, err := st.WithDetails(
+		&errdetails.ErrorInfo{Reason: "RATE_LIMITED", Domain: "sso"},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)},
+	)
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, "too many requests, try again later")
+	}
+
+	return st.Err()
+}
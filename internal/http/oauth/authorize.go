@@ -0,0 +1,198 @@
+// Package oauth содержит HTTP обработчики сервера авторизации OAuth2 и OpenID Connect: /authorize со страницей входа, /token,
+// /userinfo и вход устройств через /device_authorization и страницу /device
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/clientip"
+	"sso/internal/lib/logger/sl"
+	auth "sso/internal/services"
+)
+
+const maxFormSize = 64 << 10
+
+// Authorizer проверяет запросы к /authorize и выдает коды после входа пользователя
+type Authorizer interface {
+	ValidateAuthorizationRequest(ctx context.Context, req models.AuthorizationRequest) (models.App, error)
+	Authorize(ctx context.Context, req models.AuthorizationRequest, email string, password string, ip string) (code string, mfaToken string, err error)
+	AuthorizeMFA(ctx context.Context, req models.AuthorizationRequest, mfaToken string, code string, recoveryCode string, ip string) (string, error)
+}
+
+// AuthorizePage показывает страницу входа и согласия для запроса к /authorize
+func AuthorizePage(log *slog.Logger, authorizer Authorizer) http.HandlerFunc {
+	const op = "http.oauth.AuthorizePage"
+
+	log = log.With(slog.String("op", op))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := authorizationRequest(r.URL.Query())
+
+		app, err := authorizer.ValidateAuthorizationRequest(r.Context(), req)
+		if err != nil {
+			authorizeError(w, r, log, req, err)
+			return
+		}
+
+		renderPage(w, r, log, http.StatusOK, pageData{App: app.Name, Request: req})
+	}
+}
+
+// AuthorizeSubmit принимает форму страницы входа: email и пароль, код второго фактора или отказ
+func AuthorizeSubmit(log *slog.Logger, authorizer Authorizer) http.HandlerFunc {
+	const op = "http.oauth.AuthorizeSubmit"
+
+	log = log.With(slog.String("op", op))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxFormSize)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+
+		req := authorizationRequest(r.PostForm)
+
+		app, err := authorizer.ValidateAuthorizationRequest(r.Context(), req)
+		if err != nil {
+			authorizeError(w, r, log, req, err)
+			return
+		}
+
+		page := pageData{App: app.Name, Request: req}
+
+		// Без токена формы запрос мог прислать чужой сайт: показываем форму заново
+		if !checkCSRF(r) {
+			log.Warn("csrf token mismatch")
+			page.Error = "The page has expired. Try again."
+			renderPage(w, r, log, http.StatusForbidden, page)
+			return
+		}
+
+		if r.PostForm.Get("action") == "deny" {
+			redirect(w, r, req, url.Values{"error": {auth.OAuthAccessDenied}, "error_description": {"the user denied access"}})
+			return
+		}
+
+		var (
+			code     string
+			mfaToken = r.PostForm.Get("mfa_token")
+			ip       = clientip.FromRequest(r)
+		)
+		if mfaToken != "" {
+			code, err = authorizer.AuthorizeMFA(r.Context(), req, mfaToken, r.PostForm.Get("code"), r.PostForm.Get("recovery_code"), ip)
+			if !errors.Is(err, auth.ErrInvalidMFAToken) {
+				// Токен входа еще действует, при ошибке даем ввести код снова
+				page.MFAToken = mfaToken
+			}
+		} else {
+			page.Email = r.PostForm.Get("email")
+			code, page.MFAToken, err = authorizer.Authorize(r.Context(), req, page.Email, r.PostForm.Get("password"), ip)
+		}
+		if err != nil {
+			status, message, ok := loginErrorMessage(err)
+			if !ok {
+				authorizeError(w, r, log, req, err)
+				return
+			}
+			page.Error = message
+			renderPage(w, r, log, status, page)
+			return
+		}
+
+		// Нужен второй фактор: показываем форму кода
+		if code == "" {
+			renderPage(w, r, log, http.StatusOK, page)
+			return
+		}
+
+		redirect(w, r, req, url.Values{"code": {code}})
+	}
+}
+
+func authorizationRequest(v url.Values) models.AuthorizationRequest {
+	return models.AuthorizationRequest{
+		ClientID:            v.Get("client_id"),
+		RedirectURI:         v.Get("redirect_uri"),
+		ResponseType:        v.Get("response_type"),
+		Scope:               v.Get("scope"),
+		State:               v.Get("state"),
+		CodeChallenge:       v.Get("code_challenge"),
+		CodeChallengeMethod: v.Get("code_challenge_method"),
+		Nonce:               v.Get("nonce"),
+	}
+}
+
+// loginErrorMessage возвращает текст ошибки входа для страницы. ok = false - ошибка не про вход
+func loginErrorMessage(err error) (status int, message string, ok bool) {
+	var lockedErr *auth.LockedError
+	switch {
+	case errors.As(err, &lockedErr):
+		return http.StatusTooManyRequests, fmt.Sprintf("Too many failed attempts. Try again in %d seconds.", retryAfterSeconds(lockedErr)), true
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		return http.StatusUnauthorized, "Invalid email or password.", true
+	case errors.Is(err, auth.ErrInvalidMFACode):
+		return http.StatusUnauthorized, "Invalid code.", true
+	case errors.Is(err, auth.ErrInvalidMFAToken):
+		return http.StatusUnauthorized, "Sign in has expired. Enter your email and password again.", true
+	case errors.Is(err, auth.ErrUserDisabled):
+		return http.StatusForbidden, "Your account is disabled.", true
+	case errors.Is(err, auth.ErrEmailNotVerified):
+		return http.StatusForbidden, "Confirm your email before signing in.", true
+	case errors.Is(err, auth.ErrPasswordResetRequired):
+		return http.StatusForbidden, "You need to change your password before signing in.", true
+	}
+
+	return 0, "", false
+}
+
+func retryAfterSeconds(err *auth.LockedError) int {
+	seconds := int(err.RetryAfter.Seconds())
+	if err.RetryAfter > 0 && seconds == 0 {
+		return 1
+	}
+
+	return seconds
+}
+
+// authorizeError показывает ошибку пользователю, если redirect_uri не проверен, иначе возвращает ее приложению
+func authorizeError(w http.ResponseWriter, r *http.Request, log *slog.Logger, req models.AuthorizationRequest, err error) {
+	var oauthErr *auth.OAuthError
+	switch {
+	case errors.As(err, &oauthErr):
+		redirect(w, r, req, url.Values{"error": {oauthErr.Code}, "error_description": {oauthErr.Description}})
+	case errors.Is(err, auth.ErrInvalidClient):
+		renderPage(w, r, log, http.StatusBadRequest, pageData{Fatal: "Unknown or disabled application."})
+	case errors.Is(err, auth.ErrInvalidRedirectURI):
+		renderPage(w, r, log, http.StatusBadRequest, pageData{Fatal: "The redirect_uri is not registered for this application."})
+	default:
+		log.Error("failed to authorize", sl.Err(err))
+		renderPage(w, r, log, http.StatusInternalServerError, pageData{Fatal: "Something went wrong. Try again later."})
+	}
+}
+
+// redirect возвращает пользователя в приложение с params и state. redirect_uri к этому моменту проверен
+func redirect(w http.ResponseWriter, r *http.Request, req models.AuthorizationRequest, params url.Values) {
+	u, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	q := u.Query()
+	for k, v := range params {
+		q[k] = v
+	}
+	if req.State != "" {
+		q.Set("state", req.State)
+	}
+	u.RawQuery = q.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusSeeOther)
+}
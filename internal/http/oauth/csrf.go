@@ -0,0 +1,91 @@
+package oauth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// Защита форм входа от CSRF: в cookie браузера лежит случайный ключ, а каждая показанная форма получает свой токен -
+// случайное число и его HMAC на этом ключе. Чужой сайт не знает ключа и не может собрать токен,
+// а cookie с SameSite=Lax он с POST запросом и не получит
+const (
+	csrfCookie    = "sso_csrf"
+	csrfField     = "csrf_token"
+	csrfKeySize   = 32
+	csrfNonceSize = 16
+)
+
+// csrfToken возвращает токен для новой формы. Ключ берется из cookie, если его нет - создается и отправляется браузеру
+func csrfToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	key, ok := csrfKey(r)
+	if !ok {
+		key = make([]byte, csrfKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return "", err
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     csrfCookie,
+			Value:    base64.RawURLEncoding.EncodeToString(key),
+			Path:     "/",
+			Secure:   r.TLS != nil,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	nonce := make([]byte, csrfNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(nonce) + "." + base64.RawURLEncoding.EncodeToString(csrfMAC(key, nonce)), nil
+}
+
+// checkCSRF проверяет, что форма показана этому браузеру. Форма должна быть уже разобрана
+func checkCSRF(r *http.Request) bool {
+	key, ok := csrfKey(r)
+	if !ok {
+		return false
+	}
+
+	encNonce, encMAC, ok := strings.Cut(r.PostForm.Get(csrfField), ".")
+	if !ok {
+		return false
+	}
+	nonce, err := base64.RawURLEncoding.DecodeString(encNonce)
+	if err != nil || len(nonce) != csrfNonceSize {
+		return false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encMAC)
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal(mac, csrfMAC(key, nonce))
+}
+
+func csrfKey(r *http.Request) ([]byte, bool) {
+	c, err := r.Cookie(csrfCookie)
+	if err != nil {
+		return nil, false
+	}
+
+	key, err := base64.RawURLEncoding.DecodeString(c.Value)
+	if err != nil || len(key) != csrfKeySize {
+		return nil, false
+	}
+
+	return key, true
+}
+
+func csrfMAC(key []byte, nonce []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(nonce)
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,259 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/clientip"
+	"sso/internal/lib/logger/sl"
+	auth "sso/internal/services"
+)
+
+// DeviceAuthorizer ведет вход устройств (RFC 8628): выдает коды и принимает подтверждение пользователя на странице /device
+type DeviceAuthorizer interface {
+	StartDeviceAuthorization(ctx context.Context, clientID string, clientSecret string, scope string) (models.DeviceAuthorization, error)
+	DeviceVerification(ctx context.Context, userCode string, ip string) (models.App, error)
+	ApproveDevice(ctx context.Context, userCode string, email string, password string, ip string) (mfaToken string, err error)
+	ApproveDeviceMFA(ctx context.Context, userCode string, mfaToken string, code string, recoveryCode string, ip string) error
+	DenyDevice(ctx context.Context, userCode string, email string, password string, ip string) (mfaToken string, err error)
+	DenyDeviceMFA(ctx context.Context, userCode string, mfaToken string, code string, recoveryCode string, ip string) error
+}
+
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// DeviceAuthorization - конечная точка /device_authorization (RFC 8628, раздел 3.1).
+// Приложение аутентифицируется так же, как на /token, и получает device_code для /token и user_code для пользователя
+func DeviceAuthorization(log *slog.Logger, authorizer DeviceAuthorizer, issuer string) http.HandlerFunc {
+	const op = "http.oauth.DeviceAuthorization"
+
+	log = log.With(slog.String("op", op))
+
+	verificationURI := strings.TrimSuffix(issuer, "/") + "/device"
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxFormSize)
+		if err := r.ParseForm(); err != nil {
+			writeTokenError(w, log, &auth.OAuthError{Code: auth.OAuthInvalidRequest, Description: "invalid form"})
+			return
+		}
+
+		clientID, clientSecret, _, err := clientCredentials(r)
+		if err != nil {
+			writeTokenError(w, log, err)
+			return
+		}
+		if clientID == "" {
+			writeTokenError(w, log, &auth.OAuthError{Code: auth.OAuthInvalidClient, Description: "client_id is required"})
+			return
+		}
+
+		da, err := authorizer.StartDeviceAuthorization(r.Context(), clientID, clientSecret, r.PostForm.Get("scope"))
+		if err != nil {
+			writeTokenError(w, log, err)
+			return
+		}
+
+		writeJSON(w, log, http.StatusOK, deviceAuthorizationResponse{
+			DeviceCode:              da.DeviceCode,
+			UserCode:                da.UserCode,
+			VerificationURI:         verificationURI,
+			VerificationURIComplete: verificationURI + "?" + url.Values{"user_code": {da.UserCode}}.Encode(),
+			ExpiresIn:               int64(da.ExpiresIn.Seconds()),
+			Interval:                int64(da.Interval.Seconds()),
+		})
+	}
+}
+
+// devicePageData - то, что показывает страница /device
+type devicePageData struct {
+	App       string // Пусто, пока пользователь не ввел верный код
+	UserCode  string
+	Email     string
+	MFAToken  string // Не пустой - пароль проверен, показываем форму кода второго фактора
+	Error     string
+	Done      string // Вход подтвержден, отклонен или продолжить его нельзя: форм больше не показываем
+	CSRFToken string
+}
+
+var devicePage = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Connect a device</title>
+<style>
+body { font-family: sans-serif; max-width: 22rem; margin: 4rem auto; padding: 0 1rem; }
+label, input, button { display: block; width: 100%; box-sizing: border-box; margin-top: .5rem; }
+input, button { padding: .5rem; }
+.error { color: #b00020; }
+.actions { display: flex; gap: .5rem; }
+</style>
+</head>
+<body>
+<h1>Connect a device</h1>
+{{if .Done}}
+<p>{{.Done}}</p>
+{{else}}
+{{if .App}}<p>{{.App}} on your device requests access to your account. Continue only if you started the sign in yourself.</p>{{end}}
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="/device">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+{{if .MFAToken}}
+<input type="hidden" name="user_code" value="{{.UserCode}}">
+<input type="hidden" name="mfa_token" value="{{.MFAToken}}">
+<label>Code from your authenticator app <input name="code" autocomplete="one-time-code" inputmode="numeric" autofocus></label>
+<label>Or a recovery code <input name="recovery_code" autocomplete="off"></label>
+{{else}}
+<label>Code shown on your device <input name="user_code" value="{{.UserCode}}" autocomplete="off" required {{if not .UserCode}}autofocus{{end}}></label>
+<label>Email <input type="email" name="email" value="{{.Email}}" autocomplete="username" required {{if .UserCode}}autofocus{{end}}></label>
+<label>Password <input type="password" name="password" autocomplete="current-password" required></label>
+{{end}}
+<div class="actions">
+<button type="submit" name="action" value="allow">Allow</button>
+<button type="submit" name="action" value="deny">Deny</button>
+</div>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// DevicePage показывает страницу, на которой пользователь вводит код с устройства.
+// Ссылка verification_uri_complete сразу подставляет код
+func DevicePage(log *slog.Logger, authorizer DeviceAuthorizer) http.HandlerFunc {
+	const op = "http.oauth.DevicePage"
+
+	log = log.With(slog.String("op", op))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		page := devicePageData{UserCode: r.URL.Query().Get("user_code")}
+		if page.UserCode == "" {
+			renderDevicePage(w, r, log, http.StatusOK, page)
+			return
+		}
+
+		app, err := authorizer.DeviceVerification(r.Context(), page.UserCode, clientip.FromRequest(r))
+		if err != nil {
+			deviceError(w, r, log, page, err)
+			return
+		}
+		page.App = app.Name
+
+		renderDevicePage(w, r, log, http.StatusOK, page)
+	}
+}
+
+// DeviceSubmit принимает форму страницы /device: код с устройства с email и паролем, код второго фактора или отказ
+func DeviceSubmit(log *slog.Logger, authorizer DeviceAuthorizer) http.HandlerFunc {
+	const op = "http.oauth.DeviceSubmit"
+
+	log = log.With(slog.String("op", op))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxFormSize)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+
+		page := devicePageData{UserCode: r.PostForm.Get("user_code")}
+
+		// Без токена формы запрос мог прислать чужой сайт: показываем форму заново
+		if !checkCSRF(r) {
+			log.Warn("csrf token mismatch")
+			page.Error = "The page has expired. Try again."
+			renderDevicePage(w, r, log, http.StatusForbidden, page)
+			return
+		}
+
+		// Отказ, как и подтверждение, требует входа: иначе чужой вход мог бы сорвать любой, кто знает код
+		var (
+			err      error
+			allow    = r.PostForm.Get("action") != "deny"
+			mfaToken = r.PostForm.Get("mfa_token")
+			ip       = clientip.FromRequest(r)
+		)
+		if mfaToken != "" {
+			if allow {
+				err = authorizer.ApproveDeviceMFA(r.Context(), page.UserCode, mfaToken, r.PostForm.Get("code"), r.PostForm.Get("recovery_code"), ip)
+			} else {
+				err = authorizer.DenyDeviceMFA(r.Context(), page.UserCode, mfaToken, r.PostForm.Get("code"), r.PostForm.Get("recovery_code"), ip)
+			}
+			if err != nil && !errors.Is(err, auth.ErrInvalidMFAToken) {
+				// Токен входа еще действует, при ошибке даем ввести код снова
+				page.MFAToken = mfaToken
+			}
+		} else {
+			page.Email = r.PostForm.Get("email")
+			if allow {
+				page.MFAToken, err = authorizer.ApproveDevice(r.Context(), page.UserCode, page.Email, r.PostForm.Get("password"), ip)
+			} else {
+				page.MFAToken, err = authorizer.DenyDevice(r.Context(), page.UserCode, page.Email, r.PostForm.Get("password"), ip)
+			}
+		}
+		if err != nil {
+			deviceError(w, r, log, page, err)
+			return
+		}
+
+		// Нужен второй фактор: показываем форму кода
+		if page.MFAToken != "" {
+			renderDevicePage(w, r, log, http.StatusOK, page)
+			return
+		}
+
+		page.Done = "Your device is connected. You can return to it and close this page."
+		if !allow {
+			page.Done = "Access denied. You can close this page."
+		}
+		renderDevicePage(w, r, log, http.StatusOK, page)
+	}
+}
+
+// deviceError показывает ошибку на странице /device
+func deviceError(w http.ResponseWriter, r *http.Request, log *slog.Logger, page devicePageData, err error) {
+	if errors.Is(err, auth.ErrInvalidUserCode) {
+		// Код ввели заново: форму второго фактора не показываем
+		page.MFAToken = ""
+		page.Error = "The code is invalid or has expired. Check the code shown on your device."
+		renderDevicePage(w, r, log, http.StatusBadRequest, page)
+		return
+	}
+
+	status, message, ok := loginErrorMessage(err)
+	if !ok {
+		log.Error("failed to verify device", sl.Err(err))
+		renderDevicePage(w, r, log, http.StatusInternalServerError, devicePageData{Done: "Something went wrong. Try again later."})
+		return
+	}
+
+	page.Error = message
+	renderDevicePage(w, r, log, status, page)
+}
+
+func renderDevicePage(w http.ResponseWriter, r *http.Request, log *slog.Logger, status int, data devicePageData) {
+	if data.Done == "" {
+		token, err := csrfToken(w, r)
+		if err != nil {
+			log.Error("failed to generate csrf token", sl.Err(err))
+			data = devicePageData{Done: "Something went wrong. Try again later."}
+			status = http.StatusInternalServerError
+		}
+		data.CSRFToken = token
+	}
+
+	render(w, log, devicePage, status, data)
+}
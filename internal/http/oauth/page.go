@@ -0,0 +1,103 @@
+package oauth
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+)
+
+// pageData - то, что показывает страница входа
+type pageData struct {
+	App       string
+	Request   models.AuthorizationRequest
+	Email     string
+	MFAToken  string // Не пустой - пароль проверен, показываем форму кода второго фактора
+	Error     string
+	Fatal     string // Ошибка, после которой вход продолжить нельзя: формы не показываем
+	CSRFToken string
+}
+
+// Параметры запроса передаются скрытыми полями: сервер между шагами входа ничего не хранит
+var page = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Sign in</title>
+<style>
+body { font-family: sans-serif; max-width: 22rem; margin: 4rem auto; padding: 0 1rem; }
+label, input, button { display: block; width: 100%; box-sizing: border-box; margin-top: .5rem; }
+input, button { padding: .5rem; }
+.error { color: #b00020; }
+.actions { display: flex; gap: .5rem; }
+</style>
+</head>
+<body>
+{{if .Fatal}}
+<h1>Sign in</h1>
+<p class="error">{{.Fatal}}</p>
+{{else}}
+<h1>Sign in to {{.App}}</h1>
+{{if .Request.Scope}}<p>{{.App}} requests access: {{.Request.Scope}}</p>{{end}}
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="/authorize">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<input type="hidden" name="client_id" value="{{.Request.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Request.RedirectURI}}">
+<input type="hidden" name="response_type" value="{{.Request.ResponseType}}">
+<input type="hidden" name="scope" value="{{.Request.Scope}}">
+<input type="hidden" name="state" value="{{.Request.State}}">
+<input type="hidden" name="code_challenge" value="{{.Request.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Request.CodeChallengeMethod}}">
+<input type="hidden" name="nonce" value="{{.Request.Nonce}}">
+{{if .MFAToken}}
+<input type="hidden" name="mfa_token" value="{{.MFAToken}}">
+<label>Code from your authenticator app <input name="code" autocomplete="one-time-code" inputmode="numeric" autofocus></label>
+<label>Or a recovery code <input name="recovery_code" autocomplete="off"></label>
+{{else}}
+<label>Email <input type="email" name="email" value="{{.Email}}" autocomplete="username" required autofocus></label>
+<label>Password <input type="password" name="password" autocomplete="current-password" required></label>
+{{end}}
+<div class="actions">
+<button type="submit" name="action" value="allow">Allow</button>
+<button type="submit" name="action" value="deny" formnovalidate>Deny</button>
+</div>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+func renderPage(w http.ResponseWriter, r *http.Request, log *slog.Logger, status int, data pageData) {
+	if data.Fatal == "" {
+		token, err := csrfToken(w, r)
+		if err != nil {
+			log.Error("failed to generate csrf token", sl.Err(err))
+			data = pageData{Fatal: "Something went wrong. Try again later."}
+			status = http.StatusInternalServerError
+		}
+		data.CSRFToken = token
+	}
+
+	render(w, log, page, status, data)
+}
+
+// render показывает страницу, на которой пользователь вводит пароль
+func render(w http.ResponseWriter, log *slog.Logger, tmpl *template.Template, status int, data any) {
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	// На странице вводят пароль: не кэшируем и не даем встроить ее в чужой сайт
+	h.Set("Cache-Control", "no-store")
+	h.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	h.Set("X-Frame-Options", "DENY")
+	h.Set("Referrer-Policy", "no-referrer")
+
+	w.WriteHeader(status)
+
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Error("failed to render page", sl.Err(err))
+	}
+}
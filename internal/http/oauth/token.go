@@ -0,0 +1,159 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	auth "sso/internal/services"
+)
+
+// TokenIssuer выдает токены по /token
+type TokenIssuer interface {
+	ExchangeAuthorizationCode(ctx context.Context, clientID string, clientSecret string, code string, redirectURI string, codeVerifier string) (models.TokenPair, error)
+	ExchangeRefreshToken(ctx context.Context, clientID string, clientSecret string, refreshToken string) (models.TokenPair, error)
+	ExchangeClientCredentials(ctx context.Context, clientID string, clientSecret string, clientAssertion string, scope string) (models.TokenPair, error)
+	ExchangeDeviceCode(ctx context.Context, clientID string, clientSecret string, deviceCode string) (models.TokenPair, error)
+}
+
+// clientAssertionTypeJWTBearer - client_assertion_type для private_key_jwt (RFC 7523, раздел 2.2)
+const clientAssertionTypeJWTBearer = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+type errorResponse struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// Token - конечная точка /token (RFC 6749, раздел 3.2). Приложение передает client_id и client_secret
+// через HTTP Basic или в теле запроса, публичные приложения передают только client_id.
+// Для client_credentials вместо секрета можно передать client_assertion (private_key_jwt)
+func Token(log *slog.Logger, issuer TokenIssuer) http.HandlerFunc {
+	const op = "http.oauth.Token"
+
+	log = log.With(slog.String("op", op))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxFormSize)
+		if err := r.ParseForm(); err != nil {
+			writeTokenError(w, log, &auth.OAuthError{Code: auth.OAuthInvalidRequest, Description: "invalid form"})
+			return
+		}
+		form := r.PostForm
+
+		clientID, clientSecret, basic, err := clientCredentials(r)
+		if err != nil {
+			writeTokenError(w, log, err)
+			return
+		}
+
+		clientAssertion := form.Get("client_assertion")
+		if clientAssertion != "" {
+			if form.Get("client_assertion_type") != clientAssertionTypeJWTBearer {
+				writeTokenError(w, log, &auth.OAuthError{Code: auth.OAuthInvalidRequest, Description: "unsupported client_assertion_type"})
+				return
+			}
+			if basic || clientSecret != "" {
+				writeTokenError(w, log, &auth.OAuthError{Code: auth.OAuthInvalidRequest, Description: "use only one client authentication method"})
+				return
+			}
+			if form.Get("grant_type") != models.GrantClientCredentials {
+				writeTokenError(w, log, &auth.OAuthError{Code: auth.OAuthInvalidRequest, Description: "client_assertion is supported only for client_credentials"})
+				return
+			}
+		}
+		// С client_assertion client_id необязателен: он есть в самом assertion
+		if clientID == "" && clientAssertion == "" {
+			writeTokenError(w, log, &auth.OAuthError{Code: auth.OAuthInvalidClient, Description: "client_id is required"})
+			return
+		}
+
+		var tokens models.TokenPair
+		switch grantType := form.Get("grant_type"); grantType {
+		case models.GrantAuthorizationCode:
+			tokens, err = issuer.ExchangeAuthorizationCode(
+				r.Context(), clientID, clientSecret, form.Get("code"), form.Get("redirect_uri"), form.Get("code_verifier"),
+			)
+		case models.GrantRefreshToken:
+			tokens, err = issuer.ExchangeRefreshToken(r.Context(), clientID, clientSecret, form.Get("refresh_token"))
+		case models.GrantClientCredentials:
+			tokens, err = issuer.ExchangeClientCredentials(r.Context(), clientID, clientSecret, clientAssertion, form.Get("scope"))
+		case models.GrantDeviceCode:
+			tokens, err = issuer.ExchangeDeviceCode(r.Context(), clientID, clientSecret, form.Get("device_code"))
+		case "":
+			err = &auth.OAuthError{Code: auth.OAuthInvalidRequest, Description: "grant_type is required"}
+		default:
+			err = &auth.OAuthError{Code: auth.OAuthUnsupportedGrantType, Description: "grant_type " + grantType + " is not supported"}
+		}
+		if err != nil {
+			writeTokenError(w, log, err)
+			return
+		}
+
+		writeJSON(w, log, http.StatusOK, tokenResponse{
+			AccessToken:  tokens.AccessToken,
+			TokenType:    "Bearer",
+			ExpiresIn:    int64(tokens.ExpiresIn.Seconds()),
+			RefreshToken: tokens.RefreshToken,
+			IDToken:      tokens.IDToken,
+			Scope:        tokens.Scope,
+		})
+	}
+}
+
+// clientCredentials достает client_id и client_secret из HTTP Basic или из тела запроса, basic - откуда именно.
+// Форма к этому моменту должна быть разобрана
+func clientCredentials(r *http.Request) (clientID string, clientSecret string, basic bool, err error) {
+	clientID, clientSecret, basic = r.BasicAuth()
+	if !basic {
+		return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret"), false, nil
+	}
+	if r.PostForm.Has("client_secret") {
+		return "", "", false, &auth.OAuthError{Code: auth.OAuthInvalidRequest, Description: "use only one client authentication method"}
+	}
+
+	return clientID, clientSecret, true, nil
+}
+
+func writeTokenError(w http.ResponseWriter, log *slog.Logger, err error) {
+	var oauthErr *auth.OAuthError
+	if !errors.As(err, &oauthErr) {
+		log.Error("failed to issue tokens", sl.Err(err))
+		writeJSON(w, log, http.StatusInternalServerError, errorResponse{Error: "server_error"})
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oauthErr.Code == auth.OAuthInvalidClient {
+		status = http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", `Basic realm="sso"`)
+	}
+
+	writeJSON(w, log, status, errorResponse{Error: oauthErr.Code, Description: oauthErr.Description})
+}
+
+func writeJSON(w http.ResponseWriter, log *slog.Logger, status int, v any) {
+	h := w.Header()
+	h.Set("Content-Type", "application/json")
+	// Ответы с токенами нельзя кэшировать (RFC 6749, раздел 5.1)
+	h.Set("Cache-Control", "no-store")
+	h.Set("Pragma", "no-cache")
+
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error("failed to write response", sl.Err(err))
+	}
+}
@@ -0,0 +1,82 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	auth "sso/internal/services"
+)
+
+// UserInfoProvider отдает данные владельца access токена
+type UserInfoProvider interface {
+	UserInfo(ctx context.Context, accessToken string) (models.UserInfo, error)
+}
+
+type userInfoResponse struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+}
+
+// UserInfo - конечная точка /userinfo OpenID Connect. Access токен передается в заголовке Authorization: Bearer (RFC 6750)
+func UserInfo(log *slog.Logger, provider UserInfoProvider) http.HandlerFunc {
+	const op = "http.oauth.UserInfo"
+
+	log = log.With(slog.String("op", op))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			// Без токена в ответе нет кода ошибки (RFC 6750, раздел 3.1)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sso"`)
+			writeJSON(w, log, http.StatusUnauthorized, errorResponse{Error: auth.OAuthInvalidRequest, Description: "bearer token is required"})
+			return
+		}
+
+		info, err := provider.UserInfo(r.Context(), token)
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrInvalidToken):
+				w.Header().Set("WWW-Authenticate", `Bearer realm="sso", error="invalid_token"`)
+				writeJSON(w, log, http.StatusUnauthorized, errorResponse{Error: "invalid_token"})
+			case errors.Is(err, auth.ErrInsufficientScope):
+				w.Header().Set("WWW-Authenticate", `Bearer realm="sso", error="insufficient_scope", scope="openid"`)
+				writeJSON(w, log, http.StatusForbidden, errorResponse{Error: "insufficient_scope", Description: "openid scope is required"})
+			default:
+				log.Error("failed to get user info", sl.Err(err))
+				writeJSON(w, log, http.StatusInternalServerError, errorResponse{Error: "server_error"})
+			}
+			return
+		}
+
+		resp := userInfoResponse{
+			Subject:           strconv.FormatInt(info.UserID, 10),
+			Email:             info.Email,
+			PreferredUsername: info.PreferredUsername,
+		}
+		if info.Email != "" {
+			resp.EmailVerified = &info.EmailVerified
+		}
+
+		writeJSON(w, log, http.StatusOK, resp)
+	}
+}
+
+// bearerToken достает токен из заголовка Authorization, схема не зависит от регистра
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+
+	return token, token != ""
+}
@@ -0,0 +1,43 @@
+// Package ratelimit ограничивает частоту запросов к обработчикам HTTP сервера
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sso/internal/lib/clientip"
+	"sso/internal/lib/tokenbucket"
+)
+
+// Limit - не больше Requests запросов за Per с одного IP адреса, подряд можно сделать Burst запросов (0 - столько же, сколько Requests)
+type Limit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// Handler ограничивает запросы к next с одного IP адреса, route - имя маршрута для сообщения о неверном лимите.
+// Нулевой Requests - запросы не ограничиваются. Паникует, если лимит задан с неположительным периодом
+func Handler(route string, limit Limit, next http.Handler) http.Handler {
+	if limit.Requests <= 0 {
+		return next
+	}
+	if limit.Per <= 0 {
+		panic(fmt.Sprintf("rate limit for %s: period must be positive", route))
+	}
+
+	limiter := tokenbucket.New(limit.Requests, limit.Per, limit.Burst)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ok, retryAfter := limiter.Allow(clientip.FromRequest(r)); !ok {
+			w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+			http.Error(w, "too many requests, try again later", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,52 @@
+// Package wellknown содержит HTTP обработчики для адресов /.well-known/*
+package wellknown
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"sso/internal/lib/jwks"
+	"sso/internal/lib/logger/sl"
+)
+
+// KeySet отдает публичные ключи приложений
+type KeySet interface {
+	JWKS(ctx context.Context, appID int) (jwks.Set, error)
+}
+
+// JWKS отдает публичные ключи в формате JWK Set, необязательный параметр app_id оставляет ключи одного приложения
+func JWKS(log *slog.Logger, keySet KeySet) http.HandlerFunc {
+	const op = "http.wellknown.JWKS"
+
+	log = log.With(slog.String("op", op))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var appID int
+		if v := r.URL.Query().Get("app_id"); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "invalid app_id", http.StatusBadRequest)
+				return
+			}
+			appID = id
+		}
+
+		set, err := keySet.JWKS(r.Context(), appID)
+		if err != nil {
+			log.Error("failed to get keys", sl.Err(err))
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		// Ключи меняются редко, а next ключ публикуется заранее, поэтому проверяющим можно кэшировать ответ
+		w.Header().Set("Cache-Control", "public, max-age=300")
+
+		if err := json.NewEncoder(w).Encode(set); err != nil {
+			log.Error("failed to write response", sl.Err(err))
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package wellknown
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/jwt"
+	"sso/internal/lib/logger/sl"
+)
+
+// openIDConfiguration - метаданные провайдера OpenID Connect (OpenID Connect Discovery, раздел 3)
+type openIDConfiguration struct {
+	Issuer                                     string   `json:"issuer"`
+	AuthorizationEndpoint                      string   `json:"authorization_endpoint"`
+	TokenEndpoint                              string   `json:"token_endpoint"`
+	UserInfoEndpoint                           string   `json:"userinfo_endpoint"`
+	DeviceAuthorizationEndpoint                string   `json:"device_authorization_endpoint"`
+	JWKSURI                                    string   `json:"jwks_uri"`
+	ScopesSupported                            []string `json:"scopes_supported"`
+	ResponseTypesSupported                     []string `json:"response_types_supported"`
+	GrantTypesSupported                        []string `json:"grant_types_supported"`
+	SubjectTypesSupported                      []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported           []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported          []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgValuesSupported []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+	CodeChallengeMethodsSupported              []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                            []string `json:"claims_supported"`
+}
+
+// OpenIDConfiguration отдает документ /.well-known/openid-configuration, по которому клиенты OpenID Connect
+// сами находят адреса сервиса. issuer должен совпадать с внешним адресом HTTP сервера
+func OpenIDConfiguration(log *slog.Logger, issuer string) http.HandlerFunc {
+	const op = "http.wellknown.OpenIDConfiguration"
+
+	log = log.With(slog.String("op", op))
+
+	base := strings.TrimSuffix(issuer, "/")
+
+	// Документ не меняется, пока работает сервис, поэтому собираем его один раз
+	doc, err := json.Marshal(openIDConfiguration{
+		Issuer:                      issuer,
+		AuthorizationEndpoint:       base + "/authorize",
+		TokenEndpoint:               base + "/token",
+		UserInfoEndpoint:            base + "/userinfo",
+		DeviceAuthorizationEndpoint: base + "/device_authorization",
+		JWKSURI:                     base + "/.well-known/jwks.json",
+		ScopesSupported:             []string{models.ScopeOpenID, models.ScopeEmail, models.ScopeProfile},
+		ResponseTypesSupported:      []string{"code"},
+		GrantTypesSupported:         []string{models.GrantAuthorizationCode, models.GrantRefreshToken, models.GrantClientCredentials, models.GrantDeviceCode},
+		SubjectTypesSupported:       []string{"public"},
+		// Алгоритм выбирается в настройках приложения, HS256 подписывает токены секретом приложения
+		IDTokenSigningAlgValuesSupported: []string{jwt.AlgRS256, jwt.AlgES256, jwt.AlgEdDSA, jwt.AlgHS256},
+		// none - только для публичных приложений, конфиденциальные без секрета или assertion не пропускаем
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "private_key_jwt", "none"},
+		// private_key_jwt принимается только для client_credentials
+		TokenEndpointAuthSigningAlgValuesSupported: []string{jwt.AlgRS256, jwt.AlgES256, jwt.AlgEdDSA},
+		CodeChallengeMethodsSupported:              []string{"S256"},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "at_hash",
+			"email", "email_verified", "preferred_username",
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+
+		if _, err := w.Write(doc); err != nil {
+			log.Error("failed to write response", sl.Err(err))
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Package breach проверяет, не встречался ли пароль в утечках, по базе в формате Have I Been Pwned.
+//
+// Проверка использует k-anonymity: по паролю считается SHA-1, источнику отдаются только первые 5 символов хеша,
+// а он возвращает все известные суффиксы хешей с этим префиксом. Так даже удаленный источник не узнает сам пароль.
+package breach
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const prefixLen = 5
+
+// RangeSource отдает диапазон в формате HIBP range API: строки "SUFFIX:COUNT", где SUFFIX - 35 hex символов SHA-1 после prefix.
+// Сейчас это файлы на диске, потом сюда можно подставить клиент https://api.pwnedpasswords.com/range/{prefix}
+type RangeSource interface {
+	Range(ctx context.Context, prefix string) (io.ReadCloser, error)
+}
+
+// Checker ищет пароль в диапазоне его префикса
+type Checker struct {
+	source   RangeSource
+	minCount int
+}
+
+// New возвращает проверку паролей. Пароль считается скомпрометированным, если встретился в утечках хотя бы minCount раз
+func New(source RangeSource, minCount int) *Checker {
+	return &Checker{
+		source:   source,
+		minCount: max(minCount, 1), // HIBP дополняет ответы фиктивными суффиксами с count 0, их не считаем
+	}
+}
+
+// IsBreached сообщает, встречался ли пароль в утечках
+func (c *Checker) IsBreached(ctx context.Context, password string) (bool, error) {
+	const op = "breach.IsBreached"
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLen], hash[prefixLen:]
+
+	r, err := c.source.Range(ctx, prefix)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+	defer r.Close()
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineSuffix, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.EqualFold(lineSuffix, suffix) {
+			continue
+		}
+
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return false, fmt.Errorf("%s: invalid count for %s: %w", op, prefix, err)
+		}
+
+		return n >= c.minCount, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return false, nil
+}
+
+// Dir - локальная база: по файлу PREFIX.txt на префикс, как их сохраняет PwnedPasswordsDownloader.
+// Нет файла - нет известных утечек с таким префиксом
+type Dir struct {
+	path string
+}
+
+func NewDir(path string) *Dir {
+	return &Dir{path: path}
+}
+
+func (d *Dir) Range(_ context.Context, prefix string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(d.path, strings.ToUpper(prefix)+".txt"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return io.NopCloser(strings.NewReader("")), nil
+		}
+		return nil, err
+	}
+
+	return f, nil
+}
@@ -0,0 +1,298 @@
+// Package cbor кодирует и разбирает подмножество CBOR (RFC 8949), которого хватает WebAuthn:
+// целые числа, строки байт и текста, массивы, map, true/false/null. Дробных чисел, тегов и строк неопределенной длины нет
+package cbor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const maxDepth = 16
+
+const (
+	majorUnsigned = 0
+	majorNegative = 1
+	majorBytes    = 2
+	majorText     = 3
+	majorArray    = 4
+	majorMap      = 5
+	majorSimple   = 7
+)
+
+var ErrInvalid = errors.New("invalid cbor")
+
+// Decode разбирает первое значение из data и возвращает байты после него.
+// Целые числа возвращаются как int64, строки байт как []byte, текст как string, массивы как []any, map как map[any]any
+func Decode(data []byte) (value any, rest []byte, err error) {
+	d := decoder{data: data}
+
+	value, err = d.value(0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return value, d.data[d.pos:], nil
+}
+
+type decoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *decoder) value(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("%w: too deep", ErrInvalid)
+	}
+
+	major, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case majorUnsigned:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer overflow", ErrInvalid)
+		}
+		return int64(arg), nil
+	case majorNegative:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("%w: integer overflow", ErrInvalid)
+		}
+		return -1 - int64(arg), nil
+	case majorBytes, majorText:
+		b, err := d.take(arg)
+		if err != nil {
+			return nil, err
+		}
+		if major == majorText {
+			return string(b), nil
+		}
+		return bytes.Clone(b), nil
+	case majorArray:
+		// Каждый элемент занимает хотя бы байт, так битые данные не заставят выделить огромный массив
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, fmt.Errorf("%w: truncated", ErrInvalid)
+		}
+		arr := make([]any, 0, arg)
+		for range arg {
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case majorMap:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, fmt.Errorf("%w: truncated", ErrInvalid)
+		}
+		m := make(map[any]any, arg)
+		for range arg {
+			k, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("%w: unsupported map key %T", ErrInvalid, k)
+			}
+			if _, ok := m[k]; ok {
+				return nil, fmt.Errorf("%w: duplicate map key %v", ErrInvalid, k)
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	case majorSimple:
+		switch arg {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22:
+			return nil, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: unsupported major type %d", ErrInvalid, major)
+}
+
+// head читает первый байт значения и его аргумент: число, длину строки или количество элементов
+func (d *decoder) head() (major byte, arg uint64, err error) {
+	b, err := d.take(1)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	major = b[0] >> 5
+	info := b[0] & 0x1f
+
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info == 24:
+		b, err := d.take(1)
+		if err != nil {
+			return 0, 0, err
+		}
+		return major, uint64(b[0]), nil
+	case info == 25:
+		b, err := d.take(2)
+		if err != nil {
+			return 0, 0, err
+		}
+		return major, uint64(binary.BigEndian.Uint16(b)), nil
+	case info == 26:
+		b, err := d.take(4)
+		if err != nil {
+			return 0, 0, err
+		}
+		return major, uint64(binary.BigEndian.Uint32(b)), nil
+	case info == 27:
+		b, err := d.take(8)
+		if err != nil {
+			return 0, 0, err
+		}
+		return major, binary.BigEndian.Uint64(b), nil
+	}
+
+	return 0, 0, fmt.Errorf("%w: unsupported additional info %d", ErrInvalid, info)
+}
+
+func (d *decoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, fmt.Errorf("%w: truncated", ErrInvalid)
+	}
+
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+
+	return b, nil
+}
+
+// Encode кодирует int, int64, string, []byte, bool, nil, []any, map[string]any и map[int]any.
+// Ключи map сортируются, как требует каноническая форма CTAP2
+func Encode(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf, v); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func encode(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(majorSimple<<5 | 22)
+	case bool:
+		if v {
+			buf.WriteByte(majorSimple<<5 | 21)
+		} else {
+			buf.WriteByte(majorSimple<<5 | 20)
+		}
+	case int:
+		encodeInt(buf, int64(v))
+	case int64:
+		encodeInt(buf, v)
+	case string:
+		writeHead(buf, majorText, uint64(len(v)))
+		buf.WriteString(v)
+	case []byte:
+		writeHead(buf, majorBytes, uint64(len(v)))
+		buf.Write(v)
+	case []any:
+		writeHead(buf, majorArray, uint64(len(v)))
+		for _, item := range v {
+			if err := encode(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		keys := make([]any, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		return encodeMap(buf, keys, func(k any) any { return v[k.(string)] })
+	case map[int]any:
+		keys := make([]any, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		return encodeMap(buf, keys, func(k any) any { return v[k.(int)] })
+	default:
+		return fmt.Errorf("cbor: unsupported type %T", v)
+	}
+
+	return nil
+}
+
+// encodeMap пишет ключи в порядке их закодированных байт: сначала короче, при равной длине - лексикографически
+func encodeMap(buf *bytes.Buffer, keys []any, value func(k any) any) error {
+	type entry struct {
+		key     []byte
+		origKey any
+	}
+
+	entries := make([]entry, 0, len(keys))
+	for _, k := range keys {
+		var kb bytes.Buffer
+		if err := encode(&kb, k); err != nil {
+			return err
+		}
+		entries = append(entries, entry{key: kb.Bytes(), origKey: k})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if len(entries[i].key) != len(entries[j].key) {
+			return len(entries[i].key) < len(entries[j].key)
+		}
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+
+	writeHead(buf, majorMap, uint64(len(entries)))
+	for _, e := range entries {
+		buf.Write(e.key)
+		if err := encode(buf, value(e.origKey)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func encodeInt(buf *bytes.Buffer, v int64) {
+	if v >= 0 {
+		writeHead(buf, majorUnsigned, uint64(v))
+		return
+	}
+
+	writeHead(buf, majorNegative, uint64(-1-v))
+}
+
+func writeHead(buf *bytes.Buffer, major byte, arg uint64) {
+	switch {
+	case arg < 24:
+		buf.WriteByte(major<<5 | byte(arg))
+	case arg <= math.MaxUint8:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(arg))
+	case arg <= math.MaxUint16:
+		buf.WriteByte(major<<5 | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(arg)))
+	case arg <= math.MaxUint32:
+		buf.WriteByte(major<<5 | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(arg)))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, arg))
+	}
+}
@@ -0,0 +1,25 @@
+// Package clientip определяет адрес клиента, от которого пришел gRPC или HTTP запрос
+package clientip
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc/peer"
+)
+
+// FromContext возвращает IP адрес клиента без порта или пустую строку, если адрес неизвестен.
+// Берется адрес соединения: если сервис стоит за прокси, это будет адрес прокси
+func FromContext(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
@@ -0,0 +1,16 @@
+package clientip
+
+import (
+	"net"
+	"net/http"
+)
+
+// FromRequest возвращает IP адрес клиента HTTP запроса без порта. Как и в FromContext, заголовкам прокси не доверяем
+func FromRequest(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
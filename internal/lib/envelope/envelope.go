@@ -0,0 +1,246 @@
+// Package envelope шифрует секреты перед записью в БД конвертным шифрованием (envelope encryption).
+//
+// Каждое значение шифруется своим случайным ключом данных (DEK) в AES-256-GCM, а сам DEK шифруется мастер ключом.
+// Поэтому для смены мастер ключа достаточно перешифровать короткие DEK, сами данные не трогаются.
+package envelope
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// prefix отличает зашифрованные значения от записанных до появления шифрования
+const prefix = "enc:v1:"
+
+const keySize = 32 // AES-256
+
+var (
+	ErrNoKeys         = errors.New("no master keys")
+	ErrInvalidKey     = errors.New("invalid master key")
+	ErrUnknownKey     = errors.New("unknown master key")
+	ErrInvalidPayload = errors.New("invalid encrypted value")
+)
+
+// Keyring - набор мастер ключей. Новые значения шифруются текущим ключом,
+// расшифровать можно любым ключом из набора, так старые ключи остаются рабочими до перешифровки
+type Keyring struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewKeyring принимает ключи в виде "id:base64", первый ключ - текущий.
+// id попадает в каждое зашифрованное значение, по нему при расшифровке выбирается мастер ключ
+func NewKeyring(specs []string) (*Keyring, error) {
+	if len(specs) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	k := &Keyring{keys: make(map[string][]byte, len(specs))}
+	for _, spec := range specs {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(spec), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("%w: expected id:base64", ErrInvalidKey)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("%w: %s must be %d bytes in base64", ErrInvalidKey, id, keySize)
+		}
+		if _, ok := k.keys[id]; ok {
+			return nil, fmt.Errorf("%w: duplicate id %s", ErrInvalidKey, id)
+		}
+
+		k.keys[id] = key
+		if k.current == "" {
+			k.current = id
+		}
+	}
+
+	return k, nil
+}
+
+// LoadKeys читает ключи из файла, по одному "id:base64" в строке, пустые строки и строки с # пропускаются
+func LoadKeys(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var specs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		specs = append(specs, line)
+	}
+
+	return specs, scanner.Err()
+}
+
+// GenerateKey возвращает новый мастер ключ в base64 для конфига
+func GenerateKey() (string, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// IsEncrypted сообщает, что значение зашифровано, а не записано открытым текстом
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypt шифрует значение новым ключом данных, который шифруется текущим мастер ключом
+func (k *Keyring) Encrypt(plaintext []byte) (string, error) {
+	dek := make([]byte, keySize)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+
+	ciphertext, err := seal(dek, plaintext)
+	if err != nil {
+		return "", err
+	}
+
+	wrapped, err := seal(k.keys[k.current], dek)
+	if err != nil {
+		return "", err
+	}
+
+	return format(k.current, wrapped, ciphertext), nil
+}
+
+// Decrypt расшифровывает значение. Значения, записанные до появления шифрования, возвращаются как есть
+func (k *Keyring) Decrypt(value string) ([]byte, error) {
+	if !IsEncrypted(value) {
+		return []byte(value), nil
+	}
+
+	id, wrapped, ciphertext, err := parse(value)
+	if err != nil {
+		return nil, err
+	}
+
+	dek, err := k.unwrap(id, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	return open(dek, ciphertext)
+}
+
+// Reencrypt переводит значение на текущий мастер ключ и сообщает, изменилось ли оно.
+// Открытый текст шифруется, у зашифрованного старым ключом перешифровывается только ключ данных
+func (k *Keyring) Reencrypt(value string) (string, bool, error) {
+	if !IsEncrypted(value) {
+		encrypted, err := k.Encrypt([]byte(value))
+		return encrypted, err == nil, err
+	}
+
+	id, wrapped, ciphertext, err := parse(value)
+	if err != nil {
+		return "", false, err
+	}
+	if id == k.current {
+		return value, false, nil
+	}
+
+	dek, err := k.unwrap(id, wrapped)
+	if err != nil {
+		return "", false, err
+	}
+
+	rewrapped, err := seal(k.keys[k.current], dek)
+	if err != nil {
+		return "", false, err
+	}
+
+	return format(k.current, rewrapped, ciphertext), true, nil
+}
+
+func (k *Keyring) unwrap(id string, wrapped []byte) ([]byte, error) {
+	master, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+
+	return open(master, wrapped)
+}
+
+func format(id string, wrapped, ciphertext []byte) string {
+	return prefix + id + ":" + base64.RawURLEncoding.EncodeToString(wrapped) + ":" + base64.RawURLEncoding.EncodeToString(ciphertext)
+}
+
+func parse(value string) (string, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, ErrInvalidPayload
+	}
+
+	wrapped, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, ErrInvalidPayload
+	}
+	ciphertext, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, ErrInvalidPayload
+	}
+
+	return parts[0], wrapped, ciphertext, nil
+}
+
+// seal шифрует AES-GCM и кладет nonce перед шифротекстом
+func seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrInvalidPayload
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+	}
+
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,109 @@
+// Package jwks описывает публичные ключи в формате JSON Web Key Set (RFC 7517),
+// по которым сторонние сервисы проверяют подпись наших токенов
+package jwks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+)
+
+var ErrUnsupportedKey = errors.New("unsupported public key")
+
+type Key struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC и OKP (Ed25519)
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type Set struct {
+	Keys []Key `json:"keys"`
+}
+
+// FromPublicKey converts public key to JWK.
+func FromPublicKey(kid string, alg string, pub crypto.PublicKey) (Key, error) {
+	key, err := fromPublicKey(pub)
+	if err != nil {
+		return Key{}, err
+	}
+
+	key.Kid = kid
+	key.Use = "sig"
+	key.Alg = alg
+
+	return key, nil
+}
+
+// Thumbprint returns RFC 7638 thumbprint of public key, we use it as kid.
+func Thumbprint(pub crypto.PublicKey) (string, error) {
+	key, err := fromPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+
+	// RFC 7638 требует только обязательные поля в лексикографическом порядке, json.Marshal для map так и сортирует
+	var members map[string]string
+	switch key.Kty {
+	case "RSA":
+		members = map[string]string{"e": key.E, "kty": key.Kty, "n": key.N}
+	case "EC":
+		members = map[string]string{"crv": key.Crv, "kty": key.Kty, "x": key.X, "y": key.Y}
+	default:
+		members = map[string]string{"crv": key.Crv, "kty": key.Kty, "x": key.X}
+	}
+
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func fromPublicKey(pub crypto.PublicKey) (Key, error) {
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return Key{
+			Kty: "RSA",
+			N:   encode(pub.N.Bytes()),
+			E:   encode(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		// Координаты дополняем нулями до размера кривой, как требует RFC 7518
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return Key{
+			Kty: "EC",
+			Crv: pub.Curve.Params().Name,
+			X:   encode(pub.X.FillBytes(make([]byte, size))),
+			Y:   encode(pub.Y.FillBytes(make([]byte, size))),
+		}, nil
+	case ed25519.PublicKey:
+		return Key{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   encode(pub),
+		}, nil
+	default:
+		return Key{}, ErrUnsupportedKey
+	}
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
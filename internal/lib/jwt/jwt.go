@@ -1,28 +1,346 @@
 package jwt
 
 import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
 	"time"
 	"github.com/golang-jwt/jwt/v5"
 
 	"sso/internal/domain/models"
+	"sso/internal/lib/opaque"
 )
 
-func NewToken(user models.User, app models.App, duration time.Duration) (string, error) {
-	// Генерируем токе
-	token := jwt.New(jwt.SigningMethodHS256)
+// Алгоритмы подписи, которые можно указать приложению в колонке apps.signing_alg
+const (
+	AlgHS256 = "HS256" // Общий секрет, проверяющему нужен apps.secret
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrUnsupportedAlg = errors.New("unsupported signing algorithm")
+	ErrInvalidToken   = errors.New("invalid token")
+)
+
+// Key - ключ, которым подписывается токен
+type Key struct {
+	ID      string // kid, пустой для HS256, симметричные ключи не публикуются
+	Alg     string
+	Private any // []byte для HS256, *rsa.PrivateKey, *ecdsa.PrivateKey или ed25519.PrivateKey для остальных
+}
+
+// VerificationKey - ключ, которым проверяется подпись токена
+type VerificationKey struct {
+	Alg    string
+	Public any // []byte для HS256, публичный ключ для остальных
+}
+
+// KeyFunc по app_id и kid из еще не проверенного токена возвращает ключ для проверки подписи.
+// Если токен нельзя проверить по вине самого токена (неизвестное приложение или kid), ошибка должна оборачивать ErrInvalidToken
+type KeyFunc func(appID int, kid string) (VerificationKey, error)
+
+// Claims - содержимое access токена.
+// Стандартные поля (iss, sub, aud, exp, nbf, iat, jti) понимает любая JWT библиотека,
+// uid, email и app_id оставлены для клиентов, которые читают их с самого начала.
+// У токена приложения (client_credentials) пользователя нет: uid равен 0, а sub - это client_id
+type Claims struct {
+	UID      int64    `json:"uid"`
+	Email    string   `json:"email,omitempty"`
+	IsAdmin  *bool    `json:"is_admin,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+	Scope    string   `json:"scope,omitempty"` // Права OAuth2 через пробел (RFC 9068)
+	ClientID string   `json:"client_id,omitempty"`
+	Act      *Actor   `json:"act,omitempty"` // Кто действует от имени пользователя, есть только у токенов из TokenExchange
+	AppID    int      `json:"app_id"`
+	jwt.RegisteredClaims
+}
+
+// Actor - claim act (RFC 8693, раздел 4.1): администратор, который получил токен пользователя через TokenExchange
+type Actor struct {
+	Subject string `json:"sub"` // ID администратора
+}
+
+// IDClaims - содержимое id_token OpenID Connect (OpenID Connect Core, раздел 2)
+type IDClaims struct {
+	AuthTime          *jwt.NumericDate `json:"auth_time,omitempty"`
+	Nonce             string           `json:"nonce,omitempty"`
+	AtHash            string           `json:"at_hash,omitempty"`
+	Email             string           `json:"email,omitempty"`
+	EmailVerified     *bool            `json:"email_verified,omitempty"`
+	PreferredUsername string           `json:"preferred_username,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Extra - необязательные поля токена, пустые поля в токен не попадают.
+// Какие из них нужны, решает приложение в своих настройках
+type Extra struct {
+	Email   string
+	IsAdmin *bool
+	Roles   []string // Роли пользователя в приложении, для которого выпущен токен
+	Scope   string   // Права OAuth2, пусто для входа через Login
+	Act     *Actor   // Администратор, действующий от имени пользователя
+}
+
+// IDExtra - поля id_token, которые зависят от входа и запрошенных прав, пустые поля в токен не попадают
+type IDExtra struct {
+	AuthTime          time.Time // Когда пользователь ввел пароль
+	Nonce             string
+	AtHash            string // Хэш выданного вместе с id_token access токена, см. AccessTokenHash
+	Email             string
+	EmailVerified     *bool
+	PreferredUsername string
+}
+
+// IsAsymmetric сообщает, что токены с этим алгоритмом проверяются публичным ключом
+func IsAsymmetric(alg string) bool {
+	return alg == AlgRS256 || alg == AlgES256 || alg == AlgEdDSA
+}
+
+// NewToken выпускает access токен пользователя для приложения, issuer - адрес нашего сервиса из конфига
+func NewToken(user models.User, app models.App, key Key, issuer string, duration time.Duration, extra Extra) (string, error) {
+	if key.Alg != AlgHS256 && !IsAsymmetric(key.Alg) {
+		return "", ErrUnsupportedAlg
+	}
+
+	jti, err := opaque.New()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
 
 	// Добавляем к токену метаданные
-	claims := token.Claims.(jwt.MapClaims)
-	claims["uid"] = user.ID
-	claims["email"] = user.Email
-	claims["exp"] = time.Now().Add(duration).Unix() // Когда токен протухнет
-	claims["app_id"] = app.ID
-
-	// Подписываем токен с помощью секретного ключа приложения
-	tokenString, err := token.SignedString([]byte(app.Secret))
+	claims := Claims{
+		UID:      user.ID,
+		Email:    extra.Email,
+		IsAdmin:  extra.IsAdmin,
+		Roles:    extra.Roles,
+		Scope:    extra.Scope,
+		ClientID: ClientID(app),
+		Act:      extra.Act,
+		AppID:    app.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   strconv.FormatInt(user.ID, 10),
+			Audience:  jwt.ClaimStrings{ClientID(app)},       // Для кого выпущен токен
+			ExpiresAt: jwt.NewNumericDate(now.Add(duration)), // Когда токен протухнет
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti, // Уникальный идентификатор токена
+		},
+	}
+
+	return sign(claims, key)
+}
+
+// NewClientToken выпускает access токен самого приложения (client_credentials), scope - выданные приложению права
+func NewClientToken(app models.App, key Key, issuer string, duration time.Duration, scope string) (string, error) {
+	if key.Alg != AlgHS256 && !IsAsymmetric(key.Alg) {
+		return "", ErrUnsupportedAlg
+	}
+
+	jti, err := opaque.New()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+
+	claims := Claims{
+		Scope:    scope,
+		ClientID: ClientID(app),
+		AppID:    app.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   ClientID(app),
+			Audience:  jwt.ClaimStrings{ClientID(app)},
+			ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti,
+		},
+	}
+
+	return sign(claims, key)
+}
+
+// NewIDToken выпускает id_token OpenID Connect пользователя для приложения
+func NewIDToken(user models.User, app models.App, key Key, issuer string, duration time.Duration, extra IDExtra) (string, error) {
+	if key.Alg != AlgHS256 && !IsAsymmetric(key.Alg) {
+		return "", ErrUnsupportedAlg
+	}
+
+	now := time.Now()
+
+	claims := IDClaims{
+		Nonce:             extra.Nonce,
+		AtHash:            extra.AtHash,
+		Email:             extra.Email,
+		EmailVerified:     extra.EmailVerified,
+		PreferredUsername: extra.PreferredUsername,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   strconv.FormatInt(user.ID, 10),
+			Audience:  jwt.ClaimStrings{ClientID(app)},
+			ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	if !extra.AuthTime.IsZero() {
+		claims.AuthTime = jwt.NewNumericDate(extra.AuthTime)
+	}
+
+	return sign(claims, key)
+}
+
+// AccessTokenHash возвращает at_hash: левая половина хэша access токена в base64url.
+// Хэш берется тот же, что в алгоритме подписи, для EdDSA (Ed25519) - SHA-512
+func AccessTokenHash(accessToken string, alg string) (string, error) {
+	var sum []byte
+	switch alg {
+	case AlgHS256, AlgRS256, AlgES256:
+		h := sha256.Sum256([]byte(accessToken))
+		sum = h[:]
+	case AlgEdDSA:
+		h := sha512.Sum512([]byte(accessToken))
+		sum = h[:]
+	default:
+		return "", ErrUnsupportedAlg
+	}
+
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]), nil
+}
+
+func sign(claims jwt.Claims, key Key) (string, error) {
+	// Генерируем токе
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Alg), claims)
+	if key.ID != "" {
+		// По kid проверяющий найдет нужный публичный ключ в JWKS, поэтому ключи можно ротировать
+		token.Header["kid"] = key.ID
+	}
+
+	// Подписываем токен ключом приложения
+	tokenString, err := token.SignedString(key.Private)
 	if err != nil {
 		return "", err
 	}
 
 	return tokenString, nil
-}
\ No newline at end of file
+}
+
+// Time возвращает время из необязательного поля токена, нулевое если поля нет
+func Time(date *jwt.NumericDate) time.Time {
+	if date == nil {
+		return time.Time{}
+	}
+
+	return date.Time
+}
+
+// ClientID - идентификатор приложения, который попадает в aud токена
+func ClientID(app models.App) string {
+	return strconv.Itoa(app.ID)
+}
+
+// IsClientToken сообщает, что токен выдан приложению (client_credentials), а не пользователю
+func (c Claims) IsClientToken() bool {
+	return c.UID == 0 && c.Subject != "" && c.Subject == c.ClientID
+}
+
+// ClientAssertion - проверенный client_assertion приложения (private_key_jwt, RFC 7523)
+type ClientAssertion struct {
+	ClientID  string
+	ID        string // jti, по нему не дают предъявить assertion повторно
+	ExpiresAt time.Time
+}
+
+// ClientKeyFunc по client_id из еще не проверенного assertion возвращает публичный ключ приложения.
+// Если приложение неизвестно или ключа у него нет, ошибка должна оборачивать ErrInvalidToken
+type ClientKeyFunc func(clientID string) (VerificationKey, error)
+
+// ParseClientAssertion проверяет client_assertion: iss и sub - client_id, aud - один из audiences, есть exp и jti.
+// Ошибки самого assertion оборачивают ErrInvalidToken, ошибки keyFunc возвращаются как есть
+func ParseClientAssertion(assertion string, audiences []string, keyFunc ClientKeyFunc) (ClientAssertion, error) {
+	var (
+		keyErr error
+		claims jwt.RegisteredClaims
+	)
+
+	_, err := jwt.ParseWithClaims(assertion, &claims, func(token *jwt.Token) (interface{}, error) {
+		if claims.Subject == "" || claims.Issuer != claims.Subject {
+			return nil, ErrInvalidToken
+		}
+
+		key, err := keyFunc(claims.Subject)
+		if err != nil {
+			keyErr = err
+			return nil, err
+		}
+
+		// Как и в ParseToken, алгоритм задает ключ приложения, а не заголовок
+		if token.Method.Alg() != key.Alg {
+			return nil, ErrInvalidToken
+		}
+
+		return key.Public, nil
+	}, jwt.WithExpirationRequired())
+	if keyErr != nil {
+		return ClientAssertion{}, keyErr
+	}
+	if err != nil {
+		return ClientAssertion{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	if claims.ID == "" {
+		return ClientAssertion{}, fmt.Errorf("%w: jti is required", ErrInvalidToken)
+	}
+	if !slices.ContainsFunc(claims.Audience, func(aud string) bool { return slices.Contains(audiences, aud) }) {
+		return ClientAssertion{}, fmt.Errorf("%w: invalid audience", ErrInvalidToken)
+	}
+
+	return ClientAssertion{ClientID: claims.Subject, ID: claims.ID, ExpiresAt: claims.ExpiresAt.Time}, nil
+}
+
+// ParseToken проверяет подпись, издателя и срок жизни токена и возвращает его данные.
+// Ошибки самого токена оборачивают ErrInvalidToken, ошибки keyFunc возвращаются как есть
+func ParseToken(tokenString string, issuer string, keyFunc KeyFunc) (Claims, error) {
+	var (
+		keyErr error
+		claims Claims
+	)
+
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		if claims.AppID == 0 {
+			return nil, ErrInvalidToken
+		}
+		kid, _ := token.Header["kid"].(string)
+
+		key, err := keyFunc(claims.AppID, kid)
+		if err != nil {
+			keyErr = err
+			return nil, err
+		}
+
+		// Алгоритм берем из настроек приложения, а не из заголовка токена,
+		// иначе токен подписанный HS256 публичным ключом прошел бы проверку
+		if token.Method.Alg() != key.Alg {
+			return nil, ErrInvalidToken
+		}
+
+		return key.Public, nil
+	}, jwt.WithExpirationRequired(), jwt.WithIssuer(issuer))
+	if keyErr != nil {
+		return Claims{}, keyErr
+	}
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	return claims, nil
+}
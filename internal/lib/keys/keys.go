@@ -0,0 +1,177 @@
+// Package keys загружает приватные ключи, которыми сервис подписывает токены асимметричными алгоритмами.
+// Проверяющим сервисам достаточно публичной части ключа, приватная есть только у SSO
+package keys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"sso/internal/lib/jwt"
+)
+
+const rsaKeyBits = 2048
+
+var (
+	ErrInvalidKeyRef    = errors.New("invalid key reference")
+	ErrInvalidKey       = errors.New("invalid private key")
+	ErrInvalidPublicKey = errors.New("invalid public key")
+)
+
+// FileProvider читает ключи из PEM файлов в одной директории, ссылка на ключ - это имя файла
+type FileProvider struct {
+	dir string
+
+	mu    sync.RWMutex
+	cache map[string]crypto.Signer
+}
+
+func NewFileProvider(dir string) *FileProvider {
+	return &FileProvider{
+		dir:   dir,
+		cache: make(map[string]crypto.Signer),
+	}
+}
+
+// PrivateKey returns private key by its reference.
+func (p *FileProvider) PrivateKey(ref string) (crypto.Signer, error) {
+	const op = "keys.PrivateKey"
+
+	p.mu.RLock()
+	key, ok := p.cache[ref]
+	p.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	// Ссылка берется из БД, не даем ей выйти за пределы директории с ключами
+	if ref == "" || filepath.Base(ref) != ref {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidKeyRef)
+	}
+
+	data, err := os.ReadFile(filepath.Join(p.dir, ref))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	key, err = ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	p.mu.Lock()
+	p.cache[ref] = key
+	p.mu.Unlock()
+
+	return key, nil
+}
+
+// ParsePrivateKey parses PEM encoded RSA, ECDSA or Ed25519 private key.
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+
+	var (
+		key any
+		err error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: unsupported PEM block %q", ErrInvalidKey, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidKey, err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+
+	return signer, nil
+}
+
+// ParsePublicKey parses PEM encoded RSA (2048 bits or more), ECDSA P-256 or Ed25519 public key
+// and returns the signing algorithm for it.
+func ParsePublicKey(data []byte) (crypto.PublicKey, string, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, "", ErrInvalidPublicKey
+	}
+
+	var (
+		key any
+		err error
+	)
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, "", fmt.Errorf("%w: unsupported PEM block %q", ErrInvalidPublicKey, block.Type)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %w", ErrInvalidPublicKey, err)
+	}
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < rsaKeyBits {
+			return nil, "", fmt.Errorf("%w: RSA key must be at least %d bits", ErrInvalidPublicKey, rsaKeyBits)
+		}
+		return pub, jwt.AlgRS256, nil
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, "", fmt.Errorf("%w: only P-256 curve is supported", ErrInvalidPublicKey)
+		}
+		return pub, jwt.AlgES256, nil
+	case ed25519.PublicKey:
+		return pub, jwt.AlgEdDSA, nil
+	default:
+		return nil, "", fmt.Errorf("%w: unsupported key type", ErrInvalidPublicKey)
+	}
+}
+
+// Generate generates new private key for the signing algorithm.
+func Generate(alg string) (crypto.Signer, error) {
+	switch alg {
+	case jwt.AlgRS256:
+		return rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case jwt.AlgES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwt.AlgEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, jwt.ErrUnsupportedAlg
+	}
+}
+
+// EncodePrivateKey encodes private key to PEM PKCS8.
+func EncodePrivateKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
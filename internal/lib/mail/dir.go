@@ -0,0 +1,42 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Dir складывает письма файлами в директорию вместо отправки, для локальной разработки и интеграционных тестов.
+// Имя файла <unixnano>-<to>.eml, поэтому письма одного адресата легко найти и они сортируются по времени
+type Dir struct {
+	path string
+	from string
+}
+
+func NewDir(path string, from string) *Dir {
+	return &Dir{path: path, from: from}
+}
+
+func (d *Dir) Send(ctx context.Context, msg Message) error {
+	const op = "mail.Dir.Send"
+
+	if err := validAddress(msg.To); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := os.MkdirAll(d.path, 0o700); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%d-%s.eml", now.UnixNano(), filepath.Base(msg.To))
+
+	// В письмах токены, читать их может только владелец процесса
+	if err := os.WriteFile(filepath.Join(d.path, name), format(d.from, msg, now), 0o600); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
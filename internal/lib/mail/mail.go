@@ -0,0 +1,41 @@
+// Package mail отправляет письма пользователям: подтверждение email, сброс пароля и т.п.
+//
+// Способов отправки несколько: SMTP для прода, файлы или stdout для локальной разработки, память для тестов
+package mail
+
+import (
+	"fmt"
+	"mime"
+	"strings"
+	"time"
+)
+
+// Message - письмо в виде простого текста
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// format собирает письмо в формате RFC 5322, как его отправил бы SMTP сервер
+func format(from string, msg Message, date time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(msg.Body)
+
+	return []byte(b.String())
+}
+
+// validAddress не пускает в заголовки переводы строк, иначе через адрес можно было бы дописать свои заголовки
+func validAddress(addr string) error {
+	if addr == "" || strings.ContainsAny(addr, "\r\n") {
+		return fmt.Errorf("invalid address %q", addr)
+	}
+
+	return nil
+}
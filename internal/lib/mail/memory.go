@@ -0,0 +1,47 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Memory запоминает отправленные письма, чтобы тесты могли их проверить
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Send(ctx context.Context, msg Message) error {
+	const op = "mail.Memory.Send"
+
+	if err := validAddress(msg.To); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages = append(m.messages, msg)
+
+	return nil
+}
+
+// Messages возвращает отправленные на адрес письма от старых к новым, пустой to - все письма
+func (m *Memory) Messages(to string) []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var messages []Message
+	for _, msg := range m.messages {
+		if to == "" || msg.To == to {
+			messages = append(messages, msg)
+		}
+	}
+
+	return messages
+}
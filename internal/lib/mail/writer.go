@@ -0,0 +1,38 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Writer пишет письма в io.Writer, например в os.Stdout, чтобы видеть их в консоли при локальной разработке
+type Writer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewWriter(w io.Writer, from string) *Writer {
+	return &Writer{w: w, from: from}
+}
+
+func (w *Writer) Send(ctx context.Context, msg Message) error {
+	const op = "mail.Writer.Send"
+
+	if err := validAddress(msg.To); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Письма из параллельных запросов не должны перемешаться
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := fmt.Fprintf(w.w, "%s\r\n\r\n", format(w.from, msg, time.Now())); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,29 @@
+// Package opaque генерирует непрозрачные (не JWT) токены, которые имеют смысл только для нашего сервера
+package opaque
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+const tokenSize = 32
+
+// New возвращает случайный токен в base64url.
+func New() (string, error) {
+	b := make([]byte, tokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Hash возвращает хэш токена для хранения в БД.
+// Токены длинные и случайные, поэтому bcrypt тут не нужен, достаточно sha256, зато по хэшу можно искать
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,59 @@
+package passhash
+
+import (
+	"crypto/subtle"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const argon2idID = "argon2id"
+
+// Argon2id хеширует пароли Argon2id (RFC 9106). Memory - в КиБ
+type Argon2id struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+func (a Argon2id) Hash(password string) ([]byte, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, keyLen)
+
+	return phc(argon2idID, fmt.Sprintf("v=%d$m=%d,t=%d,p=%d", argon2.Version, a.Memory, a.Iterations, a.Parallelism), salt, key), nil
+}
+
+func (a Argon2id) Verify(password string, hash []byte) (bool, error) {
+	return Verify(password, hash)
+}
+
+func (a Argon2id) NeedsRehash(hash []byte) bool {
+	version, params, _, key, err := parsePHC(hash, argon2idID)
+	if err != nil {
+		return true
+	}
+
+	return version != argon2.Version ||
+		params["m"] != int(a.Memory) ||
+		params["t"] != int(a.Iterations) ||
+		params["p"] != int(a.Parallelism) ||
+		len(key) != keyLen
+}
+
+func verifyArgon2id(password string, hash []byte) (bool, error) {
+	version, params, salt, key, err := parsePHC(hash, argon2idID)
+	if err != nil {
+		return false, err
+	}
+	if version != argon2.Version || params["m"] == 0 || params["t"] == 0 || params["p"] == 0 || params["p"] > 255 {
+		return false, ErrInvalidHash
+	}
+
+	other := argon2.IDKey([]byte(password), salt, uint32(params["t"]), uint32(params["m"]), uint8(params["p"]), uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
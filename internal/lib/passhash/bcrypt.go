@@ -0,0 +1,43 @@
+package passhash
+
+import (
+	"bytes"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Bcrypt хеширует пароли bcrypt. Учитываются только первые 72 байта пароля, более длинные отклоняются
+type Bcrypt struct {
+	Cost int
+}
+
+func (b Bcrypt) Hash(password string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+}
+
+func (b Bcrypt) Verify(password string, hash []byte) (bool, error) {
+	return Verify(password, hash)
+}
+
+func (b Bcrypt) NeedsRehash(hash []byte) bool {
+	cost, err := bcrypt.Cost(hash)
+	return err != nil || cost != b.Cost
+}
+
+// isBcrypt узнает bcrypt по префиксу: $2a$, $2b$ или $2y$
+func isBcrypt(hash []byte) bool {
+	return len(hash) > 4 && hash[0] == '$' && hash[1] == '2' && bytes.IndexByte([]byte("aby"), hash[2]) >= 0 && hash[3] == '$'
+}
+
+func verifyBcrypt(password string, hash []byte) (bool, error) {
+	err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,98 @@
+// Package passhash хеширует пароли. Хеши хранятся строкой в формате PHC ($argon2id$..., $scrypt$...),
+// для bcrypt - в его родном формате $2a$..., который PHC тоже признает.
+//
+// В строке хеша записаны алгоритм и параметры, поэтому любой хешер проверяет хеши всех алгоритмов пакета,
+// а NeedsRehash говорит, что хеш сделан не тем алгоритмом или не с теми параметрами, что настроены сейчас
+package passhash
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	saltLen = 16
+	keyLen  = 32
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown password hash format")
+	ErrInvalidHash   = errors.New("invalid password hash")
+)
+
+// Verify проверяет пароль по хешу любого алгоритма пакета
+func Verify(password string, hash []byte) (bool, error) {
+	switch {
+	case isBcrypt(hash):
+		return verifyBcrypt(password, hash)
+	case bytes.HasPrefix(hash, []byte("$"+argon2idID+"$")):
+		return verifyArgon2id(password, hash)
+	case bytes.HasPrefix(hash, []byte("$"+scryptID+"$")):
+		return verifyScrypt(password, hash)
+	}
+
+	return false, ErrUnknownFormat
+}
+
+func newSalt() ([]byte, error) {
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	return salt, nil
+}
+
+// phc собирает строку $id$params$salt$hash, соль и хеш в base64 без паддинга, как требует PHC
+func phc(id string, params string, salt []byte, key []byte) []byte {
+	return []byte(fmt.Sprintf("$%s$%s$%s$%s", id, params,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	))
+}
+
+// parsePHC разбирает $id$[v=N$]params$salt$hash, params возвращает как map имя -> число
+func parsePHC(hash []byte, id string) (version int, params map[string]int, salt []byte, key []byte, err error) {
+	parts := strings.Split(string(hash), "$")
+	if len(parts) < 5 || parts[0] != "" || parts[1] != id {
+		return 0, nil, nil, nil, ErrInvalidHash
+	}
+	parts = parts[2:]
+
+	if v, ok := strings.CutPrefix(parts[0], "v="); ok {
+		if version, err = strconv.Atoi(v); err != nil {
+			return 0, nil, nil, nil, ErrInvalidHash
+		}
+		parts = parts[1:]
+	}
+	if len(parts) != 3 {
+		return 0, nil, nil, nil, ErrInvalidHash
+	}
+
+	params = make(map[string]int)
+	for _, param := range strings.Split(parts[0], ",") {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return 0, nil, nil, nil, ErrInvalidHash
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return 0, nil, nil, nil, ErrInvalidHash
+		}
+		params[name] = n
+	}
+
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[1]); err != nil {
+		return 0, nil, nil, nil, ErrInvalidHash
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(parts[2]); err != nil || len(key) == 0 {
+		return 0, nil, nil, nil, ErrInvalidHash
+	}
+
+	return version, params, salt, key, nil
+}
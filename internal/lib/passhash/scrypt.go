@@ -0,0 +1,61 @@
+package passhash
+
+import (
+	"crypto/subtle"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const scryptID = "scrypt"
+
+// Scrypt хеширует пароли scrypt (RFC 7914). LogN - log2 от параметра стоимости N
+type Scrypt struct {
+	LogN int
+	R    int
+	P    int
+}
+
+func (s Scrypt) Hash(password string) ([]byte, error) {
+	salt, err := newSalt()
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := scrypt.Key([]byte(password), salt, 1<<s.LogN, s.R, s.P, keyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	return phc(scryptID, fmt.Sprintf("ln=%d,r=%d,p=%d", s.LogN, s.R, s.P), salt, key), nil
+}
+
+func (s Scrypt) Verify(password string, hash []byte) (bool, error) {
+	return Verify(password, hash)
+}
+
+func (s Scrypt) NeedsRehash(hash []byte) bool {
+	_, params, _, key, err := parsePHC(hash, scryptID)
+	if err != nil {
+		return true
+	}
+
+	return params["ln"] != s.LogN || params["r"] != s.R || params["p"] != s.P || len(key) != keyLen
+}
+
+func verifyScrypt(password string, hash []byte) (bool, error) {
+	_, params, salt, key, err := parsePHC(hash, scryptID)
+	if err != nil {
+		return false, err
+	}
+	if params["ln"] == 0 || params["ln"] > 30 || params["r"] == 0 || params["p"] == 0 {
+		return false, ErrInvalidHash
+	}
+
+	other, err := scrypt.Key([]byte(password), salt, 1<<params["ln"], params["r"], params["p"], len(key))
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
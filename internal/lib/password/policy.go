@@ -0,0 +1,107 @@
+// Package password проверяет пароли на соответствие политике
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Правила политики, по ним клиент понимает, что именно не так с паролем
+const (
+	RuleMinLength           = "min_length"
+	RuleMaxLength           = "max_length"
+	RuleRequireLower        = "require_lower"
+	RuleRequireUpper        = "require_upper"
+	RuleRequireDigit        = "require_digit"
+	RuleRequireSymbol       = "require_symbol"
+	RuleMinCharacterClasses = "min_character_classes"
+	RuleNotEmail            = "not_email"
+	RuleNotBreached         = "not_breached" // Проверяет не Policy, а база утечек, см. пакет breach
+)
+
+// Policy - требования к паролю. Нулевые значения правило отключают
+type Policy struct {
+	MinLength           int // В символах
+	MaxLength           int // В байтах: bcrypt учитывает только первые 72 байта пароля
+	RequireLower        bool
+	RequireUpper        bool
+	RequireDigit        bool
+	RequireSymbol       bool // Все, что не буква и не цифра
+	MinCharacterClasses int  // Сколько разных классов из четырех (строчные, заглавные, цифры, символы) должно быть в пароле
+	RejectEmail         bool // Пароль не может совпадать с email или его частью до @
+}
+
+// Violation - нарушенное правило и его описание для пользователя
+type Violation struct {
+	Rule        string
+	Description string
+}
+
+// Validate возвращает все правила, которые нарушает пароль. Пустой результат - пароль подходит
+func (p Policy) Validate(password string, email string) []Violation {
+	var violations []Violation
+
+	if p.MinLength > 0 && utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, Violation{
+			Rule:        RuleMinLength,
+			Description: fmt.Sprintf("must be at least %d characters long", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violations = append(violations, Violation{
+			Rule:        RuleMaxLength,
+			Description: fmt.Sprintf("must be at most %d bytes long", p.MaxLength),
+		})
+	}
+
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case !unicode.IsLetter(r):
+			hasSymbol = true
+		}
+	}
+
+	if p.RequireLower && !hasLower {
+		violations = append(violations, Violation{Rule: RuleRequireLower, Description: "must contain a lowercase letter"})
+	}
+	if p.RequireUpper && !hasUpper {
+		violations = append(violations, Violation{Rule: RuleRequireUpper, Description: "must contain an uppercase letter"})
+	}
+	if p.RequireDigit && !hasDigit {
+		violations = append(violations, Violation{Rule: RuleRequireDigit, Description: "must contain a digit"})
+	}
+	if p.RequireSymbol && !hasSymbol {
+		violations = append(violations, Violation{Rule: RuleRequireSymbol, Description: "must contain a symbol"})
+	}
+
+	classes := 0
+	for _, has := range []bool{hasLower, hasUpper, hasDigit, hasSymbol} {
+		if has {
+			classes++
+		}
+	}
+	if classes < p.MinCharacterClasses {
+		violations = append(violations, Violation{
+			Rule:        RuleMinCharacterClasses,
+			Description: fmt.Sprintf("must contain at least %d of: lowercase letters, uppercase letters, digits, symbols", p.MinCharacterClasses),
+		})
+	}
+
+	if p.RejectEmail && email != "" {
+		localPart, _, _ := strings.Cut(email, "@")
+		if strings.EqualFold(password, email) || strings.EqualFold(password, localPart) {
+			violations = append(violations, Violation{Rule: RuleNotEmail, Description: "must not be the same as email"})
+		}
+	}
+
+	return violations
+}
@@ -0,0 +1,99 @@
+// Package tokenbucket ограничивает частоту событий алгоритмом token bucket, отдельно для каждого ключа
+package tokenbucket
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter держит по ведру на ключ. В ведре помещается burst токенов, за период per их добавляется requests,
+// каждое событие забирает один токен. Полные ведра удаляются, поэтому память занимают только активные ключи
+type Limiter struct {
+	rate  float64 // Токенов в секунду
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// New возвращает лимитер на requests событий за per. burst - сколько событий можно сделать подряд,
+// если 0 - столько же, сколько requests. requests и per должны быть положительными
+func New(requests int, per time.Duration, burst int) *Limiter {
+	if burst <= 0 {
+		burst = requests
+	}
+
+	return &Limiter{
+		rate:      float64(requests) / per.Seconds(),
+		burst:     float64(burst),
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow забирает токен из ведра ключа. Если токенов нет, возвращает false и через сколько появится следующий
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updatedAt: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.updatedAt).Seconds()*l.rate)
+	b.updatedAt = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+
+	return true, 0
+}
+
+// Wait возвращает, через сколько в ведре ключа появится токен, не забирая его. 0 - токен есть уже сейчас
+func (l *Limiter) Wait(key string) time.Duration {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		return 0
+	}
+
+	tokens := min(l.burst, b.tokens+now.Sub(b.updatedAt).Seconds()*l.rate)
+	if tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - tokens) / l.rate * float64(time.Second))
+}
+
+// sweep раз в время полного наполнения ведра удаляет ведра, которые за это время успели наполниться
+func (l *Limiter) sweep(now time.Time) {
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.lastSweep) < refill {
+		return
+	}
+
+	for key, b := range l.buckets {
+		if now.Sub(b.updatedAt) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,123 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	"sso/internal/lib/cbor"
+)
+
+// Алгоритмы COSE (RFC 9053), которые мы принимаем. Этот же список уходит клиенту в pubKeyCredParams
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// SupportedAlgorithms в порядке предпочтения
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// Параметры COSE_Key
+const (
+	coseKty = 1
+	coseAlg = 3
+	coseCrv = -1 // У RSA под этим номером n
+	coseX   = -2 // У RSA под этим номером e
+	coseY   = -3
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+
+	minRSABits = 2048
+)
+
+// PublicKey - открытый ключ учетных данных из COSE_Key
+type PublicKey struct {
+	Alg int64
+	key any
+}
+
+// ParsePublicKey разбирает COSE_Key, который аутентификатор вернул при регистрации
+func ParsePublicKey(data []byte) (PublicKey, error) {
+	v, _, err := cbor.Decode(data)
+	if err != nil {
+		return PublicKey{}, err
+	}
+
+	return publicKeyFromMap(v)
+}
+
+func publicKeyFromMap(v any) (PublicKey, error) {
+	m, ok := v.(map[any]any)
+	if !ok {
+		return PublicKey{}, fmt.Errorf("%w: public key is not a map", ErrInvalidResponse)
+	}
+
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		y, _ := m[int64(coseY)].([]byte)
+		if crv != crvP256 || len(x) != 32 || len(y) != 32 {
+			return PublicKey{}, fmt.Errorf("%w: invalid ES256 key", ErrInvalidResponse)
+		}
+		// ecdh проверяет, что точка лежит на кривой
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return PublicKey{}, fmt.Errorf("%w: invalid ES256 key: %v", ErrInvalidResponse, err)
+		}
+		return PublicKey{Alg: alg, key: &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}}, nil
+	case kty == ktyOKP && alg == AlgEdDSA:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		if crv != crvEd25519 || len(x) != ed25519.PublicKeySize {
+			return PublicKey{}, fmt.Errorf("%w: invalid EdDSA key", ErrInvalidResponse)
+		}
+		return PublicKey{Alg: alg, key: ed25519.PublicKey(x)}, nil
+	case kty == ktyRSA && alg == AlgRS256:
+		n, _ := m[int64(coseCrv)].([]byte)
+		e, _ := m[int64(coseX)].([]byte)
+		if len(n)*8 < minRSABits || len(e) == 0 || len(e) > 4 {
+			return PublicKey{}, fmt.Errorf("%w: invalid RS256 key", ErrInvalidResponse)
+		}
+		return PublicKey{Alg: alg, key: &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}}, nil
+	}
+
+	return PublicKey{}, fmt.Errorf("%w: unsupported key type %d with algorithm %d", ErrInvalidResponse, kty, alg)
+}
+
+// Verify проверяет подпись data этим ключом
+func (k PublicKey) Verify(data []byte, sig []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, sig)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil
+	}
+
+	return false
+}
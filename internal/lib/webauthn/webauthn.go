@@ -0,0 +1,269 @@
+// Package webauthn проверяет ответы аутентификаторов WebAuthn (https://www.w3.org/TR/webauthn-2/):
+// регистрацию новых учетных данных и вход по ним.
+//
+// Аттестацию мы не проверяем по сертификатам производителей: принимаем формат none и packed с самоподписью.
+// Клиенту нужно запрашивать attestation: "none", браузеры тогда всегда присылают none
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"sso/internal/lib/cbor"
+)
+
+const (
+	challengeSize      = 32
+	maxCredentialIDLen = 1023
+
+	typeCreate = "webauthn.create"
+	typeGet    = "webauthn.get"
+
+	flagUserPresent        = 0x01
+	flagUserVerified       = 0x04
+	flagAttestedCredential = 0x40
+	flagExtensions         = 0x80
+)
+
+var (
+	ErrInvalidResponse = errors.New("invalid webauthn response")
+	// ErrSignCount - счетчик подписей не вырос: ответ повторен или аутентификатор склонирован
+	ErrSignCount = errors.New("authenticator sign count did not increase")
+)
+
+// RelyingParty - наш сервис в терминах WebAuthn
+type RelyingParty struct {
+	ID      string   // Домен, к которому привязаны учетные данные, например example.com
+	Name    string   // Название сервиса, которое браузер покажет пользователю
+	Origins []string // Откуда браузер может присылать ответы, например https://login.example.com
+	// Требовать проверку пользователя (PIN, биометрия), а не только присутствие. Без нее passkey - лишь один фактор
+	RequireUserVerification bool
+}
+
+// Credential - учетные данные, которые аутентификатор создал при регистрации
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE_Key
+	SignCount uint32
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+// NewChallenge возвращает случайный вызов, который аутентификатор подпишет
+func NewChallenge() ([]byte, error) {
+	b := make([]byte, challengeSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Challenge достает вызов из clientDataJSON, по нему ищется сохраненная сессия регистрации или входа.
+// Сам ответ это не проверяет, проверка - в VerifyRegistration и VerifyAssertion
+func Challenge(clientDataJSON []byte) ([]byte, error) {
+	var cd clientData
+	if err := json.Unmarshal(clientDataJSON, &cd); err != nil {
+		return nil, fmt.Errorf("%w: client data: %v", ErrInvalidResponse, err)
+	}
+
+	challenge, err := base64.RawURLEncoding.DecodeString(cd.Challenge)
+	if err != nil {
+		return nil, fmt.Errorf("%w: challenge: %v", ErrInvalidResponse, err)
+	}
+
+	return challenge, nil
+}
+
+// VerifyRegistration проверяет ответ navigator.credentials.create() на вызов challenge и возвращает новые учетные данные
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, clientDataJSON []byte, attestationObject []byte) (Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, typeCreate, challenge); err != nil {
+		return Credential{}, err
+	}
+
+	v, _, err := cbor.Decode(attestationObject)
+	if err != nil {
+		return Credential{}, fmt.Errorf("%w: attestation object: %v", ErrInvalidResponse, err)
+	}
+	att, ok := v.(map[any]any)
+	if !ok {
+		return Credential{}, fmt.Errorf("%w: attestation object is not a map", ErrInvalidResponse)
+	}
+	format, _ := att["fmt"].(string)
+	attStmt, _ := att["attStmt"].(map[any]any)
+	rawAuthData, _ := att["authData"].([]byte)
+
+	authData, err := rp.parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return Credential{}, err
+	}
+	if authData.flags&flagAttestedCredential == 0 {
+		return Credential{}, fmt.Errorf("%w: no attested credential data", ErrInvalidResponse)
+	}
+
+	key, err := ParsePublicKey(authData.publicKey)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	switch format {
+	case "none":
+		if len(attStmt) != 0 {
+			return Credential{}, fmt.Errorf("%w: none attestation with statement", ErrInvalidResponse)
+		}
+	case "packed":
+		// Самоподпись: аутентификатор подписывает регистрацию ключом самих учетных данных
+		if _, ok := attStmt["x5c"]; ok {
+			return Credential{}, fmt.Errorf("%w: packed attestation with certificates is not supported, request attestation none", ErrInvalidResponse)
+		}
+		alg, _ := attStmt["alg"].(int64)
+		sig, _ := attStmt["sig"].([]byte)
+		if alg != key.Alg || !key.Verify(signedData(rawAuthData, clientDataJSON), sig) {
+			return Credential{}, fmt.Errorf("%w: invalid packed self attestation", ErrInvalidResponse)
+		}
+	default:
+		return Credential{}, fmt.Errorf("%w: attestation format %q is not supported, request attestation none", ErrInvalidResponse, format)
+	}
+
+	return Credential{ID: authData.credentialID, PublicKey: authData.publicKey, SignCount: authData.signCount}, nil
+}
+
+// VerifyAssertion проверяет ответ navigator.credentials.get() на вызов challenge подписью ключа publicKey (COSE_Key)
+// и возвращает новое значение счетчика подписей. storedSignCount - значение, сохраненное при прошлом входе
+func (rp *RelyingParty) VerifyAssertion(
+	challenge []byte,
+	publicKey []byte,
+	storedSignCount uint32,
+	clientDataJSON []byte,
+	authenticatorData []byte,
+	signature []byte,
+) (signCount uint32, err error) {
+	if err := rp.verifyClientData(clientDataJSON, typeGet, challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := rp.parseAuthenticatorData(authenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+	if !key.Verify(signedData(authenticatorData, clientDataJSON), signature) {
+		return 0, fmt.Errorf("%w: invalid signature", ErrInvalidResponse)
+	}
+
+	// Аутентификаторы без счетчика (например, синхронизируемые passkey) всегда присылают 0
+	if (authData.signCount != 0 || storedSignCount != 0) && authData.signCount <= storedSignCount {
+		return 0, fmt.Errorf("%w: got %d, stored %d", ErrSignCount, authData.signCount, storedSignCount)
+	}
+
+	return authData.signCount, nil
+}
+
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, typ string, challenge []byte) error {
+	var cd clientData
+	if err := json.Unmarshal(clientDataJSON, &cd); err != nil {
+		return fmt.Errorf("%w: client data: %v", ErrInvalidResponse, err)
+	}
+
+	if cd.Type != typ {
+		return fmt.Errorf("%w: client data type %q, expected %q", ErrInvalidResponse, cd.Type, typ)
+	}
+	expected := base64.RawURLEncoding.EncodeToString(challenge)
+	if subtle.ConstantTimeCompare([]byte(cd.Challenge), []byte(expected)) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrInvalidResponse)
+	}
+	if !slices.Contains(rp.Origins, cd.Origin) {
+		return fmt.Errorf("%w: origin %q is not allowed", ErrInvalidResponse, cd.Origin)
+	}
+
+	return nil
+}
+
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// parseAuthenticatorData разбирает authenticatorData и проверяет, что ответ для нашего RP ID и пользователь присутствовал
+func (rp *RelyingParty) parseAuthenticatorData(data []byte) (authenticatorData, error) {
+	// rpIdHash (32) | flags (1) | signCount (4) | [attestedCredentialData] | [extensions]
+	if len(data) < 37 {
+		return authenticatorData{}, fmt.Errorf("%w: authenticator data is too short", ErrInvalidResponse)
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(data[:32], rpIDHash[:]) {
+		return authenticatorData{}, fmt.Errorf("%w: rp id mismatch", ErrInvalidResponse)
+	}
+
+	ad := authenticatorData{
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return authenticatorData{}, fmt.Errorf("%w: user is not present", ErrInvalidResponse)
+	}
+	if rp.RequireUserVerification && ad.flags&flagUserVerified == 0 {
+		return authenticatorData{}, fmt.Errorf("%w: user is not verified", ErrInvalidResponse)
+	}
+
+	rest := data[37:]
+	if ad.flags&flagAttestedCredential != 0 {
+		// aaguid (16) | credentialIdLength (2) | credentialId | credentialPublicKey (COSE_Key)
+		if len(rest) < 18 {
+			return authenticatorData{}, fmt.Errorf("%w: attested credential data is too short", ErrInvalidResponse)
+		}
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen == 0 || idLen > maxCredentialIDLen || idLen > len(rest) {
+			return authenticatorData{}, fmt.Errorf("%w: invalid credential id length", ErrInvalidResponse)
+		}
+		ad.credentialID = bytes.Clone(rest[:idLen])
+		rest = rest[idLen:]
+
+		// Длина ключа не записана, ее знает только CBOR
+		_, after, err := cbor.Decode(rest)
+		if err != nil {
+			return authenticatorData{}, fmt.Errorf("%w: credential public key: %v", ErrInvalidResponse, err)
+		}
+		ad.publicKey = bytes.Clone(rest[:len(rest)-len(after)])
+		rest = after
+	}
+	if ad.flags&flagExtensions != 0 {
+		_, after, err := cbor.Decode(rest)
+		if err != nil {
+			return authenticatorData{}, fmt.Errorf("%w: extensions: %v", ErrInvalidResponse, err)
+		}
+		rest = after
+	}
+	if len(rest) != 0 {
+		return authenticatorData{}, fmt.Errorf("%w: trailing bytes in authenticator data", ErrInvalidResponse)
+	}
+
+	return ad, nil
+}
+
+// signedData - то, что подписывает аутентификатор: authenticatorData || SHA-256(clientDataJSON)
+func signedData(authenticatorData []byte, clientDataJSON []byte) []byte {
+	hash := sha256.Sum256(clientDataJSON)
+
+	return append(bytes.Clone(authenticatorData), hash[:]...)
+}
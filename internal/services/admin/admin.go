@@ -0,0 +1,295 @@
+// Package admin - управление пользователями для администраторов сервиса
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	auth "sso/internal/services"
+	"sso/internal/storage"
+)
+
+// Размер страницы в ListUsers
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 100
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrInvalidAppID = errors.New("invalid app id")
+	ErrRoleNotFound = errors.New("role not found")
+)
+
+type Admin struct {
+	log            *slog.Logger
+	userSaver      UserSaver
+	userProvider   UserProvider
+	appProvider    auth.AppProvider
+	roleAssigner   RoleAssigner
+	sessionRevoker SessionRevoker
+	loginUnlocker  LoginUnlocker
+}
+
+// UserSaver - auth.UserSaver с изменениями, которые может делать только администратор
+type UserSaver interface {
+	auth.UserSaver
+	SetUserDisabled(ctx context.Context, userID int64, disabled bool) error
+	SetPasswordResetRequired(ctx context.Context, userID int64, required bool) error
+	SetAdmin(ctx context.Context, userID int64, isAdmin bool) error
+	DeleteUser(ctx context.Context, userID int64) error
+}
+
+// UserProvider - auth.UserProvider с выборкой списка пользователей
+type UserProvider interface {
+	auth.UserProvider
+	Users(ctx context.Context, filter models.UserFilter) ([]models.User, error)
+}
+
+type RoleAssigner interface {
+	Role(ctx context.Context, appID int, name string) (models.Role, error)
+	AssignRole(ctx context.Context, userID int64, roleID int64) error
+	UnassignRole(ctx context.Context, userID int64, roleID int64) error
+}
+
+// SessionRevoker отзывает refresh токены пользователя, access токены доживают свой короткий срок
+type SessionRevoker interface {
+	RevokeUserRefreshTokens(ctx context.Context, userID int64) error
+}
+
+// LoginUnlocker снимает блокировку входа, которая ставится после неудачных попыток
+type LoginUnlocker interface {
+	Unlock(ctx context.Context, email string) error
+}
+
+// New возвращает сервис администрирования пользователей.
+func New(
+	log *slog.Logger,
+	userSaver UserSaver,
+	userProvider UserProvider,
+	appProvider auth.AppProvider,
+	roleAssigner RoleAssigner,
+	sessionRevoker SessionRevoker,
+	loginUnlocker LoginUnlocker,
+) *Admin {
+	return &Admin{
+		log:            log,
+		userSaver:      userSaver,
+		userProvider:   userProvider,
+		appProvider:    appProvider,
+		roleAssigner:   roleAssigner,
+		sessionRevoker: sessionRevoker,
+		loginUnlocker:  loginUnlocker,
+	}
+}
+
+// ListUsers возвращает страницу пользователей, подходящих под фильтр, и ID последнего из них для следующей страницы.
+// Если следующей страницы нет, вместо ID возвращает 0.
+func (a *Admin) ListUsers(ctx context.Context, filter models.UserFilter) ([]models.User, int64, error) {
+	const op = "admin.ListUsers"
+
+	log := a.log.With(slog.String("op", op))
+
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultPageSize
+	}
+	filter.Limit = min(filter.Limit, MaxPageSize)
+
+	// Берем на одного пользователя больше, чтобы узнать, есть ли следующая страница
+	pageSize := filter.Limit
+	filter.Limit++
+
+	users, err := a.userProvider.Users(ctx, filter)
+	if err != nil {
+		log.Error("failed to list users", sl.Err(err))
+		return nil, 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(users) <= pageSize {
+		return users, 0, nil
+	}
+
+	users = users[:pageSize]
+
+	return users, users[pageSize-1].ID, nil
+}
+
+// User возвращает пользователя по ID.
+func (a *Admin) User(ctx context.Context, userID int64) (models.User, error) {
+	const op = "admin.User"
+
+	user, err := a.userProvider.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.User{}, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		a.log.Error("failed to get user", slog.String("op", op), sl.Err(err))
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// SetUserDisabled отключает или включает пользователя. Отключенный пользователь теряет все свои сессии.
+func (a *Admin) SetUserDisabled(ctx context.Context, userID int64, disabled bool) error {
+	const op = "admin.SetUserDisabled"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID), slog.Bool("disabled", disabled))
+	log.Info("Changing user status")
+
+	if err := a.userSaver.SetUserDisabled(ctx, userID, disabled); err != nil {
+		return a.userError(log, op, err)
+	}
+
+	if disabled {
+		if err := a.sessionRevoker.RevokeUserRefreshTokens(ctx, userID); err != nil {
+			log.Error("failed to revoke user sessions", sl.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	log.Info("User status changed")
+
+	return nil
+}
+
+// ForcePasswordReset не дает пользователю войти, пока он не сменит пароль, и завершает все его сессии.
+func (a *Admin) ForcePasswordReset(ctx context.Context, userID int64) error {
+	const op = "admin.ForcePasswordReset"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+	log.Info("Forcing password reset")
+
+	if err := a.userSaver.SetPasswordResetRequired(ctx, userID, true); err != nil {
+		return a.userError(log, op, err)
+	}
+
+	if err := a.sessionRevoker.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		log.Error("failed to revoke user sessions", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Password reset forced")
+
+	return nil
+}
+
+// UnlockUser снимает блокировку входа, которую пользователь получил за неудачные попытки.
+// Блокировка IP адресов остается, она не привязана к пользователю.
+func (a *Admin) UnlockUser(ctx context.Context, userID int64) error {
+	const op = "admin.UnlockUser"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+	log.Info("Unlocking user")
+
+	user, err := a.userProvider.UserByID(ctx, userID)
+	if err != nil {
+		return a.userError(log, op, err)
+	}
+
+	if err := a.loginUnlocker.Unlock(ctx, user.Email); err != nil {
+		log.Error("failed to unlock user", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("User unlocked")
+
+	return nil
+}
+
+// SetAdmin выдает или забирает права администратора.
+func (a *Admin) SetAdmin(ctx context.Context, userID int64, isAdmin bool) error {
+	const op = "admin.SetAdmin"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID), slog.Bool("is_admin", isAdmin))
+	log.Info("Changing admin status")
+
+	if err := a.userSaver.SetAdmin(ctx, userID, isAdmin); err != nil {
+		return a.userError(log, op, err)
+	}
+
+	log.Info("Admin status changed")
+
+	return nil
+}
+
+// SetUserRole выдает пользователю роль в приложении или забирает ее.
+func (a *Admin) SetUserRole(ctx context.Context, userID int64, appID int, roleName string, assigned bool) error {
+	const op = "admin.SetUserRole"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.Int("app_id", appID),
+		slog.String("role", roleName),
+		slog.Bool("assigned", assigned),
+	)
+	log.Info("Changing user role")
+
+	if _, err := a.userProvider.UserByID(ctx, userID); err != nil {
+		return a.userError(log, op, err)
+	}
+
+	if _, err := a.appProvider.App(ctx, appID); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found")
+			return fmt.Errorf("%s: %w", op, ErrInvalidAppID)
+		}
+		log.Error("failed to get app", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	role, err := a.roleAssigner.Role(ctx, appID, roleName)
+	if err != nil {
+		if errors.Is(err, storage.ErrRoleNotFound) {
+			log.Warn("role not found")
+			return fmt.Errorf("%s: %w", op, ErrRoleNotFound)
+		}
+		log.Error("failed to get role", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if assigned {
+		err = a.roleAssigner.AssignRole(ctx, userID, role.ID)
+	} else {
+		err = a.roleAssigner.UnassignRole(ctx, userID, role.ID)
+	}
+	if err != nil {
+		log.Error("failed to change user role", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("User role changed")
+
+	return nil
+}
+
+// DeleteUser удаляет пользователя вместе с его ролями и сессиями.
+func (a *Admin) DeleteUser(ctx context.Context, userID int64) error {
+	const op = "admin.DeleteUser"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID))
+	log.Info("Deleting user")
+
+	if err := a.userSaver.DeleteUser(ctx, userID); err != nil {
+		return a.userError(log, op, err)
+	}
+
+	log.Info("User deleted")
+
+	return nil
+}
+
+func (a *Admin) userError(log *slog.Logger, op string, err error) error {
+	if errors.Is(err, storage.ErrUserNotFound) {
+		log.Warn("user not found")
+		return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+	}
+	log.Error("failed to update user", sl.Err(err))
+
+	return fmt.Errorf("%s: %w", op, err)
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/jwt"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+)
+
+// ErrNotAdmin - токен действует, но его владелец не администратор SSO
+var ErrNotAdmin = errors.New("admin rights required")
+
+// AuthenticateAdmin проверяет access токен администратора SSO: подпись, срок, отзыв, как Introspect, и права владельца.
+//
+// Принимаются только токены приложения администраторов (adminAppID). Токены HS256 подписаны секретом приложения,
+// который знают все его сервисы, и любой из них выпустил бы себе токен с uid администратора. Поэтому и само
+// приложение администраторов должно подписывать токены асимметричным ключом, иначе его токены тоже не принимаются.
+// Права смотрим в БД, а не в токене: токен мог быть выпущен до того, как права забрали
+func (a *Auth) AuthenticateAdmin(ctx context.Context, token string) (models.TokenInfo, error) {
+	const op = "auth.AuthenticateAdmin"
+
+	log := a.log.With(slog.String("op", op))
+
+	info, err := a.Introspect(ctx, token)
+	if err != nil {
+		return models.TokenInfo{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !info.Active {
+		log.Info("token is not active")
+		return models.TokenInfo{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+	if info.AppID != a.adminAppID {
+		log.Warn("token is not issued for admin app", slog.Int("app_id", info.AppID))
+		return models.TokenInfo{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	app, err := a.appProvider.App(ctx, a.adminAppID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("admin app not found", slog.Int("app_id", a.adminAppID))
+			return models.TokenInfo{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+		log.Error("failed to get admin app", sl.Err(err))
+		return models.TokenInfo{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if app.SigningAlg == jwt.AlgHS256 {
+		log.Error("admin app must sign tokens with an asymmetric algorithm", slog.Int("app_id", app.ID))
+		return models.TokenInfo{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	// Токен приложения (client_credentials) выдан без пользователя, администратором он быть не может
+	if info.UserID == 0 {
+		log.Warn("client token is not admin token")
+		return models.TokenInfo{}, fmt.Errorf("%s: %w", op, ErrNotAdmin)
+	}
+
+	isAdmin, err := a.IsAdmin(ctx, info.UserID)
+	if err != nil {
+		return models.TokenInfo{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !isAdmin {
+		log.Warn("user is not admin", slog.Int64("user_id", info.UserID))
+		return models.TokenInfo{}, fmt.Errorf("%s: %w", op, ErrNotAdmin)
+	}
+
+	return info, nil
+}
@@ -0,0 +1,280 @@
+// Package apps - регистрация приложений (клиентов), которые получают токены нашего сервиса
+package apps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/jwt"
+	"sso/internal/lib/keys"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/opaque"
+	auth "sso/internal/services"
+	"sso/internal/storage"
+)
+
+var (
+	ErrAppNotFound = errors.New("app not found")
+	ErrAppExists   = errors.New("app already exists")
+)
+
+// ValidationError - ошибка в настройках приложения, ее текст можно показать клиенту
+type ValidationError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Field + ": " + e.Reason
+}
+
+// Значения, которые можно указать приложению
+var (
+	knownClaims     = []string{models.ClaimEmail, models.ClaimIsAdmin, models.ClaimRoles}
+	knownGrantTypes = []string{models.GrantPassword, models.GrantRefreshToken, models.GrantAuthorizationCode, models.GrantClientCredentials, models.GrantDeviceCode}
+)
+
+type Apps struct {
+	log         *slog.Logger
+	appSaver    AppSaver
+	appProvider AppProvider
+}
+
+type AppSaver interface {
+	SaveApp(ctx context.Context, app models.App) (int, error)
+	UpdateApp(ctx context.Context, app models.App) error
+	UpdateAppSecret(ctx context.Context, appID int, secret string) error
+	DeleteApp(ctx context.Context, appID int) error
+}
+
+// AppProvider - auth.AppProvider со списком всех приложений
+type AppProvider interface {
+	auth.AppProvider
+	Apps(ctx context.Context) ([]models.App, error)
+}
+
+// New возвращает сервис управления приложениями.
+func New(log *slog.Logger, appSaver AppSaver, appProvider AppProvider) *Apps {
+	return &Apps{
+		log:         log,
+		appSaver:    appSaver,
+		appProvider: appProvider,
+	}
+}
+
+// CreateApp регистрирует приложение и генерирует ему секрет.
+// Секрет возвращается только здесь и в RotateSecret, потом его узнать нельзя.
+func (a *Apps) CreateApp(ctx context.Context, app models.App) (models.App, error) {
+	const op = "apps.CreateApp"
+
+	log := a.log.With(slog.String("op", op), slog.String("name", app.Name))
+	log.Info("Creating app")
+
+	if app.SigningAlg == "" {
+		app.SigningAlg = jwt.AlgHS256
+	}
+	if app.SigningAlg != jwt.AlgHS256 && !jwt.IsAsymmetric(app.SigningAlg) {
+		return models.App{}, fmt.Errorf("%s: %w", op, &ValidationError{Field: "signing_alg", Reason: "unsupported signing algorithm"})
+	}
+	if err := validate(app); err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret, err := opaque.New()
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+	app.Secret = secret
+	// Ключи асимметричным приложениям генерирует и ротирует keystore
+	app.SigningKey = ""
+
+	id, err := a.appSaver.SaveApp(ctx, app)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppExists) {
+			log.Warn("app already exists")
+			return models.App{}, fmt.Errorf("%s: %w", op, ErrAppExists)
+		}
+		log.Error("failed to save app", sl.Err(err))
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+	app.ID = id
+
+	log.Info("App created", slog.Int("app_id", id))
+
+	return app, nil
+}
+
+// Apps возвращает все зарегистрированные приложения.
+func (a *Apps) Apps(ctx context.Context) ([]models.App, error) {
+	const op = "apps.Apps"
+
+	apps, err := a.appProvider.Apps(ctx)
+	if err != nil {
+		a.log.Error("failed to list apps", slog.String("op", op), sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Приложение самого SSO только владеет его ролями, управлять им через API нельзя
+	apps = slices.DeleteFunc(apps, func(app models.App) bool { return app.ID == models.SystemAppID })
+
+	return apps, nil
+}
+
+// App возвращает приложение по ID.
+func (a *Apps) App(ctx context.Context, appID int) (models.App, error) {
+	const op = "apps.App"
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return models.App{}, fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		a.log.Error("failed to get app", slog.String("op", op), sl.Err(err))
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return app, nil
+}
+
+// UpdateApp заменяет настройки приложения. Секрет и алгоритм подписи так поменять нельзя.
+func (a *Apps) UpdateApp(ctx context.Context, app models.App) (models.App, error) {
+	const op = "apps.UpdateApp"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", app.ID))
+	log.Info("Updating app")
+
+	if err := validate(app); err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.appSaver.UpdateApp(ctx, app); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found")
+			return models.App{}, fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		if errors.Is(err, storage.ErrAppExists) {
+			log.Warn("app name is taken")
+			return models.App{}, fmt.Errorf("%s: %w", op, ErrAppExists)
+		}
+		log.Error("failed to update app", sl.Err(err))
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("App updated")
+
+	return a.App(ctx, app.ID)
+}
+
+// RotateSecret генерирует приложению новый секрет, старый сразу перестает действовать.
+//
+// HS256 приложения подписывают токены секретом, поэтому их уже выданные access токены тоже перестанут проходить проверку.
+func (a *Apps) RotateSecret(ctx context.Context, appID int) (string, error) {
+	const op = "apps.RotateSecret"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", appID))
+	log.Info("Rotating app secret")
+
+	secret, err := opaque.New()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.appSaver.UpdateAppSecret(ctx, appID, secret); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found")
+			return "", fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		log.Error("failed to update app secret", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("App secret rotated")
+
+	return secret, nil
+}
+
+// DeleteApp удаляет приложение вместе с его ролями, сессиями и ключами.
+func (a *Apps) DeleteApp(ctx context.Context, appID int) error {
+	const op = "apps.DeleteApp"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", appID))
+	log.Info("Deleting app")
+
+	if err := a.appSaver.DeleteApp(ctx, appID); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found")
+			return fmt.Errorf("%s: %w", op, ErrAppNotFound)
+		}
+		log.Error("failed to delete app", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("App deleted")
+
+	return nil
+}
+
+func validate(app models.App) error {
+	if app.Name == "" {
+		return &ValidationError{Field: "name", Reason: "is required"}
+	}
+	if app.TokenTTL < 0 || app.RefreshTokenTTL < 0 {
+		return &ValidationError{Field: "token_ttl", Reason: "must not be negative"}
+	}
+
+	for _, claim := range app.Claims {
+		if !slices.Contains(knownClaims, claim) {
+			return &ValidationError{Field: "claims", Reason: fmt.Sprintf("unknown claim %q", claim)}
+		}
+	}
+
+	for _, grantType := range app.GrantTypes {
+		if !slices.Contains(knownGrantTypes, grantType) {
+			return &ValidationError{Field: "grant_types", Reason: fmt.Sprintf("unknown grant type %q", grantType)}
+		}
+	}
+
+	for _, redirectURI := range app.RedirectURIs {
+		// Redirect URI сравнивается целиком (RFC 6749 3.1.2), поэтому он должен быть абсолютным и без фрагмента
+		u, err := url.Parse(redirectURI)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Fragment != "" {
+			return &ValidationError{Field: "redirect_uris", Reason: fmt.Sprintf("%q must be an absolute URI without fragment", redirectURI)}
+		}
+	}
+
+	for _, scope := range app.Scopes {
+		if !validScope(scope) {
+			return &ValidationError{Field: "scopes", Reason: fmt.Sprintf("%q is not a valid scope", scope)}
+		}
+	}
+
+	// У публичного клиента нет секрета, а токен без пользователя ему выдавать нельзя
+	if app.Public && slices.Contains(app.GrantTypes, models.GrantClientCredentials) {
+		return &ValidationError{Field: "grant_types", Reason: "client_credentials is not allowed for public apps"}
+	}
+
+	if app.ClientPublicKey != "" {
+		if _, _, err := keys.ParsePublicKey([]byte(app.ClientPublicKey)); err != nil {
+			return &ValidationError{Field: "client_public_key", Reason: err.Error()}
+		}
+	}
+
+	return nil
+}
+
+// validScope проверяет синтаксис scope-token из RFC 6749 3.3: видимые ASCII символы, кроме " и \
+func validScope(scope string) bool {
+	if scope == "" {
+		return false
+	}
+
+	return !strings.ContainsFunc(scope, func(r rune) bool {
+		return r <= ' ' || r > '~' || r == '"' || r == '\\'
+	})
+}
@@ -5,13 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
-	"golang.org/x/crypto/bcrypt"
-
 	"sso/internal/domain/models"
 	"sso/internal/lib/jwt"
 	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/opaque"
+	"sso/internal/lib/password"
+	"sso/internal/lib/webauthn"
 	"sso/internal/storage"
 )
 
@@ -20,16 +22,50 @@ type Auth struct {
 	userSaver 		UserSaver
 	userProvider UserProvider
 	appProvider 	AppProvider
+	refreshTokenSaver RefreshTokenSaver
+	refreshTokenProvider RefreshTokenProvider
+	keyProvider KeyProvider
+	tokenRevoker TokenRevoker
+	roleProvider RoleProvider
+	loginGuard LoginGuard
+	passwordPolicy password.Policy
+	breachChecker BreachChecker
+	passwordHasher PasswordHasher
+	passwordResetStore PasswordResetStore
+	mailer Mailer
+	emailVerificationStore EmailVerificationStore
+	mfaStore MFAStore
+	mfaPolicy MFAPolicy
+	webAuthnStore WebAuthnStore
+	relyingParty *webauthn.RelyingParty
+	authorizationCodeStore AuthorizationCodeStore
+	clientAssertionStore ClientAssertionStore
+	deviceCodeStore DeviceCodeStore
+	userCodeLimiter UserCodeLimiter
+	impersonationStore ImpersonationStore
+	issuer string
+	adminAppID int
 	tokenTTL 		time.Duration
-
+	refreshTokenTTL time.Duration
+	passwordResetTTL time.Duration
+	emailVerificationTTL time.Duration
+	webAuthnSessionTTL time.Duration
+	authorizationCodeTTL time.Duration
+	deviceCodeTTL time.Duration
+	deviceCodeInterval time.Duration
+	impersonationTTL time.Duration
+	requireVerifiedEmail bool
 }
 
 type UserSaver interface {
 	SaveUser(ctx context.Context, email string, passHash []byte) (uid int64, err error)
+	UpdatePassHash(ctx context.Context, userID int64, passHash []byte) error
+	ChangePassword(ctx context.Context, userID int64, passHash []byte, changedAt time.Time) error
 }
 
 type UserProvider interface {
 	User(ctx context.Context, email string) (models.User, error)
+	UserByID(ctx context.Context, userID int64) (models.User, error)
 	IsAdmin(ctx context.Context, userID int64) (bool, error)
 }
 
@@ -37,87 +73,473 @@ type AppProvider interface {
 	App(ctx context.Context, appID int) (models.App, error)
 }
 
+type RefreshTokenSaver interface {
+	SaveRefreshToken(ctx context.Context, token models.RefreshToken) error
+	RotateRefreshToken(ctx context.Context, oldID int64, newToken models.RefreshToken) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+}
+
+type RefreshTokenProvider interface {
+	RefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error)
+}
+
+type KeyProvider interface {
+	SigningKey(ctx context.Context, app models.App) (jwt.Key, error)
+	VerificationKey(ctx context.Context, app models.App, kid string) (jwt.VerificationKey, error)
+}
+
+type TokenRevoker interface {
+	Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, tokenID string) (bool, error)
+}
+
+type RoleProvider interface {
+	UserRoles(ctx context.Context, userID int64, appID int) ([]models.Role, error)
+	HasPermission(ctx context.Context, userID int64, appID int, permission string) (bool, error)
+}
+
+// LoginGuard считает неудачные попытки входа и не дает перебирать пароли
+type LoginGuard interface {
+	Blocked(ctx context.Context, email string, ip string) (retryAfter time.Duration, err error)
+	LoginFailed(ctx context.Context, email string, ip string) error
+	LoginSucceeded(ctx context.Context, email string) error
+}
+
+// PasswordHasher хеширует пароли. Verify должен проверять и хеши, сделанные другими алгоритмами или параметрами,
+// а NeedsRehash - сообщать о таких хешах, чтобы при входе пароль перехешировался текущими настройками
+type PasswordHasher interface {
+	Hash(password string) ([]byte, error)
+	Verify(password string, hash []byte) (bool, error)
+	NeedsRehash(hash []byte) bool
+}
+
+// BreachChecker проверяет, не встречался ли пароль в известных утечках
+type BreachChecker interface {
+	IsBreached(ctx context.Context, password string) (bool, error)
+}
+
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrUserExists = errors.New("user already exists")
 	ErrInvalidAppID = errors.New("invalid app id")
 	ErrUserNotFound = errors.New("user not found")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrInvalidToken = errors.New("invalid token")
+	ErrUserDisabled = errors.New("user is disabled")
+	ErrPasswordResetRequired = errors.New("password reset required")
+	ErrAppDisabled = errors.New("app is disabled")
+	ErrGrantNotAllowed = errors.New("grant type is not allowed for app")
+	ErrAccountLocked = errors.New("account is temporarily locked")
+	ErrWeakPassword = errors.New("password does not meet policy")
 )
 
+// PasswordPolicyError - пароль не прошел политику, Violations - все нарушенные правила
+type PasswordPolicyError struct {
+	Violations []password.Violation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	rules := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		rules = append(rules, v.Rule)
+	}
+
+	return fmt.Sprintf("%s: %s", ErrWeakPassword, strings.Join(rules, ", "))
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// LockedError - вход временно заблокирован из-за неудачных попыток, RetryAfter - когда можно попробовать снова
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrAccountLocked, e.RetryAfter)
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrAccountLocked
+}
+
+// Deps - хранилища и сервисы, с которыми работает Auth
+type Deps struct {
+	UserSaver              UserSaver
+	UserProvider           UserProvider
+	AppProvider            AppProvider
+	RefreshTokenSaver      RefreshTokenSaver
+	RefreshTokenProvider   RefreshTokenProvider
+	KeyProvider            KeyProvider
+	TokenRevoker           TokenRevoker
+	RoleProvider           RoleProvider
+	LoginGuard             LoginGuard
+	BreachChecker          BreachChecker // nil - пароли по базе утечек не проверяются
+	PasswordHasher         PasswordHasher
+	PasswordResetStore     PasswordResetStore
+	Mailer                 Mailer
+	EmailVerificationStore EmailVerificationStore
+	MFAStore               MFAStore
+	WebAuthnStore          WebAuthnStore
+	AuthorizationCodeStore AuthorizationCodeStore
+	ClientAssertionStore   ClientAssertionStore
+	DeviceCodeStore        DeviceCodeStore
+	UserCodeLimiter        UserCodeLimiter
+	ImpersonationStore     ImpersonationStore
+}
+
+// TTLs - время жизни токенов, кодов и сессий
+type TTLs struct {
+	Token             time.Duration // access токен, если у приложения не задано свое
+	RefreshToken      time.Duration // refresh токен, если у приложения не задано свое
+	PasswordReset     time.Duration
+	EmailVerification time.Duration
+	WebAuthnSession   time.Duration
+	AuthorizationCode time.Duration
+	DeviceCode        time.Duration
+	Impersonation     time.Duration // токен, выданный через TokenExchange
+}
+
+// Settings - остальные настройки Auth
+type Settings struct {
+	Issuer               string
+	PasswordPolicy       password.Policy
+	MFAPolicy            MFAPolicy
+	RelyingParty         *webauthn.RelyingParty
+	DeviceCodeInterval   time.Duration // Как часто устройство может спрашивать /token о device_code
+	RequireVerifiedEmail bool
+	AdminAppID           int // Токены администраторов принимаются только от этого приложения (AuthenticateAdmin)
+}
+
 // New возвращает новый экземпляр службы аутентификации.
-func New(log *slog.Logger, userSaver UserSaver, userProvider UserProvider, appProvider AppProvider, tokenTTL time.Duration) *Auth {
+func New(log *slog.Logger, deps Deps, ttls TTLs, settings Settings) *Auth {
 	return &Auth{
-		log: 					log,
-		userSaver: 		userSaver,
-		userProvider: userProvider,
-		appProvider: 	appProvider,
-		tokenTTL: 		tokenTTL,
+		log:                    log,
+		userSaver:              deps.UserSaver,
+		userProvider:           deps.UserProvider,
+		appProvider:            deps.AppProvider,
+		refreshTokenSaver:      deps.RefreshTokenSaver,
+		refreshTokenProvider:   deps.RefreshTokenProvider,
+		keyProvider:            deps.KeyProvider,
+		tokenRevoker:           deps.TokenRevoker,
+		roleProvider:           deps.RoleProvider,
+		loginGuard:             deps.LoginGuard,
+		passwordPolicy:         settings.PasswordPolicy,
+		breachChecker:          deps.BreachChecker,
+		passwordHasher:         deps.PasswordHasher,
+		passwordResetStore:     deps.PasswordResetStore,
+		mailer:                 deps.Mailer,
+		emailVerificationStore: deps.EmailVerificationStore,
+		mfaStore:               deps.MFAStore,
+		mfaPolicy:              settings.MFAPolicy,
+		webAuthnStore:          deps.WebAuthnStore,
+		relyingParty:           settings.RelyingParty,
+		authorizationCodeStore: deps.AuthorizationCodeStore,
+		clientAssertionStore:   deps.ClientAssertionStore,
+		deviceCodeStore:        deps.DeviceCodeStore,
+		userCodeLimiter:        deps.UserCodeLimiter,
+		impersonationStore:     deps.ImpersonationStore,
+		issuer:                 settings.Issuer,
+		adminAppID:             settings.AdminAppID,
+		tokenTTL:               ttls.Token,
+		refreshTokenTTL:        ttls.RefreshToken,
+		passwordResetTTL:       ttls.PasswordReset,
+		emailVerificationTTL:   ttls.EmailVerification,
+		webAuthnSessionTTL:     ttls.WebAuthnSession,
+		authorizationCodeTTL:   ttls.AuthorizationCode,
+		deviceCodeTTL:          ttls.DeviceCode,
+		deviceCodeInterval:     settings.DeviceCodeInterval,
+		impersonationTTL:       ttls.Impersonation,
+		requireVerifiedEmail:   settings.RequireVerifiedEmail,
 	}
 }
 
-// Login проверяет, существует ли в системе пользователь с указанными учетными данными, и возвращает токен доступа.
+// Login проверяет, существует ли в системе пользователь с указанными учетными данными, и возвращает токен доступа
+// вместе с refresh токеном.
 //
 // Если пользователь существует, но пароль неверен, возвращает ошибку.
 // Если пользователь не существует, возвращает ошибку.
-func (a *Auth) Login(ctx context.Context, email string, password string, appID int) (string, error) {
+// После нескольких неудачных попыток с этим email или с этого ip (адрес клиента) вход временно блокируется.
+// Если у пользователя включен второй фактор, вместо токенов возвращает MFAToken, вход завершает VerifyMFA.
+func (a *Auth) Login(ctx context.Context, email string, password string, appID int, ip string) (models.TokenPair, error) {
 	const op = "auth.Login"
 
 	log := a.log.With(slog.String("op", op), slog.String("email", email)) // Внимание email это GDPR данные, лучше их не логировать
 	log.Info("Login user")
 
+	user, err := a.checkPassword(ctx, log, email, password, ip)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Теперь смотрим в какое приложение пользователь хочет залогинится
+	app, err := a.loginApp(ctx, log, appID)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// С включенным вторым фактором пароля мало: токены выдаст VerifyMFA, когда пользователь введет код
+	mfaToken, err := a.requireSecondFactor(ctx, log, user, app)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if mfaToken != "" {
+		return models.TokenPair{MFAToken: mfaToken}, nil
+	}
+
+	log.Info("User logged in successfully")
+
+	tokens, err := a.issueTokens(ctx, log, user, app)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tokens, nil
+}
+
+// checkPassword проверяет email и пароль с учетом блокировки после неудачных попыток и статус пользователя
+func (a *Auth) checkPassword(ctx context.Context, log *slog.Logger, email string, password string, ip string) (models.User, error) {
+	// Блокировку проверяем до пароля, иначе во время блокировки перебор бы продолжался
+	retryAfter, err := a.loginGuard.Blocked(ctx, email, ip)
+	if err != nil {
+		log.Error("failed to check login failures", sl.Err(err))
+		return models.User{}, err
+	}
+	if retryAfter > 0 {
+		log.Warn("login is temporarily locked", slog.String("ip", ip), slog.Duration("retry_after", retryAfter))
+		return models.User{}, &LockedError{RetryAfter: retryAfter}
+	}
+
 	user, err := a.userProvider.User(ctx, email)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
 			a.log.Warn("user not found", sl.Err(err))
+			// Несуществующий email считаем так же, как неверный пароль, иначе блокировка выдала бы какие email зарегистрированы
+			a.loginFailed(ctx, log, email, ip)
 
-			return "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+			return models.User{}, ErrInvalidCredentials
 		}
 		a.log.Error("failed to get user", sl.Err(err))
-		return "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+		return models.User{}, ErrInvalidCredentials
 	}
 
-	// Теперь с помощью bcrypt проверим правильный ли пароль ввел юзер
-	if err := bcrypt.CompareHashAndPassword(user.PassHash, []byte(password)); err != nil {
-		a.log.Info("invalid credentials", sl.Err(err))
-		return "", fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	// Теперь проверим правильный ли пароль ввел юзер, алгоритм хеша записан в самом хеше
+	match, err := a.passwordHasher.Verify(password, user.PassHash)
+	if err != nil {
+		log.Error("failed to verify password hash", sl.Err(err))
+	}
+	if !match {
+		a.log.Info("invalid credentials")
+		a.loginFailed(ctx, log, email, ip)
+		return models.User{}, ErrInvalidCredentials
 	}
 
-	// Теперь смотрим в какое приложение пользователь хочет залогинится
+	// Пароль верный, неудачные попытки больше не считаются
+	if err := a.loginGuard.LoginSucceeded(ctx, email); err != nil {
+		log.Error("failed to reset login failures", sl.Err(err))
+	}
+
+	// Открытый пароль есть только сейчас, поэтому устаревший хеш обновляем при входе
+	a.rehashPassword(ctx, log, user, password)
+
+	// Статус проверяем только после пароля, иначе по ответу можно было бы узнать о чужой учетной записи
+	if user.Disabled {
+		log.Warn("user is disabled")
+		return models.User{}, ErrUserDisabled
+	}
+	if a.requireVerifiedEmail && !user.EmailVerified {
+		log.Info("email is not verified")
+		return models.User{}, ErrEmailNotVerified
+	}
+	if user.PasswordResetRequired {
+		log.Info("password reset required")
+		return models.User{}, ErrPasswordResetRequired
+	}
+
+	return user, nil
+}
+
+// loginApp возвращает приложение, в которое пользователь входит сам (паролем или passkey)
+func (a *Auth) loginApp(ctx context.Context, log *slog.Logger, appID int) (models.App, error) {
 	app, err := a.appProvider.App(ctx, appID)
 	if err != nil {
-		return "", fmt.Errorf("%s: %w", op)
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found", sl.Err(err))
+			return models.App{}, ErrInvalidAppID
+		}
+		return models.App{}, err
+	}
+
+	if !app.Enabled {
+		log.Warn("app is disabled")
+		return models.App{}, ErrAppDisabled
+	}
+	if !app.AllowsGrant(models.GrantPassword) {
+		log.Warn("password grant is not allowed for app")
+		return models.App{}, ErrGrantNotAllowed
+	}
+
+	return app, nil
+}
+
+// issueTokens выдает access токен и, если приложению разрешен refresh_token grant, refresh токен нового семейства
+func (a *Auth) issueTokens(ctx context.Context, log *slog.Logger, user models.User, app models.App) (models.TokenPair, error) {
+	// Каждый логин начинает новое семейство refresh токенов
+	familyID, err := opaque.New()
+	if err != nil {
+		return models.TokenPair{}, err
 	}
 
+	return a.issueTokensInFamily(ctx, log, user, app, familyID, "")
+}
+
+// issueTokensInFamily выдает токены, как issueTokens, но refresh токен начинает заранее выбранное семейство.
+// scope - права OAuth2, они сохраняются в refresh токене
+func (a *Auth) issueTokensInFamily(
+	ctx context.Context,
+	log *slog.Logger,
+	user models.User,
+	app models.App,
+	familyID string,
+	scope string,
+) (models.TokenPair, error) {
 	// Каждый токен подписывается ключем, но ключей может быть много, у каждого приложения свой
-	// Пока что мы будем хранить секретный ключ приложения в БД, что не очень хорошо
 	// Для получения токена мы используем ключ приложения в которое хочет залогинится пользователь
-	log.Info("User logged in successfully")
+	token, err := a.newAccessToken(ctx, log, user, app, scope)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	tokens := models.TokenPair{AccessToken: token, ExpiresIn: app.AccessTTL(a.tokenTTL), Scope: scope}
 
-	token, err := jwt.NewToken(user, app, a.tokenTTL)
+	// Приложению без refresh_token grant отдаем только access токен
+	if !app.AllowsGrant(models.GrantRefreshToken) {
+		return tokens, nil
+	}
+
+	refreshToken, rt, err := a.newRefreshToken(user.ID, app, familyID, scope)
 	if err != nil {
-		a.log.Error("failed to generate token", sl.Err(err))
+		return models.TokenPair{}, err
+	}
 
-		return "", fmt.Errorf("%s: %w", op)
+	if err := a.refreshTokenSaver.SaveRefreshToken(ctx, rt); err != nil {
+		log.Error("failed to save refresh token", sl.Err(err))
+		return models.TokenPair{}, err
 	}
 
+	tokens.RefreshToken = refreshToken
+
+	return tokens, nil
+}
+
+// loginFailed засчитывает неудачную попытку входа. Ошибку только логируем: клиенту в любом случае уходит ErrInvalidCredentials
+func (a *Auth) loginFailed(ctx context.Context, log *slog.Logger, email string, ip string) {
+	if err := a.loginGuard.LoginFailed(ctx, email, ip); err != nil {
+		log.Error("failed to record login failure", sl.Err(err))
+	}
+}
+
+// rehashPassword перехеширует пароль, если хеш сделан другим алгоритмом или с другими параметрами.
+// Ошибку только логируем: старый хеш остается рабочим, обновим при следующем входе
+func (a *Auth) rehashPassword(ctx context.Context, log *slog.Logger, user models.User, password string) {
+	if !a.passwordHasher.NeedsRehash(user.PassHash) {
+		return
+	}
+
+	passHash, err := a.passwordHasher.Hash(password)
+	if err != nil {
+		log.Error("failed to rehash password", sl.Err(err))
+		return
+	}
+
+	if err := a.userSaver.UpdatePassHash(ctx, user.ID, passHash); err != nil {
+		log.Error("failed to save rehashed password", sl.Err(err))
+		return
+	}
+
+	log.Info("password rehashed")
+}
+
+// newAccessToken подписывает access токен ключом приложения.
+// Время жизни и необязательные поля берутся из настроек приложения, время жизни по умолчанию - из конфига.
+// scope попадает в токен, по нему /userinfo решает, какие данные пользователя отдать
+func (a *Auth) newAccessToken(ctx context.Context, log *slog.Logger, user models.User, app models.App, scope string) (string, error) {
+	extra, err := a.accessTokenExtra(ctx, log, user, app, scope)
+	if err != nil {
+		return "", err
+	}
+
+	return a.signAccessToken(ctx, log, user, app, app.AccessTTL(a.tokenTTL), extra)
+}
+
+// accessTokenExtra собирает необязательные поля access токена, которые приложение включило в настройках
+func (a *Auth) accessTokenExtra(ctx context.Context, log *slog.Logger, user models.User, app models.App, scope string) (jwt.Extra, error) {
+	extra := jwt.Extra{Scope: scope}
+	if app.HasClaim(models.ClaimEmail) {
+		extra.Email = user.Email
+	}
+	if app.HasClaim(models.ClaimIsAdmin) {
+		isAdmin := user.IsAdmin
+		extra.IsAdmin = &isAdmin
+	}
+	if app.HasClaim(models.ClaimRoles) {
+		roles, err := a.roleProvider.UserRoles(ctx, user.ID, app.ID)
+		if err != nil {
+			log.Error("failed to get user roles", sl.Err(err))
+			return jwt.Extra{}, err
+		}
+		for _, role := range roles {
+			extra.Roles = append(extra.Roles, role.Name)
+		}
+	}
+
+	return extra, nil
+}
+
+// signAccessToken подписывает access токен ключом приложения
+func (a *Auth) signAccessToken(
+	ctx context.Context,
+	log *slog.Logger,
+	user models.User,
+	app models.App,
+	duration time.Duration,
+	extra jwt.Extra,
+) (string, error) {
+	key, err := a.keyProvider.SigningKey(ctx, app)
+	if err != nil {
+		log.Error("failed to get signing key", sl.Err(err))
+		return "", err
+	}
+
+	token, err := jwt.NewToken(user, app, key, a.issuer, duration, extra)
+	if err != nil {
+		log.Error("failed to generate token", sl.Err(err))
+		return "", err
+	}
 
 	return token, nil
 }
 
 // RegisterNewUser регистрирует нового пользователя в системе и возвращает идентификатор пользователя.
 // Если пользователь с указанным именем пользователя уже существует, возвращает ошибку.
+// На email отправляется токен, которым пользователь подтверждает, что адрес принадлежит ему.
 func (a *Auth) RegisterNewUser(ctx context.Context, email string, pass string) (int64, error) {
 	const op = "auth.RegisterNewUser"
 
 	log := a.log.With(slog.String("op", op), slog.String("email", email)) // Внимание email это GDPR данные, лучше их не логировать
 	log.Info("Registering user")
+
+	if err := a.validatePassword(ctx, log, pass, email); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
 	// Пароль в открытом виде хранить нельзя, перед сохранением пароля в БД нам нужно его захэшировать
 	// Потом при логине мы будем сравнивать один хэш с другим
 	// Если же наши хэши утекут из БД то злоумышленники простые пароли все же могут из хэша восстановить, поэтому подсолим пароль
 	// Подсолить значит добавить к паролю рандомную фразу. Бывают более продвинутые технологии, например динамическая соль
-	// Все это мы реализуем с помощью bcrypt из golang.org/x/crypto
-	// bcrypt.GenerateFromPassword - создает соль для пароля и хэширует его, делает она это bcrypt.DefaultCost количество раз
-	passHash, err := bcrypt.GenerateFromPassword([]byte(pass), bcrypt.DefaultCost)
+	// Алгоритм (bcrypt, argon2id или scrypt) и его параметры задаются в конфиге, соль хешер генерирует сам
+	passHash, err := a.passwordHasher.Hash(pass)
 	if err != nil {
 		log.Error("failed to generate password hash", sl.Err(err))
 		return 0, fmt.Errorf("%s: %w", op, err)
@@ -135,11 +557,46 @@ func (a *Auth) RegisterNewUser(ctx context.Context, email string, pass string) (
 	}
 
 	log.Info("User registered")
+
+	// Пользователь уже создан, поэтому неудачная отправка письма регистрацию не отменяет.
+	// Email подтверждает и сброс пароля: токен сброса тоже приходит на почту
+	if err := a.sendVerificationEmail(ctx, id, email); err != nil {
+		log.Error("failed to send verification email", sl.Err(err))
+	}
+
 	return id, nil
 
 }
 
-// IsAdmin checks if user is admin.
+// validatePassword проверяет новый пароль политикой и по базе утечек.
+// Сразу сообщаем обо всех нарушенных правилах, чтобы пользователь исправил пароль за одну попытку
+func (a *Auth) validatePassword(ctx context.Context, log *slog.Logger, pass string, email string) error {
+	violations := a.passwordPolicy.Validate(pass, email)
+
+	// Без базы утечек проверка выключена
+	if a.breachChecker != nil {
+		breached, err := a.breachChecker.IsBreached(ctx, pass)
+		if err != nil {
+			// Недоступная база не должна блокировать регистрацию, пароль все равно прошел политику
+			log.Error("failed to check password against breaches", sl.Err(err))
+		}
+		if breached {
+			violations = append(violations, password.Violation{
+				Rule:        password.RuleNotBreached,
+				Description: "has appeared in a data breach, choose another password",
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		log.Info("password does not meet policy")
+		return &PasswordPolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+// IsAdmin checks if user has the SSO admin role.
 func (a *Auth) IsAdmin(ctx context.Context, userID int64) (bool, error) {
 	const op = "auth.IsAdmin"
 
@@ -0,0 +1,290 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/jwt"
+	"sso/internal/lib/keys"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+)
+
+// maxClientAssertionTTL - сколько может жить client_assertion. Его jti хранится, пока assertion не истечет,
+// поэтому долгоживущие assertion не принимаем
+const maxClientAssertionTTL = 5 * time.Minute
+
+// ClientAssertionStore запоминает jti предъявленных client_assertion, чтобы их нельзя было предъявить повторно
+type ClientAssertionStore interface {
+	UseClientAssertion(ctx context.Context, appID int, jti string, expiresAt time.Time) error
+}
+
+var (
+	// ErrInvalidClientCredentials - приложение не найдено, выключено или не подтвердило, что это оно
+	ErrInvalidClientCredentials = errors.New("invalid client credentials")
+	// ErrInvalidScope - приложение запросило права, которые ему не выданы
+	ErrInvalidScope = errors.New("invalid scope")
+)
+
+// ClientLogin выдает access токен самому приложению, без пользователя (client_credentials).
+// Так получают токены фоновые задачи и сервисы, которые ходят друг к другу.
+//
+// Приложение подтверждает, что это оно, секретом или client_assertion - JWT, подписанным его ключом (private_key_jwt).
+// scope - нужные права через пробел, пусто - все выданные приложению права.
+// Refresh токен не выдается: приложение в любой момент может получить новый токен само (RFC 6749, раздел 4.4.3)
+func (a *Auth) ClientLogin(ctx context.Context, appID int, clientSecret string, clientAssertion string, scope string) (models.TokenPair, error) {
+	const op = "auth.ClientLogin"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", appID))
+
+	app, err := a.authenticateConfidentialClient(ctx, log, strconv.Itoa(appID), clientSecret, clientAssertion)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	tokens, err := a.issueClientToken(ctx, log, app, scope)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tokens, nil
+}
+
+// ExchangeClientCredentials выдает токен приложению по /token (grant_type=client_credentials), как ClientLogin.
+// С client_assertion clientID можно не передавать, он берется из assertion
+func (a *Auth) ExchangeClientCredentials(
+	ctx context.Context,
+	clientID string,
+	clientSecret string,
+	clientAssertion string,
+	scope string,
+) (models.TokenPair, error) {
+	const op = "auth.ExchangeClientCredentials"
+
+	log := a.log.With(slog.String("op", op), slog.String("client_id", clientID))
+
+	app, err := a.authenticateConfidentialClient(ctx, log, clientID, clientSecret, clientAssertion)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, clientCredentialsError(err))
+	}
+
+	tokens, err := a.issueClientToken(ctx, log, app, scope)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, clientCredentialsError(err))
+	}
+
+	return tokens, nil
+}
+
+// clientCredentialsError переводит ошибки ClientLogin в ошибки OAuth2 для /token
+func clientCredentialsError(err error) error {
+	switch {
+	case errors.Is(err, ErrInvalidClientCredentials):
+		return &OAuthError{OAuthInvalidClient, "client authentication failed"}
+	case errors.Is(err, ErrGrantNotAllowed):
+		return &OAuthError{OAuthUnauthorizedClient, "client_credentials grant is not allowed"}
+	case errors.Is(err, ErrInvalidScope):
+		return &OAuthError{OAuthInvalidScope, "requested scope is not granted to the client"}
+	}
+
+	return err
+}
+
+// issueClientToken подписывает токен приложения ключом приложения, как и токены его пользователей
+func (a *Auth) issueClientToken(ctx context.Context, log *slog.Logger, app models.App, scope string) (models.TokenPair, error) {
+	if !app.AllowsGrant(models.GrantClientCredentials) {
+		log.Warn("client_credentials grant is not allowed for app")
+		return models.TokenPair{}, ErrGrantNotAllowed
+	}
+
+	scope, err := clientScope(app, scope)
+	if err != nil {
+		log.Warn("requested scope is not granted to app", sl.Err(err))
+		return models.TokenPair{}, err
+	}
+
+	key, err := a.keyProvider.SigningKey(ctx, app)
+	if err != nil {
+		log.Error("failed to get signing key", sl.Err(err))
+		return models.TokenPair{}, err
+	}
+
+	ttl := app.AccessTTL(a.tokenTTL)
+
+	token, err := jwt.NewClientToken(app, key, a.issuer, ttl, scope)
+	if err != nil {
+		log.Error("failed to generate token", sl.Err(err))
+		return models.TokenPair{}, err
+	}
+
+	log.Info("client token issued", slog.String("scope", scope))
+
+	return models.TokenPair{AccessToken: token, ExpiresIn: ttl, Scope: scope}, nil
+}
+
+// authenticateConfidentialClient проверяет приложение по секрету или по client_assertion, нужно что-то одно.
+// В отличие от authenticateClient, приложение без секрета и assertion не пропускается. Все ошибки проверки - ErrInvalidClientCredentials
+func (a *Auth) authenticateConfidentialClient(
+	ctx context.Context,
+	log *slog.Logger,
+	clientID string,
+	clientSecret string,
+	clientAssertion string,
+) (models.App, error) {
+	switch {
+	case clientAssertion != "" && clientSecret != "":
+		log.Warn("both client secret and client assertion are passed")
+		return models.App{}, ErrInvalidClientCredentials
+	case clientAssertion != "":
+		return a.authenticateClientAssertion(ctx, log, clientID, clientAssertion)
+	case clientSecret == "":
+		log.Warn("client credentials are missing")
+		return models.App{}, ErrInvalidClientCredentials
+	}
+
+	app, err := a.clientApp(ctx, log, clientID)
+	if err != nil {
+		return models.App{}, err
+	}
+	if subtle.ConstantTimeCompare([]byte(clientSecret), []byte(app.Secret)) != 1 {
+		log.Warn("invalid client secret")
+		return models.App{}, ErrInvalidClientCredentials
+	}
+
+	return app, nil
+}
+
+// authenticatePublicOrConfidentialClient - authenticateConfidentialClient, но публичное приложение (App.Public)
+// пропускается и без секрета: хранить его ему негде (RFC 6749, раздел 2.1)
+func (a *Auth) authenticatePublicOrConfidentialClient(
+	ctx context.Context,
+	log *slog.Logger,
+	clientID string,
+	clientSecret string,
+	clientAssertion string,
+) (models.App, error) {
+	if clientSecret != "" || clientAssertion != "" {
+		return a.authenticateConfidentialClient(ctx, log, clientID, clientSecret, clientAssertion)
+	}
+
+	app, err := a.clientApp(ctx, log, clientID)
+	if err != nil {
+		return models.App{}, err
+	}
+	if !app.Public {
+		log.Warn("client credentials are missing")
+		return models.App{}, ErrInvalidClientCredentials
+	}
+
+	return app, nil
+}
+
+// authenticateClientAssertion проверяет private_key_jwt (RFC 7523): подпись ключом приложения, aud - наш сервис,
+// короткий срок жизни и jti, который еще не предъявлялся
+func (a *Auth) authenticateClientAssertion(ctx context.Context, log *slog.Logger, clientID string, clientAssertion string) (models.App, error) {
+	var app models.App
+
+	issuer := strings.TrimSuffix(a.issuer, "/")
+	audiences := []string{a.issuer, issuer + "/token"}
+
+	assertion, err := jwt.ParseClientAssertion(clientAssertion, audiences, func(assertionClientID string) (jwt.VerificationKey, error) {
+		if clientID != "" && assertionClientID != clientID {
+			return jwt.VerificationKey{}, fmt.Errorf("%w: client_id mismatch", jwt.ErrInvalidToken)
+		}
+
+		var err error
+		app, err = a.clientApp(ctx, log, assertionClientID)
+		if err != nil {
+			if errors.Is(err, ErrInvalidClientCredentials) {
+				return jwt.VerificationKey{}, fmt.Errorf("%w: %w", jwt.ErrInvalidToken, err)
+			}
+			return jwt.VerificationKey{}, err
+		}
+		if app.ClientPublicKey == "" {
+			return jwt.VerificationKey{}, fmt.Errorf("%w: app has no client public key", jwt.ErrInvalidToken)
+		}
+
+		public, alg, err := keys.ParsePublicKey([]byte(app.ClientPublicKey))
+		if err != nil {
+			return jwt.VerificationKey{}, err
+		}
+
+		return jwt.VerificationKey{Alg: alg, Public: public}, nil
+	})
+	if err != nil {
+		if errors.Is(err, jwt.ErrInvalidToken) {
+			log.Warn("invalid client assertion", sl.Err(err))
+			return models.App{}, ErrInvalidClientCredentials
+		}
+		log.Error("failed to verify client assertion", sl.Err(err))
+		return models.App{}, err
+	}
+
+	if time.Until(assertion.ExpiresAt) > maxClientAssertionTTL {
+		log.Warn("client assertion lives too long", slog.Time("expires_at", assertion.ExpiresAt))
+		return models.App{}, ErrInvalidClientCredentials
+	}
+
+	if err := a.clientAssertionStore.UseClientAssertion(ctx, app.ID, assertion.ID, assertion.ExpiresAt); err != nil {
+		if errors.Is(err, storage.ErrClientAssertionUsed) {
+			log.Warn("client assertion replay detected", slog.Int("app_id", app.ID))
+			return models.App{}, ErrInvalidClientCredentials
+		}
+		log.Error("failed to save client assertion", sl.Err(err))
+		return models.App{}, err
+	}
+
+	return app, nil
+}
+
+// clientApp возвращает включенное приложение по client_id
+func (a *Auth) clientApp(ctx context.Context, log *slog.Logger, clientID string) (models.App, error) {
+	appID, err := strconv.Atoi(clientID)
+	if err != nil {
+		log.Warn("invalid client_id")
+		return models.App{}, ErrInvalidClientCredentials
+	}
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found")
+			return models.App{}, ErrInvalidClientCredentials
+		}
+		log.Error("failed to get app", sl.Err(err))
+		return models.App{}, err
+	}
+	if !app.Enabled {
+		log.Warn("app is disabled")
+		return models.App{}, ErrInvalidClientCredentials
+	}
+
+	return app, nil
+}
+
+// clientScope проверяет запрошенные права по выданным приложению. Пустой запрос получает все выданные права
+func clientScope(app models.App, requested string) (string, error) {
+	if requested == "" {
+		return strings.Join(app.Scopes, " "), nil
+	}
+
+	var granted []string
+	for _, scope := range strings.Fields(requested) {
+		if !slices.Contains(app.Scopes, scope) {
+			return "", fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+		if !slices.Contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+
+	return strings.Join(granted, " "), nil
+}
@@ -0,0 +1,469 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/opaque"
+	"sso/internal/storage"
+)
+
+// user_code вводят руками: только согласные без похожих друг на друга букв (RFC 8628, раздел 6.1).
+// 20^8 вариантов хватает, пока перебор ограничен временем жизни кода и счетчиком неверных кодов (UserCodeLimiter)
+const (
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLen      = 8
+
+	// На сколько увеличивается interval после slow_down (RFC 8628, раздел 3.5)
+	slowDownStep = 5 * time.Second
+
+	// Сколько раз пробуем выбрать user_code, если сгенерированный уже занят
+	userCodeAttempts = 3
+)
+
+// Коды ошибок /token для device_code (RFC 8628, раздел 3.5)
+const (
+	OAuthAuthorizationPending = "authorization_pending"
+	OAuthSlowDown             = "slow_down"
+	OAuthExpiredToken         = "expired_token"
+)
+
+// DeviceCodeStore хранит коды входа устройств, ожидающие подтверждения пользователем
+type DeviceCodeStore interface {
+	SaveDeviceCode(ctx context.Context, code models.DeviceCode) error
+	DeviceCode(ctx context.Context, deviceCodeHash string) (models.DeviceCode, error)
+	DeviceCodeByUserCode(ctx context.Context, userCode string) (models.DeviceCode, error)
+	ApproveDeviceCode(ctx context.Context, userCode string, userID int64, authTime time.Time) error
+	DenyDeviceCode(ctx context.Context, userCode string) error
+	TouchDeviceCode(ctx context.Context, deviceCodeHash string, polledAt time.Time, interval time.Duration) error
+	DeleteDeviceCode(ctx context.Context, deviceCodeHash string) error
+}
+
+// UserCodeLimiter считает неверные user_code по IP адресу, чтобы коды нельзя было перебирать:
+// Allow тратит попытку, Wait сообщает, через сколько появится следующая, не тратя ее
+type UserCodeLimiter interface {
+	Allow(key string) (bool, time.Duration)
+	Wait(key string) time.Duration
+}
+
+// ErrInvalidUserCode - user_code не найден, истек или уже подтвержден либо отклонен
+var ErrInvalidUserCode = errors.New("invalid user code")
+
+// StartDeviceAuthorization начинает вход устройства (/device_authorization, RFC 8628, раздел 3.1).
+// Устройство показывает пользователю user_code и адрес страницы /device, а само спрашивает /token с device_code,
+// пока пользователь не подтвердит или не отклонит вход
+func (a *Auth) StartDeviceAuthorization(ctx context.Context, clientID string, clientSecret string, scope string) (models.DeviceAuthorization, error) {
+	const op = "auth.StartDeviceAuthorization"
+
+	log := a.log.With(slog.String("op", op), slog.String("client_id", clientID))
+
+	app, err := a.authenticateClient(ctx, log, clientID, clientSecret)
+	if err != nil {
+		return models.DeviceAuthorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !app.AllowsGrant(models.GrantDeviceCode) {
+		log.Warn("device_code grant is not allowed for app")
+		return models.DeviceAuthorization{}, fmt.Errorf("%s: %w", op, &OAuthError{OAuthUnauthorizedClient, "device_code grant is not allowed"})
+	}
+
+	deviceCode, err := opaque.New()
+	if err != nil {
+		return models.DeviceAuthorization{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	code := models.DeviceCode{
+		DeviceCodeHash: opaque.Hash(deviceCode),
+		AppID:          app.ID,
+		Scope:          grantedScope(scope),
+		Interval:       a.deviceCodeInterval,
+		ExpiresAt:      time.Now().Add(a.deviceCodeTTL),
+	}
+
+	// user_code короткий, поэтому изредка совпадает с кодом, который еще ждет подтверждения
+	for attempt := 1; ; attempt++ {
+		code.UserCode, err = newUserCode()
+		if err != nil {
+			return models.DeviceAuthorization{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		err = a.deviceCodeStore.SaveDeviceCode(ctx, code)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, storage.ErrDeviceCodeExists) || attempt == userCodeAttempts {
+			log.Error("failed to save device code", sl.Err(err))
+			return models.DeviceAuthorization{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	log.Info("device authorization started")
+
+	return models.DeviceAuthorization{
+		DeviceCode: deviceCode,
+		UserCode:   formatUserCode(code.UserCode),
+		ExpiresIn:  a.deviceCodeTTL,
+		Interval:   a.deviceCodeInterval,
+	}, nil
+}
+
+// DeviceVerification проверяет user_code, введенный на странице /device, и возвращает приложение,
+// чтобы пользователь видел, какому приложению разрешает вход
+func (a *Auth) DeviceVerification(ctx context.Context, userCode string, ip string) (models.App, error) {
+	const op = "auth.DeviceVerification"
+
+	log := a.log.With(slog.String("op", op))
+
+	_, app, err := a.pendingDeviceCode(ctx, log, userCode, ip)
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return app, nil
+}
+
+// ApproveDevice проверяет email и пароль, введенные на странице /device, и разрешает вход устройству.
+// Если у пользователя включен второй фактор, возвращает mfaToken, вход завершает ApproveDeviceMFA
+func (a *Auth) ApproveDevice(ctx context.Context, userCode string, email string, password string, ip string) (mfaToken string, err error) {
+	const op = "auth.ApproveDevice"
+
+	mfaToken, err = a.decideDevice(ctx, a.log.With(slog.String("op", op)), userCode, email, password, ip, true)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return mfaToken, nil
+}
+
+// ApproveDeviceMFA завершает подтверждение устройства кодом второго фактора
+func (a *Auth) ApproveDeviceMFA(ctx context.Context, userCode string, mfaToken string, totpCode string, recoveryCode string, ip string) error {
+	const op = "auth.ApproveDeviceMFA"
+
+	if err := a.decideDeviceMFA(ctx, a.log.With(slog.String("op", op)), userCode, mfaToken, totpCode, recoveryCode, ip, true); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DenyDevice отклоняет вход устройства: следующий запрос устройства к /token получит access_denied.
+// Отказать может только владелец аккаунта, поэтому вход проверяется так же, как в ApproveDevice:
+// иначе любой, кто узнал или подобрал user_code, мог бы сорвать чужой вход
+func (a *Auth) DenyDevice(ctx context.Context, userCode string, email string, password string, ip string) (mfaToken string, err error) {
+	const op = "auth.DenyDevice"
+
+	mfaToken, err = a.decideDevice(ctx, a.log.With(slog.String("op", op)), userCode, email, password, ip, false)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return mfaToken, nil
+}
+
+// DenyDeviceMFA завершает отказ устройству кодом второго фактора
+func (a *Auth) DenyDeviceMFA(ctx context.Context, userCode string, mfaToken string, totpCode string, recoveryCode string, ip string) error {
+	const op = "auth.DenyDeviceMFA"
+
+	if err := a.decideDeviceMFA(ctx, a.log.With(slog.String("op", op)), userCode, mfaToken, totpCode, recoveryCode, ip, false); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ExchangeDeviceCode выдает токены устройству по /token (grant_type=urn:ietf:params:oauth:grant-type:device_code).
+//
+// Пока пользователь не подтвердил вход, возвращает authorization_pending, а если устройство спрашивает
+// чаще interval - slow_down, и interval для этого кода увеличивается на 5 секунд.
+// Токены по коду выдаются один раз, после этого код удаляется
+func (a *Auth) ExchangeDeviceCode(ctx context.Context, clientID string, clientSecret string, deviceCode string) (models.TokenPair, error) {
+	const op = "auth.ExchangeDeviceCode"
+
+	log := a.log.With(slog.String("op", op), slog.String("client_id", clientID))
+
+	app, err := a.authenticateClient(ctx, log, clientID, clientSecret)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !app.AllowsGrant(models.GrantDeviceCode) {
+		log.Warn("device_code grant is not allowed for app")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, &OAuthError{OAuthUnauthorizedClient, "device_code grant is not allowed"})
+	}
+	if deviceCode == "" {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, &OAuthError{OAuthInvalidRequest, "device_code is required"})
+	}
+
+	invalidGrant := &OAuthError{OAuthInvalidGrant, "invalid device code"}
+	deviceCodeHash := opaque.Hash(deviceCode)
+
+	code, err := a.deviceCodeStore.DeviceCode(ctx, deviceCodeHash)
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			log.Warn("device code not found")
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, invalidGrant)
+		}
+		log.Error("failed to get device code", sl.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if code.AppID != app.ID {
+		log.Warn("device code issued to another app")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, invalidGrant)
+	}
+	if time.Now().After(code.ExpiresAt) {
+		log.Info("device code expired")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, &OAuthError{OAuthExpiredToken, "the device code has expired"})
+	}
+
+	switch code.Status {
+	case models.DeviceCodePending:
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, a.pollDeviceCode(ctx, log, code))
+	case models.DeviceCodeDenied:
+		if err := a.deviceCodeStore.DeleteDeviceCode(ctx, deviceCodeHash); err != nil && !errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			log.Error("failed to delete device code", sl.Err(err))
+		}
+		log.Info("device authorization denied by user")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, &OAuthError{OAuthAccessDenied, "the user denied access"})
+	}
+
+	// Код подтвержден. Удаление - отметка, что токены выданы: из двух одновременных запросов их получит один
+	if err := a.deviceCodeStore.DeleteDeviceCode(ctx, deviceCodeHash); err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			log.Warn("device code already exchanged")
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, invalidGrant)
+		}
+		log.Error("failed to delete device code", sl.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("user_id", code.UserID))
+
+	user, err := a.userProvider.UserByID(ctx, code.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, invalidGrant)
+		}
+		log.Error("failed to get user", sl.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	// Пока устройство ждало, пользователя могли отключить
+	if user.Disabled || user.PasswordResetRequired {
+		log.Warn("user can not get tokens", slog.Bool("disabled", user.Disabled))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, invalidGrant)
+	}
+
+	familyID, err := opaque.New()
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	tokens, err := a.issueTokensInFamily(ctx, log, user, app, familyID, code.Scope)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if hasScope(code.Scope, models.ScopeOpenID) {
+		tokens.IDToken, err = a.newIDToken(ctx, log, user, app, code.Scope, "", code.AuthTime, tokens.AccessToken)
+		if err != nil {
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	log.Info("device code exchanged")
+
+	return tokens, nil
+}
+
+// pollDeviceCode отвечает устройству, которое спрашивает о еще не подтвержденном коде, и запоминает время запроса
+func (a *Auth) pollDeviceCode(ctx context.Context, log *slog.Logger, code models.DeviceCode) error {
+	now := time.Now()
+
+	interval := code.Interval
+	tooFast := !code.LastPolledAt.IsZero() && now.Sub(code.LastPolledAt) < code.Interval
+	if tooFast {
+		interval += slowDownStep
+	}
+
+	if err := a.deviceCodeStore.TouchDeviceCode(ctx, code.DeviceCodeHash, now, interval); err != nil {
+		log.Error("failed to update device code", sl.Err(err))
+		return err
+	}
+
+	if tooFast {
+		log.Info("device polls too fast", slog.Duration("interval", interval))
+		return &OAuthError{OAuthSlowDown, fmt.Sprintf("poll at most every %d seconds", int(interval.Seconds()))}
+	}
+
+	return &OAuthError{OAuthAuthorizationPending, "the user has not approved the device yet"}
+}
+
+// pendingDeviceCode находит код, ожидающий подтверждения, по введенному пользователем user_code, и его приложение.
+// Неверные коды считаются по ip (адрес клиента): когда попытки кончаются, возвращает LockedError
+func (a *Auth) pendingDeviceCode(ctx context.Context, log *slog.Logger, userCode string, ip string) (models.DeviceCode, models.App, error) {
+	if retryAfter := a.userCodeLimiter.Wait(ip); retryAfter > 0 {
+		log.Warn("too many invalid user codes", slog.Duration("retry_after", retryAfter))
+		return models.DeviceCode{}, models.App{}, &LockedError{RetryAfter: retryAfter}
+	}
+
+	code, err := a.deviceCodeStore.DeviceCodeByUserCode(ctx, normalizeUserCode(userCode))
+	if err != nil {
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			log.Warn("device code not found")
+			a.userCodeLimiter.Allow(ip)
+			return models.DeviceCode{}, models.App{}, ErrInvalidUserCode
+		}
+		log.Error("failed to get device code", sl.Err(err))
+		return models.DeviceCode{}, models.App{}, err
+	}
+	if code.Status != models.DeviceCodePending || time.Now().After(code.ExpiresAt) {
+		log.Info("device code is not pending", slog.String("status", code.Status))
+		a.userCodeLimiter.Allow(ip)
+		return models.DeviceCode{}, models.App{}, ErrInvalidUserCode
+	}
+
+	app, err := a.appProvider.App(ctx, code.AppID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found", slog.Int("app_id", code.AppID))
+			return models.DeviceCode{}, models.App{}, ErrInvalidUserCode
+		}
+		log.Error("failed to get app", sl.Err(err))
+		return models.DeviceCode{}, models.App{}, err
+	}
+	if !app.Enabled {
+		log.Warn("app is disabled", slog.Int("app_id", code.AppID))
+		return models.DeviceCode{}, models.App{}, ErrInvalidUserCode
+	}
+
+	return code, app, nil
+}
+
+// decideDevice проверяет код с устройства, email и пароль и разрешает (allow) или отклоняет вход устройства.
+// Если у пользователя включен второй фактор, возвращает mfaToken, решение принимает decideDeviceMFA
+func (a *Auth) decideDevice(ctx context.Context, log *slog.Logger, userCode string, email string, password string, ip string, allow bool) (mfaToken string, err error) {
+	code, app, err := a.pendingDeviceCode(ctx, log, userCode, ip)
+	if err != nil {
+		return "", err
+	}
+
+	log = log.With(slog.Int("app_id", app.ID))
+
+	user, err := a.checkPassword(ctx, log, email, password, ip)
+	if err != nil {
+		return "", err
+	}
+
+	log = log.With(slog.Int64("user_id", user.ID))
+
+	mfaToken, err = a.requireSecondFactor(ctx, log, user, app)
+	if err != nil {
+		return "", err
+	}
+	if mfaToken != "" {
+		return mfaToken, nil
+	}
+
+	return "", a.decideDeviceCode(ctx, log, code, user, allow)
+}
+
+// decideDeviceMFA проверяет код второго фактора и разрешает (allow) или отклоняет вход устройства
+func (a *Auth) decideDeviceMFA(ctx context.Context, log *slog.Logger, userCode string, mfaToken string, totpCode string, recoveryCode string, ip string, allow bool) error {
+	code, app, err := a.pendingDeviceCode(ctx, log, userCode, ip)
+	if err != nil {
+		return err
+	}
+
+	log = log.With(slog.Int("app_id", app.ID))
+
+	challenge, user, err := a.passSecondFactor(ctx, log, mfaToken, totpCode, recoveryCode, ip)
+	if err != nil {
+		return err
+	}
+	// Токен входа получен для другого приложения
+	if challenge.AppID != app.ID {
+		log.Warn("mfa challenge belongs to another app", slog.Int("challenge_app_id", challenge.AppID))
+		return ErrInvalidMFAToken
+	}
+
+	return a.decideDeviceCode(ctx, log, code, user, allow)
+}
+
+func (a *Auth) decideDeviceCode(ctx context.Context, log *slog.Logger, code models.DeviceCode, user models.User, allow bool) error {
+	if allow {
+		return a.approveDeviceCode(ctx, log, code, user)
+	}
+
+	return a.denyDeviceCode(ctx, log, code)
+}
+
+func (a *Auth) approveDeviceCode(ctx context.Context, log *slog.Logger, code models.DeviceCode, user models.User) error {
+	if err := a.deviceCodeStore.ApproveDeviceCode(ctx, code.UserCode, user.ID, time.Now()); err != nil {
+		// Пока пользователь вводил пароль, код истек или его отклонили в другой вкладке
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			log.Warn("device code is no longer pending")
+			return ErrInvalidUserCode
+		}
+		log.Error("failed to approve device code", sl.Err(err))
+		return err
+	}
+
+	log.Info("device authorization approved")
+
+	return nil
+}
+
+func (a *Auth) denyDeviceCode(ctx context.Context, log *slog.Logger, code models.DeviceCode) error {
+	if err := a.deviceCodeStore.DenyDeviceCode(ctx, code.UserCode); err != nil {
+		// Пока пользователь вводил пароль, код истек или его подтвердили в другой вкладке
+		if errors.Is(err, storage.ErrDeviceCodeNotFound) {
+			log.Warn("device code is no longer pending")
+			return ErrInvalidUserCode
+		}
+		log.Error("failed to deny device code", sl.Err(err))
+		return err
+	}
+
+	log.Info("device authorization denied")
+
+	return nil
+}
+
+// newUserCode возвращает случайный user_code из userCodeAlphabet
+func newUserCode() (string, error) {
+	alphabetLen := big.NewInt(int64(len(userCodeAlphabet)))
+
+	var b strings.Builder
+	for range userCodeLen {
+		n, err := rand.Int(rand.Reader, alphabetLen)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+
+	return b.String(), nil
+}
+
+// formatUserCode разбивает user_code дефисом на две половины, так его проще прочитать и ввести: BCDF-GHJK
+func formatUserCode(userCode string) string {
+	return userCode[:userCodeLen/2] + "-" + userCode[userCodeLen/2:]
+}
+
+// normalizeUserCode приводит введенный пользователем код к виду, в котором он хранится:
+// регистр, дефисы и пробелы не важны
+func normalizeUserCode(userCode string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(userCode))
+}
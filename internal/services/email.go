@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/mail"
+	"sso/internal/lib/opaque"
+	"sso/internal/storage"
+)
+
+// EmailVerificationStore хранит токены подтверждения email. Сам токен знает только пользователь, в БД - его хэш
+type EmailVerificationStore interface {
+	SaveEmailVerificationToken(ctx context.Context, token models.EmailVerificationToken) error
+	VerifyEmail(ctx context.Context, tokenHash string, now time.Time) (userID int64, err error)
+}
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid email verification token")
+	ErrEmailNotVerified         = errors.New("email is not verified")
+)
+
+// VerifyEmail подтверждает email по токену из письма, отправленного при регистрации. Токен можно использовать только один раз
+func (a *Auth) VerifyEmail(ctx context.Context, token string) error {
+	const op = "auth.VerifyEmail"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("Verifying email")
+
+	userID, err := a.emailVerificationStore.VerifyEmail(ctx, opaque.Hash(token), time.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrEmailVerificationTokenNotFound) {
+			log.Warn("email verification token not found or expired")
+			return fmt.Errorf("%s: %w", op, ErrInvalidVerificationToken)
+		}
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+			return fmt.Errorf("%s: %w", op, ErrInvalidVerificationToken)
+		}
+		log.Error("failed to verify email", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Email verified", slog.Int64("user_id", userID))
+
+	return nil
+}
+
+// sendVerificationEmail выпускает токен подтверждения email и отправляет его пользователю
+func (a *Auth) sendVerificationEmail(ctx context.Context, userID int64, email string) error {
+	token, err := opaque.New()
+	if err != nil {
+		return err
+	}
+
+	err = a.emailVerificationStore.SaveEmailVerificationToken(ctx, models.EmailVerificationToken{
+		TokenHash: opaque.Hash(token),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(a.emailVerificationTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	return a.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Confirm your email",
+		Body: fmt.Sprintf(
+			"Thanks for signing up! Confirm your email with this token.\r\n\r\nVerification token: %s\r\n\r\nThe token expires in %s. If it wasn't you, ignore this email.\r\n",
+			token, a.emailVerificationTTL,
+		),
+	})
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/jwt"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+)
+
+// ImpersonationStore ведет журнал входов администраторов от имени пользователей
+type ImpersonationStore interface {
+	SaveImpersonation(ctx context.Context, imp models.Impersonation) (int64, error)
+}
+
+// ErrImpersonationDenied - войти от имени пользователя нельзя: у владельца токена нет прав администратора,
+// токен сам получен через TokenExchange или пользователь - администратор
+var ErrImpersonationDenied = errors.New("impersonation is not allowed")
+
+// TokenExchange выдает администратору access токен пользователя userID в приложении appID (RFC 8693),
+// чтобы поддержка могла увидеть приложение глазами пользователя.
+//
+// actorToken - access токен администратора из приложения администраторов, проверяется как в AuthenticateAdmin. В выданном токене
+// claim act называет администратора, токен живет не дольше impersonationTTL, refresh токена нет.
+// Каждый вход с reason записывается в журнал
+func (a *Auth) TokenExchange(ctx context.Context, actorToken string, userID int64, appID int, reason string) (models.TokenPair, error) {
+	const op = "auth.TokenExchange"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID), slog.Int("app_id", appID))
+
+	// Администратора проверяем так же, как сервис Admin: иначе токен, выпущенный секретом HS256 любого приложения,
+	// открыл бы вход от имени его пользователей, а в журнал попал бы настоящий администратор
+	info, err := a.AuthenticateAdmin(ctx, actorToken)
+	if err != nil {
+		if errors.Is(err, ErrNotAdmin) {
+			log.Warn("actor is not admin")
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrImpersonationDenied)
+		}
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("actor_id", info.UserID))
+
+	// Цепочки не допускаем: в act всегда тот, кто вошел сам
+	if info.ActorID != 0 {
+		log.Warn("actor token is an impersonation token", slog.Int64("original_actor_id", info.ActorID))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrImpersonationDenied)
+	}
+
+	user, err := a.userProvider.UserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		log.Error("failed to get user", sl.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	// Токен отключенного пользователя Introspect все равно не примет
+	if user.Disabled {
+		log.Warn("user is disabled")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrUserDisabled)
+	}
+	// Поддержка действует от имени клиентов, войти от имени другого администратора значило бы получить его права
+	if user.IsAdmin {
+		log.Warn("user is admin")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrImpersonationDenied)
+	}
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found")
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidAppID)
+		}
+		log.Error("failed to get app", sl.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !app.Enabled {
+		log.Warn("app is disabled")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrAppDisabled)
+	}
+
+	extra, err := a.accessTokenExtra(ctx, log, user, app, "")
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	extra.Act = &jwt.Actor{Subject: strconv.FormatInt(info.UserID, 10)}
+
+	ttl := min(app.AccessTTL(a.tokenTTL), a.impersonationTTL)
+
+	token, err := a.signAccessToken(ctx, log, user, app, ttl, extra)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Без записи в журнале токен не отдаем
+	now := time.Now()
+	id, err := a.impersonationStore.SaveImpersonation(ctx, models.Impersonation{
+		ActorID:   info.UserID,
+		UserID:    user.ID,
+		AppID:     app.ID,
+		Reason:    reason,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		log.Error("failed to save impersonation", sl.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Warn("impersonation token issued", slog.Int64("impersonation_id", id), slog.Duration("ttl", ttl))
+
+	return models.TokenPair{AccessToken: token, ExpiresIn: ttl}, nil
+}
+
+// actorActive проверяет администратора из claim act: токен, полученный через TokenExchange,
+// перестает действовать, как только администратора отключили или лишили прав
+func (a *Auth) actorActive(ctx context.Context, log *slog.Logger, act *jwt.Actor) (actorID int64, active bool, err error) {
+	actorID, err = strconv.ParseInt(act.Subject, 10, 64)
+	if err != nil {
+		log.Warn("invalid act claim")
+		return 0, false, nil
+	}
+
+	actor, err := a.userProvider.UserByID(ctx, actorID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Info("token actor not found")
+			return actorID, false, nil
+		}
+		log.Error("failed to get token actor", sl.Err(err))
+		return 0, false, err
+	}
+	if actor.Disabled || !actor.IsAdmin {
+		log.Info("token actor is disabled or no longer admin", slog.Int64("actor_id", actorID))
+		return actorID, false, nil
+	}
+
+	return actorID, true, nil
+}
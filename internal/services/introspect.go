@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/jwt"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+)
+
+// IntrospectToken - Introspect для приложений. Отвечает только приложению appID, подтвердившему, что это оно,
+// секретом или client_assertion, как в ClientLogin (RFC 7662, раздел 2.1): иначе кто угодно мог бы узнать,
+// действует ли украденный токен, и прочитать его поля
+func (a *Auth) IntrospectToken(ctx context.Context, appID int, clientSecret string, clientAssertion string, token string) (models.TokenInfo, error) {
+	const op = "auth.IntrospectToken"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", appID))
+
+	if _, err := a.authenticateConfidentialClient(ctx, log, strconv.Itoa(appID), clientSecret, clientAssertion); err != nil {
+		return models.TokenInfo{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	info, err := a.Introspect(ctx, token)
+	if err != nil {
+		return models.TokenInfo{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return info, nil
+}
+
+// Introspect проверяет токен доступа и возвращает информацию о нем (RFC 7662).
+//
+// Невалидный токен - это не ошибка, а ответ с Active: false, ошибку возвращаем только если сами не смогли проверить токен.
+func (a *Auth) Introspect(ctx context.Context, token string) (models.TokenInfo, error) {
+	const op = "auth.Introspect"
+
+	log := a.log.With(slog.String("op", op))
+
+	claims, err := a.parseAccessToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, jwt.ErrInvalidToken) {
+			log.Info("token is not active", sl.Err(err))
+			return models.TokenInfo{Active: false}, nil
+		}
+		log.Error("failed to parse token", sl.Err(err))
+		return models.TokenInfo{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Токены, выпущенные до появления jti, отозвать нельзя
+	if claims.ID != "" {
+		revoked, err := a.tokenRevoker.IsRevoked(ctx, claims.ID)
+		if err != nil {
+			log.Error("failed to check revocation", sl.Err(err))
+			return models.TokenInfo{}, fmt.Errorf("%s: %w", op, err)
+		}
+		if revoked {
+			log.Info("token is revoked")
+			return models.TokenInfo{Active: false, Revoked: true}, nil
+		}
+	}
+
+	info := models.TokenInfo{
+		Active:    true,
+		UserID:    claims.UID,
+		Subject:   claims.Subject,
+		Email:     claims.Email,
+		AppID:     claims.AppID,
+		ExpiresAt: claims.ExpiresAt.Time,
+		IssuedAt:  jwt.Time(claims.IssuedAt),
+		NotBefore: jwt.Time(claims.NotBefore),
+		Issuer:    claims.Issuer,
+		Audience:  claims.Audience,
+		TokenID:   claims.ID,
+		Scope:     claims.Scope,
+	}
+
+	// У токена приложения нет пользователя, а приложение уже проверено вместе с подписью
+	if claims.IsClientToken() {
+		return info, nil
+	}
+
+	// Токены отключенного или удаленного пользователя не принимаем, даже если они еще не протухли
+	user, err := a.userProvider.UserByID(ctx, claims.UID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Info("token user not found")
+			return models.TokenInfo{Active: false}, nil
+		}
+		log.Error("failed to get user", sl.Err(err))
+		return models.TokenInfo{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if user.Disabled {
+		log.Info("token user is disabled")
+		return models.TokenInfo{Active: false}, nil
+	}
+	// Смена или сброс пароля завершает все сессии, в том числе выданные до нее access токены
+	if !user.PasswordChangedAt.IsZero() && jwt.Time(claims.IssuedAt).Before(user.PasswordChangedAt) {
+		log.Info("token was issued before password change")
+		return models.TokenInfo{Active: false}, nil
+	}
+
+	if claims.Act != nil {
+		actorID, active, err := a.actorActive(ctx, log, claims.Act)
+		if err != nil {
+			return models.TokenInfo{}, fmt.Errorf("%s: %w", op, err)
+		}
+		if !active {
+			return models.TokenInfo{Active: false}, nil
+		}
+		info.ActorID = actorID
+	}
+
+	return info, nil
+}
+
+// parseAccessToken проверяет access токен, выпущенный нашим сервисом
+func (a *Auth) parseAccessToken(ctx context.Context, token string) (jwt.Claims, error) {
+	return jwt.ParseToken(token, a.issuer, func(appID int, kid string) (jwt.VerificationKey, error) {
+		return a.verificationKey(ctx, appID, kid)
+	})
+}
+
+// verificationKey ищет ключ проверки подписи так же, как Login ищет ключ подписи: через приложение из токена
+func (a *Auth) verificationKey(ctx context.Context, appID int, kid string) (jwt.VerificationKey, error) {
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return jwt.VerificationKey{}, fmt.Errorf("%w: %w", jwt.ErrInvalidToken, err)
+		}
+		return jwt.VerificationKey{}, err
+	}
+	// Токены отключенного приложения не принимаем
+	if !app.Enabled {
+		return jwt.VerificationKey{}, fmt.Errorf("%w: app is disabled", jwt.ErrInvalidToken)
+	}
+
+	key, err := a.keyProvider.VerificationKey(ctx, app, kid)
+	if err != nil {
+		if errors.Is(err, storage.ErrSigningKeyNotFound) {
+			return jwt.VerificationKey{}, fmt.Errorf("%w: %w", jwt.ErrInvalidToken, err)
+		}
+		return jwt.VerificationKey{}, err
+	}
+
+	return key, nil
+}
@@ -0,0 +1,354 @@
+// Package keystore хранит и ротирует ключи, которыми подписываются токены, и публикует их публичную часть в JWKS
+package keystore
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/jwks"
+	"sso/internal/lib/jwt"
+	"sso/internal/lib/keys"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+)
+
+type KeyStore struct {
+	log            *slog.Logger
+	keySaver       KeySaver
+	keyProvider    KeyProvider
+	appProvider    AppProvider
+	files          FileKeyProvider
+	rotationPeriod time.Duration
+	tokenTTL       time.Duration
+
+	// Защищает генерацию ключей, чтобы два одновременных логина не создали приложению два активных ключа
+	mu sync.Mutex
+	// Распарсенные приватные ключи по kid, чтобы не разбирать PEM на каждый токен
+	cacheMu sync.RWMutex
+	cache   map[string]crypto.Signer
+}
+
+type KeySaver interface {
+	SaveSigningKey(ctx context.Context, key models.SigningKey) error
+	RotateSigningKeys(ctx context.Context, appID int, next models.SigningKey, retiredUntil time.Time) error
+	DeleteExpiredSigningKeys(ctx context.Context) (int64, error)
+}
+
+type KeyProvider interface {
+	SigningKeys(ctx context.Context, appID int) ([]models.SigningKey, error)
+}
+
+type AppProvider interface {
+	AsymmetricApps(ctx context.Context) ([]models.App, error)
+}
+
+// FileKeyProvider отдает ключи, на которые приложение ссылается в колонке apps.signing_key.
+// Такие ключи сервис не ротирует, это делает тот, кто кладет их в keys_path
+type FileKeyProvider interface {
+	PrivateKey(ref string) (crypto.Signer, error)
+}
+
+// New возвращает хранилище ключей.
+// rotationPeriod - сколько ключ подписывает токены до ротации,
+// tokenTTL - сколько по умолчанию живут подписанные им токены, если у приложения не задан свой TTL.
+func New(
+	log *slog.Logger,
+	keySaver KeySaver,
+	keyProvider KeyProvider,
+	appProvider AppProvider,
+	files FileKeyProvider,
+	rotationPeriod time.Duration,
+	tokenTTL time.Duration,
+) *KeyStore {
+	return &KeyStore{
+		log:            log,
+		keySaver:       keySaver,
+		keyProvider:    keyProvider,
+		appProvider:    appProvider,
+		files:          files,
+		rotationPeriod: rotationPeriod,
+		tokenTTL:       tokenTTL,
+		cache:          make(map[string]crypto.Signer),
+	}
+}
+
+// SigningKey возвращает ключ, которым сейчас подписываются токены приложения.
+//
+// HS256 приложения подписывают токены общим секретом, приложения со ссылкой на файл - ключом из файла,
+// остальным ключи генерирует и ротирует сам сервис.
+func (k *KeyStore) SigningKey(ctx context.Context, app models.App) (jwt.Key, error) {
+	const op = "keystore.SigningKey"
+
+	if app.SigningAlg == "" || app.SigningAlg == jwt.AlgHS256 {
+		return jwt.Key{Alg: jwt.AlgHS256, Private: []byte(app.Secret)}, nil
+	}
+
+	if !jwt.IsAsymmetric(app.SigningAlg) {
+		return jwt.Key{}, fmt.Errorf("%s: %w: %s", op, jwt.ErrUnsupportedAlg, app.SigningAlg)
+	}
+
+	if app.SigningKey != "" {
+		private, kid, err := k.fileKey(app.SigningKey)
+		if err != nil {
+			return jwt.Key{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return jwt.Key{ID: kid, Alg: app.SigningAlg, Private: private}, nil
+	}
+
+	active, err := k.activeKey(ctx, app)
+	if err != nil {
+		return jwt.Key{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	private, err := k.parse(active)
+	if err != nil {
+		return jwt.Key{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return jwt.Key{ID: active.ID, Alg: active.Alg, Private: private}, nil
+}
+
+// VerificationKey возвращает ключ, которым проверяется подпись токена приложения с указанным kid.
+// Подходит любой опубликованный ключ, токены подписанные retired ключом тоже должны проходить проверку
+func (k *KeyStore) VerificationKey(ctx context.Context, app models.App, kid string) (jwt.VerificationKey, error) {
+	const op = "keystore.VerificationKey"
+
+	if app.SigningAlg == "" || app.SigningAlg == jwt.AlgHS256 {
+		return jwt.VerificationKey{Alg: jwt.AlgHS256, Public: []byte(app.Secret)}, nil
+	}
+
+	if app.SigningKey != "" {
+		private, fileKid, err := k.fileKey(app.SigningKey)
+		if err != nil {
+			return jwt.VerificationKey{}, fmt.Errorf("%s: %w", op, err)
+		}
+		if kid != fileKid {
+			return jwt.VerificationKey{}, fmt.Errorf("%s: %w", op, storage.ErrSigningKeyNotFound)
+		}
+
+		return jwt.VerificationKey{Alg: app.SigningAlg, Public: private.Public()}, nil
+	}
+
+	signingKeys, err := k.keyProvider.SigningKeys(ctx, app.ID)
+	if err != nil {
+		return jwt.VerificationKey{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, key := range signingKeys {
+		if key.ID != kid {
+			continue
+		}
+
+		private, err := k.parse(key)
+		if err != nil {
+			return jwt.VerificationKey{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		return jwt.VerificationKey{Alg: key.Alg, Public: private.Public()}, nil
+	}
+
+	return jwt.VerificationKey{}, fmt.Errorf("%s: %w", op, storage.ErrSigningKeyNotFound)
+}
+
+// JWKS возвращает публичные ключи приложения, если appID равен 0 - ключи всех приложений.
+// Публикуются next, active и retired ключи, чтобы проверяющие заранее знали следующий ключ и могли проверить старые токены
+func (k *KeyStore) JWKS(ctx context.Context, appID int) (jwks.Set, error) {
+	const op = "keystore.JWKS"
+
+	apps, err := k.appProvider.AsymmetricApps(ctx)
+	if err != nil {
+		return jwks.Set{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	set := jwks.Set{Keys: []jwks.Key{}}
+	for _, app := range apps {
+		if appID != 0 && app.ID != appID {
+			continue
+		}
+
+		if app.SigningKey != "" {
+			private, kid, err := k.fileKey(app.SigningKey)
+			if err != nil {
+				// Один битый ключ не должен ломать публикацию остальных
+				k.log.Error("failed to load app key", slog.String("op", op), slog.Int("app_id", app.ID), sl.Err(err))
+				continue
+			}
+
+			jwk, err := jwks.FromPublicKey(kid, app.SigningAlg, private.Public())
+			if err != nil {
+				return jwks.Set{}, fmt.Errorf("%s: %w", op, err)
+			}
+			set.Keys = append(set.Keys, jwk)
+
+			continue
+		}
+
+		signingKeys, err := k.keyProvider.SigningKeys(ctx, app.ID)
+		if err != nil {
+			return jwks.Set{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		for _, key := range signingKeys {
+			private, err := k.parse(key)
+			if err != nil {
+				return jwks.Set{}, fmt.Errorf("%s: %w", op, err)
+			}
+
+			jwk, err := jwks.FromPublicKey(key.ID, key.Alg, private.Public())
+			if err != nil {
+				return jwks.Set{}, fmt.Errorf("%s: %w", op, err)
+			}
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+
+	return set, nil
+}
+
+// Rotate выводит из работы активный ключ приложения, делает активным next ключ и генерирует новый next.
+func (k *KeyStore) Rotate(ctx context.Context, app models.App) error {
+	const op = "keystore.Rotate"
+
+	log := k.log.With(slog.String("op", op), slog.Int("app_id", app.ID))
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	next, err := newSigningKey(app, models.SigningKeyNext)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Старый ключ публикуем, пока не протухнут все токены, которые он успел подписать.
+	// TTL приложения могли поменять, поэтому берем наибольший из его TTL и TTL по умолчанию
+	ttl := max(k.tokenTTL, app.AccessTTL(k.tokenTTL))
+	if err := k.keySaver.RotateSigningKeys(ctx, app.ID, next, time.Now().Add(ttl)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Signing key rotated", slog.String("next_kid", next.ID))
+
+	return nil
+}
+
+// activeKey возвращает активный ключ приложения, при первом обращении генерирует приложению active и next ключи
+func (k *KeyStore) activeKey(ctx context.Context, app models.App) (models.SigningKey, error) {
+	if key, ok, err := k.findActive(ctx, app.ID); err != nil || ok {
+		return key, err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	// Пока ждали блокировку, ключи мог создать параллельный запрос
+	if key, ok, err := k.findActive(ctx, app.ID); err != nil || ok {
+		return key, err
+	}
+
+	active, err := newSigningKey(app, models.SigningKeyActive)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	next, err := newSigningKey(app, models.SigningKeyNext)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	for _, key := range []models.SigningKey{active, next} {
+		if err := k.keySaver.SaveSigningKey(ctx, key); err != nil {
+			return models.SigningKey{}, err
+		}
+	}
+
+	k.log.Info("Signing keys generated", slog.Int("app_id", app.ID), slog.String("kid", active.ID))
+
+	return active, nil
+}
+
+func (k *KeyStore) findActive(ctx context.Context, appID int) (models.SigningKey, bool, error) {
+	signingKeys, err := k.keyProvider.SigningKeys(ctx, appID)
+	if err != nil {
+		return models.SigningKey{}, false, err
+	}
+
+	for _, key := range signingKeys {
+		if key.Status == models.SigningKeyActive {
+			return key, true, nil
+		}
+	}
+
+	return models.SigningKey{}, false, nil
+}
+
+func (k *KeyStore) fileKey(ref string) (crypto.Signer, string, error) {
+	private, err := k.files.PrivateKey(ref)
+	if err != nil {
+		return nil, "", err
+	}
+
+	kid, err := jwks.Thumbprint(private.Public())
+	if err != nil {
+		return nil, "", err
+	}
+
+	return private, kid, nil
+}
+
+func (k *KeyStore) parse(key models.SigningKey) (crypto.Signer, error) {
+	k.cacheMu.RLock()
+	private, ok := k.cache[key.ID]
+	k.cacheMu.RUnlock()
+	if ok {
+		return private, nil
+	}
+
+	private, err := keys.ParsePrivateKey(key.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	k.cacheMu.Lock()
+	k.cache[key.ID] = private
+	k.cacheMu.Unlock()
+
+	return private, nil
+}
+
+func newSigningKey(app models.App, status string) (models.SigningKey, error) {
+	private, err := keys.Generate(app.SigningAlg)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	pem, err := keys.EncodePrivateKey(private)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	kid, err := jwks.Thumbprint(private.Public())
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	now := time.Now()
+	key := models.SigningKey{
+		ID:         kid,
+		AppID:      app.ID,
+		Alg:        app.SigningAlg,
+		PrivateKey: pem,
+		Status:     status,
+		CreatedAt:  now,
+	}
+	if status == models.SigningKeyActive {
+		key.ActivatedAt = now
+	}
+
+	return key, nil
+}
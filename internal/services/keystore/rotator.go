@@ -0,0 +1,101 @@
+package keystore
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"sso/internal/lib/logger/sl"
+)
+
+// Rotator по расписанию ротирует ключи приложений и удаляет retired ключи, которые больше не нужны
+type Rotator struct {
+	log      *slog.Logger
+	store    *KeyStore
+	interval time.Duration
+	done     chan struct{}
+}
+
+// NewRotator возвращает планировщик ротации, interval - как часто проверять возраст ключей.
+func NewRotator(log *slog.Logger, store *KeyStore, interval time.Duration) *Rotator {
+	return &Rotator{
+		log:      log,
+		store:    store,
+		interval: interval,
+		done:     make(chan struct{}),
+	}
+}
+
+// Run блокируется до вызова Stop, поэтому запускаем его в отдельной горутине
+func (r *Rotator) Run() {
+	const op = "keystore.Rotator.Run"
+
+	r.log.With(slog.String("op", op)).Info("Key rotation is running", slog.Duration("interval", r.interval))
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.check()
+
+		select {
+		case <-ticker.C:
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (r *Rotator) Stop() {
+	const op = "keystore.Rotator.Stop"
+
+	r.log.With(slog.String("op", op)).Info("Stopping key rotation")
+
+	close(r.done)
+}
+
+func (r *Rotator) check() {
+	const op = "keystore.Rotator.check"
+
+	log := r.log.With(slog.String("op", op))
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+	defer cancel()
+
+	apps, err := r.store.appProvider.AsymmetricApps(ctx)
+	if err != nil {
+		log.Error("failed to get apps", sl.Err(err))
+		return
+	}
+
+	for _, app := range apps {
+		// Ключами из файлов управляет тот, кто их туда положил
+		if app.SigningKey != "" {
+			continue
+		}
+
+		// Заодно создаем ключи приложениям, которые еще ни разу не выдавали токены, чтобы next ключ попал в JWKS заранее
+		active, err := r.store.activeKey(ctx, app)
+		if err != nil {
+			log.Error("failed to get active key", slog.Int("app_id", app.ID), sl.Err(err))
+			continue
+		}
+
+		if time.Since(active.ActivatedAt) < r.store.rotationPeriod {
+			continue
+		}
+
+		if err := r.store.Rotate(ctx, app); err != nil {
+			log.Error("failed to rotate key", slog.Int("app_id", app.ID), sl.Err(err))
+		}
+	}
+
+	deleted, err := r.store.keySaver.DeleteExpiredSigningKeys(ctx)
+	if err != nil {
+		log.Error("failed to delete expired keys", sl.Err(err))
+		return
+	}
+	if deleted > 0 {
+		log.Info("Expired signing keys deleted", slog.Int64("count", deleted))
+	}
+}
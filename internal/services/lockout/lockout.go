@@ -0,0 +1,154 @@
+// Package lockout защищает вход по паролю от перебора: считает неудачные попытки
+// по учетной записи и по IP адресу, замедляет повторные попытки и временно блокирует вход
+package lockout
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+)
+
+// Policy - настройки блокировки
+type Policy struct {
+	MaxFailures   int           // После стольких неудач подряд учетная запись блокируется на LockDuration
+	IPMaxFailures int           // То же для IP адреса, порог выше: за одним адресом может быть много пользователей
+	Window        time.Duration // Неудачи, между которыми прошло больше Window, не складываются
+	LockDuration  time.Duration
+	BaseDelay     time.Duration // Задержка после первой неудачи, после каждой следующей удваивается
+}
+
+// Guard хранит счетчики в БД, чтобы перезапуск сервиса не обнулял блокировки
+type Guard struct {
+	log     *slog.Logger
+	storage Storage
+	policy  Policy
+}
+
+type Storage interface {
+	LoginFailures(ctx context.Context, subject string) (models.LoginFailures, error)
+	RecordLoginFailure(ctx context.Context, subject string, failedAt time.Time, resetBefore time.Time) error
+	ResetLoginFailures(ctx context.Context, subject string) error
+}
+
+// New возвращает защиту от перебора паролей.
+func New(log *slog.Logger, storage Storage, policy Policy) *Guard {
+	return &Guard{
+		log:     log,
+		storage: storage,
+		policy:  policy,
+	}
+}
+
+// Blocked возвращает, сколько еще ждать до следующей попытки входа. Ноль - пробовать можно сейчас
+func (g *Guard) Blocked(ctx context.Context, email string, ip string) (time.Duration, error) {
+	const op = "lockout.Blocked"
+
+	now := time.Now()
+
+	account, err := g.storage.LoginFailures(ctx, accountSubject(email))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	until := g.accountBlockedUntil(account, now)
+
+	if ip != "" {
+		source, err := g.storage.LoginFailures(ctx, ipSubject(ip))
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		if ipUntil := g.ipBlockedUntil(source); ipUntil.After(until) {
+			until = ipUntil
+		}
+	}
+
+	if !until.After(now) {
+		return 0, nil
+	}
+
+	return until.Sub(now), nil
+}
+
+// LoginFailed засчитывает неудачную попытку учетной записи и IP адресу
+func (g *Guard) LoginFailed(ctx context.Context, email string, ip string) error {
+	const op = "lockout.LoginFailed"
+
+	now := time.Now()
+	resetBefore := now.Add(-g.policy.Window)
+
+	if err := g.storage.RecordLoginFailure(ctx, accountSubject(email), now, resetBefore); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if ip != "" {
+		if err := g.storage.RecordLoginFailure(ctx, ipSubject(ip), now, resetBefore); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+// LoginSucceeded сбрасывает счетчик учетной записи. Счетчик IP не сбрасываем,
+// иначе перебор чужих паролей можно было бы разбавлять входами в свою учетную запись
+func (g *Guard) LoginSucceeded(ctx context.Context, email string) error {
+	const op = "lockout.LoginSucceeded"
+
+	if err := g.storage.ResetLoginFailures(ctx, accountSubject(email)); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Unlock снимает блокировку с учетной записи, вызывает администратор
+func (g *Guard) Unlock(ctx context.Context, email string) error {
+	const op = "lockout.Unlock"
+
+	if err := g.storage.ResetLoginFailures(ctx, accountSubject(email)); err != nil {
+		g.log.Error("failed to unlock account", slog.String("op", op), sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (g *Guard) accountBlockedUntil(failures models.LoginFailures, now time.Time) time.Time {
+	if failures.Count == 0 {
+		return time.Time{}
+	}
+	if failures.Count >= g.policy.MaxFailures {
+		return failures.LastFailedAt.Add(g.policy.LockDuration)
+	}
+	if g.policy.BaseDelay == 0 || failures.LastFailedAt.Before(now.Add(-g.policy.Window)) {
+		return time.Time{}
+	}
+
+	// Задержка растет вдвое с каждой неудачей, но не дольше самой блокировки
+	delay := g.policy.BaseDelay
+	for i := 1; i < failures.Count && delay < g.policy.LockDuration; i++ {
+		delay *= 2
+	}
+	delay = min(delay, g.policy.LockDuration)
+
+	return failures.LastFailedAt.Add(delay)
+}
+
+func (g *Guard) ipBlockedUntil(failures models.LoginFailures) time.Time {
+	if failures.Count < g.policy.IPMaxFailures {
+		return time.Time{}
+	}
+
+	return failures.LastFailedAt.Add(g.policy.LockDuration)
+}
+
+func accountSubject(email string) string {
+	return "email:" + email
+}
+
+func ipSubject(ip string) string {
+	return "ip:" + ip
+}
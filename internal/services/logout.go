@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/jwt"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/opaque"
+	"sso/internal/storage"
+)
+
+// ErrForeignToken - приложение пытается отозвать токен, выданный другому приложению
+var ErrForeignToken = errors.New("token was issued to another app")
+
+// Типы токенов для подсказки в RevokeToken (RFC 7009)
+const (
+	TokenTypeAccessToken  = "access_token"
+	TokenTypeRefreshToken = "refresh_token"
+)
+
+// Logout отзывает access токен пользователя и, если он передан, refresh токен вместе со всем его семейством.
+func (a *Auth) Logout(ctx context.Context, accessToken string, refreshToken string) error {
+	const op = "auth.Logout"
+
+	log := a.log.With(slog.String("op", op))
+
+	claims, err := a.parseAccessToken(ctx, accessToken)
+	if err != nil {
+		if errors.Is(err, jwt.ErrInvalidToken) {
+			log.Info("invalid access token", sl.Err(err))
+			return fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+		log.Error("failed to parse token", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("user_id", claims.UID))
+	log.Info("Logging out user")
+
+	if refreshToken != "" {
+		rt, err := a.refreshTokenProvider.RefreshToken(ctx, opaque.Hash(refreshToken))
+		if err != nil {
+			if errors.Is(err, storage.ErrRefreshTokenNotFound) {
+				log.Warn("refresh token not found")
+				return fmt.Errorf("%s: %w", op, ErrInvalidRefreshToken)
+			}
+			log.Error("failed to get refresh token", sl.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		// Чужой refresh токен разлогинить нельзя
+		if rt.UserID != claims.UID {
+			log.Warn("refresh token belongs to another user")
+			return fmt.Errorf("%s: %w", op, ErrInvalidRefreshToken)
+		}
+
+		if err := a.revokeRefreshToken(ctx, rt); err != nil {
+			log.Error("failed to revoke refresh token", sl.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := a.revokeAccessToken(ctx, claims); err != nil {
+		log.Error("failed to revoke access token", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("User logged out")
+
+	return nil
+}
+
+// RevokeToken отзывает access или refresh токен (RFC 7009), tokenTypeHint подсказывает с какого типа начать поиск.
+//
+// Приложение appID подтверждает, что это оно, секретом или client_assertion (публичное - только appID)
+// и может отозвать только выданный ему токен, иначе ErrForeignToken.
+// Как требует RFC 7009, неизвестный или уже невалидный токен - не ошибка: отзывать в нем нечего.
+func (a *Auth) RevokeToken(ctx context.Context, appID int, clientSecret string, clientAssertion string, token string, tokenTypeHint string) error {
+	const op = "auth.RevokeToken"
+
+	log := a.log.With(slog.String("op", op), slog.Int("app_id", appID), slog.String("token_type_hint", tokenTypeHint))
+
+	app, err := a.authenticatePublicOrConfidentialClient(ctx, log, strconv.Itoa(appID), clientSecret, clientAssertion)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if tokenTypeHint != TokenTypeRefreshToken {
+		claims, err := a.parseAccessToken(ctx, token)
+		if err == nil {
+			if claims.AppID != app.ID {
+				log.Warn("access token belongs to another app", slog.Int("token_app_id", claims.AppID))
+				return fmt.Errorf("%s: %w", op, ErrForeignToken)
+			}
+			if err := a.revokeAccessToken(ctx, claims); err != nil {
+				log.Error("failed to revoke access token", sl.Err(err))
+				return fmt.Errorf("%s: %w", op, err)
+			}
+
+			log.Info("Access token revoked", slog.Int64("user_id", claims.UID))
+
+			return nil
+		}
+		if !errors.Is(err, jwt.ErrInvalidToken) {
+			log.Error("failed to parse token", sl.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	rt, err := a.refreshTokenProvider.RefreshToken(ctx, opaque.Hash(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrRefreshTokenNotFound) {
+			log.Info("token not found, nothing to revoke")
+			return nil
+		}
+		log.Error("failed to get refresh token", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if rt.AppID != app.ID {
+		log.Warn("refresh token belongs to another app", slog.Int("token_app_id", rt.AppID))
+		return fmt.Errorf("%s: %w", op, ErrForeignToken)
+	}
+
+	if err := a.revokeRefreshToken(ctx, rt); err != nil {
+		log.Error("failed to revoke refresh token", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Refresh token revoked", slog.Int64("user_id", rt.UserID))
+
+	return nil
+}
+
+func (a *Auth) revokeAccessToken(ctx context.Context, claims jwt.Claims) error {
+	// Без jti токен отозвать нельзя, остается дождаться пока он протухнет
+	if claims.ID == "" {
+		return nil
+	}
+
+	return a.tokenRevoker.Revoke(ctx, claims.ID, claims.ExpiresAt.Time)
+}
+
+// revokeRefreshToken отзывает все семейство: токены, полученные ротацией, выданы той же сессии
+func (a *Auth) revokeRefreshToken(ctx context.Context, rt models.RefreshToken) error {
+	ttl := a.refreshTokenTTL
+
+	app, err := a.appProvider.App(ctx, rt.AppID)
+	if err != nil && !errors.Is(err, storage.ErrAppNotFound) {
+		return err
+	}
+	// Без приложения семейство уже не обменять, но запись в denylist все равно оставляем
+	if err == nil {
+		ttl = app.RefreshTTL(ttl)
+	}
+
+	// Новые токены семейства выдаются с TTL приложения от текущего момента, позже этого срока ни один из них не проживет
+	return a.tokenRevoker.Revoke(ctx, rt.FamilyID, time.Now().Add(ttl))
+}
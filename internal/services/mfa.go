@@ -0,0 +1,471 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/opaque"
+	"sso/internal/lib/totp"
+	"sso/internal/storage"
+)
+
+const (
+	recoveryCodeCount = 10
+	recoveryCodeSize  = 10 // 80 бит, в виде xxxx-xxxx-xxxx-xxxx
+)
+
+// MFAStore хранит TOTP секреты, коды восстановления и входы, которые ждут второй фактор
+type MFAStore interface {
+	SaveMFASecret(ctx context.Context, userID int64, secret string) error
+	MFA(ctx context.Context, userID int64) (models.MFA, error)
+	ConfirmMFA(ctx context.Context, userID int64, step int64, recoveryCodeHashes []string, confirmedAt time.Time) error
+	UseMFAStep(ctx context.Context, userID int64, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string, usedAt time.Time) error
+	DeleteMFA(ctx context.Context, userID int64) error
+	SaveMFAChallenge(ctx context.Context, challenge models.MFAChallenge) error
+	MFAChallenge(ctx context.Context, tokenHash string) (models.MFAChallenge, error)
+	RecordMFAChallengeFailure(ctx context.Context, tokenHash string) (attempts int, err error)
+	DeleteMFAChallenge(ctx context.Context, tokenHash string) error
+}
+
+// MFAPolicy - настройки второго фактора
+type MFAPolicy struct {
+	Issuer       string        // Название сервиса, которое покажет приложение-аутентификатор
+	ChallengeTTL time.Duration // Сколько после пароля ждать код
+	MaxAttempts  int           // Сколько неверных кодов можно ввести за один вход, потом вход начинается заново с пароля
+	Skew         int           // Сколько соседних 30-секундных шагов принимать, часы телефона могут спешить или отставать
+}
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("mfa is already enabled")
+	ErrMFANotEnabled     = errors.New("mfa is not enabled")
+	ErrInvalidMFACode    = errors.New("invalid mfa code")
+	ErrInvalidMFAToken   = errors.New("invalid mfa token")
+)
+
+// EnrollTOTP начинает подключение TOTP: генерирует секрет и otpauth:// ссылку для QR кода.
+// Второй фактор заработает только после ConfirmTOTP, до этого повторный вызов заменяет секрет
+func (a *Auth) EnrollTOTP(ctx context.Context, accessToken string) (secret string, uri string, err error) {
+	const op = "auth.EnrollTOTP"
+
+	log := a.log.With(slog.String("op", op))
+
+	user, err := a.authenticate(ctx, log, accessToken)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("user_id", user.ID))
+	log.Info("Enrolling TOTP")
+
+	secret, err = totp.NewSecret()
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.mfaStore.SaveMFASecret(ctx, user.ID, secret); err != nil {
+		if errors.Is(err, storage.ErrMFAExists) {
+			log.Warn("mfa is already enabled")
+			return "", "", fmt.Errorf("%s: %w", op, ErrMFAAlreadyEnabled)
+		}
+		log.Error("failed to save mfa secret", sl.Err(err))
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return secret, totp.URI(a.mfaPolicy.Issuer, user.Email, secret), nil
+}
+
+// ConfirmTOTP включает второй фактор, если пользователь ввел верный код из приложения.
+// Возвращает коды восстановления: они показываются один раз, в БД лежат только их хэши
+func (a *Auth) ConfirmTOTP(ctx context.Context, accessToken string, code string) (recoveryCodes []string, err error) {
+	const op = "auth.ConfirmTOTP"
+
+	log := a.log.With(slog.String("op", op))
+
+	user, err := a.authenticate(ctx, log, accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("user_id", user.ID))
+	log.Info("Confirming TOTP")
+
+	mfa, err := a.mfaStore.MFA(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, storage.ErrMFANotFound) {
+			log.Warn("totp enrollment not found")
+			return nil, fmt.Errorf("%s: %w", op, ErrMFANotEnabled)
+		}
+		log.Error("failed to get mfa", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if mfa.Enabled() {
+		log.Warn("mfa is already enabled")
+		return nil, fmt.Errorf("%s: %w", op, ErrMFAAlreadyEnabled)
+	}
+
+	step, ok, err := totp.Validate(mfa.Secret, code, time.Now(), a.mfaPolicy.Skew)
+	if err != nil {
+		log.Error("failed to validate totp code", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if !ok {
+		log.Info("invalid totp code")
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidMFACode)
+	}
+
+	recoveryCodes = make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		recoveryCodes = append(recoveryCodes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	// Код подтверждения уже использован, повторно войти с ним нельзя
+	if err := a.mfaStore.ConfirmMFA(ctx, user.ID, step, hashes, time.Now()); err != nil {
+		if errors.Is(err, storage.ErrMFANotFound) {
+			log.Warn("totp enrollment not found")
+			return nil, fmt.Errorf("%s: %w", op, ErrMFANotEnabled)
+		}
+		log.Error("failed to confirm mfa", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("TOTP enabled")
+
+	return recoveryCodes, nil
+}
+
+// DisableTOTP выключает второй фактор. Одного access токена мало, нужен еще код из приложения или код восстановления.
+// Неверные коды считаются как неудачные попытки входа, иначе с украденным токеном можно было бы перебирать коды здесь
+func (a *Auth) DisableTOTP(ctx context.Context, accessToken string, code string, recoveryCode string, ip string) error {
+	const op = "auth.DisableTOTP"
+
+	log := a.log.With(slog.String("op", op))
+
+	user, err := a.authenticate(ctx, log, accessToken)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("user_id", user.ID))
+	log.Info("Disabling TOTP")
+
+	mfa, err := a.mfaStore.MFA(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, storage.ErrMFANotFound) {
+			log.Warn("mfa is not enabled")
+			return fmt.Errorf("%s: %w", op, ErrMFANotEnabled)
+		}
+		log.Error("failed to get mfa", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Неподтвержденный секрет вход не защищает, его можно удалить без кода
+	if mfa.Enabled() {
+		retryAfter, err := a.loginGuard.Blocked(ctx, user.Email, ip)
+		if err != nil {
+			log.Error("failed to check login failures", sl.Err(err))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if retryAfter > 0 {
+			log.Warn("login is temporarily locked", slog.String("ip", ip), slog.Duration("retry_after", retryAfter))
+			return fmt.Errorf("%s: %w", op, &LockedError{RetryAfter: retryAfter})
+		}
+
+		if err := a.verifySecondFactor(ctx, log, mfa, code, recoveryCode); err != nil {
+			if errors.Is(err, ErrInvalidMFACode) {
+				a.loginFailed(ctx, log, user.Email, ip)
+			}
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := a.mfaStore.DeleteMFA(ctx, user.ID); err != nil {
+		log.Error("failed to delete mfa", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("TOTP disabled")
+
+	return nil
+}
+
+// VerifyMFA завершает вход пользователя со вторым фактором: принимает токен, который вернул Login, и код из приложения
+// или код восстановления. Неверные коды считаются как неудачные попытки входа, а после MaxAttempts вход нужно начинать заново
+func (a *Auth) VerifyMFA(ctx context.Context, mfaToken string, code string, recoveryCode string, ip string) (models.TokenPair, error) {
+	const op = "auth.VerifyMFA"
+
+	log := a.log.With(slog.String("op", op))
+
+	challenge, user, err := a.passSecondFactor(ctx, log, mfaToken, code, recoveryCode, ip)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Пока пользователь вводил код, приложение могли выключить
+	app, err := a.appProvider.App(ctx, challenge.AppID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found", sl.Err(err))
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidAppID)
+		}
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !app.Enabled {
+		log.Warn("app is disabled")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrAppDisabled)
+	}
+
+	log.Info("User logged in successfully")
+
+	tokens, err := a.issueTokens(ctx, log, user, app)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tokens, nil
+}
+
+// passSecondFactor проверяет код второго фактора по токену входа из Login и возвращает вход и пользователя.
+// Токен входа одноразовый: после верного кода он удаляется
+func (a *Auth) passSecondFactor(
+	ctx context.Context,
+	log *slog.Logger,
+	mfaToken string,
+	code string,
+	recoveryCode string,
+	ip string,
+) (models.MFAChallenge, models.User, error) {
+	tokenHash := opaque.Hash(mfaToken)
+
+	challenge, err := a.mfaStore.MFAChallenge(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, storage.ErrMFAChallengeNotFound) {
+			log.Warn("mfa challenge not found")
+			return models.MFAChallenge{}, models.User{}, ErrInvalidMFAToken
+		}
+		log.Error("failed to get mfa challenge", sl.Err(err))
+		return models.MFAChallenge{}, models.User{}, err
+	}
+	if time.Now().After(challenge.ExpiresAt) {
+		log.Warn("mfa challenge expired")
+		return models.MFAChallenge{}, models.User{}, ErrInvalidMFAToken
+	}
+
+	log.Info("Verifying second factor", slog.Int64("user_id", challenge.UserID))
+
+	user, err := a.userProvider.UserByID(ctx, challenge.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+			return models.MFAChallenge{}, models.User{}, ErrInvalidMFAToken
+		}
+		log.Error("failed to get user", sl.Err(err))
+		return models.MFAChallenge{}, models.User{}, err
+	}
+
+	retryAfter, err := a.loginGuard.Blocked(ctx, user.Email, ip)
+	if err != nil {
+		log.Error("failed to check login failures", sl.Err(err))
+		return models.MFAChallenge{}, models.User{}, err
+	}
+	if retryAfter > 0 {
+		log.Warn("login is temporarily locked", slog.String("ip", ip), slog.Duration("retry_after", retryAfter))
+		return models.MFAChallenge{}, models.User{}, &LockedError{RetryAfter: retryAfter}
+	}
+
+	mfa, err := a.mfaStore.MFA(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, storage.ErrMFANotFound) {
+			// Второй фактор выключили, пока шел вход
+			log.Warn("mfa is not enabled")
+			return models.MFAChallenge{}, models.User{}, ErrInvalidMFAToken
+		}
+		log.Error("failed to get mfa", sl.Err(err))
+		return models.MFAChallenge{}, models.User{}, err
+	}
+
+	if err := a.verifySecondFactor(ctx, log, mfa, code, recoveryCode); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			a.loginFailed(ctx, log, user.Email, ip)
+			a.mfaChallengeFailed(ctx, log, tokenHash)
+		}
+		return models.MFAChallenge{}, models.User{}, err
+	}
+
+	// Токен входа одноразовый: удаляем его до выдачи токенов, второй запрос с ним получит ошибку
+	if err := a.mfaStore.DeleteMFAChallenge(ctx, tokenHash); err != nil {
+		if errors.Is(err, storage.ErrMFAChallengeNotFound) {
+			log.Warn("mfa challenge is already used")
+			return models.MFAChallenge{}, models.User{}, ErrInvalidMFAToken
+		}
+		log.Error("failed to delete mfa challenge", sl.Err(err))
+		return models.MFAChallenge{}, models.User{}, err
+	}
+
+	if err := a.loginGuard.LoginSucceeded(ctx, user.Email); err != nil {
+		log.Error("failed to reset login failures", sl.Err(err))
+	}
+
+	// Пока пользователь вводил код, его могли отключить
+	if user.Disabled {
+		log.Warn("user is disabled")
+		return models.MFAChallenge{}, models.User{}, ErrUserDisabled
+	}
+
+	return challenge, user, nil
+}
+
+// requireSecondFactor начинает вход со вторым фактором, если он включен у пользователя, и возвращает токен входа.
+// Пустой токен - второй фактор не нужен
+func (a *Auth) requireSecondFactor(ctx context.Context, log *slog.Logger, user models.User, app models.App) (string, error) {
+	mfa, err := a.mfaStore.MFA(ctx, user.ID)
+	if err != nil && !errors.Is(err, storage.ErrMFANotFound) {
+		log.Error("failed to get mfa", sl.Err(err))
+		return "", err
+	}
+	if !mfa.Enabled() {
+		return "", nil
+	}
+
+	log.Info("second factor required")
+
+	return a.newMFAChallenge(ctx, log, user, app)
+}
+
+// newMFAChallenge начинает вход со вторым фактором: пароль проверен, токены выдаст VerifyMFA по возвращенному токену
+func (a *Auth) newMFAChallenge(ctx context.Context, log *slog.Logger, user models.User, app models.App) (string, error) {
+	token, err := opaque.New()
+	if err != nil {
+		return "", err
+	}
+
+	err = a.mfaStore.SaveMFAChallenge(ctx, models.MFAChallenge{
+		TokenHash: opaque.Hash(token),
+		UserID:    user.ID,
+		AppID:     app.ID,
+		ExpiresAt: time.Now().Add(a.mfaPolicy.ChallengeTTL),
+	})
+	if err != nil {
+		log.Error("failed to save mfa challenge", sl.Err(err))
+		return "", err
+	}
+
+	return token, nil
+}
+
+// verifySecondFactor проверяет код из приложения или, если его нет, код восстановления. Каждый код принимается один раз
+func (a *Auth) verifySecondFactor(ctx context.Context, log *slog.Logger, mfa models.MFA, code string, recoveryCode string) error {
+	if code != "" {
+		step, ok, err := totp.Validate(mfa.Secret, code, time.Now(), a.mfaPolicy.Skew)
+		if err != nil {
+			log.Error("failed to validate totp code", sl.Err(err))
+			return err
+		}
+		if !ok {
+			log.Info("invalid totp code")
+			return ErrInvalidMFACode
+		}
+
+		if err := a.mfaStore.UseMFAStep(ctx, mfa.UserID, step); err != nil {
+			if errors.Is(err, storage.ErrMFACodeReused) {
+				log.Warn("totp code is already used")
+				return ErrInvalidMFACode
+			}
+			log.Error("failed to save used totp step", sl.Err(err))
+			return err
+		}
+
+		return nil
+	}
+
+	if err := a.mfaStore.UseRecoveryCode(ctx, mfa.UserID, hashRecoveryCode(recoveryCode), time.Now()); err != nil {
+		if errors.Is(err, storage.ErrRecoveryCodeNotFound) {
+			log.Info("invalid recovery code")
+			return ErrInvalidMFACode
+		}
+		log.Error("failed to use recovery code", sl.Err(err))
+		return err
+	}
+
+	log.Info("recovery code used")
+
+	return nil
+}
+
+// mfaChallengeFailed считает неверный код. После MaxAttempts токен входа удаляется, и перебирать коды дальше
+// можно только заново вводя пароль. Ошибку только логируем: клиенту в любом случае уходит ErrInvalidMFACode
+func (a *Auth) mfaChallengeFailed(ctx context.Context, log *slog.Logger, tokenHash string) {
+	attempts, err := a.mfaStore.RecordMFAChallengeFailure(ctx, tokenHash)
+	if err != nil {
+		log.Error("failed to record mfa failure", sl.Err(err))
+		return
+	}
+	if attempts < a.mfaPolicy.MaxAttempts {
+		return
+	}
+
+	log.Warn("too many invalid mfa codes, challenge is deleted")
+	if err := a.mfaStore.DeleteMFAChallenge(ctx, tokenHash); err != nil && !errors.Is(err, storage.ErrMFAChallengeNotFound) {
+		log.Error("failed to delete mfa challenge", sl.Err(err))
+	}
+}
+
+// authenticate возвращает владельца access токена. Токен проверяется так же, как в Introspect: подпись, срок, отзыв
+func (a *Auth) authenticate(ctx context.Context, log *slog.Logger, accessToken string) (models.User, error) {
+	info, err := a.Introspect(ctx, accessToken)
+	if err != nil {
+		return models.User{}, err
+	}
+	if !info.Active {
+		log.Info("access token is not active")
+		return models.User{}, ErrInvalidToken
+	}
+	// Администратор, вошедший от имени пользователя, не должен менять его второй фактор и passkey
+	if info.ActorID != 0 {
+		log.Warn("impersonation token can not manage credentials", slog.Int64("actor_id", info.ActorID))
+		return models.User{}, ErrInvalidToken
+	}
+
+	user, err := a.userProvider.UserByID(ctx, info.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.User{}, ErrInvalidToken
+		}
+		log.Error("failed to get user", sl.Err(err))
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+func newRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))
+
+	return code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16], nil
+}
+
+// hashRecoveryCode не учитывает регистр, дефисы и пробелы: код вводят руками
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+
+	return opaque.Hash(code)
+}
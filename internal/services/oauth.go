@@ -0,0 +1,432 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/opaque"
+	"sso/internal/storage"
+)
+
+// Допустимая длина code_verifier (RFC 7636, раздел 4.1). code_challenge S256 - всегда 43 символа base64url
+const (
+	minCodeVerifierLen = 43
+	maxCodeVerifierLen = 128
+	codeChallengeLen   = 43
+
+	codeChallengeS256 = "S256"
+
+	// nonce приложение генерирует само, длинные значения не храним
+	maxNonceLen = 255
+)
+
+// AuthorizationCodeStore хранит коды OAuth2 authorization_code
+type AuthorizationCodeStore interface {
+	SaveAuthorizationCode(ctx context.Context, code models.AuthorizationCode) error
+	UseAuthorizationCode(ctx context.Context, codeHash string, usedAt time.Time) (models.AuthorizationCode, error)
+}
+
+// Коды ошибок OAuth2 (RFC 6749, разделы 4.1.2.1 и 5.2)
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthUnauthorizedClient      = "unauthorized_client"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthAccessDenied            = "access_denied"
+	OAuthInvalidScope            = "invalid_scope"
+)
+
+// OAuthError - ошибка протокола OAuth2. Code уходит клиенту в поле error, Description - в error_description
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+var (
+	// ErrInvalidClient - client_id в /authorize неизвестен или приложение выключено. Куда вернуть пользователя, неизвестно
+	ErrInvalidClient = errors.New("invalid client")
+	// ErrInvalidRedirectURI - redirect_uri не зарегистрирован у приложения, отправлять туда пользователя нельзя
+	ErrInvalidRedirectURI = errors.New("invalid redirect uri")
+)
+
+// ValidateAuthorizationRequest проверяет запрос к /authorize и возвращает приложение, чтобы показать его на странице входа.
+//
+// ErrInvalidClient и ErrInvalidRedirectURI показываются пользователю, остальные ошибки - *OAuthError,
+// их возвращают приложению на redirect_uri
+func (a *Auth) ValidateAuthorizationRequest(ctx context.Context, req models.AuthorizationRequest) (models.App, error) {
+	const op = "auth.ValidateAuthorizationRequest"
+
+	log := a.log.With(slog.String("op", op), slog.String("client_id", req.ClientID))
+
+	app, err := a.validateAuthorizationRequest(ctx, log, req)
+	if err != nil {
+		return models.App{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return app, nil
+}
+
+// Authorize проверяет email и пароль, введенные на странице входа, и возвращает код для redirect_uri.
+// Если у пользователя включен второй фактор, вместо кода возвращает mfaToken, вход завершает AuthorizeMFA
+func (a *Auth) Authorize(
+	ctx context.Context,
+	req models.AuthorizationRequest,
+	email string,
+	password string,
+	ip string,
+) (code string, mfaToken string, err error) {
+	const op = "auth.Authorize"
+
+	log := a.log.With(slog.String("op", op), slog.String("client_id", req.ClientID))
+
+	app, err := a.validateAuthorizationRequest(ctx, log, req)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := a.checkPassword(ctx, log, email, password, ip)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("user_id", user.ID))
+
+	mfaToken, err = a.requireSecondFactor(ctx, log, user, app)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+	if mfaToken != "" {
+		return "", mfaToken, nil
+	}
+
+	code, err = a.newAuthorizationCode(ctx, log, user, app, req)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("authorization code issued")
+
+	return code, "", nil
+}
+
+// AuthorizeMFA завершает вход на странице входа кодом второго фактора и возвращает код для redirect_uri
+func (a *Auth) AuthorizeMFA(
+	ctx context.Context,
+	req models.AuthorizationRequest,
+	mfaToken string,
+	totpCode string,
+	recoveryCode string,
+	ip string,
+) (string, error) {
+	const op = "auth.AuthorizeMFA"
+
+	log := a.log.With(slog.String("op", op), slog.String("client_id", req.ClientID))
+
+	app, err := a.validateAuthorizationRequest(ctx, log, req)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	challenge, user, err := a.passSecondFactor(ctx, log, mfaToken, totpCode, recoveryCode, ip)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+	// Токен входа получен для другого приложения
+	if challenge.AppID != app.ID {
+		log.Warn("mfa challenge belongs to another app", slog.Int("challenge_app_id", challenge.AppID))
+		return "", fmt.Errorf("%s: %w", op, ErrInvalidMFAToken)
+	}
+
+	code, err := a.newAuthorizationCode(ctx, log, user, app, req)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("authorization code issued", slog.Int64("user_id", user.ID))
+
+	return code, nil
+}
+
+// ExchangeAuthorizationCode обменивает код из /authorize на токены (grant_type=authorization_code).
+//
+// clientSecret можно не передавать: публичные клиенты (SPA, мобильные приложения) секрет хранить не могут,
+// код у них защищает PKCE. Переданный секрет проверяется.
+// Повторный обмен кода отзывает refresh токены, выданные по нему в первый раз
+func (a *Auth) ExchangeAuthorizationCode(
+	ctx context.Context,
+	clientID string,
+	clientSecret string,
+	code string,
+	redirectURI string,
+	codeVerifier string,
+) (models.TokenPair, error) {
+	const op = "auth.ExchangeAuthorizationCode"
+
+	log := a.log.With(slog.String("op", op), slog.String("client_id", clientID))
+
+	app, err := a.authenticateClient(ctx, log, clientID, clientSecret)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !app.AllowsGrant(models.GrantAuthorizationCode) {
+		log.Warn("authorization_code grant is not allowed for app")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, &OAuthError{OAuthUnauthorizedClient, "authorization_code grant is not allowed"})
+	}
+	if code == "" || codeVerifier == "" {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, &OAuthError{OAuthInvalidRequest, "code and code_verifier are required"})
+	}
+
+	invalidGrant := &OAuthError{OAuthInvalidGrant, "invalid or expired authorization code"}
+
+	ac, err := a.authorizationCodeStore.UseAuthorizationCode(ctx, opaque.Hash(code), time.Now())
+	if err != nil {
+		if errors.Is(err, storage.ErrAuthorizationCodeNotFound) {
+			log.Warn("authorization code not found")
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, invalidGrant)
+		}
+		if errors.Is(err, storage.ErrAuthorizationCodeUsed) {
+			// Код перехвачен: кто-то из двоих получил токены, отзываем их
+			log.Warn("authorization code reuse detected, revoking token family", slog.String("family_id", ac.FamilyID))
+			if err := a.refreshTokenSaver.RevokeRefreshTokenFamily(ctx, ac.FamilyID); err != nil {
+				log.Error("failed to revoke refresh token family", sl.Err(err))
+			}
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, invalidGrant)
+		}
+		log.Error("failed to use authorization code", sl.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("user_id", ac.UserID))
+
+	if ac.AppID != app.ID {
+		log.Warn("authorization code issued to another app")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, invalidGrant)
+	}
+	if time.Now().After(ac.ExpiresAt) {
+		log.Info("authorization code expired")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, invalidGrant)
+	}
+	if ac.RedirectURI != redirectURI {
+		log.Warn("redirect_uri mismatch")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, invalidGrant)
+	}
+	if !verifyCodeChallenge(codeVerifier, ac.CodeChallenge) {
+		log.Warn("invalid code_verifier")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, invalidGrant)
+	}
+
+	user, err := a.userProvider.UserByID(ctx, ac.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, invalidGrant)
+		}
+		log.Error("failed to get user", sl.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	// Пока код ждал обмена, пользователя могли отключить
+	if user.Disabled || user.PasswordResetRequired {
+		log.Warn("user can not get tokens", slog.Bool("disabled", user.Disabled))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, invalidGrant)
+	}
+
+	tokens, err := a.issueTokensInFamily(ctx, log, user, app, ac.FamilyID, ac.Scope)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if hasScope(ac.Scope, models.ScopeOpenID) {
+		tokens.IDToken, err = a.newIDToken(ctx, log, user, app, ac.Scope, ac.Nonce, ac.AuthTime, tokens.AccessToken)
+		if err != nil {
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	log.Info("authorization code exchanged")
+
+	return tokens, nil
+}
+
+// ExchangeRefreshToken обменивает refresh токен по /token (grant_type=refresh_token), как Refresh,
+// но только токен, выданный этому приложению
+func (a *Auth) ExchangeRefreshToken(ctx context.Context, clientID string, clientSecret string, refreshToken string) (models.TokenPair, error) {
+	const op = "auth.ExchangeRefreshToken"
+
+	log := a.log.With(slog.String("op", op), slog.String("client_id", clientID))
+
+	app, err := a.authenticateClient(ctx, log, clientID, clientSecret)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !app.AllowsGrant(models.GrantRefreshToken) {
+		log.Warn("refresh_token grant is not allowed for app")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, &OAuthError{OAuthUnauthorizedClient, "refresh_token grant is not allowed"})
+	}
+	if refreshToken == "" {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, &OAuthError{OAuthInvalidRequest, "refresh_token is required"})
+	}
+
+	tokens, err := a.refresh(ctx, log, refreshToken, app.ID)
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) {
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, &OAuthError{OAuthInvalidGrant, "invalid refresh token"})
+		}
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tokens, nil
+}
+
+func (a *Auth) validateAuthorizationRequest(ctx context.Context, log *slog.Logger, req models.AuthorizationRequest) (models.App, error) {
+	appID, err := strconv.Atoi(req.ClientID)
+	if err != nil {
+		log.Warn("invalid client_id")
+		return models.App{}, ErrInvalidClient
+	}
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found")
+			return models.App{}, ErrInvalidClient
+		}
+		log.Error("failed to get app", sl.Err(err))
+		return models.App{}, err
+	}
+	if !app.Enabled {
+		log.Warn("app is disabled")
+		return models.App{}, ErrInvalidClient
+	}
+
+	// Адрес сравнивается целиком: иначе код можно было бы увести на похожий адрес
+	if !slices.Contains(app.RedirectURIs, req.RedirectURI) {
+		log.Warn("redirect_uri is not registered", slog.String("redirect_uri", req.RedirectURI))
+		return models.App{}, ErrInvalidRedirectURI
+	}
+
+	// Дальше адрес проверен, и об ошибках сообщаем приложению
+	if req.ResponseType != "code" {
+		return models.App{}, &OAuthError{OAuthUnsupportedResponseType, "only response_type=code is supported"}
+	}
+	if !app.AllowsGrant(models.GrantAuthorizationCode) {
+		log.Warn("authorization_code grant is not allowed for app")
+		return models.App{}, &OAuthError{OAuthUnauthorizedClient, "authorization_code grant is not allowed"}
+	}
+	// PKCE обязателен для всех приложений, plain не принимаем: он не защищает от перехвата запроса
+	if req.CodeChallengeMethod != codeChallengeS256 {
+		return models.App{}, &OAuthError{OAuthInvalidRequest, "code_challenge_method must be S256"}
+	}
+	if _, err := base64.RawURLEncoding.DecodeString(req.CodeChallenge); err != nil || len(req.CodeChallenge) != codeChallengeLen {
+		return models.App{}, &OAuthError{OAuthInvalidRequest, "invalid code_challenge"}
+	}
+	if len(req.Nonce) > maxNonceLen {
+		return models.App{}, &OAuthError{OAuthInvalidRequest, "nonce is too long"}
+	}
+
+	return app, nil
+}
+
+// newAuthorizationCode сохраняет код для обмена на токены. Семейство refresh токенов выбирается сразу,
+// чтобы при повторном обмене знать, что отзывать. Из запрошенных прав сохраняются только известные нам
+func (a *Auth) newAuthorizationCode(
+	ctx context.Context,
+	log *slog.Logger,
+	user models.User,
+	app models.App,
+	req models.AuthorizationRequest,
+) (string, error) {
+	code, err := opaque.New()
+	if err != nil {
+		return "", err
+	}
+	familyID, err := opaque.New()
+	if err != nil {
+		return "", err
+	}
+
+	err = a.authorizationCodeStore.SaveAuthorizationCode(ctx, models.AuthorizationCode{
+		CodeHash:      opaque.Hash(code),
+		AppID:         app.ID,
+		UserID:        user.ID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         grantedScope(req.Scope),
+		CodeChallenge: req.CodeChallenge,
+		FamilyID:      familyID,
+		Nonce:         req.Nonce,
+		AuthTime:      time.Now(),
+		ExpiresAt:     time.Now().Add(a.authorizationCodeTTL),
+	})
+	if err != nil {
+		log.Error("failed to save authorization code", sl.Err(err))
+		return "", err
+	}
+
+	return code, nil
+}
+
+// authenticateClient находит приложение по client_id и проверяет секрет.
+// Без секрета пропускает только публичные приложения, им вместо секрета служит PKCE
+func (a *Auth) authenticateClient(ctx context.Context, log *slog.Logger, clientID string, clientSecret string) (models.App, error) {
+	invalidClient := &OAuthError{OAuthInvalidClient, "client authentication failed"}
+
+	appID, err := strconv.Atoi(clientID)
+	if err != nil {
+		log.Warn("invalid client_id")
+		return models.App{}, invalidClient
+	}
+
+	app, err := a.appProvider.App(ctx, appID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found")
+			return models.App{}, invalidClient
+		}
+		log.Error("failed to get app", sl.Err(err))
+		return models.App{}, err
+	}
+	if !app.Enabled {
+		log.Warn("app is disabled")
+		return models.App{}, invalidClient
+	}
+	if clientSecret == "" {
+		if !app.Public {
+			log.Warn("client secret is missing")
+			return models.App{}, invalidClient
+		}
+		return app, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(clientSecret), []byte(app.Secret)) != 1 {
+		log.Warn("invalid client secret")
+		return models.App{}, invalidClient
+	}
+
+	return app, nil
+}
+
+// verifyCodeChallenge проверяет PKCE: code_challenge = base64url(sha256(code_verifier))
+func verifyCodeChallenge(codeVerifier string, codeChallenge string) bool {
+	if len(codeVerifier) < minCodeVerifierLen || len(codeVerifier) > maxCodeVerifierLen {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(codeVerifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(codeChallenge)) == 1
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/jwt"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+)
+
+// supportedScopes - права, которые понимает сервис, в порядке, в котором они возвращаются в scope
+var supportedScopes = []string{models.ScopeOpenID, models.ScopeEmail, models.ScopeProfile}
+
+// ErrInsufficientScope - access токен выдан без scope openid, /userinfo с ним не работает
+var ErrInsufficientScope = errors.New("insufficient scope")
+
+// UserInfo возвращает данные владельца access токена для /userinfo (OpenID Connect Core, раздел 5.3).
+// Токен проверяется так же, как в Introspect, набор полей зависит от прав, с которыми он выдан
+func (a *Auth) UserInfo(ctx context.Context, accessToken string) (models.UserInfo, error) {
+	const op = "auth.UserInfo"
+
+	log := a.log.With(slog.String("op", op))
+
+	info, err := a.Introspect(ctx, accessToken)
+	if err != nil {
+		return models.UserInfo{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if !info.Active {
+		log.Info("access token is not active")
+		return models.UserInfo{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	// Токен приложения (client_credentials) выдан без пользователя
+	if info.UserID == 0 {
+		log.Info("access token has no user")
+		return models.UserInfo{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+	}
+
+	log = log.With(slog.Int64("user_id", info.UserID))
+
+	if !hasScope(info.Scope, models.ScopeOpenID) {
+		log.Info("access token has no openid scope")
+		return models.UserInfo{}, fmt.Errorf("%s: %w", op, ErrInsufficientScope)
+	}
+
+	// Данные берем из БД, а не из токена: email мог измениться или подтвердиться после входа
+	user, err := a.userProvider.UserByID(ctx, info.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return models.UserInfo{}, fmt.Errorf("%s: %w", op, ErrInvalidToken)
+		}
+		log.Error("failed to get user", sl.Err(err))
+		return models.UserInfo{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	userInfo := models.UserInfo{UserID: user.ID}
+	if hasScope(info.Scope, models.ScopeEmail) {
+		userInfo.Email = user.Email
+		userInfo.EmailVerified = user.EmailVerified
+	}
+	// Имени у пользователя нет, логином служит email
+	if hasScope(info.Scope, models.ScopeProfile) {
+		userInfo.PreferredUsername = user.Email
+	}
+
+	return userInfo, nil
+}
+
+// newIDToken подписывает id_token ключом приложения, тем же, что и access токен.
+// at_hash связывает id_token с выданным вместе с ним access токеном
+func (a *Auth) newIDToken(
+	ctx context.Context,
+	log *slog.Logger,
+	user models.User,
+	app models.App,
+	scope string,
+	nonce string,
+	authTime time.Time,
+	accessToken string,
+) (string, error) {
+	key, err := a.keyProvider.SigningKey(ctx, app)
+	if err != nil {
+		log.Error("failed to get signing key", sl.Err(err))
+		return "", err
+	}
+
+	atHash, err := jwt.AccessTokenHash(accessToken, key.Alg)
+	if err != nil {
+		log.Error("failed to hash access token", sl.Err(err))
+		return "", err
+	}
+
+	extra := jwt.IDExtra{
+		AuthTime: authTime,
+		Nonce:    nonce,
+		AtHash:   atHash,
+	}
+	if hasScope(scope, models.ScopeEmail) {
+		extra.Email = user.Email
+		extra.EmailVerified = &user.EmailVerified
+	}
+	if hasScope(scope, models.ScopeProfile) {
+		extra.PreferredUsername = user.Email
+	}
+
+	token, err := jwt.NewIDToken(user, app, key, a.issuer, app.AccessTTL(a.tokenTTL), extra)
+	if err != nil {
+		log.Error("failed to generate id token", sl.Err(err))
+		return "", err
+	}
+
+	return token, nil
+}
+
+// grantedScope оставляет из запрошенных прав только известные сервису, без повторов.
+// Неизвестные права OpenID Connect предписывает игнорировать, а не отклонять запрос
+func grantedScope(requested string) string {
+	fields := strings.Fields(requested)
+
+	granted := make([]string, 0, len(supportedScopes))
+	for _, scope := range supportedScopes {
+		if slices.Contains(fields, scope) {
+			granted = append(granted, scope)
+		}
+	}
+
+	return strings.Join(granted, " ")
+}
+
+func hasScope(scope string, want string) bool {
+	return slices.Contains(strings.Fields(scope), want)
+}
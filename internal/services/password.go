@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/mail"
+	"sso/internal/lib/opaque"
+	"sso/internal/storage"
+)
+
+// PasswordResetStore хранит токены сброса пароля. Сам токен знает только пользователь, в БД - его хэш
+type PasswordResetStore interface {
+	SavePasswordResetToken(ctx context.Context, token models.PasswordResetToken) error
+	PasswordResetToken(ctx context.Context, tokenHash string) (models.PasswordResetToken, error)
+	ResetPassword(ctx context.Context, tokenHash string, passHash []byte, changedAt time.Time) error
+}
+
+// Mailer отправляет письма пользователям
+type Mailer interface {
+	Send(ctx context.Context, msg mail.Message) error
+}
+
+var ErrInvalidResetToken = errors.New("invalid password reset token")
+
+// ChangePassword меняет пароль пользователя, который знает текущий пароль.
+// Попытки со старым паролем считаются как попытки входа, иначе через смену пароля можно было бы подбирать пароль в обход блокировки.
+// После смены все сессии пользователя завершаются: refresh токены отзываются, выданные раньше access токены перестают приниматься
+func (a *Auth) ChangePassword(ctx context.Context, email string, oldPassword string, newPassword string, ip string) error {
+	const op = "auth.ChangePassword"
+
+	log := a.log.With(slog.String("op", op), slog.String("email", email)) // Внимание email это GDPR данные, лучше их не логировать
+	log.Info("Changing password")
+
+	retryAfter, err := a.loginGuard.Blocked(ctx, email, ip)
+	if err != nil {
+		log.Error("failed to check login failures", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if retryAfter > 0 {
+		log.Warn("login is temporarily locked", slog.String("ip", ip), slog.Duration("retry_after", retryAfter))
+		return fmt.Errorf("%s: %w", op, &LockedError{RetryAfter: retryAfter})
+	}
+
+	user, err := a.userProvider.User(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", sl.Err(err))
+			a.loginFailed(ctx, log, email, ip)
+			return fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+		}
+		log.Error("failed to get user", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	match, err := a.passwordHasher.Verify(oldPassword, user.PassHash)
+	if err != nil {
+		log.Error("failed to verify password hash", sl.Err(err))
+	}
+	if !match {
+		log.Info("invalid credentials")
+		a.loginFailed(ctx, log, email, ip)
+		return fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+
+	if err := a.loginGuard.LoginSucceeded(ctx, email); err != nil {
+		log.Error("failed to reset login failures", sl.Err(err))
+	}
+
+	// Отключенному пользователю смена пароля не поможет войти, а требование сбросить пароль как раз снимается этой сменой
+	if user.Disabled {
+		log.Warn("user is disabled")
+		return fmt.Errorf("%s: %w", op, ErrUserDisabled)
+	}
+
+	if err := a.validatePassword(ctx, log, newPassword, user.Email); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	passHash, err := a.passwordHasher.Hash(newPassword)
+	if err != nil {
+		log.Error("failed to generate password hash", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.userSaver.ChangePassword(ctx, user.ID, passHash, time.Now()); err != nil {
+		log.Error("failed to change password", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Password changed")
+
+	return nil
+}
+
+// RequestPasswordReset отправляет на email одноразовый токен для сброса пароля.
+// Для неизвестного или отключенного email тоже возвращает успех, иначе по ответу можно было бы узнать, кто зарегистрирован.
+// Новый запрос делает недействительными токены, отправленные раньше
+func (a *Auth) RequestPasswordReset(ctx context.Context, email string) error {
+	const op = "auth.RequestPasswordReset"
+
+	log := a.log.With(slog.String("op", op), slog.String("email", email)) // Внимание email это GDPR данные, лучше их не логировать
+	log.Info("Requesting password reset")
+
+	user, err := a.userProvider.User(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Info("user not found, password reset is not sent")
+			return nil
+		}
+		log.Error("failed to get user", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if user.Disabled {
+		log.Info("user is disabled, password reset is not sent")
+		return nil
+	}
+
+	token, err := opaque.New()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.passwordResetStore.SavePasswordResetToken(ctx, models.PasswordResetToken{
+		TokenHash: opaque.Hash(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(a.passwordResetTTL),
+	})
+	if err != nil {
+		log.Error("failed to save password reset token", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf(
+			"Someone requested a password reset for your account.\r\n\r\nReset token: %s\r\n\r\nThe token expires in %s. If it wasn't you, ignore this email.\r\n",
+			token, a.passwordResetTTL,
+		),
+	})
+	if err != nil {
+		log.Error("failed to send password reset email", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Password reset sent")
+
+	return nil
+}
+
+// ConfirmPasswordReset устанавливает новый пароль по токену из письма. Токен можно использовать только один раз.
+// Как и ChangePassword, завершает все сессии пользователя и снимает требование сбросить пароль
+func (a *Auth) ConfirmPasswordReset(ctx context.Context, token string, newPassword string) error {
+	const op = "auth.ConfirmPasswordReset"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("Confirming password reset")
+
+	tokenHash := opaque.Hash(token)
+
+	rt, err := a.passwordResetStore.PasswordResetToken(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, storage.ErrPasswordResetTokenNotFound) {
+			log.Warn("password reset token not found")
+			return fmt.Errorf("%s: %w", op, ErrInvalidResetToken)
+		}
+		log.Error("failed to get password reset token", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !rt.UsedAt.IsZero() || time.Now().After(rt.ExpiresAt) {
+		log.Warn("password reset token is used or expired")
+		return fmt.Errorf("%s: %w", op, ErrInvalidResetToken)
+	}
+
+	user, err := a.userProvider.UserByID(ctx, rt.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+			return fmt.Errorf("%s: %w", op, ErrInvalidResetToken)
+		}
+		log.Error("failed to get user", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if user.Disabled {
+		log.Warn("user is disabled")
+		return fmt.Errorf("%s: %w", op, ErrUserDisabled)
+	}
+
+	// Токен еще не тратим: если пароль не прошел политику, пользователь попробует другой с тем же токеном
+	if err := a.validatePassword(ctx, log, newPassword, user.Email); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	passHash, err := a.passwordHasher.Hash(newPassword)
+	if err != nil {
+		log.Error("failed to generate password hash", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Хранилище еще раз проверяет, что токен не использован, на случай двух одновременных запросов
+	if err := a.passwordResetStore.ResetPassword(ctx, tokenHash, passHash, time.Now()); err != nil {
+		if errors.Is(err, storage.ErrPasswordResetTokenNotFound) {
+			log.Warn("password reset token is already used")
+			return fmt.Errorf("%s: %w", op, ErrInvalidResetToken)
+		}
+		log.Error("failed to reset password", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Сброс по почте доказывает владение email, поэтому счетчик неудачных входов обнуляем
+	if err := a.loginGuard.LoginSucceeded(ctx, user.Email); err != nil {
+		log.Error("failed to reset login failures", sl.Err(err))
+	}
+
+	log.Info("Password reset")
+
+	return nil
+}
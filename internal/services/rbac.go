@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/storage"
+)
+
+// CheckPermission проверяет, дает ли какая-нибудь из ролей пользователя в приложении указанное разрешение.
+//
+// Роли заводятся на каждое приложение отдельно, поэтому разрешение в одном приложении ничего не дает в другом.
+func (a *Auth) CheckPermission(ctx context.Context, userID int64, appID int, permission string) (bool, error) {
+	const op = "auth.CheckPermission"
+
+	log := a.log.With(
+		slog.String("op", op),
+		slog.Int64("user_id", userID),
+		slog.Int("app_id", appID),
+		slog.String("permission", permission),
+	)
+	log.Info("Checking permission")
+
+	if err := a.checkUserAndApp(ctx, userID, appID); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	allowed, err := a.roleProvider.HasPermission(ctx, userID, appID, permission)
+	if err != nil {
+		log.Error("failed to check permission", sl.Err(err))
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Checked permission", slog.Bool("allowed", allowed))
+
+	return allowed, nil
+}
+
+// ListUserRoles возвращает роли пользователя в приложении вместе с их разрешениями.
+func (a *Auth) ListUserRoles(ctx context.Context, userID int64, appID int) ([]models.Role, error) {
+	const op = "auth.ListUserRoles"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("user_id", userID), slog.Int("app_id", appID))
+	log.Info("Listing user roles")
+
+	if err := a.checkUserAndApp(ctx, userID, appID); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	roles, err := a.roleProvider.UserRoles(ctx, userID, appID)
+	if err != nil {
+		log.Error("failed to get user roles", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return roles, nil
+}
+
+// checkUserAndApp отличает "нет ролей" от опечатки в user_id или app_id
+func (a *Auth) checkUserAndApp(ctx context.Context, userID int64, appID int) error {
+	if _, err := a.userProvider.UserByID(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	if _, err := a.appProvider.App(ctx, appID); err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			return ErrInvalidAppID
+		}
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/opaque"
+	"sso/internal/storage"
+)
+
+// Refresh обменивает refresh токен на новую пару токенов (ротация).
+//
+// Старый refresh токен после обмена становится недействительным. Если его предъявят повторно,
+// значит токен скорее всего украден, поэтому отзываем все семейство токенов, выросшее из того же логина.
+func (a *Auth) Refresh(ctx context.Context, refreshToken string) (models.TokenPair, error) {
+	const op = "auth.Refresh"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("Refreshing tokens")
+
+	tokens, err := a.refresh(ctx, log, refreshToken, 0)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tokens, nil
+}
+
+// refresh обменивает refresh токен. clientAppID - приложение, которое предъявило токен по /token,
+// токены других приложений ему не обменяем. 0 - приложение не проверяется
+func (a *Auth) refresh(ctx context.Context, log *slog.Logger, refreshToken string, clientAppID int) (models.TokenPair, error) {
+	rt, err := a.refreshTokenProvider.RefreshToken(ctx, opaque.Hash(refreshToken))
+	if err != nil {
+		if errors.Is(err, storage.ErrRefreshTokenNotFound) {
+			log.Warn("refresh token not found")
+			return models.TokenPair{}, ErrInvalidRefreshToken
+		}
+		log.Error("failed to get refresh token", sl.Err(err))
+		return models.TokenPair{}, err
+	}
+
+	log = log.With(slog.Int64("user_id", rt.UserID), slog.String("family_id", rt.FamilyID))
+
+	if clientAppID != 0 && rt.AppID != clientAppID {
+		log.Warn("refresh token belongs to another app", slog.Int("client_app_id", clientAppID))
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	if !rt.RevokedAt.IsZero() {
+		log.Warn("refresh token revoked")
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	if !rt.RotatedAt.IsZero() {
+		a.revokeFamily(ctx, log, rt.FamilyID)
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	// Семейство могли отозвать через Logout или RevokeToken
+	revoked, err := a.tokenRevoker.IsRevoked(ctx, rt.FamilyID)
+	if err != nil {
+		log.Error("failed to check revocation", sl.Err(err))
+		return models.TokenPair{}, err
+	}
+	if revoked {
+		log.Info("refresh token family revoked")
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	if time.Now().After(rt.ExpiresAt) {
+		log.Info("refresh token expired")
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	user, err := a.userProvider.UserByID(ctx, rt.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", sl.Err(err))
+			return models.TokenPair{}, ErrInvalidRefreshToken
+		}
+		log.Error("failed to get user", sl.Err(err))
+		return models.TokenPair{}, err
+	}
+
+	// Отключенному пользователю и пользователю, которому нужно сменить пароль, новые токены не выдаем
+	if user.Disabled || user.PasswordResetRequired {
+		log.Warn("user can not refresh tokens", slog.Bool("disabled", user.Disabled))
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	app, err := a.appProvider.App(ctx, rt.AppID)
+	if err != nil {
+		if errors.Is(err, storage.ErrAppNotFound) {
+			log.Warn("app not found", sl.Err(err))
+			return models.TokenPair{}, ErrInvalidRefreshToken
+		}
+		log.Error("failed to get app", sl.Err(err))
+		return models.TokenPair{}, err
+	}
+
+	if !app.Enabled || !app.AllowsGrant(models.GrantRefreshToken) {
+		log.Warn("app can not refresh tokens", slog.Bool("enabled", app.Enabled))
+		return models.TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	newRefreshToken, newRT, err := a.newRefreshToken(user.ID, app, rt.FamilyID, rt.Scope)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	if err := a.refreshTokenSaver.RotateRefreshToken(ctx, rt.ID, newRT); err != nil {
+		// Параллельный запрос успел обменять этот же токен раньше нас
+		if errors.Is(err, storage.ErrRefreshTokenReused) {
+			a.revokeFamily(ctx, log, rt.FamilyID)
+			return models.TokenPair{}, ErrInvalidRefreshToken
+		}
+		log.Error("failed to rotate refresh token", sl.Err(err))
+		return models.TokenPair{}, err
+	}
+
+	token, err := a.newAccessToken(ctx, log, user, app, rt.Scope)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	log.Info("Tokens refreshed")
+
+	return models.TokenPair{
+		AccessToken:  token,
+		RefreshToken: newRefreshToken,
+		ExpiresIn:    app.AccessTTL(a.tokenTTL),
+		Scope:        rt.Scope,
+	}, nil
+}
+
+// newRefreshToken создает refresh токен, сам токен отдаем клиенту, а в БД сохраняем только его хэш
+func (a *Auth) newRefreshToken(userID int64, app models.App, familyID string, scope string) (string, models.RefreshToken, error) {
+	token, err := opaque.New()
+	if err != nil {
+		return "", models.RefreshToken{}, err
+	}
+
+	return token, models.RefreshToken{
+		TokenHash: opaque.Hash(token),
+		FamilyID:  familyID,
+		UserID:    userID,
+		AppID:     app.ID,
+		Scope:     scope,
+		ExpiresAt: time.Now().Add(app.RefreshTTL(a.refreshTokenTTL)),
+	}, nil
+}
+
+// revokeFamily вызывается при повторном использовании уже обмененного refresh токена
+func (a *Auth) revokeFamily(ctx context.Context, log *slog.Logger, familyID string) {
+	log.Warn("refresh token reuse detected, revoking token family")
+
+	if err := a.refreshTokenSaver.RevokeRefreshTokenFamily(ctx, familyID); err != nil {
+		log.Error("failed to revoke refresh token family", sl.Err(err))
+	}
+}
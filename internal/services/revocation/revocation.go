@@ -0,0 +1,143 @@
+// Package revocation хранит список отозванных до истечения срока токенов (denylist)
+package revocation
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"sso/internal/lib/logger/sl"
+)
+
+// Denylist держит отозванные токены в памяти, чтобы проверка на каждый запрос не ходила в БД,
+// а в БД пишет их, чтобы отзыв пережил перезапуск сервиса
+type Denylist struct {
+	log      *slog.Logger
+	storage  Storage
+	interval time.Duration
+	done     chan struct{}
+
+	mu     sync.RWMutex
+	tokens map[string]time.Time // id токена -> когда токен протухнет сам
+}
+
+type Storage interface {
+	RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	RevokedTokens(ctx context.Context) (map[string]time.Time, error)
+	DeleteExpiredRevokedTokens(ctx context.Context) (int64, error)
+}
+
+// New возвращает denylist, interval - как часто удалять протухшие записи и перечитывать список из БД.
+func New(log *slog.Logger, storage Storage, interval time.Duration) *Denylist {
+	return &Denylist{
+		log:      log,
+		storage:  storage,
+		interval: interval,
+		done:     make(chan struct{}),
+		tokens:   make(map[string]time.Time),
+	}
+}
+
+// Load загружает в память отозванные токены из БД, вызываем до того как начнем принимать запросы.
+// Загруженное добавляется к тому, что уже в памяти: токен, отозванный через Revoke, пока шло чтение из БД,
+// не должен пропасть из списка. Из памяти уходят только протухшие записи
+func (d *Denylist) Load(ctx context.Context) error {
+	const op = "revocation.Load"
+
+	tokens, err := d.storage.RevokedTokens(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for tokenID, expiresAt := range tokens {
+		d.tokens[tokenID] = expiresAt
+	}
+	for tokenID, expiresAt := range d.tokens {
+		if !expiresAt.After(now) {
+			delete(d.tokens, tokenID)
+		}
+	}
+
+	return nil
+}
+
+// Revoke отзывает токен, запись хранится до expiresAt - после него токен и так не пройдет проверку
+func (d *Denylist) Revoke(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	const op = "revocation.Revoke"
+
+	if err := d.storage.RevokeToken(ctx, tokenID, expiresAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	d.mu.Lock()
+	d.tokens[tokenID] = expiresAt
+	d.mu.Unlock()
+
+	return nil
+}
+
+func (d *Denylist) IsRevoked(ctx context.Context, tokenID string) (bool, error) {
+	d.mu.RLock()
+	_, ok := d.tokens[tokenID]
+	d.mu.RUnlock()
+
+	return ok, nil
+}
+
+// Run блокируется до вызова Stop, поэтому запускаем его в отдельной горутине
+func (d *Denylist) Run() {
+	const op = "revocation.Run"
+
+	d.log.With(slog.String("op", op)).Info("Revoked tokens cleanup is running", slog.Duration("interval", d.interval))
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.cleanup()
+		case <-d.done:
+			return
+		}
+	}
+}
+
+func (d *Denylist) Stop() {
+	const op = "revocation.Stop"
+
+	d.log.With(slog.String("op", op)).Info("Stopping revoked tokens cleanup")
+
+	close(d.done)
+}
+
+func (d *Denylist) cleanup() {
+	const op = "revocation.cleanup"
+
+	log := d.log.With(slog.String("op", op))
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.interval)
+	defer cancel()
+
+	deleted, err := d.storage.DeleteExpiredRevokedTokens(ctx)
+	if err != nil {
+		log.Error("failed to delete expired revoked tokens", sl.Err(err))
+		return
+	}
+	if deleted > 0 {
+		log.Info("Expired revoked tokens deleted", slog.Int64("count", deleted))
+	}
+
+	// Перечитываем список: так из памяти уходят протухшие записи
+	// и подтягиваются токены, отозванные в БД в обход этого процесса
+	if err := d.Load(ctx); err != nil {
+		log.Error("failed to reload revoked tokens", sl.Err(err))
+	}
+}
@@ -0,0 +1,89 @@
+package revocation
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingStorage отдает список из БД только после сигнала release, чтобы отозвать токен посреди Load
+type blockingStorage struct {
+	tokens  map[string]time.Time
+	loading chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStorage) RevokeToken(_ context.Context, tokenID string, expiresAt time.Time) error {
+	return nil
+}
+
+func (s *blockingStorage) RevokedTokens(_ context.Context) (map[string]time.Time, error) {
+	close(s.loading)
+	<-s.release
+
+	return s.tokens, nil
+}
+
+func (s *blockingStorage) DeleteExpiredRevokedTokens(_ context.Context) (int64, error) {
+	return 0, nil
+}
+
+func TestDenylist_RevokeDuringLoad(t *testing.T) {
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour)
+
+	storage := &blockingStorage{
+		// Список прочитан из БД до того, как отозвали revoked-during-load
+		tokens:  map[string]time.Time{"loaded": expiresAt},
+		loading: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	d := New(slog.New(slog.NewTextHandler(io.Discard, nil)), storage, time.Hour)
+
+	loaded := make(chan error)
+	go func() {
+		loaded <- d.Load(ctx)
+	}()
+
+	<-storage.loading
+	require.NoError(t, d.Revoke(ctx, "revoked-during-load", expiresAt))
+	close(storage.release)
+	require.NoError(t, <-loaded)
+
+	revoked, err := d.IsRevoked(ctx, "revoked-during-load")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = d.IsRevoked(ctx, "loaded")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestDenylist_LoadDropsExpired(t *testing.T) {
+	ctx := context.Background()
+
+	storage := &blockingStorage{
+		tokens:  map[string]time.Time{},
+		loading: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	close(storage.release)
+	d := New(slog.New(slog.NewTextHandler(io.Discard, nil)), storage, time.Hour)
+
+	require.NoError(t, d.Revoke(ctx, "expired", time.Now().Add(-time.Second)))
+	require.NoError(t, d.Revoke(ctx, "active", time.Now().Add(time.Hour)))
+	require.NoError(t, d.Load(ctx))
+
+	revoked, err := d.IsRevoked(ctx, "expired")
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	revoked, err = d.IsRevoked(ctx, "active")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
@@ -0,0 +1,374 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/lib/logger/sl"
+	"sso/internal/lib/opaque"
+	"sso/internal/lib/webauthn"
+	"sso/internal/storage"
+)
+
+const maxWebAuthnCredentialNameLen = 64
+
+// WebAuthnStore хранит учетные данные WebAuthn (passkey) и начатые регистрации и входы
+type WebAuthnStore interface {
+	SaveWebAuthnSession(ctx context.Context, session models.WebAuthnSession) error
+	TakeWebAuthnSession(ctx context.Context, challengeHash string) (models.WebAuthnSession, error)
+	SaveWebAuthnCredential(ctx context.Context, credential models.WebAuthnCredential) error
+	WebAuthnCredential(ctx context.Context, id []byte) (models.WebAuthnCredential, error)
+	WebAuthnCredentials(ctx context.Context, userID int64) ([]models.WebAuthnCredential, error)
+	UpdateWebAuthnSignCount(ctx context.Context, id []byte, oldCount uint32, newCount uint32, usedAt time.Time) error
+}
+
+var (
+	ErrInvalidWebAuthnResponse  = errors.New("invalid webauthn response")
+	ErrWebAuthnCredentialExists = errors.New("webauthn credential already registered")
+	// ErrWebAuthnSignCount - счетчик подписей не вырос, аутентификатор мог быть склонирован
+	ErrWebAuthnSignCount = errors.New("webauthn sign count did not increase")
+)
+
+// BeginWebAuthnRegistration начинает регистрацию passkey для владельца access токена.
+// Возвращает параметры для navigator.credentials.create(), ответ браузера принимает FinishWebAuthnRegistration
+func (a *Auth) BeginWebAuthnRegistration(ctx context.Context, accessToken string) (models.WebAuthnOptions, error) {
+	const op = "auth.BeginWebAuthnRegistration"
+
+	log := a.log.With(slog.String("op", op))
+
+	user, err := a.authenticate(ctx, log, accessToken)
+	if err != nil {
+		return models.WebAuthnOptions{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("user_id", user.ID))
+	log.Info("Beginning webauthn registration")
+
+	// Уже зарегистрированные учетные данные передаем в excludeCredentials, чтобы один аутентификатор не добавили дважды
+	credentials, err := a.webAuthnStore.WebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		log.Error("failed to get webauthn credentials", sl.Err(err))
+		return models.WebAuthnOptions{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	challenge, err := a.newWebAuthnSession(ctx, log, models.WebAuthnRegistration, user.ID, 0)
+	if err != nil {
+		return models.WebAuthnOptions{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	options := a.webAuthnOptions(challenge, credentials)
+	options.UserHandle = webAuthnUserHandle(user.ID)
+	options.UserName = user.Email
+	options.Algorithms = webauthn.SupportedAlgorithms
+
+	return options, nil
+}
+
+// FinishWebAuthnRegistration проверяет ответ navigator.credentials.create() и сохраняет новый passkey под именем name.
+// Возвращает id учетных данных
+func (a *Auth) FinishWebAuthnRegistration(
+	ctx context.Context,
+	accessToken string,
+	name string,
+	clientDataJSON []byte,
+	attestationObject []byte,
+) ([]byte, error) {
+	const op = "auth.FinishWebAuthnRegistration"
+
+	log := a.log.With(slog.String("op", op))
+
+	user, err := a.authenticate(ctx, log, accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("user_id", user.ID))
+	log.Info("Finishing webauthn registration")
+
+	if len(name) > maxWebAuthnCredentialNameLen {
+		log.Warn("credential name is too long")
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidWebAuthnResponse)
+	}
+
+	challenge, err := a.takeWebAuthnSession(ctx, log, clientDataJSON, models.WebAuthnRegistration)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	// Сессию начинал другой пользователь
+	if challenge.session.UserID != user.ID {
+		log.Warn("webauthn session belongs to another user")
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidWebAuthnResponse)
+	}
+
+	credential, err := a.relyingParty.VerifyRegistration(challenge.challenge, clientDataJSON, attestationObject)
+	if err != nil {
+		log.Warn("invalid webauthn registration", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidWebAuthnResponse)
+	}
+
+	err = a.webAuthnStore.SaveWebAuthnCredential(ctx, models.WebAuthnCredential{
+		ID:        credential.ID,
+		UserID:    user.ID,
+		PublicKey: credential.PublicKey,
+		SignCount: credential.SignCount,
+		Name:      name,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrWebAuthnCredentialExists) {
+			log.Warn("webauthn credential already registered")
+			return nil, fmt.Errorf("%s: %w", op, ErrWebAuthnCredentialExists)
+		}
+		log.Error("failed to save webauthn credential", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("webauthn credential registered")
+
+	return credential.ID, nil
+}
+
+// BeginWebAuthnLogin начинает вход по passkey в приложение appID.
+// Возвращает параметры для navigator.credentials.get(). Без email allowCredentials пуст и браузер
+// предложит любой passkey для нашего RP ID, пользователя тогда назовет аутентификатор
+func (a *Auth) BeginWebAuthnLogin(ctx context.Context, email string, appID int) (models.WebAuthnOptions, error) {
+	const op = "auth.BeginWebAuthnLogin"
+
+	log := a.log.With(slog.String("op", op))
+
+	log.Info("Beginning webauthn login")
+
+	if _, err := a.loginApp(ctx, log, appID); err != nil {
+		return models.WebAuthnOptions{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var (
+		userID      int64
+		credentials []models.WebAuthnCredential
+	)
+	if email != "" {
+		user, err := a.userProvider.User(ctx, email)
+		switch {
+		case err == nil:
+			userID = user.ID
+			credentials, err = a.webAuthnStore.WebAuthnCredentials(ctx, user.ID)
+			if err != nil {
+				log.Error("failed to get webauthn credentials", sl.Err(err))
+				return models.WebAuthnOptions{}, fmt.Errorf("%s: %w", op, err)
+			}
+		case errors.Is(err, storage.ErrUserNotFound):
+			// Отвечаем как для пользователя без passkey, чтобы по ответу нельзя было узнать, зарегистрирован ли email
+			log.Info("user not found")
+		default:
+			log.Error("failed to get user", sl.Err(err))
+			return models.WebAuthnOptions{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	challenge, err := a.newWebAuthnSession(ctx, log, models.WebAuthnLogin, userID, appID)
+	if err != nil {
+		return models.WebAuthnOptions{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return a.webAuthnOptions(challenge, credentials), nil
+}
+
+// FinishWebAuthnLogin проверяет ответ navigator.credentials.get() и выдает токены, как Login.
+// userHandle может быть пустым, если аутентификатор его не прислал.
+// С требованием проверки пользователя (PIN, биометрия) passkey сам по себе два фактора, и TOTP не спрашивается.
+// Без него у пользователя с включенным TOTP вместо токенов вернется MFAToken
+func (a *Auth) FinishWebAuthnLogin(
+	ctx context.Context,
+	credentialID []byte,
+	clientDataJSON []byte,
+	authenticatorData []byte,
+	signature []byte,
+	userHandle []byte,
+) (models.TokenPair, error) {
+	const op = "auth.FinishWebAuthnLogin"
+
+	log := a.log.With(slog.String("op", op))
+
+	challenge, err := a.takeWebAuthnSession(ctx, log, clientDataJSON, models.WebAuthnLogin)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	credential, err := a.webAuthnStore.WebAuthnCredential(ctx, credentialID)
+	if err != nil {
+		if errors.Is(err, storage.ErrWebAuthnCredentialNotFound) {
+			log.Warn("webauthn credential not found")
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidWebAuthnResponse)
+		}
+		log.Error("failed to get webauthn credential", sl.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("user_id", credential.UserID))
+	log.Info("Finishing webauthn login")
+
+	// Вход начинали для другого пользователя или аутентификатор назвал не владельца учетных данных
+	if challenge.session.UserID != 0 && challenge.session.UserID != credential.UserID {
+		log.Warn("webauthn credential belongs to another user")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidWebAuthnResponse)
+	}
+	if len(userHandle) != 0 && !bytes.Equal(userHandle, webAuthnUserHandle(credential.UserID)) {
+		log.Warn("webauthn user handle mismatch")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidWebAuthnResponse)
+	}
+
+	signCount, err := a.relyingParty.VerifyAssertion(
+		challenge.challenge, credential.PublicKey, credential.SignCount, clientDataJSON, authenticatorData, signature,
+	)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrSignCount) {
+			log.Warn("webauthn sign count did not increase, authenticator may be cloned", sl.Err(err))
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrWebAuthnSignCount)
+		}
+		log.Warn("invalid webauthn assertion", sl.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidWebAuthnResponse)
+	}
+
+	// Счетчик обновляется только если его не поменял параллельный вход с тем же ответом
+	if err := a.webAuthnStore.UpdateWebAuthnSignCount(ctx, credential.ID, credential.SignCount, signCount, time.Now()); err != nil {
+		if errors.Is(err, storage.ErrWebAuthnCredentialNotFound) {
+			log.Warn("webauthn sign count changed concurrently")
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrWebAuthnSignCount)
+		}
+		log.Error("failed to update webauthn sign count", sl.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := a.userProvider.UserByID(ctx, credential.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found")
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrInvalidWebAuthnResponse)
+		}
+		log.Error("failed to get user", sl.Err(err))
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if user.Disabled {
+		log.Warn("user is disabled")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrUserDisabled)
+	}
+	if a.requireVerifiedEmail && !user.EmailVerified {
+		log.Info("email is not verified")
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, ErrEmailNotVerified)
+	}
+
+	app, err := a.loginApp(ctx, log, challenge.session.AppID)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !a.relyingParty.RequireUserVerification {
+		mfaToken, err := a.requireSecondFactor(ctx, log, user, app)
+		if err != nil {
+			return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+		}
+		if mfaToken != "" {
+			return models.TokenPair{MFAToken: mfaToken}, nil
+		}
+	}
+
+	log.Info("User logged in successfully")
+
+	tokens, err := a.issueTokens(ctx, log, user, app)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tokens, nil
+}
+
+// newWebAuthnSession сохраняет начатую регистрацию или вход и возвращает вызов для аутентификатора
+func (a *Auth) newWebAuthnSession(ctx context.Context, log *slog.Logger, kind string, userID int64, appID int) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.webAuthnStore.SaveWebAuthnSession(ctx, models.WebAuthnSession{
+		ChallengeHash: hashWebAuthnChallenge(challenge),
+		Kind:          kind,
+		UserID:        userID,
+		AppID:         appID,
+		ExpiresAt:     time.Now().Add(a.webAuthnSessionTTL),
+	})
+	if err != nil {
+		log.Error("failed to save webauthn session", sl.Err(err))
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+type webAuthnChallenge struct {
+	challenge []byte
+	session   models.WebAuthnSession
+}
+
+// takeWebAuthnSession находит и удаляет сессию по вызову из clientDataJSON: на один вызов принимается один ответ
+func (a *Auth) takeWebAuthnSession(ctx context.Context, log *slog.Logger, clientDataJSON []byte, kind string) (webAuthnChallenge, error) {
+	challenge, err := webauthn.Challenge(clientDataJSON)
+	if err != nil {
+		log.Warn("invalid client data", sl.Err(err))
+		return webAuthnChallenge{}, ErrInvalidWebAuthnResponse
+	}
+
+	session, err := a.webAuthnStore.TakeWebAuthnSession(ctx, hashWebAuthnChallenge(challenge))
+	if err != nil {
+		if errors.Is(err, storage.ErrWebAuthnSessionNotFound) {
+			log.Warn("webauthn session not found")
+			return webAuthnChallenge{}, ErrInvalidWebAuthnResponse
+		}
+		log.Error("failed to get webauthn session", sl.Err(err))
+		return webAuthnChallenge{}, err
+	}
+	if session.Kind != kind {
+		log.Warn("webauthn session kind mismatch", slog.String("kind", session.Kind))
+		return webAuthnChallenge{}, ErrInvalidWebAuthnResponse
+	}
+	if time.Now().After(session.ExpiresAt) {
+		log.Warn("webauthn session expired")
+		return webAuthnChallenge{}, ErrInvalidWebAuthnResponse
+	}
+
+	return webAuthnChallenge{challenge: challenge, session: session}, nil
+}
+
+func (a *Auth) webAuthnOptions(challenge []byte, credentials []models.WebAuthnCredential) models.WebAuthnOptions {
+	options := models.WebAuthnOptions{
+		Challenge:        challenge,
+		RPID:             a.relyingParty.ID,
+		RPName:           a.relyingParty.Name,
+		Timeout:          a.webAuthnSessionTTL,
+		UserVerification: "preferred",
+	}
+	if a.relyingParty.RequireUserVerification {
+		options.UserVerification = "required"
+	}
+	for _, c := range credentials {
+		options.CredentialIDs = append(options.CredentialIDs, c.ID)
+	}
+
+	return options
+}
+
+// webAuthnUserHandle - user.id для аутентификатора. Email туда не кладем: user handle не должен раскрывать пользователя
+func webAuthnUserHandle(userID int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(userID))
+}
+
+func hashWebAuthnChallenge(challenge []byte) string {
+	return opaque.Hash(base64.RawURLEncoding.EncodeToString(challenge))
+}
@@ -0,0 +1,196 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+
+	"sso/internal/domain/models"
+	"sso/internal/storage"
+)
+
+// SaveApp saves new app and returns its id.
+func (s *Storage) SaveApp(ctx context.Context, app models.App) (int, error) {
+	const op = "storage.sqlite.SaveApp"
+
+	stmt, err := s.db.Prepare(`
+		INSERT INTO apps(name, secret, signing_alg, signing_key, token_ttl, refresh_token_ttl, claims, redirect_uris, grant_types, scopes, client_public_key, public, enabled)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret, err := s.encrypt([]byte(app.Secret))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx,
+		app.Name, secret, app.SigningAlg, app.SigningKey, int64(app.TokenTTL.Seconds()), int64(app.RefreshTokenTTL.Seconds()),
+		strings.Join(app.Claims, ","), strings.Join(app.RedirectURIs, " "), strings.Join(app.GrantTypes, " "),
+		strings.Join(app.Scopes, " "), app.ClientPublicKey, app.Public, app.Enabled,
+	)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrAppExists)
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return int(id), nil
+}
+
+// Apps returns all apps ordered by id.
+func (s *Storage) Apps(ctx context.Context) ([]models.App, error) {
+	const op = "storage.sqlite.Apps"
+
+	stmt, err := s.db.Prepare("SELECT " + appColumns + " FROM apps ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var apps []models.App
+	for rows.Next() {
+		app, err := s.scanApp(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		apps = append(apps, app)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return apps, nil
+}
+
+// UpdateApp updates app settings. Secret and signing settings are not changed.
+func (s *Storage) UpdateApp(ctx context.Context, app models.App) error {
+	const op = "storage.sqlite.UpdateApp"
+
+	stmt, err := s.db.Prepare(`
+		UPDATE apps
+		SET name = ?, token_ttl = ?, refresh_token_ttl = ?, claims = ?, redirect_uris = ?, grant_types = ?, scopes = ?,
+		    client_public_key = ?, public = ?, enabled = ?
+		WHERE id = ?`)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx,
+		app.Name, int64(app.TokenTTL.Seconds()), int64(app.RefreshTokenTTL.Seconds()), strings.Join(app.Claims, ","),
+		strings.Join(app.RedirectURIs, " "), strings.Join(app.GrantTypes, " "), strings.Join(app.Scopes, " "),
+		app.ClientPublicKey, app.Public, app.Enabled, app.ID,
+	)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return fmt.Errorf("%s: %w", op, storage.ErrAppExists)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := appAffected(res); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UpdateAppSecret replaces app secret.
+func (s *Storage) UpdateAppSecret(ctx context.Context, appID int, secret string) error {
+	const op = "storage.sqlite.UpdateAppSecret"
+
+	stmt, err := s.db.Prepare("UPDATE apps SET secret = ? WHERE id = ?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	encrypted, err := s.encrypt([]byte(secret))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, encrypted, appID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := appAffected(res); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteApp deletes the app with its roles, refresh tokens, authorization and device codes, client assertions and signing keys.
+func (s *Storage) DeleteApp(ctx context.Context, appID int) error {
+	const op = "storage.sqlite.DeleteApp"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// Внешние ключи в sqlite по умолчанию выключены, поэтому ON DELETE CASCADE не сработает, удаляем сами
+	for _, query := range []string{
+		"DELETE FROM user_roles WHERE role_id IN (SELECT id FROM roles WHERE app_id = ?)",
+		"DELETE FROM role_permissions WHERE role_id IN (SELECT id FROM roles WHERE app_id = ?)",
+		"DELETE FROM roles WHERE app_id = ?",
+		"DELETE FROM refresh_tokens WHERE app_id = ?",
+		"DELETE FROM authorization_codes WHERE app_id = ?",
+		"DELETE FROM client_assertions WHERE app_id = ?",
+		"DELETE FROM device_codes WHERE app_id = ?",
+		"DELETE FROM signing_keys WHERE app_id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, query, appID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM apps WHERE id = ?", appID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := appAffected(res); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func appAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return storage.ErrAppNotFound
+	}
+
+	return nil
+}
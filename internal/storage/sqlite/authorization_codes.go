@@ -0,0 +1,99 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/storage"
+)
+
+const authorizationCodeColumns = "code_hash, app_id, user_id, redirect_uri, scope, code_challenge, family_id, nonce, auth_time, expires_at, used_at"
+
+// SaveAuthorizationCode saves new OAuth2 authorization code and deletes expired ones.
+func (s *Storage) SaveAuthorizationCode(ctx context.Context, code models.AuthorizationCode) error {
+	const op = "storage.sqlite.SaveAuthorizationCode"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM authorization_codes WHERE expires_at <= ?", time.Now().Unix()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO authorization_codes(code_hash, app_id, user_id, redirect_uri, scope, code_challenge, family_id, nonce, auth_time, expires_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		code.CodeHash, code.AppID, code.UserID, code.RedirectURI, code.Scope, code.CodeChallenge, code.FamilyID, code.Nonce, code.AuthTime.Unix(), code.ExpiresAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseAuthorizationCode marks authorization code as used and returns it.
+// If the code was already used returns it with storage.ErrAuthorizationCodeUsed.
+func (s *Storage) UseAuthorizationCode(ctx context.Context, codeHash string, usedAt time.Time) (models.AuthorizationCode, error) {
+	const op = "storage.sqlite.UseAuthorizationCode"
+
+	stmt, err := s.db.Prepare("UPDATE authorization_codes SET used_at = ? WHERE code_hash = ? AND used_at IS NULL RETURNING " + authorizationCodeColumns)
+	if err != nil {
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	code, err := scanAuthorizationCode(stmt.QueryRowContext(ctx, usedAt.Unix(), codeHash))
+	if err == nil {
+		return code, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Кода нет или его уже обменяли, во втором случае вызывающему нужно семейство выданных по нему токенов
+	stmt, err = s.db.Prepare("SELECT " + authorizationCodeColumns + " FROM authorization_codes WHERE code_hash = ?")
+	if err != nil {
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	code, err = scanAuthorizationCode(stmt.QueryRowContext(ctx, codeHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.AuthorizationCode{}, fmt.Errorf("%s: %w", op, storage.ErrAuthorizationCodeNotFound)
+		}
+		return models.AuthorizationCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return code, fmt.Errorf("%s: %w", op, storage.ErrAuthorizationCodeUsed)
+}
+
+func scanAuthorizationCode(row scanner) (models.AuthorizationCode, error) {
+	var (
+		code      models.AuthorizationCode
+		authTime  int64
+		expiresAt int64
+		usedAt    sql.NullInt64
+	)
+	err := row.Scan(
+		&code.CodeHash, &code.AppID, &code.UserID, &code.RedirectURI, &code.Scope, &code.CodeChallenge, &code.FamilyID, &code.Nonce, &authTime, &expiresAt, &usedAt,
+	)
+	if err != nil {
+		return models.AuthorizationCode{}, err
+	}
+
+	code.AuthTime = time.Unix(authTime, 0)
+	code.ExpiresAt = time.Unix(expiresAt, 0)
+	code.UsedAt = unixOrZero(usedAt)
+
+	return code, nil
+}
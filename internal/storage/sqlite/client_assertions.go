@@ -0,0 +1,43 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"sso/internal/storage"
+)
+
+// UseClientAssertion saves jti of app's client assertion and deletes expired ones.
+// If the assertion was already used returns storage.ErrClientAssertionUsed.
+func (s *Storage) UseClientAssertion(ctx context.Context, appID int, jti string, expiresAt time.Time) error {
+	const op = "storage.sqlite.UseClientAssertion"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM client_assertions WHERE expires_at <= ?", time.Now().Unix()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO client_assertions(app_id, jti, expires_at) VALUES(?, ?, ?)", appID, jti, expiresAt.Unix())
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+			return fmt.Errorf("%s: %w", op, storage.ErrClientAssertionUsed)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
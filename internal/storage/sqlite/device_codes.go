@@ -0,0 +1,213 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/storage"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const deviceCodeColumns = "device_code_hash, user_code, app_id, scope, status, user_id, auth_time, interval, last_polled_at, expires_at"
+
+// SaveDeviceCode saves new device code and deletes expired ones.
+// Returns storage.ErrDeviceCodeExists if the user code is already taken.
+func (s *Storage) SaveDeviceCode(ctx context.Context, code models.DeviceCode) error {
+	const op = "storage.sqlite.SaveDeviceCode"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM device_codes WHERE expires_at <= ?", time.Now().Unix()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO device_codes(device_code_hash, user_code, app_id, scope, status, interval, expires_at) VALUES(?, ?, ?, ?, ?, ?, ?)",
+		code.DeviceCodeHash, code.UserCode, code.AppID, code.Scope, models.DeviceCodePending, int64(code.Interval/time.Second), code.ExpiresAt.Unix(),
+	)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && (sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey) {
+			return fmt.Errorf("%s: %w", op, storage.ErrDeviceCodeExists)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeviceCode returns device code by hash of device_code.
+func (s *Storage) DeviceCode(ctx context.Context, deviceCodeHash string) (models.DeviceCode, error) {
+	const op = "storage.sqlite.DeviceCode"
+
+	stmt, err := s.db.Prepare("SELECT " + deviceCodeColumns + " FROM device_codes WHERE device_code_hash = ?")
+	if err != nil {
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	code, err := scanDeviceCode(stmt.QueryRowContext(ctx, deviceCodeHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.DeviceCode{}, fmt.Errorf("%s: %w", op, storage.ErrDeviceCodeNotFound)
+		}
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return code, nil
+}
+
+// DeviceCodeByUserCode returns device code by user code.
+func (s *Storage) DeviceCodeByUserCode(ctx context.Context, userCode string) (models.DeviceCode, error) {
+	const op = "storage.sqlite.DeviceCodeByUserCode"
+
+	stmt, err := s.db.Prepare("SELECT " + deviceCodeColumns + " FROM device_codes WHERE user_code = ?")
+	if err != nil {
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	code, err := scanDeviceCode(stmt.QueryRowContext(ctx, userCode))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.DeviceCode{}, fmt.Errorf("%s: %w", op, storage.ErrDeviceCodeNotFound)
+		}
+		return models.DeviceCode{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return code, nil
+}
+
+// ApproveDeviceCode marks pending device code approved by the user.
+// Returns storage.ErrDeviceCodeNotFound if there is no such pending unexpired code.
+func (s *Storage) ApproveDeviceCode(ctx context.Context, userCode string, userID int64, authTime time.Time) error {
+	const op = "storage.sqlite.ApproveDeviceCode"
+
+	// Условие status = 'pending' не дает разрешить или отклонить код дважды
+	stmt, err := s.db.Prepare("UPDATE device_codes SET status = ?, user_id = ?, auth_time = ? WHERE user_code = ? AND status = ? AND expires_at > ?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, models.DeviceCodeApproved, userID, authTime.Unix(), userCode, models.DeviceCodePending, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrDeviceCodeNotFound)
+	}
+
+	return nil
+}
+
+// DenyDeviceCode marks pending device code denied by the user.
+// Returns storage.ErrDeviceCodeNotFound if there is no such pending unexpired code.
+func (s *Storage) DenyDeviceCode(ctx context.Context, userCode string) error {
+	const op = "storage.sqlite.DenyDeviceCode"
+
+	stmt, err := s.db.Prepare("UPDATE device_codes SET status = ? WHERE user_code = ? AND status = ? AND expires_at > ?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, models.DeviceCodeDenied, userCode, models.DeviceCodePending, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrDeviceCodeNotFound)
+	}
+
+	return nil
+}
+
+// TouchDeviceCode remembers when the device polled the token endpoint and the interval it must wait from now on.
+func (s *Storage) TouchDeviceCode(ctx context.Context, deviceCodeHash string, polledAt time.Time, interval time.Duration) error {
+	const op = "storage.sqlite.TouchDeviceCode"
+
+	stmt, err := s.db.Prepare("UPDATE device_codes SET last_polled_at = ?, interval = ? WHERE device_code_hash = ?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, polledAt.UnixMilli(), int64(interval/time.Second), deviceCodeHash); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteDeviceCode deletes device code.
+// Returns storage.ErrDeviceCodeNotFound if it is already deleted, so tokens for the code can be issued only once.
+func (s *Storage) DeleteDeviceCode(ctx context.Context, deviceCodeHash string) error {
+	const op = "storage.sqlite.DeleteDeviceCode"
+
+	stmt, err := s.db.Prepare("DELETE FROM device_codes WHERE device_code_hash = ?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, deviceCodeHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrDeviceCodeNotFound)
+	}
+
+	return nil
+}
+
+func scanDeviceCode(row scanner) (models.DeviceCode, error) {
+	var (
+		code         models.DeviceCode
+		userID       sql.NullInt64
+		authTime     sql.NullInt64
+		interval     int64
+		lastPolledAt sql.NullInt64
+		expiresAt    int64
+	)
+	err := row.Scan(
+		&code.DeviceCodeHash, &code.UserCode, &code.AppID, &code.Scope, &code.Status, &userID, &authTime, &interval, &lastPolledAt, &expiresAt,
+	)
+	if err != nil {
+		return models.DeviceCode{}, err
+	}
+
+	code.UserID = userID.Int64
+	code.AuthTime = unixOrZero(authTime)
+	code.Interval = time.Duration(interval) * time.Second
+	if lastPolledAt.Valid {
+		code.LastPolledAt = time.UnixMilli(lastPolledAt.Int64)
+	}
+	code.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return code, nil
+}
@@ -0,0 +1,97 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/storage"
+)
+
+// SaveEmailVerificationToken saves new email verification token. Previous tokens of the user stop working.
+func (s *Storage) SaveEmailVerificationToken(ctx context.Context, token models.EmailVerificationToken) error {
+	const op = "storage.sqlite.SaveEmailVerificationToken"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM email_verification_tokens WHERE user_id = ?", token.UserID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO email_verification_tokens(token_hash, user_id, expires_at) VALUES(?, ?, ?)",
+		token.TokenHash, token.UserID, token.ExpiresAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// VerifyEmail marks email of the token's user verified and deletes the token.
+// Returns storage.ErrEmailVerificationTokenNotFound if the token does not exist or expired.
+func (s *Storage) VerifyEmail(ctx context.Context, tokenHash string, now time.Time) (userID int64, err error) {
+	const op = "storage.sqlite.VerifyEmail"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// Токен удаляется в той же транзакции, поэтому подтвердить им email можно только один раз
+	err = tx.QueryRowContext(ctx,
+		"DELETE FROM email_verification_tokens WHERE token_hash = ? AND expires_at > ? RETURNING user_id",
+		tokenHash, now.Unix(),
+	).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrEmailVerificationTokenNotFound)
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := setEmailVerified(ctx, tx, userID); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
+
+// setEmailVerified отмечает email подтвержденным, оставшиеся токены подтверждения больше не нужны
+func setEmailVerified(ctx context.Context, tx *sql.Tx, userID int64) error {
+	res, err := tx.ExecContext(ctx, "UPDATE users SET email_verified = TRUE WHERE id = ?", userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return storage.ErrUserNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM email_verification_tokens WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+
+	return nil
+}
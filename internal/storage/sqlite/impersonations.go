@@ -0,0 +1,30 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+
+	"sso/internal/domain/models"
+)
+
+// SaveImpersonation adds a record to the impersonation audit log and returns its id.
+func (s *Storage) SaveImpersonation(ctx context.Context, imp models.Impersonation) (int64, error) {
+	const op = "storage.sqlite.SaveImpersonation"
+
+	stmt, err := s.db.Prepare("INSERT INTO impersonations(actor_id, user_id, app_id, reason, created_at, expires_at) VALUES(?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, imp.ActorID, imp.UserID, imp.AppID, imp.Reason, imp.CreatedAt.Unix(), imp.ExpiresAt.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
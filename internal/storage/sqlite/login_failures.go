@@ -0,0 +1,74 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"sso/internal/domain/models"
+)
+
+// LoginFailures returns failed login attempts for subject. Returns zero count if there were none.
+func (s *Storage) LoginFailures(ctx context.Context, subject string) (models.LoginFailures, error) {
+	const op = "storage.sqlite.LoginFailures"
+
+	stmt, err := s.db.Prepare("SELECT failures, last_failed_at FROM login_failures WHERE subject = ?")
+	if err != nil {
+		return models.LoginFailures{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	failures := models.LoginFailures{Subject: subject}
+	var lastFailedAt int64
+	err = stmt.QueryRowContext(ctx, subject).Scan(&failures.Count, &lastFailedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return failures, nil
+		}
+
+		return models.LoginFailures{}, fmt.Errorf("%s: %w", op, err)
+	}
+	failures.LastFailedAt = time.UnixMilli(lastFailedAt)
+
+	return failures, nil
+}
+
+// RecordLoginFailure increments failed login attempts for subject.
+// The counter starts over if the previous failure happened before resetBefore.
+func (s *Storage) RecordLoginFailure(ctx context.Context, subject string, failedAt time.Time, resetBefore time.Time) error {
+	const op = "storage.sqlite.RecordLoginFailure"
+
+	// Одним запросом, чтобы параллельные попытки не затирали счетчик друг друга
+	stmt, err := s.db.Prepare(`
+		INSERT INTO login_failures(subject, failures, last_failed_at) VALUES(?, 1, ?)
+		ON CONFLICT(subject) DO UPDATE SET
+			failures = CASE WHEN last_failed_at < ? THEN 1 ELSE failures + 1 END,
+			last_failed_at = excluded.last_failed_at`)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(ctx, subject, failedAt.UnixMilli(), resetBefore.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ResetLoginFailures clears failed login attempts for subject.
+func (s *Storage) ResetLoginFailures(ctx context.Context, subject string) error {
+	const op = "storage.sqlite.ResetLoginFailures"
+
+	stmt, err := s.db.Prepare("DELETE FROM login_failures WHERE subject = ?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := stmt.ExecContext(ctx, subject); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,306 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/storage"
+)
+
+// SaveMFASecret starts TOTP enrollment: saves new unconfirmed secret replacing previous unconfirmed one.
+// Returns storage.ErrMFAExists if user already has confirmed MFA.
+func (s *Storage) SaveMFASecret(ctx context.Context, userID int64, secret string) error {
+	const op = "storage.sqlite.SaveMFASecret"
+
+	encrypted, err := s.encrypt([]byte(secret))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	stmt, err := s.db.Prepare(`INSERT INTO user_mfa(user_id, secret) VALUES(?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET secret = excluded.secret, last_used_step = 0 WHERE confirmed_at IS NULL`)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, userID, encrypted)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrMFAExists)
+	}
+
+	return nil
+}
+
+// MFA returns user's TOTP settings, confirmed or not.
+func (s *Storage) MFA(ctx context.Context, userID int64) (models.MFA, error) {
+	const op = "storage.sqlite.MFA"
+
+	stmt, err := s.db.Prepare("SELECT user_id, secret, confirmed_at, last_used_step FROM user_mfa WHERE user_id = ?")
+	if err != nil {
+		return models.MFA{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var (
+		mfa         models.MFA
+		secret      string
+		confirmedAt sql.NullInt64
+	)
+	err = stmt.QueryRowContext(ctx, userID).Scan(&mfa.UserID, &secret, &confirmedAt, &mfa.LastUsedStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.MFA{}, fmt.Errorf("%s: %w", op, storage.ErrMFANotFound)
+		}
+
+		return models.MFA{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	plaintext, err := s.decrypt(secret)
+	if err != nil {
+		return models.MFA{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	mfa.Secret = string(plaintext)
+	mfa.ConfirmedAt = unixOrZero(confirmedAt)
+
+	return mfa, nil
+}
+
+// ConfirmMFA confirms TOTP enrollment with the code of step and replaces user's recovery codes.
+// Returns storage.ErrMFANotFound if there is no unconfirmed enrollment.
+func (s *Storage) ConfirmMFA(ctx context.Context, userID int64, step int64, recoveryCodeHashes []string, confirmedAt time.Time) error {
+	const op = "storage.sqlite.ConfirmMFA"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE user_mfa SET confirmed_at = ?, last_used_step = ? WHERE user_id = ? AND confirmed_at IS NULL",
+		confirmedAt.Unix(), step, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrMFANotFound)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id = ?", userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO mfa_recovery_codes(user_id, code_hash) VALUES(?, ?)", userID, hash); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseMFAStep remembers that the code of step was used.
+// Returns storage.ErrMFACodeReused if a code of this or later step was already used.
+func (s *Storage) UseMFAStep(ctx context.Context, userID int64, step int64) error {
+	const op = "storage.sqlite.UseMFAStep"
+
+	// Условие last_used_step < ? не дает принять один код дважды, даже если два запроса пришли одновременно
+	stmt, err := s.db.Prepare("UPDATE user_mfa SET last_used_step = ? WHERE user_id = ? AND last_used_step < ?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, step, userID, step)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrMFACodeReused)
+	}
+
+	return nil
+}
+
+// UseRecoveryCode marks user's recovery code used.
+// Returns storage.ErrRecoveryCodeNotFound if there is no such unused code.
+func (s *Storage) UseRecoveryCode(ctx context.Context, userID int64, codeHash string, usedAt time.Time) error {
+	const op = "storage.sqlite.UseRecoveryCode"
+
+	stmt, err := s.db.Prepare("UPDATE mfa_recovery_codes SET used_at = ? WHERE id = (SELECT id FROM mfa_recovery_codes WHERE user_id = ? AND code_hash = ? AND used_at IS NULL LIMIT 1)")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, usedAt.Unix(), userID, codeHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrRecoveryCodeNotFound)
+	}
+
+	return nil
+}
+
+// DeleteMFA turns MFA off: deletes user's TOTP secret, recovery codes and pending challenges.
+func (s *Storage) DeleteMFA(ctx context.Context, userID int64) error {
+	const op = "storage.sqlite.DeleteMFA"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		"DELETE FROM user_mfa WHERE user_id = ?",
+		"DELETE FROM mfa_recovery_codes WHERE user_id = ?",
+		"DELETE FROM mfa_challenges WHERE user_id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SaveMFAChallenge saves login waiting for the second factor and deletes user's expired ones.
+func (s *Storage) SaveMFAChallenge(ctx context.Context, challenge models.MFAChallenge) error {
+	const op = "storage.sqlite.SaveMFAChallenge"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// Незавершенные входы сами не удаляются, чистим их при следующем входе пользователя
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_challenges WHERE user_id = ? AND expires_at <= ?", challenge.UserID, time.Now().Unix()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO mfa_challenges(token_hash, user_id, app_id, expires_at) VALUES(?, ?, ?, ?)",
+		challenge.TokenHash, challenge.UserID, challenge.AppID, challenge.ExpiresAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// MFAChallenge returns login waiting for the second factor by its token hash.
+func (s *Storage) MFAChallenge(ctx context.Context, tokenHash string) (models.MFAChallenge, error) {
+	const op = "storage.sqlite.MFAChallenge"
+
+	stmt, err := s.db.Prepare("SELECT token_hash, user_id, app_id, expires_at, attempts FROM mfa_challenges WHERE token_hash = ?")
+	if err != nil {
+		return models.MFAChallenge{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var (
+		challenge models.MFAChallenge
+		expiresAt int64
+	)
+	err = stmt.QueryRowContext(ctx, tokenHash).Scan(&challenge.TokenHash, &challenge.UserID, &challenge.AppID, &expiresAt, &challenge.Attempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.MFAChallenge{}, fmt.Errorf("%s: %w", op, storage.ErrMFAChallengeNotFound)
+		}
+
+		return models.MFAChallenge{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	challenge.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return challenge, nil
+}
+
+// RecordMFAChallengeFailure counts wrong code and returns number of wrong codes for the challenge.
+func (s *Storage) RecordMFAChallengeFailure(ctx context.Context, tokenHash string) (int, error) {
+	const op = "storage.sqlite.RecordMFAChallengeFailure"
+
+	stmt, err := s.db.Prepare("UPDATE mfa_challenges SET attempts = attempts + 1 WHERE token_hash = ? RETURNING attempts")
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var attempts int
+	if err := stmt.QueryRowContext(ctx, tokenHash).Scan(&attempts); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrMFAChallengeNotFound)
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return attempts, nil
+}
+
+// DeleteMFAChallenge deletes login waiting for the second factor.
+// Returns storage.ErrMFAChallengeNotFound if it is already deleted, so the challenge can be completed only once.
+func (s *Storage) DeleteMFAChallenge(ctx context.Context, tokenHash string) error {
+	const op = "storage.sqlite.DeleteMFAChallenge"
+
+	stmt, err := s.db.Prepare("DELETE FROM mfa_challenges WHERE token_hash = ?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, tokenHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrMFAChallengeNotFound)
+	}
+
+	return nil
+}
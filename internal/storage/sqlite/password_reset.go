@@ -0,0 +1,161 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/storage"
+)
+
+// SavePasswordResetToken saves new password reset token. Previous tokens of the user stop working.
+func (s *Storage) SavePasswordResetToken(ctx context.Context, token models.PasswordResetToken) error {
+	const op = "storage.sqlite.SavePasswordResetToken"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM password_reset_tokens WHERE user_id = ?", token.UserID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO password_reset_tokens(token_hash, user_id, expires_at) VALUES(?, ?, ?)",
+		token.TokenHash, token.UserID, token.ExpiresAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// PasswordResetToken returns password reset token by its hash.
+func (s *Storage) PasswordResetToken(ctx context.Context, tokenHash string) (models.PasswordResetToken, error) {
+	const op = "storage.sqlite.PasswordResetToken"
+
+	stmt, err := s.db.Prepare("SELECT token_hash, user_id, expires_at, used_at FROM password_reset_tokens WHERE token_hash = ?")
+	if err != nil {
+		return models.PasswordResetToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var (
+		token     models.PasswordResetToken
+		expiresAt int64
+		usedAt    sql.NullInt64
+	)
+	err = stmt.QueryRowContext(ctx, tokenHash).Scan(&token.TokenHash, &token.UserID, &expiresAt, &usedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.PasswordResetToken{}, fmt.Errorf("%s: %w", op, storage.ErrPasswordResetTokenNotFound)
+		}
+
+		return models.PasswordResetToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	token.ExpiresAt = time.Unix(expiresAt, 0)
+	token.UsedAt = unixOrZero(usedAt)
+
+	return token, nil
+}
+
+// ResetPassword sets new password hash by reset token, marks the token used, revokes user's refresh tokens
+// and marks user's email verified.
+// Returns storage.ErrPasswordResetTokenNotFound if the token does not exist, is used or expired.
+func (s *Storage) ResetPassword(ctx context.Context, tokenHash string, passHash []byte, changedAt time.Time) error {
+	const op = "storage.sqlite.ResetPassword"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// Условие на used_at делает токен одноразовым, даже если два запроса пришли одновременно
+	var userID int64
+	err = tx.QueryRowContext(ctx,
+		"UPDATE password_reset_tokens SET used_at = ? WHERE token_hash = ? AND used_at IS NULL AND expires_at > ? RETURNING user_id",
+		changedAt.Unix(), tokenHash, changedAt.Unix(),
+	).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%s: %w", op, storage.ErrPasswordResetTokenNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := setPassword(ctx, tx, userID, passHash, changedAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Токен пришел на почту, значит email принадлежит пользователю
+	if err := setEmailVerified(ctx, tx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ChangePassword sets new password hash of the user and revokes user's refresh tokens and password reset tokens.
+func (s *Storage) ChangePassword(ctx context.Context, userID int64, passHash []byte, changedAt time.Time) error {
+	const op = "storage.sqlite.ChangePassword"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	if err := setPassword(ctx, tx, userID, passHash, changedAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// setPassword меняет пароль и завершает все, что было выдано под старым паролем
+func setPassword(ctx context.Context, tx *sql.Tx, userID int64, passHash []byte, changedAt time.Time) error {
+	res, err := tx.ExecContext(ctx,
+		"UPDATE users SET pass_hash = ?, password_reset_required = FALSE, password_changed_at = ? WHERE id = ?",
+		passHash, changedAt.Unix(), userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return storage.ErrUserNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", changedAt.Unix(), userID); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM password_reset_tokens WHERE user_id = ? AND used_at IS NULL", userID); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/storage"
+)
+
+// SaveRefreshToken saves new refresh token.
+func (s *Storage) SaveRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	const op = "storage.sqlite.SaveRefreshToken"
+
+	stmt, err := s.db.Prepare("INSERT INTO refresh_tokens(token_hash, family_id, user_id, app_id, scope, expires_at) VALUES(?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(ctx, token.TokenHash, token.FamilyID, token.UserID, token.AppID, token.Scope, token.ExpiresAt.Unix())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RefreshToken returns refresh token by its hash.
+func (s *Storage) RefreshToken(ctx context.Context, tokenHash string) (models.RefreshToken, error) {
+	const op = "storage.sqlite.RefreshToken"
+
+	stmt, err := s.db.Prepare("SELECT id, token_hash, family_id, user_id, app_id, scope, expires_at, rotated_at, revoked_at FROM refresh_tokens WHERE token_hash = ?")
+	if err != nil {
+		return models.RefreshToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	row := stmt.QueryRowContext(ctx, tokenHash)
+
+	var (
+		token                models.RefreshToken
+		expiresAt            int64
+		rotatedAt, revokedAt sql.NullInt64
+	)
+	err = row.Scan(&token.ID, &token.TokenHash, &token.FamilyID, &token.UserID, &token.AppID, &token.Scope, &expiresAt, &rotatedAt, &revokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.RefreshToken{}, fmt.Errorf("%s: %w", op, storage.ErrRefreshTokenNotFound)
+		}
+
+		return models.RefreshToken{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	token.ExpiresAt = time.Unix(expiresAt, 0)
+	token.RotatedAt = unixOrZero(rotatedAt)
+	token.RevokedAt = unixOrZero(revokedAt)
+
+	return token, nil
+}
+
+// RotateRefreshToken marks old token as rotated and saves its replacement in one transaction.
+// If old token was already rotated or revoked returns storage.ErrRefreshTokenReused.
+func (s *Storage) RotateRefreshToken(ctx context.Context, oldID int64, newToken models.RefreshToken) error {
+	const op = "storage.sqlite.RotateRefreshToken"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// Условие rotated_at IS NULL защищает от гонки, когда один и тот же токен обменивают два запроса одновременно
+	res, err := tx.ExecContext(ctx,
+		"UPDATE refresh_tokens SET rotated_at = ? WHERE id = ? AND rotated_at IS NULL AND revoked_at IS NULL",
+		time.Now().Unix(), oldID,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrRefreshTokenReused)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO refresh_tokens(token_hash, family_id, user_id, app_id, scope, expires_at) VALUES(?, ?, ?, ?, ?, ?)",
+		newToken.TokenHash, newToken.FamilyID, newToken.UserID, newToken.AppID, newToken.Scope, newToken.ExpiresAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeRefreshTokenFamily revokes all refresh tokens of the family.
+func (s *Storage) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	const op = "storage.sqlite.RevokeRefreshTokenFamily"
+
+	stmt, err := s.db.Prepare("UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(ctx, time.Now().Unix(), familyID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes all refresh tokens of the user in all apps.
+func (s *Storage) RevokeUserRefreshTokens(ctx context.Context, userID int64) error {
+	const op = "storage.sqlite.RevokeUserRefreshTokens"
+
+	stmt, err := s.db.Prepare("UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(ctx, time.Now().Unix(), userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func unixOrZero(v sql.NullInt64) time.Time {
+	if !v.Valid {
+		return time.Time{}
+	}
+
+	return time.Unix(v.Int64, 0)
+}
@@ -0,0 +1,79 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RevokeToken saves revoked token id until the token expires.
+func (s *Storage) RevokeToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	const op = "storage.sqlite.RevokeToken"
+
+	stmt, err := s.db.Prepare("INSERT OR IGNORE INTO revoked_tokens(token_id, expires_at) VALUES(?, ?)")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(ctx, tokenID, expiresAt.Unix())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokedTokens returns ids of revoked tokens which are not expired yet.
+func (s *Storage) RevokedTokens(ctx context.Context) (map[string]time.Time, error) {
+	const op = "storage.sqlite.RevokedTokens"
+
+	stmt, err := s.db.Prepare("SELECT token_id, expires_at FROM revoked_tokens WHERE expires_at >= ?")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, time.Now().Unix())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	tokens := make(map[string]time.Time)
+	for rows.Next() {
+		var (
+			tokenID   string
+			expiresAt int64
+		)
+		if err := rows.Scan(&tokenID, &expiresAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		tokens[tokenID] = time.Unix(expiresAt, 0)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tokens, nil
+}
+
+// DeleteExpiredRevokedTokens deletes revoked tokens which expired anyway.
+func (s *Storage) DeleteExpiredRevokedTokens(ctx context.Context) (int64, error) {
+	const op = "storage.sqlite.DeleteExpiredRevokedTokens"
+
+	stmt, err := s.db.Prepare("DELETE FROM revoked_tokens WHERE expires_at < ?")
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, time.Now().Unix())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deleted, nil
+}
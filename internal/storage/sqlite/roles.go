@@ -0,0 +1,188 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+
+	"sso/internal/domain/models"
+	"sso/internal/storage"
+)
+
+// SaveRole saves new role of the app.
+func (s *Storage) SaveRole(ctx context.Context, appID int, name string) (int64, error) {
+	const op = "storage.sqlite.SaveRole"
+
+	stmt, err := s.db.Prepare("INSERT INTO roles(app_id, name) VALUES(?, ?)")
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, appID, name)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return 0, fmt.Errorf("%s: %w", op, storage.ErrRoleExists)
+		}
+
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// SavePermission grants permission to the role.
+func (s *Storage) SavePermission(ctx context.Context, roleID int64, permission string) error {
+	const op = "storage.sqlite.SavePermission"
+
+	stmt, err := s.db.Prepare("INSERT OR IGNORE INTO role_permissions(role_id, permission) VALUES(?, ?)")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(ctx, roleID, permission)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Role returns role of the app by name.
+func (s *Storage) Role(ctx context.Context, appID int, name string) (models.Role, error) {
+	const op = "storage.sqlite.Role"
+
+	roles, err := s.roles(ctx,
+		"SELECT r.id, r.app_id, r.name, rp.permission FROM roles r LEFT JOIN role_permissions rp ON rp.role_id = r.id WHERE r.app_id = ? AND r.name = ? ORDER BY rp.permission",
+		appID, name,
+	)
+	if err != nil {
+		return models.Role{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(roles) == 0 {
+		return models.Role{}, fmt.Errorf("%s: %w", op, storage.ErrRoleNotFound)
+	}
+
+	return roles[0], nil
+}
+
+// AssignRole assigns role to the user, assigning the same role twice is not an error.
+func (s *Storage) AssignRole(ctx context.Context, userID int64, roleID int64) error {
+	const op = "storage.sqlite.AssignRole"
+
+	stmt, err := s.db.Prepare("INSERT OR IGNORE INTO user_roles(user_id, role_id) VALUES(?, ?)")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(ctx, userID, roleID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UnassignRole removes role from the user.
+func (s *Storage) UnassignRole(ctx context.Context, userID int64, roleID int64) error {
+	const op = "storage.sqlite.UnassignRole"
+
+	stmt, err := s.db.Prepare("DELETE FROM user_roles WHERE user_id = ? AND role_id = ?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(ctx, userID, roleID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UserRoles returns roles of the user in the app with their permissions.
+func (s *Storage) UserRoles(ctx context.Context, userID int64, appID int) ([]models.Role, error) {
+	const op = "storage.sqlite.UserRoles"
+
+	roles, err := s.roles(ctx, `
+		SELECT r.id, r.app_id, r.name, rp.permission
+		FROM user_roles ur
+			JOIN roles r ON r.id = ur.role_id
+			LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		WHERE ur.user_id = ? AND r.app_id = ?
+		ORDER BY r.name, rp.permission`,
+		userID, appID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return roles, nil
+}
+
+// HasPermission checks if any role of the user in the app grants the permission.
+func (s *Storage) HasPermission(ctx context.Context, userID int64, appID int, permission string) (bool, error) {
+	const op = "storage.sqlite.HasPermission"
+
+	stmt, err := s.db.Prepare(`
+		SELECT EXISTS(
+			SELECT 1
+			FROM user_roles ur
+				JOIN roles r ON r.id = ur.role_id
+				JOIN role_permissions rp ON rp.role_id = r.id
+			WHERE ur.user_id = ? AND r.app_id = ? AND rp.permission = ?
+		)`)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var allowed bool
+	if err := stmt.QueryRowContext(ctx, userID, appID, permission).Scan(&allowed); err != nil {
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return allowed, nil
+}
+
+// roles собирает роли из строк role x permission, строки одной роли должны идти подряд
+func (s *Storage) roles(ctx context.Context, query string, args ...any) ([]models.Role, error) {
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+	for rows.Next() {
+		var (
+			role       models.Role
+			permission sql.NullString
+		)
+		if err := rows.Scan(&role.ID, &role.AppID, &role.Name, &permission); err != nil {
+			return nil, err
+		}
+
+		if len(roles) == 0 || roles[len(roles)-1].ID != role.ID {
+			roles = append(roles, role)
+		}
+		if permission.Valid {
+			last := &roles[len(roles)-1]
+			last.Permissions = append(last.Permissions, permission.String)
+		}
+	}
+
+	return roles, rows.Err()
+}
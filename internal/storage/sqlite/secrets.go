@@ -0,0 +1,120 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Cipher шифрует секреты приложений, приватные ключи подписи и TOTP секреты пользователей перед записью в БД.
+// Значения, записанные до появления шифрования, Decrypt должен возвращать как есть
+type Cipher interface {
+	Encrypt(plaintext []byte) (string, error)
+	Decrypt(value string) ([]byte, error)
+	Reencrypt(value string) (string, bool, error)
+}
+
+// ReencryptSecrets encrypts plaintext app secrets, private keys and TOTP secrets and moves encrypted ones to the current master key.
+// Returns number of updated rows.
+func (s *Storage) ReencryptSecrets(ctx context.Context) (int64, error) {
+	const op = "storage.sqlite.ReencryptSecrets"
+
+	if s.cipher == nil {
+		return 0, fmt.Errorf("%s: encryption is not configured", op)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var updated int64
+	for _, table := range []struct {
+		selectQuery string
+		updateQuery string
+	}{
+		{
+			selectQuery: "SELECT id, secret FROM apps",
+			updateQuery: "UPDATE apps SET secret = ? WHERE id = ?",
+		},
+		{
+			selectQuery: "SELECT kid, private_key FROM signing_keys",
+			updateQuery: "UPDATE signing_keys SET private_key = ? WHERE kid = ?",
+		},
+		{
+			selectQuery: "SELECT user_id, secret FROM user_mfa",
+			updateQuery: "UPDATE user_mfa SET secret = ? WHERE user_id = ?",
+		},
+	} {
+		values, err := queryValues(ctx, tx, table.selectQuery)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+
+		for id, value := range values {
+			reencrypted, changed, err := s.cipher.Reencrypt(value)
+			if err != nil {
+				return 0, fmt.Errorf("%s: %v: %w", op, id, err)
+			}
+			if !changed {
+				continue
+			}
+
+			if _, err := tx.ExecContext(ctx, table.updateQuery, reencrypted, id); err != nil {
+				return 0, fmt.Errorf("%s: %w", op, err)
+			}
+			updated++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return updated, nil
+}
+
+// encrypt шифрует значение перед записью, без настроенного шифрования пишет как есть
+func (s *Storage) encrypt(plaintext []byte) (string, error) {
+	if s.cipher == nil {
+		return string(plaintext), nil
+	}
+
+	return s.cipher.Encrypt(plaintext)
+}
+
+func (s *Storage) decrypt(value string) ([]byte, error) {
+	if s.cipher == nil {
+		return []byte(value), nil
+	}
+
+	return s.cipher.Decrypt(value)
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// queryValues читает пары id - значение, id может быть числом или строкой
+func queryValues(ctx context.Context, q querier, query string) (map[any]string, error) {
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[any]string)
+	for rows.Next() {
+		var (
+			id    any
+			value []byte
+		)
+		if err := rows.Scan(&id, &value); err != nil {
+			return nil, err
+		}
+		values[id] = string(value)
+	}
+
+	return values, rows.Err()
+}
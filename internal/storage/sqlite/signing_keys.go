@@ -0,0 +1,176 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/storage"
+)
+
+const signingKeyColumns = "kid, app_id, alg, private_key, status, created_at, activated_at, retired_at, expires_at"
+
+// SaveSigningKey saves new signing key.
+func (s *Storage) SaveSigningKey(ctx context.Context, key models.SigningKey) error {
+	const op = "storage.sqlite.SaveSigningKey"
+
+	stmt, err := s.db.Prepare("INSERT INTO signing_keys(kid, app_id, alg, private_key, status, created_at, activated_at) VALUES(?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	privateKey, err := s.encrypt(key.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(ctx, key.ID, key.AppID, key.Alg, privateKey, key.Status, key.CreatedAt.Unix(), nullUnix(key.ActivatedAt))
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SigningKeys returns all published signing keys of the app.
+func (s *Storage) SigningKeys(ctx context.Context, appID int) ([]models.SigningKey, error) {
+	const op = "storage.sqlite.SigningKeys"
+
+	stmt, err := s.db.Prepare("SELECT " + signingKeyColumns + " FROM signing_keys WHERE app_id = ? ORDER BY created_at")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, appID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	keys, err := s.scanSigningKeys(rows)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+// RotateSigningKeys retires active key of the app, promotes next key to active and saves new next key.
+// Retired key stays published until retiredUntil.
+func (s *Storage) RotateSigningKeys(ctx context.Context, appID int, next models.SigningKey, retiredUntil time.Time) error {
+	const op = "storage.sqlite.RotateSigningKeys"
+
+	privateKey, err := s.encrypt(next.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE signing_keys SET status = ?, retired_at = ?, expires_at = ? WHERE app_id = ? AND status = ?",
+		models.SigningKeyRetired, now, retiredUntil.Unix(), appID, models.SigningKeyActive,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := tx.ExecContext(ctx,
+		"UPDATE signing_keys SET status = ?, activated_at = ? WHERE app_id = ? AND status = ?",
+		models.SigningKeyActive, now, appID, models.SigningKeyNext,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	// Без next ключа приложение осталось бы вообще без активного ключа
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrSigningKeyNotFound)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO signing_keys(kid, app_id, alg, private_key, status, created_at) VALUES(?, ?, ?, ?, ?, ?)",
+		next.ID, appID, next.Alg, privateKey, models.SigningKeyNext, now,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredSigningKeys deletes retired keys that no longer have live tokens.
+func (s *Storage) DeleteExpiredSigningKeys(ctx context.Context) (int64, error) {
+	const op = "storage.sqlite.DeleteExpiredSigningKeys"
+
+	stmt, err := s.db.Prepare("DELETE FROM signing_keys WHERE status = ? AND expires_at < ?")
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, models.SigningKeyRetired, time.Now().Unix())
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deleted, nil
+}
+
+func (s *Storage) scanSigningKeys(rows *sql.Rows) ([]models.SigningKey, error) {
+	defer rows.Close()
+
+	var keys []models.SigningKey
+	for rows.Next() {
+		var (
+			key                              models.SigningKey
+			createdAt                        int64
+			activatedAt, retiredAt, expireAt sql.NullInt64
+		)
+		err := rows.Scan(&key.ID, &key.AppID, &key.Alg, &key.PrivateKey, &key.Status, &createdAt, &activatedAt, &retiredAt, &expireAt)
+		if err != nil {
+			return nil, err
+		}
+
+		key.PrivateKey, err = s.decrypt(string(key.PrivateKey))
+		if err != nil {
+			return nil, err
+		}
+
+		key.CreatedAt = time.Unix(createdAt, 0)
+		key.ActivatedAt = unixOrZero(activatedAt)
+		key.RetiredAt = unixOrZero(retiredAt)
+		key.ExpiresAt = unixOrZero(expireAt)
+
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func nullUnix(t time.Time) sql.NullInt64 {
+	if t.IsZero() {
+		return sql.NullInt64{}
+	}
+
+	return sql.NullInt64{Int64: t.Unix(), Valid: true}
+}
@@ -5,6 +5,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 	"sso/internal/domain/models"
 	"sso/internal/storage"
 
@@ -13,9 +15,11 @@ import (
 
 type Storage struct {
 	db *sql.DB
+	cipher Cipher
 }
 
-func New(storagePath string) (*Storage, error) {
+// New открывает БД, cipher шифрует секреты приложений, приватные ключи и TOTP секреты, если он nil - они хранятся открытым текстом
+func New(storagePath string, cipher Cipher) (*Storage, error) {
 	const op = "storage.sqlite.New"
 
 	db, err := sql.Open("sqlite3", storagePath)
@@ -23,7 +27,7 @@ func New(storagePath string) (*Storage, error) {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &Storage{db: db}, nil
+	return &Storage{db: db, cipher: cipher}, nil
 }
 
 func (s *Storage) Stop() error {
@@ -67,15 +71,14 @@ func (s *Storage) SaveUser(ctx context.Context, email string, passHash []byte) (
 func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
 	const op = "storage.sqlite.User"
 
-	stmt, err := s.db.Prepare("SELECT id, email, pass_hash FROM users WHERE email = ?")
+	stmt, err := s.db.Prepare("SELECT " + userColumns + " FROM users WHERE email = ?")
 	if err != nil {
 		return models.User{}, fmt.Errorf("%s: %w", op, err)
 	}
 
 	row := stmt.QueryRowContext(ctx, email)
 
-	var user models.User
-	err = row.Scan(&user.ID, &user.Email, &user.PassHash)
+	user, err := scanUser(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
@@ -87,35 +90,41 @@ func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
 	return user, nil
 }
 
-//func (s *Storage) SavePermission(ctx context.Context, userID int64, permission models.Permission, appID string) error {
-//	const op = "storage.sqlite.SavePermission"
-//
-//	stmt, err := s.db.Prepare("INSERT INTO permissions(user_id, permission, app_id) VALUES(?, ?, ?)")
-//	if err != nil {
-//		return fmt.Errorf("%s: %w", op, err)
-//	}
-//
-//	_, err = stmt.ExecContext(ctx, userID, permission, appID)
-//	if err != nil {
-//		return fmt.Errorf("%s: %w", op, err)
-//	}
-//
-//	return nil
-//}
+// UserByID returns user by id.
+func (s *Storage) UserByID(ctx context.Context, userID int64) (models.User, error) {
+	const op = "storage.sqlite.UserByID"
+
+	stmt, err := s.db.Prepare("SELECT " + userColumns + " FROM users WHERE id = ?")
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	row := stmt.QueryRowContext(ctx, userID)
+
+	user, err := scanUser(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		}
+
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
 
 // App returns app by id.
 func (s *Storage) App(ctx context.Context, id int) (models.App, error) {
 	const op = "storage.sqlite.App"
 
-	stmt, err := s.db.Prepare("SELECT id, name, secret FROM apps WHERE id = ?")
+	stmt, err := s.db.Prepare("SELECT " + appColumns + " FROM apps WHERE id = ?")
 	if err != nil {
 		return models.App{}, fmt.Errorf("%s: %w", op, err)
 	}
 
 	row := stmt.QueryRowContext(ctx, id)
 
-	var app models.App
-	err = row.Scan(&app.ID, &app.Name, &app.Secret)
+	app, err := s.scanApp(row)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return models.App{}, fmt.Errorf("%s: %w", op, storage.ErrAppNotFound)
@@ -127,10 +136,83 @@ func (s *Storage) App(ctx context.Context, id int) (models.App, error) {
 	return app, nil
 }
 
+// AsymmetricApps returns apps which sign tokens with RS256, ES256 or EdDSA.
+func (s *Storage) AsymmetricApps(ctx context.Context) ([]models.App, error) {
+	const op = "storage.sqlite.AsymmetricApps"
+
+	stmt, err := s.db.Prepare("SELECT " + appColumns + " FROM apps WHERE signing_alg != 'HS256'")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var apps []models.App
+	for rows.Next() {
+		app, err := s.scanApp(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		apps = append(apps, app)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return apps, nil
+}
+
+const appColumns = "id, name, secret, signing_alg, signing_key, token_ttl, refresh_token_ttl, claims, redirect_uris, grant_types, scopes, client_public_key, public, enabled"
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func (s *Storage) scanApp(row scanner) (models.App, error) {
+	var (
+		app                       models.App
+		tokenTTL, refreshTokenTTL int64
+		claims                    string
+		redirectURIs, grantTypes  string
+		scopes                    string
+	)
+	err := row.Scan(
+		&app.ID, &app.Name, &app.Secret, &app.SigningAlg, &app.SigningKey, &tokenTTL, &refreshTokenTTL, &claims,
+		&redirectURIs, &grantTypes, &scopes, &app.ClientPublicKey, &app.Public, &app.Enabled,
+	)
+	if err != nil {
+		return models.App{}, err
+	}
+
+	app.TokenTTL = time.Duration(tokenTTL) * time.Second
+	app.RefreshTokenTTL = time.Duration(refreshTokenTTL) * time.Second
+	for _, claim := range strings.Split(claims, ",") {
+		if claim = strings.TrimSpace(claim); claim != "" {
+			app.Claims = append(app.Claims, claim)
+		}
+	}
+	app.RedirectURIs = strings.Fields(redirectURIs)
+	app.GrantTypes = strings.Fields(grantTypes)
+	app.Scopes = strings.Fields(scopes)
+
+	secret, err := s.decrypt(app.Secret)
+	if err != nil {
+		return models.App{}, err
+	}
+	app.Secret = string(secret)
+
+	return app, nil
+}
+
+// IsAdmin checks if the user has the SSO admin permission.
 func (s *Storage) IsAdmin(ctx context.Context, userID int64) (bool, error) {
 	const op = "storage.sqlite.IsAdmin"
 
-	stmt, err := s.db.Prepare("SELECT is_admin FROM users WHERE id = ?")
+	stmt, err := s.db.Prepare("SELECT " + isAdminColumn + " FROM users WHERE id = ?")
 	if err != nil {
 		return false, fmt.Errorf("%s: %w", op, err)
 	}
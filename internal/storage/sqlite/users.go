@@ -0,0 +1,228 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/storage"
+)
+
+// isAdminColumn - есть ли у пользователя разрешение администратора SSO
+// (models.PermissionAdmin в роли приложения models.SystemAppID)
+const isAdminColumn = `EXISTS(
+	SELECT 1
+	FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		JOIN role_permissions rp ON rp.role_id = r.id
+	WHERE ur.user_id = users.id AND r.app_id = 0 AND rp.permission = 'sso:admin'
+)`
+
+const userColumns = "id, email, pass_hash, " + isAdminColumn + ", disabled, password_reset_required, password_changed_at, email_verified"
+
+// Users returns users matching the filter ordered by id.
+func (s *Storage) Users(ctx context.Context, filter models.UserFilter) ([]models.User, error) {
+	const op = "storage.sqlite.Users"
+
+	var (
+		where []string
+		args  []any
+	)
+	where = append(where, "id > ?")
+	args = append(args, filter.AfterID)
+
+	if filter.Email != "" {
+		where = append(where, "email LIKE ? ESCAPE '\\'")
+		args = append(args, "%"+escapeLike(filter.Email)+"%")
+	}
+	if filter.IsAdmin != nil {
+		where = append(where, isAdminColumn+" = ?")
+		args = append(args, *filter.IsAdmin)
+	}
+	if filter.Disabled != nil {
+		where = append(where, "disabled = ?")
+		args = append(args, *filter.Disabled)
+	}
+	args = append(args, filter.Limit)
+
+	stmt, err := s.db.Prepare("SELECT " + userColumns + " FROM users WHERE " + strings.Join(where, " AND ") + " ORDER BY id LIMIT ?")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return users, nil
+}
+
+// SetUserDisabled disables or enables the user.
+func (s *Storage) SetUserDisabled(ctx context.Context, userID int64, disabled bool) error {
+	const op = "storage.sqlite.SetUserDisabled"
+
+	if err := s.updateUser(ctx, "UPDATE users SET disabled = ? WHERE id = ?", disabled, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SetPasswordResetRequired marks that the user must reset password before next login.
+func (s *Storage) SetPasswordResetRequired(ctx context.Context, userID int64, required bool) error {
+	const op = "storage.sqlite.SetPasswordResetRequired"
+
+	if err := s.updateUser(ctx, "UPDATE users SET password_reset_required = ? WHERE id = ?", required, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// SetAdmin assigns the SSO admin role to the user or removes it.
+func (s *Storage) SetAdmin(ctx context.Context, userID int64, isAdmin bool) error {
+	const op = "storage.sqlite.SetAdmin"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", userID).Scan(&exists); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !exists {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	query := "DELETE FROM user_roles WHERE user_id = ? AND role_id IN (SELECT id FROM roles WHERE app_id = ? AND name = ?)"
+	if isAdmin {
+		query = "INSERT OR IGNORE INTO user_roles(user_id, role_id) SELECT ?, id FROM roles WHERE app_id = ? AND name = ?"
+	}
+	if _, err := tx.ExecContext(ctx, query, userID, models.SystemAppID, models.RoleAdmin); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UpdatePassHash replaces password hash of the user.
+func (s *Storage) UpdatePassHash(ctx context.Context, userID int64, passHash []byte) error {
+	const op = "storage.sqlite.UpdatePassHash"
+
+	if err := s.updateUser(ctx, "UPDATE users SET pass_hash = ? WHERE id = ?", passHash, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteUser deletes the user with roles and refresh tokens.
+func (s *Storage) DeleteUser(ctx context.Context, userID int64) error {
+	const op = "storage.sqlite.DeleteUser"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// Внешние ключи в sqlite по умолчанию выключены, поэтому ON DELETE CASCADE не сработает, удаляем сами
+	for _, query := range []string{
+		"DELETE FROM user_roles WHERE user_id = ?",
+		"DELETE FROM refresh_tokens WHERE user_id = ?",
+		"DELETE FROM password_reset_tokens WHERE user_id = ?",
+		"DELETE FROM email_verification_tokens WHERE user_id = ?",
+		"DELETE FROM user_mfa WHERE user_id = ?",
+		"DELETE FROM mfa_recovery_codes WHERE user_id = ?",
+		"DELETE FROM mfa_challenges WHERE user_id = ?",
+		"DELETE FROM webauthn_credentials WHERE user_id = ?",
+		"DELETE FROM webauthn_sessions WHERE user_id = ?",
+		"DELETE FROM authorization_codes WHERE user_id = ?",
+		"DELETE FROM device_codes WHERE user_id = ?",
+	} {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) updateUser(ctx context.Context, query string, args ...any) error {
+	stmt, err := s.db.Prepare(query)
+	if err != nil {
+		return err
+	}
+
+	res, err := stmt.ExecContext(ctx, args...)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return storage.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func scanUser(row scanner) (models.User, error) {
+	var (
+		user              models.User
+		passwordChangedAt int64
+	)
+	err := row.Scan(&user.ID, &user.Email, &user.PassHash, &user.IsAdmin, &user.Disabled, &user.PasswordResetRequired, &passwordChangedAt, &user.EmailVerified)
+	if passwordChangedAt != 0 {
+		user.PasswordChangedAt = time.Unix(passwordChangedAt, 0)
+	}
+
+	return user, err
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,192 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"sso/internal/domain/models"
+	"sso/internal/storage"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// SaveWebAuthnSession saves started WebAuthn registration or login and deletes expired ones.
+func (s *Storage) SaveWebAuthnSession(ctx context.Context, session models.WebAuthnSession) error {
+	const op = "storage.sqlite.SaveWebAuthnSession"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	// Брошенные сессии сами не удаляются, а начать вход может кто угодно, поэтому чистим все протухшие
+	if _, err := tx.ExecContext(ctx, "DELETE FROM webauthn_sessions WHERE expires_at <= ?", time.Now().Unix()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO webauthn_sessions(challenge_hash, kind, user_id, app_id, expires_at) VALUES(?, ?, ?, ?, ?)",
+		session.ChallengeHash, session.Kind, session.UserID, session.AppID, session.ExpiresAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// TakeWebAuthnSession deletes WebAuthn session and returns it, so each session can be finished only once.
+func (s *Storage) TakeWebAuthnSession(ctx context.Context, challengeHash string) (models.WebAuthnSession, error) {
+	const op = "storage.sqlite.TakeWebAuthnSession"
+
+	stmt, err := s.db.Prepare("DELETE FROM webauthn_sessions WHERE challenge_hash = ? RETURNING challenge_hash, kind, user_id, app_id, expires_at")
+	if err != nil {
+		return models.WebAuthnSession{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var (
+		session   models.WebAuthnSession
+		expiresAt int64
+	)
+	err = stmt.QueryRowContext(ctx, challengeHash).Scan(&session.ChallengeHash, &session.Kind, &session.UserID, &session.AppID, &expiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.WebAuthnSession{}, fmt.Errorf("%s: %w", op, storage.ErrWebAuthnSessionNotFound)
+		}
+
+		return models.WebAuthnSession{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	session.ExpiresAt = time.Unix(expiresAt, 0)
+
+	return session, nil
+}
+
+// SaveWebAuthnCredential saves new WebAuthn credential.
+func (s *Storage) SaveWebAuthnCredential(ctx context.Context, credential models.WebAuthnCredential) error {
+	const op = "storage.sqlite.SaveWebAuthnCredential"
+
+	stmt, err := s.db.Prepare("INSERT INTO webauthn_credentials(id, user_id, public_key, sign_count, name, created_at) VALUES(?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = stmt.ExecContext(ctx,
+		credential.ID, credential.UserID, credential.PublicKey, credential.SignCount, credential.Name, credential.CreatedAt.Unix(),
+	)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+			return fmt.Errorf("%s: %w", op, storage.ErrWebAuthnCredentialExists)
+		}
+
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// WebAuthnCredential returns WebAuthn credential by its id.
+func (s *Storage) WebAuthnCredential(ctx context.Context, id []byte) (models.WebAuthnCredential, error) {
+	const op = "storage.sqlite.WebAuthnCredential"
+
+	stmt, err := s.db.Prepare("SELECT " + webAuthnCredentialColumns + " FROM webauthn_credentials WHERE id = ?")
+	if err != nil {
+		return models.WebAuthnCredential{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	credential, err := scanWebAuthnCredential(stmt.QueryRowContext(ctx, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.WebAuthnCredential{}, fmt.Errorf("%s: %w", op, storage.ErrWebAuthnCredentialNotFound)
+		}
+
+		return models.WebAuthnCredential{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return credential, nil
+}
+
+// WebAuthnCredentials returns all WebAuthn credentials of the user.
+func (s *Storage) WebAuthnCredentials(ctx context.Context, userID int64) ([]models.WebAuthnCredential, error) {
+	const op = "storage.sqlite.WebAuthnCredentials"
+
+	stmt, err := s.db.Prepare("SELECT " + webAuthnCredentialColumns + " FROM webauthn_credentials WHERE user_id = ? ORDER BY created_at")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	rows, err := stmt.QueryContext(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var credentials []models.WebAuthnCredential
+	for rows.Next() {
+		credential, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		credentials = append(credentials, credential)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return credentials, nil
+}
+
+// UpdateWebAuthnSignCount saves new sign count after login.
+// Returns storage.ErrWebAuthnCredentialNotFound if the count was changed by another login since it was read.
+func (s *Storage) UpdateWebAuthnSignCount(ctx context.Context, id []byte, oldCount uint32, newCount uint32, usedAt time.Time) error {
+	const op = "storage.sqlite.UpdateWebAuthnSignCount"
+
+	// Условие на старое значение не дает двум входам с одним счетчиком пройти одновременно
+	stmt, err := s.db.Prepare("UPDATE webauthn_credentials SET sign_count = ?, last_used_at = ? WHERE id = ? AND sign_count = ?")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := stmt.ExecContext(ctx, newCount, usedAt.Unix(), id, oldCount)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s: %w", op, storage.ErrWebAuthnCredentialNotFound)
+	}
+
+	return nil
+}
+
+const webAuthnCredentialColumns = "id, user_id, public_key, sign_count, name, created_at, last_used_at"
+
+func scanWebAuthnCredential(row scanner) (models.WebAuthnCredential, error) {
+	var (
+		credential models.WebAuthnCredential
+		createdAt  int64
+		lastUsedAt sql.NullInt64
+	)
+	err := row.Scan(&credential.ID, &credential.UserID, &credential.PublicKey, &credential.SignCount, &credential.Name, &createdAt, &lastUsedAt)
+	if err != nil {
+		return models.WebAuthnCredential{}, err
+	}
+
+	credential.CreatedAt = time.Unix(createdAt, 0)
+	credential.LastUsedAt = unixOrZero(lastUsedAt)
+
+	return credential, nil
+}
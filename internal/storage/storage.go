@@ -6,4 +6,25 @@ var (
 	ErrUserExists = errors.New("User already exists")
 	ErrUserNotFound = errors.New("User not found")
 	ErrAppNotFound = errors.New("App not found")
-)
\ No newline at end of file
+	ErrAppExists = errors.New("App already exists")
+	ErrRefreshTokenNotFound = errors.New("Refresh token not found")
+	ErrRefreshTokenReused = errors.New("Refresh token already rotated")
+	ErrSigningKeyNotFound = errors.New("Signing key not found")
+	ErrRoleExists = errors.New("Role already exists")
+	ErrRoleNotFound = errors.New("Role not found")
+	ErrPasswordResetTokenNotFound = errors.New("Password reset token not found")
+	ErrEmailVerificationTokenNotFound = errors.New("Email verification token not found")
+	ErrMFANotFound = errors.New("MFA not found")
+	ErrMFAExists = errors.New("MFA already enabled")
+	ErrMFACodeReused = errors.New("MFA code already used")
+	ErrRecoveryCodeNotFound = errors.New("Recovery code not found")
+	ErrMFAChallengeNotFound = errors.New("MFA challenge not found")
+	ErrWebAuthnSessionNotFound = errors.New("WebAuthn session not found")
+	ErrWebAuthnCredentialNotFound = errors.New("WebAuthn credential not found")
+	ErrWebAuthnCredentialExists = errors.New("WebAuthn credential already exists")
+	ErrAuthorizationCodeNotFound = errors.New("Authorization code not found")
+	ErrAuthorizationCodeUsed = errors.New("Authorization code already used")
+	ErrClientAssertionUsed = errors.New("Client assertion already used")
+	ErrDeviceCodeNotFound = errors.New("Device code not found")
+	ErrDeviceCodeExists = errors.New("Device code already exists")
+)
@@ -0,0 +1,3 @@
+ALTER TABLE apps DROP COLUMN enabled;
+ALTER TABLE apps DROP COLUMN grant_types;
+ALTER TABLE apps DROP COLUMN redirect_uris;
@@ -0,0 +1,8 @@
+-- Списки хранятся через пробел, как в OAuth2: пробел не может встретиться ни в URI, ни в названии grant type
+ALTER TABLE apps
+    ADD COLUMN redirect_uris TEXT NOT NULL DEFAULT '';
+ALTER TABLE apps
+    ADD COLUMN grant_types TEXT NOT NULL DEFAULT 'password refresh_token';
+-- Отключенное приложение не может получать новые токены, его токены перестают приниматься
+ALTER TABLE apps
+    ADD COLUMN enabled BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,8 @@
+-- Счетчики неудачных попыток входа. subject - "email:<email>" для учетной записи или "ip:<адрес>" для источника запросов
+-- Считаем по email, а не по id пользователя, чтобы несуществующий email блокировался так же, как существующий
+CREATE TABLE IF NOT EXISTS login_failures
+(
+    subject        TEXT PRIMARY KEY,
+    failures       INTEGER NOT NULL,
+    last_failed_at INTEGER NOT NULL -- unix время в миллисекундах, задержки между попытками бывают меньше секунды
+);
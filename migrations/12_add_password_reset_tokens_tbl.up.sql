@@ -0,0 +1,12 @@
+-- Токены сброса пароля, храним только sha256 хэш токена, как и у refresh токенов
+CREATE TABLE IF NOT EXISTS password_reset_tokens
+(
+    token_hash TEXT PRIMARY KEY,
+    user_id    INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL, -- unix время
+    used_at    INTEGER           -- NULL - токен еще не использован
+);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user_id ON password_reset_tokens (user_id);
+-- Access токены, выпущенные до смены пароля, перестают приниматься. 0 - пароль не меняли
+ALTER TABLE users
+    ADD COLUMN password_changed_at INTEGER NOT NULL DEFAULT 0;
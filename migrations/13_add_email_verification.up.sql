@@ -0,0 +1,12 @@
+-- Токены подтверждения email, храним только sha256 хэш токена
+CREATE TABLE IF NOT EXISTS email_verification_tokens
+(
+    token_hash TEXT PRIMARY KEY,
+    user_id    INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL -- unix время
+);
+CREATE INDEX IF NOT EXISTS idx_email_verification_tokens_user_id ON email_verification_tokens (user_id);
+ALTER TABLE users
+    ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+-- Пользователи, зарегистрированные до подтверждения email, считаются подтвержденными, иначе они не смогли бы войти
+UPDATE users SET email_verified = TRUE;
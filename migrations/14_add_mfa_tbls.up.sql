@@ -0,0 +1,28 @@
+-- TOTP второго фактора. secret зашифрован мастер ключом, как секреты приложений
+-- confirmed_at NULL - пользователь начал подключение, но еще не ввел первый код, вход такой секрет не требует
+CREATE TABLE IF NOT EXISTS user_mfa
+(
+    user_id        INTEGER PRIMARY KEY,
+    secret         TEXT    NOT NULL,
+    confirmed_at   INTEGER,
+    last_used_step INTEGER NOT NULL DEFAULT 0 -- шаг последнего принятого кода, один код нельзя использовать дважды
+);
+-- Одноразовые коды восстановления на случай потери телефона, храним только sha256 хэш
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes
+(
+    id        INTEGER PRIMARY KEY,
+    user_id   INTEGER NOT NULL,
+    code_hash TEXT    NOT NULL,
+    used_at   INTEGER
+);
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes (user_id);
+-- Вход, который ждет второй фактор: пароль уже проверен, токены выдаст VerifyMFA
+CREATE TABLE IF NOT EXISTS mfa_challenges
+(
+    token_hash TEXT PRIMARY KEY,
+    user_id    INTEGER NOT NULL,
+    app_id     INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL,          -- unix время
+    attempts   INTEGER NOT NULL DEFAULT 0 -- неверные коды
+);
+CREATE INDEX IF NOT EXISTS idx_mfa_challenges_user_id ON mfa_challenges (user_id);
@@ -0,0 +1,21 @@
+-- Учетные данные WebAuthn (passkey): открытый ключ, который аутентификатор создал при регистрации
+CREATE TABLE IF NOT EXISTS webauthn_credentials
+(
+    id           BLOB PRIMARY KEY, -- credential id, его выбирает аутентификатор
+    user_id      INTEGER NOT NULL,
+    public_key   BLOB    NOT NULL, -- COSE_Key
+    sign_count   INTEGER NOT NULL DEFAULT 0,
+    name         TEXT    NOT NULL DEFAULT '',
+    created_at   INTEGER NOT NULL, -- unix время
+    last_used_at INTEGER
+);
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials (user_id);
+-- Начатые регистрации и входы, ждущие ответа аутентификатора. Храним sha256 хэш вызова, сессия одноразовая
+CREATE TABLE IF NOT EXISTS webauthn_sessions
+(
+    challenge_hash TEXT PRIMARY KEY,
+    kind           TEXT    NOT NULL,           -- registration или login
+    user_id        INTEGER NOT NULL DEFAULT 0, -- 0 - вход без email, пользователя назовет сам аутентификатор
+    app_id         INTEGER NOT NULL DEFAULT 0, -- только для входа
+    expires_at     INTEGER NOT NULL            -- unix время
+);
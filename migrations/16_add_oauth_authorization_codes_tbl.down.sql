@@ -0,0 +1,2 @@
+ALTER TABLE refresh_tokens DROP COLUMN scope;
+DROP TABLE IF EXISTS authorization_codes;
@@ -0,0 +1,18 @@
+-- Коды OAuth2 authorization_code, храним только sha256 хэш. Код одноразовый: после обмена used_at заполняется,
+-- а строка остается до истечения срока, чтобы повторный обмен отозвал выданные по коду токены
+CREATE TABLE IF NOT EXISTS authorization_codes
+(
+    code_hash      TEXT PRIMARY KEY,
+    app_id         INTEGER NOT NULL,
+    user_id        INTEGER NOT NULL,
+    redirect_uri   TEXT    NOT NULL,
+    scope          TEXT    NOT NULL DEFAULT '',
+    code_challenge TEXT    NOT NULL, -- PKCE S256: base64url(sha256(code_verifier))
+    family_id      TEXT    NOT NULL, -- семейство refresh токенов, которое начнет обмен кода
+    expires_at     INTEGER NOT NULL, -- unix время
+    used_at        INTEGER
+);
+CREATE INDEX IF NOT EXISTS idx_authorization_codes_user_id ON authorization_codes (user_id);
+-- Права OAuth2, с которыми выдан токен, при обмене переходят к следующему токену семейства
+ALTER TABLE refresh_tokens
+    ADD COLUMN scope TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- OpenID Connect: nonce из /authorize и время входа пользователя переходят из кода в id_token
+ALTER TABLE authorization_codes
+    ADD COLUMN nonce TEXT NOT NULL DEFAULT '';
+ALTER TABLE authorization_codes
+    ADD COLUMN auth_time INTEGER NOT NULL DEFAULT 0; -- unix время
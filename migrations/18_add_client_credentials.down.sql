@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS client_assertions;
+ALTER TABLE apps DROP COLUMN client_public_key;
+ALTER TABLE apps DROP COLUMN scopes;
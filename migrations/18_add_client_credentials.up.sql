@@ -0,0 +1,15 @@
+-- Права, которые приложение получает через client_credentials, через пробел, как scope в OAuth2
+ALTER TABLE apps
+    ADD COLUMN scopes TEXT NOT NULL DEFAULT '';
+-- PEM публичного ключа, которым приложение подписывает client_assertion (private_key_jwt, RFC 7523)
+ALTER TABLE apps
+    ADD COLUMN client_public_key TEXT NOT NULL DEFAULT '';
+-- jti уже предъявленных client_assertion, повторно их не принимаем. Строка живет, пока не истечет сам assertion
+CREATE TABLE IF NOT EXISTS client_assertions
+(
+    app_id     INTEGER NOT NULL,
+    jti        TEXT    NOT NULL,
+    expires_at INTEGER NOT NULL, -- unix время
+    PRIMARY KEY (app_id, jti)
+);
+CREATE INDEX IF NOT EXISTS idx_client_assertions_expires_at ON client_assertions (expires_at);
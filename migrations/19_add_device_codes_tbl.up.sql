@@ -0,0 +1,16 @@
+-- Коды входа устройств (RFC 8628). device_code храним как sha256 хэш, user_code - как есть:
+-- его вводят руками, и в нем слишком мало символов, чтобы хэш что-то защищал
+CREATE TABLE IF NOT EXISTS device_codes
+(
+    device_code_hash TEXT PRIMARY KEY,
+    user_code        TEXT    NOT NULL UNIQUE,
+    app_id           INTEGER NOT NULL,
+    scope            TEXT    NOT NULL DEFAULT '',
+    status           TEXT    NOT NULL DEFAULT 'pending', -- pending, approved или denied
+    user_id          INTEGER,                            -- кто разрешил вход
+    auth_time        INTEGER,                            -- unix время ввода пароля
+    interval         INTEGER NOT NULL,                   -- секунды между запросами устройства к /token
+    last_polled_at   INTEGER,                            -- unix время в миллисекундах, секунд мало для interval
+    expires_at       INTEGER NOT NULL                    -- unix время
+);
+CREATE INDEX IF NOT EXISTS idx_device_codes_user_id ON device_codes (user_id);
@@ -0,0 +1,14 @@
+-- Журнал входов администраторов от имени пользователей через TokenExchange. Записи не удаляются вместе с пользователями:
+-- журнал нужен как раз для того, чтобы потом разобраться, кто и зачем действовал от имени пользователя
+CREATE TABLE IF NOT EXISTS impersonations
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    actor_id   INTEGER NOT NULL,
+    user_id    INTEGER NOT NULL,
+    app_id     INTEGER NOT NULL,
+    reason     TEXT    NOT NULL,
+    created_at INTEGER NOT NULL, -- unix время
+    expires_at INTEGER NOT NULL  -- unix время, когда протухнет выданный токен
+);
+CREATE INDEX IF NOT EXISTS idx_impersonations_user_id ON impersonations (user_id);
+CREATE INDEX IF NOT EXISTS idx_impersonations_actor_id ON impersonations (actor_id);
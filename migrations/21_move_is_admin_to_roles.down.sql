@@ -0,0 +1,10 @@
+ALTER TABLE users
+    ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users SET is_admin = TRUE
+WHERE id IN (SELECT ur.user_id FROM user_roles ur JOIN roles r ON r.id = ur.role_id WHERE r.app_id = 0 AND r.name = 'admin');
+
+DELETE FROM user_roles WHERE role_id IN (SELECT id FROM roles WHERE app_id = 0);
+DELETE FROM role_permissions WHERE role_id IN (SELECT id FROM roles WHERE app_id = 0);
+DELETE FROM roles WHERE app_id = 0;
+DELETE FROM apps WHERE id = 0;
@@ -0,0 +1,14 @@
+-- Права администратора теперь роль 'admin' с разрешением 'sso:admin'. Роль относится к самому SSO, а не к приложению
+-- клиента, поэтому для SSO заводится свое приложение с id 0. Оно выключено и без способов входа: токенов по нему
+-- не выдать, оно только владеет ролями SSO. Пользователи с is_admin получают эту роль, колонка удаляется
+INSERT INTO apps(id, name, secret, grant_types, enabled) VALUES (0, 'sso-system', lower(hex(randomblob(32))), '', FALSE);
+
+INSERT INTO roles(app_id, name) VALUES (0, 'admin');
+
+INSERT INTO role_permissions(role_id, permission)
+SELECT id, 'sso:admin' FROM roles WHERE app_id = 0 AND name = 'admin';
+
+INSERT INTO user_roles(user_id, role_id)
+SELECT u.id, r.id FROM users u, roles r WHERE u.is_admin AND r.app_id = 0 AND r.name = 'admin';
+
+ALTER TABLE users DROP COLUMN is_admin;
@@ -0,0 +1,4 @@
+-- Публичные клиенты (SPA, мобильные и CLI приложения) не могут хранить секрет и входят на /token только по client_id.
+-- Остальные приложения обязаны передавать секрет, поэтому все существующие приложения считаем конфиденциальными
+ALTER TABLE apps
+    ADD COLUMN public BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,14 @@
+-- Refresh токены храним только в виде хэша, сам токен знает лишь клиент
+-- Все токены, полученные ротацией из одного логина, объединены в семейство family_id
+CREATE TABLE IF NOT EXISTS refresh_tokens
+(
+    id         INTEGER PRIMARY KEY,
+    token_hash TEXT    NOT NULL UNIQUE,
+    family_id  TEXT    NOT NULL,
+    user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    app_id     INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    expires_at INTEGER NOT NULL, -- unix время
+    rotated_at INTEGER,          -- когда токен был обменян на новый
+    revoked_at INTEGER           -- когда семейство токена было отозвано
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens (family_id);
@@ -0,0 +1,6 @@
+-- Алгоритм подписи токенов приложения, по умолчанию HS256 с общим секретом из колонки secret
+-- Для RS256, ES256 и EdDSA в signing_key лежит ссылка на приватный ключ (имя PEM файла в директории keys_path)
+ALTER TABLE apps
+    ADD COLUMN signing_alg TEXT NOT NULL DEFAULT 'HS256';
+ALTER TABLE apps
+    ADD COLUMN signing_key TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,16 @@
+-- Ключи подписи приложений с асимметричными алгоритмами, которыми управляет сам сервис
+-- next - уже опубликован в JWKS, но еще не подписывает, active - подписывает токены,
+-- retired - больше не подписывает, но публикуется до expires_at, пока живы подписанные им токены
+CREATE TABLE IF NOT EXISTS signing_keys
+(
+    kid          TEXT PRIMARY KEY,
+    app_id       INTEGER NOT NULL REFERENCES apps (id) ON DELETE CASCADE,
+    alg          TEXT    NOT NULL,
+    private_key  BLOB    NOT NULL, -- PEM PKCS8
+    status       TEXT    NOT NULL,
+    created_at   INTEGER NOT NULL, -- unix время
+    activated_at INTEGER,
+    retired_at   INTEGER,
+    expires_at   INTEGER
+);
+CREATE INDEX IF NOT EXISTS idx_signing_keys_app ON signing_keys (app_id, status);
@@ -0,0 +1,8 @@
+-- Отозванные до истечения срока токены: jti access токенов и семейства refresh токенов
+-- Запись нужна только пока сам токен жив, после expires_at ее удаляет фоновая очистка
+CREATE TABLE IF NOT EXISTS revoked_tokens
+(
+    token_id   TEXT PRIMARY KEY,
+    expires_at INTEGER NOT NULL -- unix время
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
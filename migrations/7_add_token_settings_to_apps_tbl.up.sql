@@ -0,0 +1,8 @@
+-- Настройки токенов приложения, 0 - использовать token_ttl и refresh_token_ttl из конфига (в секундах)
+-- claims - необязательные поля access токена через запятую, например 'email,is_admin'
+ALTER TABLE apps
+    ADD COLUMN token_ttl INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE apps
+    ADD COLUMN refresh_token_ttl INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE apps
+    ADD COLUMN claims TEXT NOT NULL DEFAULT 'email';
@@ -0,0 +1,6 @@
+-- Отключенный пользователь не может войти, его токены перестают приниматься
+ALTER TABLE users
+    ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE;
+-- Администратор потребовал сменить пароль, войти со старым паролем нельзя
+ALTER TABLE users
+    ADD COLUMN password_reset_required BOOLEAN NOT NULL DEFAULT FALSE;
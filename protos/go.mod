@@ -0,0 +1,3 @@
+module github.com/VladimirKraswov/protos
+
+go 1.22.1
@@ -0,0 +1,192 @@
+package tests
+
+import (
+	"sso/tests/suite"
+	"testing"
+	"time"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAdminApps_Lifecycle(t *testing.T) {
+	ctx, st := suite.New(t)
+	adminCtx := adminContext(ctx, t, st)
+
+	settings := &ssov1.AppSettings{
+		Name:            "app-" + gofakeit.LetterN(12),
+		RedirectUris:    []string{"https://example.com/callback"},
+		GrantTypes:      []string{"password", "refresh_token"},
+		Enabled:         true,
+		TokenTtlSeconds: 600,
+		Claims:          []string{"email"},
+	}
+
+	respCreate, err := st.AdminClient.CreateApp(adminCtx, &ssov1.CreateAppRequest{Settings: settings})
+	require.NoError(t, err)
+	app := respCreate.GetApp()
+	secret := respCreate.GetSecret()
+	require.NotEmpty(t, secret)
+	assert.Equal(t, settings.GetName(), app.GetName())
+	assert.Equal(t, "HS256", app.GetSigningAlg())
+	assert.Equal(t, settings.GetRedirectUris(), app.GetRedirectUris())
+
+	respGet, err := st.AdminClient.GetApp(adminCtx, &ssov1.GetAppRequest{AppId: app.GetId()})
+	require.NoError(t, err)
+	assert.Equal(t, int64(600), respGet.GetApp().GetTokenTtlSeconds())
+
+	respList, err := st.AdminClient.ListApps(adminCtx, &ssov1.ListAppsRequest{})
+	require.NoError(t, err)
+	var names []string
+	for _, listed := range respList.GetApps() {
+		names = append(names, listed.GetName())
+	}
+	assert.Contains(t, names, settings.GetName())
+
+	// Новое приложение сразу выдает токены, подписанные сгенерированным секретом
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+	_, err = st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: app.GetId()})
+	require.NoError(t, err)
+	loginTime := time.Now()
+	claims := parseHS256Claims(t, respLogin.GetToken(), secret)
+	assert.InDelta(t, loginTime.Add(10*time.Minute).Unix(), claims["exp"].(float64), 1)
+
+	// Отключенное приложение не получает токены, выданные ему токены больше не принимаются
+	settings.Enabled = false
+	respUpdate, err := st.AdminClient.UpdateApp(adminCtx, &ssov1.UpdateAppRequest{AppId: app.GetId(), Settings: settings})
+	require.NoError(t, err)
+	assert.False(t, respUpdate.GetApp().GetEnabled())
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: app.GetId()})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, introspectRequest(respLogin.GetToken()))
+	require.NoError(t, err)
+	assert.False(t, respIntrospect.GetActive())
+
+	// После ротации токены подписываются новым секретом
+	respRotate, err := st.AdminClient.RotateAppSecret(adminCtx, &ssov1.RotateAppSecretRequest{AppId: app.GetId()})
+	require.NoError(t, err)
+	require.NotEmpty(t, respRotate.GetSecret())
+	assert.NotEqual(t, secret, respRotate.GetSecret())
+
+	settings.Enabled = true
+	_, err = st.AdminClient.UpdateApp(adminCtx, &ssov1.UpdateAppRequest{AppId: app.GetId(), Settings: settings})
+	require.NoError(t, err)
+
+	respLogin, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: app.GetId()})
+	require.NoError(t, err)
+	parseHS256Claims(t, respLogin.GetToken(), respRotate.GetSecret())
+
+	_, err = st.AdminClient.DeleteApp(adminCtx, &ssov1.DeleteAppRequest{AppId: app.GetId()})
+	require.NoError(t, err)
+
+	_, err = st.AdminClient.GetApp(adminCtx, &ssov1.GetAppRequest{AppId: app.GetId()})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: app.GetId()})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestAdminApps_GrantTypes(t *testing.T) {
+	ctx, st := suite.New(t)
+	adminCtx := adminContext(ctx, t, st)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	// Без refresh_token приложение получает только access токен
+	respCreate, err := st.AdminClient.CreateApp(adminCtx, &ssov1.CreateAppRequest{Settings: &ssov1.AppSettings{
+		Name:       "app-" + gofakeit.LetterN(12),
+		GrantTypes: []string{"password"},
+		Enabled:    true,
+	}})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: respCreate.GetApp().GetId()})
+	require.NoError(t, err)
+	assert.NotEmpty(t, respLogin.GetToken())
+	assert.Empty(t, respLogin.GetRefreshToken())
+
+	// Без password приложению нельзя входить по паролю
+	respCreate, err = st.AdminClient.CreateApp(adminCtx, &ssov1.CreateAppRequest{Settings: &ssov1.AppSettings{
+		Name:       "app-" + gofakeit.LetterN(12),
+		GrantTypes: []string{"refresh_token"},
+		Enabled:    true,
+	}})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: respCreate.GetApp().GetId()})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestAdminApps_FailCases(t *testing.T) {
+	ctx, st := suite.New(t)
+	adminCtx := adminContext(ctx, t, st)
+
+	tests := []struct {
+		name     string
+		settings *ssov1.AppSettings
+		alg      string
+		code     codes.Code
+	}{
+		{
+			name:     "Empty Name",
+			settings: &ssov1.AppSettings{},
+			code:     codes.InvalidArgument,
+		},
+		{
+			name:     "Duplicate Name",
+			settings: &ssov1.AppSettings{Name: "test"},
+			code:     codes.AlreadyExists,
+		},
+		{
+			name:     "Relative Redirect URI",
+			settings: &ssov1.AppSettings{Name: "app-" + gofakeit.LetterN(12), RedirectUris: []string{"/callback"}},
+			code:     codes.InvalidArgument,
+		},
+		{
+			name:     "Unknown Grant Type",
+			settings: &ssov1.AppSettings{Name: "app-" + gofakeit.LetterN(12), GrantTypes: []string{"implicit"}},
+			code:     codes.InvalidArgument,
+		},
+		{
+			name:     "Unknown Claim",
+			settings: &ssov1.AppSettings{Name: "app-" + gofakeit.LetterN(12), Claims: []string{"password"}},
+			code:     codes.InvalidArgument,
+		},
+		{
+			name:     "Public Client Credentials",
+			settings: &ssov1.AppSettings{Name: "app-" + gofakeit.LetterN(12), GrantTypes: []string{"client_credentials"}, Public: true},
+			code:     codes.InvalidArgument,
+		},
+		{
+			name:     "Unknown Signing Alg",
+			settings: &ssov1.AppSettings{Name: "app-" + gofakeit.LetterN(12)},
+			alg:      "none",
+			code:     codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AdminClient.CreateApp(adminCtx, &ssov1.CreateAppRequest{Settings: tt.settings, SigningAlg: tt.alg})
+			require.Error(t, err)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
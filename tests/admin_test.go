@@ -0,0 +1,260 @@
+package tests
+
+import (
+	"context"
+	"sso/tests/suite"
+	"strconv"
+	"testing"
+	"time"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Администратор из tests/migrations
+const (
+	adminEmail    = "admin@example.com"
+	adminPassword = "admin-password"
+)
+
+func TestAdmin_RequiresAdminToken(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email, pass := registerUser(ctx, t, st)
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: int32(st.Cfg.Admin.AppID)})
+	require.NoError(t, err)
+
+	// Администратор, но токен выдан обычному приложению
+	respOtherApp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: adminEmail, Password: adminPassword, AppId: appID})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		code codes.Code
+	}{
+		{name: "No Token", ctx: ctx, code: codes.Unauthenticated},
+		{name: "Invalid Token", ctx: withToken(ctx, "not-a-token"), code: codes.Unauthenticated},
+		{name: "Not Admin", ctx: withToken(ctx, respLogin.GetToken()), code: codes.PermissionDenied},
+		{name: "Other App", ctx: withToken(ctx, respOtherApp.GetToken()), code: codes.Unauthenticated},
+		{name: "Forged HS256 Token", ctx: withToken(ctx, forgedAdminToken(ctx, t, st)), code: codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AdminClient.ListUsers(tt.ctx, &ssov1.ListUsersRequest{})
+			require.Error(t, err)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
+
+func TestAdmin_ListUsers(t *testing.T) {
+	ctx, st := suite.New(t)
+	adminCtx := adminContext(ctx, t, st)
+
+	// Общая часть email, по которой отфильтруем только пользователей этого теста
+	marker := gofakeit.LetterN(16)
+	var ids []int64
+	for i := 0; i < 3; i++ {
+		resp, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{
+			Email:    gofakeit.LetterN(8) + marker + "@example.com",
+			Password: randomFakePassword(),
+		})
+		require.NoError(t, err)
+		ids = append(ids, resp.GetUserId())
+	}
+
+	first, err := st.AdminClient.ListUsers(adminCtx, &ssov1.ListUsersRequest{PageSize: 2, Email: marker})
+	require.NoError(t, err)
+	require.Len(t, first.GetUsers(), 2)
+	assert.Equal(t, ids[0], first.GetUsers()[0].GetId())
+	assert.Equal(t, ids[1], first.GetUsers()[1].GetId())
+	require.NotEmpty(t, first.GetNextPageToken())
+
+	second, err := st.AdminClient.ListUsers(adminCtx, &ssov1.ListUsersRequest{
+		PageSize:  2,
+		PageToken: first.GetNextPageToken(),
+		Email:     marker,
+	})
+	require.NoError(t, err)
+	require.Len(t, second.GetUsers(), 1)
+	assert.Equal(t, ids[2], second.GetUsers()[0].GetId())
+	assert.Empty(t, second.GetNextPageToken())
+
+	isAdmin := true
+	admins, err := st.AdminClient.ListUsers(adminCtx, &ssov1.ListUsersRequest{Email: marker, IsAdmin: &isAdmin})
+	require.NoError(t, err)
+	assert.Empty(t, admins.GetUsers())
+
+	_, err = st.AdminClient.ListUsers(adminCtx, &ssov1.ListUsersRequest{PageToken: "not-a-token"})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestAdmin_DisableUser(t *testing.T) {
+	ctx, st := suite.New(t)
+	adminCtx := adminContext(ctx, t, st)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	respReg, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+	userID := respReg.GetUserId()
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.NoError(t, err)
+
+	_, err = st.AdminClient.DisableUser(adminCtx, &ssov1.DisableUserRequest{UserId: userID})
+	require.NoError(t, err)
+
+	respUser, err := st.AdminClient.GetUser(adminCtx, &ssov1.GetUserRequest{UserId: userID})
+	require.NoError(t, err)
+	assert.True(t, respUser.GetUser().GetDisabled())
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Сессии отключенного пользователя больше не работают
+	_, err = st.AuthClient.Refresh(ctx, &ssov1.RefreshRequest{RefreshToken: respLogin.GetRefreshToken()})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, introspectRequest(respLogin.GetToken()))
+	require.NoError(t, err)
+	assert.False(t, respIntrospect.GetActive())
+
+	_, err = st.AdminClient.EnableUser(adminCtx, &ssov1.EnableUserRequest{UserId: userID})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.NoError(t, err)
+}
+
+func TestAdmin_ForcePasswordReset(t *testing.T) {
+	ctx, st := suite.New(t)
+	adminCtx := adminContext(ctx, t, st)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	respReg, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.NoError(t, err)
+
+	_, err = st.AdminClient.ForcePasswordReset(adminCtx, &ssov1.ForcePasswordResetRequest{UserId: respReg.GetUserId()})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = st.AuthClient.Refresh(ctx, &ssov1.RefreshRequest{RefreshToken: respLogin.GetRefreshToken()})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestAdmin_SetAdminAndRole(t *testing.T) {
+	ctx, st := suite.New(t)
+	adminCtx := adminContext(ctx, t, st)
+
+	respReg, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: gofakeit.Email(), Password: randomFakePassword()})
+	require.NoError(t, err)
+	userID := respReg.GetUserId()
+
+	_, err = st.AdminClient.SetAdmin(adminCtx, &ssov1.SetAdminRequest{UserId: userID, IsAdmin: true})
+	require.NoError(t, err)
+
+	respIsAdmin, err := st.AuthClient.IsAdmin(ctx, &ssov1.IsAdminRequest{UserId: userID})
+	require.NoError(t, err)
+	assert.True(t, respIsAdmin.GetIsAdmin())
+
+	_, err = st.AdminClient.SetUserRole(adminCtx, &ssov1.SetUserRoleRequest{UserId: userID, AppId: appID, Role: "viewer", Assigned: true})
+	require.NoError(t, err)
+
+	respRoles, err := st.AuthClient.ListUserRoles(ctx, &ssov1.ListUserRolesRequest{UserId: userID, AppId: appID})
+	require.NoError(t, err)
+	require.Len(t, respRoles.GetRoles(), 1)
+	assert.Equal(t, "viewer", respRoles.GetRoles()[0].GetName())
+
+	_, err = st.AdminClient.SetUserRole(adminCtx, &ssov1.SetUserRoleRequest{UserId: userID, AppId: appID, Role: "viewer", Assigned: false})
+	require.NoError(t, err)
+
+	respRoles, err = st.AuthClient.ListUserRoles(ctx, &ssov1.ListUserRolesRequest{UserId: userID, AppId: appID})
+	require.NoError(t, err)
+	assert.Empty(t, respRoles.GetRoles())
+
+	_, err = st.AdminClient.SetUserRole(adminCtx, &ssov1.SetUserRoleRequest{UserId: userID, AppId: appID, Role: "unknown", Assigned: true})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestAdmin_DeleteUser(t *testing.T) {
+	ctx, st := suite.New(t)
+	adminCtx := adminContext(ctx, t, st)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	respReg, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	_, err = st.AdminClient.DeleteUser(adminCtx, &ssov1.DeleteUserRequest{UserId: respReg.GetUserId()})
+	require.NoError(t, err)
+
+	_, err = st.AdminClient.GetUser(adminCtx, &ssov1.GetUserRequest{UserId: respReg.GetUserId()})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = st.AdminClient.DeleteUser(adminCtx, &ssov1.DeleteUserRequest{UserId: respReg.GetUserId()})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// forgedAdminToken выпускает токен с uid администратора так, как это может сделать любой сервис,
+// которому известен секрет HS256 приложения. Для самого приложения такой токен действует
+func forgedAdminToken(ctx context.Context, t *testing.T, st *suite.Suite) string {
+	t.Helper()
+
+	adminID := tokenUID(ctx, t, st, adminLoginToken(ctx, t, st))
+
+	now := time.Now()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"uid":    adminID,
+		"sub":    strconv.FormatInt(adminID, 10),
+		"app_id": appID,
+		"aud":    strconv.Itoa(appID),
+		"iss":    st.Cfg.Issuer,
+		"iat":    now.Unix(),
+		"exp":    now.Add(time.Hour).Unix(),
+	}).SignedString([]byte(appSecret))
+	require.NoError(t, err)
+	require.Equal(t, adminID, tokenUID(ctx, t, st, token))
+
+	return token
+}
+
+// adminContext возвращает контекст с токеном администратора для запросов к сервису Admin
+func adminContext(ctx context.Context, t *testing.T, st *suite.Suite) context.Context {
+	t.Helper()
+
+	return withToken(ctx, adminLoginToken(ctx, t, st))
+}
+
+func withToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
@@ -0,0 +1,97 @@
+package tests
+
+import (
+	"testing"
+
+	"sso/tests/suite"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const verificationTokenPrefix = "Verification token: "
+
+func TestVerifyEmail_HappyPath(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	adminCtx := adminContext(ctx, t, st)
+
+	email := gofakeit.Email()
+
+	respReg, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: randomFakePassword()})
+	require.NoError(t, err)
+
+	respUser, err := st.AdminClient.GetUser(adminCtx, &ssov1.GetUserRequest{UserId: respReg.GetUserId()})
+	require.NoError(t, err)
+	assert.False(t, respUser.GetUser().GetEmailVerified())
+
+	token := readMailToken(t, st, email, verificationTokenPrefix)
+
+	_, err = st.AuthClient.VerifyEmail(ctx, &ssov1.VerifyEmailRequest{Token: token})
+	require.NoError(t, err)
+
+	respUser, err = st.AdminClient.GetUser(adminCtx, &ssov1.GetUserRequest{UserId: respReg.GetUserId()})
+	require.NoError(t, err)
+	assert.True(t, respUser.GetUser().GetEmailVerified())
+
+	// Токен одноразовый
+	_, err = st.AuthClient.VerifyEmail(ctx, &ssov1.VerifyEmailRequest{Token: token})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestVerifyEmail_ByPasswordReset(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	adminCtx := adminContext(ctx, t, st)
+
+	email := gofakeit.Email()
+
+	respReg, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: randomFakePassword()})
+	require.NoError(t, err)
+	verificationToken := readMailToken(t, st, email, verificationTokenPrefix)
+
+	_, err = st.AuthClient.RequestPasswordReset(ctx, &ssov1.RequestPasswordResetRequest{Email: email})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.ConfirmPasswordReset(ctx, &ssov1.ConfirmPasswordResetRequest{
+		Token:       readMailToken(t, st, email, resetTokenPrefix),
+		NewPassword: randomFakePassword(),
+	})
+	require.NoError(t, err)
+
+	// Токен сброса пароля тоже пришел на почту, поэтому email подтвержден, а токен подтверждения больше не нужен
+	respUser, err := st.AdminClient.GetUser(adminCtx, &ssov1.GetUserRequest{UserId: respReg.GetUserId()})
+	require.NoError(t, err)
+	assert.True(t, respUser.GetUser().GetEmailVerified())
+
+	_, err = st.AuthClient.VerifyEmail(ctx, &ssov1.VerifyEmailRequest{Token: verificationToken})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestVerifyEmail_FailCases(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	tests := []struct {
+		name        string
+		token       string
+		expectedErr string
+	}{
+		{name: "Empty Token", token: "", expectedErr: "token is required"},
+		{name: "Unknown Token", token: "unknown-token", expectedErr: "invalid or expired email verification token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.VerifyEmail(ctx, &ssov1.VerifyEmailRequest{Token: tt.token})
+			require.Error(t, err)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+			assert.Contains(t, err.Error(), tt.expectedErr)
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"sso/tests/suite"
+	"strconv"
+	"testing"
+	"time"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIntrospect_HappyPath(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	for _, id := range []int32{appID, rs256AppID, managedKeysAppID} {
+		t.Run("app "+strconv.Itoa(int(id)), func(t *testing.T) {
+			email := gofakeit.Email()
+			pass := randomFakePassword()
+
+			respReg, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: pass})
+			require.NoError(t, err)
+
+			respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: id})
+			require.NoError(t, err)
+			loginTime := time.Now()
+
+			resp, err := st.AuthClient.Introspect(ctx, introspectRequest(respLogin.GetToken()))
+			require.NoError(t, err)
+
+			assert.True(t, resp.GetActive())
+			assert.Equal(t, respReg.GetUserId(), resp.GetUid())
+			assert.Equal(t, strconv.FormatInt(respReg.GetUserId(), 10), resp.GetSub())
+			assert.Equal(t, email, resp.GetEmail())
+			assert.Equal(t, email, resp.GetUsername())
+			assert.Equal(t, id, resp.GetAppId())
+			assert.InDelta(t, loginTime.Add(st.Cfg.TokenTTL).Unix(), resp.GetExp(), 1)
+			assert.InDelta(t, loginTime.Unix(), resp.GetIat(), 1)
+			assert.Equal(t, st.Cfg.Issuer, resp.GetIss())
+			assert.Equal(t, []string{strconv.Itoa(int(id))}, resp.GetAud())
+			assert.NotEmpty(t, resp.GetJti())
+		})
+	}
+}
+
+func TestIntrospect_Inactive(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"uid":    1,
+		"email":  gofakeit.Email(),
+		"app_id": appID,
+		"iss":    st.Cfg.Issuer,
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	})
+	forgedToken, err := forged.SignedString([]byte("not-" + appSecret))
+	require.NoError(t, err)
+
+	expired := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"uid":    1,
+		"email":  gofakeit.Email(),
+		"app_id": appID,
+		"iss":    st.Cfg.Issuer,
+		"exp":    time.Now().Add(-time.Hour).Unix(),
+	})
+	expiredToken, err := expired.SignedString([]byte(appSecret))
+	require.NoError(t, err)
+
+	// Токен RS256 приложения, подписанный его общим секретом через HS256, не должен проходить проверку
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"uid":    1,
+		"email":  gofakeit.Email(),
+		"app_id": rs256AppID,
+		"iss":    st.Cfg.Issuer,
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	})
+	confusedToken, err := confused.SignedString([]byte("test-rs256-secret"))
+	require.NoError(t, err)
+
+	foreign := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"uid":    1,
+		"email":  gofakeit.Email(),
+		"app_id": appID,
+		"iss":    "https://other-issuer.example",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	})
+	foreignToken, err := foreign.SignedString([]byte(appSecret))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "Malformed Token", token: gofakeit.UUID()},
+		{name: "Wrong Signature", token: forgedToken},
+		{name: "Expired Token", token: expiredToken},
+		{name: "Algorithm Confusion", token: confusedToken},
+		{name: "Foreign Issuer", token: foreignToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := st.AuthClient.Introspect(ctx, introspectRequest(tt.token))
+			require.NoError(t, err)
+			assert.False(t, resp.GetActive())
+			assert.Empty(t, resp.GetUid())
+		})
+	}
+}
+
+func TestIntrospect_EmptyToken(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	_, err := st.AuthClient.Introspect(ctx, &ssov1.IntrospectRequest{AppId: appID, ClientSecret: appSecret})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestIntrospect_RequiresClient(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	token := registerAndLogin(ctx, t, st).GetToken()
+
+	tests := []struct {
+		name string
+		req  *ssov1.IntrospectRequest
+		code codes.Code
+	}{
+		{name: "No Client", req: &ssov1.IntrospectRequest{Token: token}, code: codes.InvalidArgument},
+		{name: "No Secret", req: &ssov1.IntrospectRequest{Token: token, AppId: appID}, code: codes.InvalidArgument},
+		{name: "Wrong Secret", req: &ssov1.IntrospectRequest{Token: token, AppId: appID, ClientSecret: "not-" + appSecret}, code: codes.Unauthenticated},
+		{name: "Unknown App", req: &ssov1.IntrospectRequest{Token: token, AppId: 1 << 30, ClientSecret: appSecret}, code: codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.Introspect(ctx, tt.req)
+			require.Error(t, err)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
+
+// introspectRequest проверяет token от имени тестового приложения: без секрета Introspect не отвечает
+func introspectRequest(token string) *ssov1.IntrospectRequest {
+	return &ssov1.IntrospectRequest{Token: token, AppId: appID, ClientSecret: appSecret}
+}
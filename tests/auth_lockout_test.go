@@ -0,0 +1,132 @@
+package tests
+
+import (
+	"context"
+	"sso/tests/suite"
+	"testing"
+	"time"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLogin_ProgressiveDelay(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: "wrong-" + pass, AppId: appID})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Сразу после неудачи даже верный пароль не проверяется, клиенту сообщают сколько ждать
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	retryAfter := requireLocked(t, err)
+	assert.LessOrEqual(t, retryAfter, st.Cfg.Lockout.BaseDelay)
+
+	time.Sleep(retryAfter)
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.NoError(t, err)
+
+	// Успешный вход сбрасывает счетчик, следующая неудача снова дает минимальную задержку
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: "wrong-" + pass, AppId: appID})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	assert.LessOrEqual(t, requireLocked(t, err), st.Cfg.Lockout.BaseDelay)
+}
+
+func TestLogin_LockoutAndUnlock(t *testing.T) {
+	ctx, st := suite.New(t)
+	adminCtx := adminContext(ctx, t, st)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+	respReg, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	failLogins(ctx, t, st, email, st.Cfg.Lockout.MaxFailures)
+
+	// Учетная запись заблокирована на lock_duration, верный пароль не помогает
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	retryAfter := requireLocked(t, err)
+	assert.Greater(t, retryAfter, st.Cfg.Lockout.LockDuration-time.Minute)
+
+	_, err = st.AdminClient.UnlockUser(adminCtx, &ssov1.UnlockUserRequest{UserId: respReg.GetUserId()})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.NoError(t, err)
+}
+
+func TestLogin_LockoutUnknownEmail(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	// Несуществующий email блокируется так же, как существующий, иначе блокировка выдавала бы зарегистрированные email
+	email := gofakeit.Email()
+	failLogins(ctx, t, st, email, st.Cfg.Lockout.MaxFailures)
+
+	_, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: randomFakePassword(), AppId: appID})
+	requireLocked(t, err)
+}
+
+func TestAdmin_UnlockUnknownUser(t *testing.T) {
+	ctx, st := suite.New(t)
+	adminCtx := adminContext(ctx, t, st)
+
+	_, err := st.AdminClient.UnlockUser(adminCtx, &ssov1.UnlockUserRequest{UserId: 1 << 40})
+	require.Error(t, err)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// failLogins делает count неудачных попыток входа, дожидаясь между ними окончания задержки
+func failLogins(ctx context.Context, t *testing.T, st *suite.Suite, email string, count int) {
+	t.Helper()
+
+	for i := 0; i < count; i++ {
+		_, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: randomFakePassword(), AppId: appID})
+		require.Error(t, err)
+		require.Equal(t, codes.InvalidArgument, status.Code(err), "attempt %d", i+1)
+
+		if i < count-1 {
+			_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: randomFakePassword(), AppId: appID})
+			time.Sleep(requireLocked(t, err))
+		}
+	}
+}
+
+// requireLocked проверяет, что вход заблокирован, и возвращает время ожидания из RetryInfo
+func requireLocked(t *testing.T, err error) time.Duration {
+	t.Helper()
+
+	require.Error(t, err)
+	st := status.Convert(err)
+	require.Equal(t, codes.FailedPrecondition, st.Code())
+
+	var (
+		reason     string
+		retryAfter time.Duration
+	)
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			reason = d.GetReason()
+		case *errdetails.RetryInfo:
+			retryAfter = d.GetRetryDelay().AsDuration()
+		}
+	}
+	require.Equal(t, "ACCOUNT_LOCKED", reason)
+	require.Positive(t, retryAfter)
+
+	return retryAfter
+}
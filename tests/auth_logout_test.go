@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"context"
+	"sso/tests/suite"
+	"testing"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLogout_HappyPath(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respLogin := registerAndLogin(ctx, t, st)
+
+	_, err := st.AuthClient.Logout(ctx, &ssov1.LogoutRequest{
+		Token:        respLogin.GetToken(),
+		RefreshToken: respLogin.GetRefreshToken(),
+	})
+	require.NoError(t, err)
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, introspectRequest(respLogin.GetToken()))
+	require.NoError(t, err)
+	assert.False(t, respIntrospect.GetActive())
+	assert.True(t, respIntrospect.GetRevoked())
+
+	_, err = st.AuthClient.Refresh(ctx, &ssov1.RefreshRequest{RefreshToken: respLogin.GetRefreshToken()})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestLogout_ForeignRefreshToken(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respLogin := registerAndLogin(ctx, t, st)
+	respOther := registerAndLogin(ctx, t, st)
+
+	_, err := st.AuthClient.Logout(ctx, &ssov1.LogoutRequest{
+		Token:        respLogin.GetToken(),
+		RefreshToken: respOther.GetRefreshToken(),
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Чужая сессия осталась жива
+	_, err = st.AuthClient.Refresh(ctx, &ssov1.RefreshRequest{RefreshToken: respOther.GetRefreshToken()})
+	require.NoError(t, err)
+}
+
+func TestRevokeToken(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	t.Run("Access Token", func(t *testing.T) {
+		respLogin := registerAndLogin(ctx, t, st)
+
+		_, err := st.AuthClient.RevokeToken(ctx, &ssov1.RevokeTokenRequest{Token: respLogin.GetToken(), AppId: appID, ClientSecret: appSecret})
+		require.NoError(t, err)
+
+		respIntrospect, err := st.AuthClient.Introspect(ctx, introspectRequest(respLogin.GetToken()))
+		require.NoError(t, err)
+		assert.False(t, respIntrospect.GetActive())
+		assert.True(t, respIntrospect.GetRevoked())
+
+		// Отзыв access токена не трогает сессию
+		_, err = st.AuthClient.Refresh(ctx, &ssov1.RefreshRequest{RefreshToken: respLogin.GetRefreshToken()})
+		require.NoError(t, err)
+	})
+
+	t.Run("Refresh Token", func(t *testing.T) {
+		respLogin := registerAndLogin(ctx, t, st)
+
+		_, err := st.AuthClient.RevokeToken(ctx, &ssov1.RevokeTokenRequest{
+			Token:         respLogin.GetRefreshToken(),
+			TokenTypeHint: "refresh_token",
+			AppId:         appID,
+			ClientSecret:  appSecret,
+		})
+		require.NoError(t, err)
+
+		_, err = st.AuthClient.Refresh(ctx, &ssov1.RefreshRequest{RefreshToken: respLogin.GetRefreshToken()})
+		require.Error(t, err)
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+
+	t.Run("Unknown Token", func(t *testing.T) {
+		_, err := st.AuthClient.RevokeToken(ctx, &ssov1.RevokeTokenRequest{Token: gofakeit.UUID(), AppId: appID, ClientSecret: appSecret})
+		require.NoError(t, err)
+	})
+}
+
+func TestRevokeToken_Client(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respLogin := registerAndLogin(ctx, t, st)
+
+	tests := []struct {
+		name string
+		req  *ssov1.RevokeTokenRequest
+		code codes.Code
+	}{
+		{name: "No App", req: &ssov1.RevokeTokenRequest{Token: respLogin.GetToken()}, code: codes.InvalidArgument},
+		// Приложение не публичное: без секрета оно не подтвердило, что это оно
+		{name: "No Secret", req: &ssov1.RevokeTokenRequest{Token: respLogin.GetToken(), AppId: appID}, code: codes.Unauthenticated},
+		{name: "Wrong Secret", req: &ssov1.RevokeTokenRequest{Token: respLogin.GetToken(), AppId: appID, ClientSecret: "not-" + appSecret}, code: codes.Unauthenticated},
+		// Токены выданы приложению appID, другое приложение отозвать их не может
+		{name: "Foreign Access Token", req: &ssov1.RevokeTokenRequest{Token: respLogin.GetToken(), AppId: rs256AppID, ClientSecret: "test-rs256-secret"}, code: codes.PermissionDenied},
+		{
+			name: "Foreign Refresh Token",
+			req:  &ssov1.RevokeTokenRequest{Token: respLogin.GetRefreshToken(), TokenTypeHint: "refresh_token", AppId: rs256AppID, ClientSecret: "test-rs256-secret"},
+			code: codes.PermissionDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.RevokeToken(ctx, tt.req)
+			require.Error(t, err)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+
+	// Ни один из запросов токены не отозвал
+	respIntrospect, err := st.AuthClient.Introspect(ctx, introspectRequest(respLogin.GetToken()))
+	require.NoError(t, err)
+	assert.True(t, respIntrospect.GetActive())
+
+	_, err = st.AuthClient.Refresh(ctx, &ssov1.RefreshRequest{RefreshToken: respLogin.GetRefreshToken()})
+	require.NoError(t, err)
+}
+
+func registerAndLogin(ctx context.Context, t *testing.T, st *suite.Suite) *ssov1.LoginResponse {
+	t.Helper()
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.NoError(t, err)
+
+	return respLogin
+}
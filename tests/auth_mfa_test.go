@@ -0,0 +1,188 @@
+package tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"sso/internal/lib/totp"
+	"sso/tests/suite"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMFA_EnrollLoginAndDisable(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.NoError(t, err)
+	accessToken := respLogin.GetToken()
+
+	respEnroll, err := st.AuthClient.EnrollTOTP(ctx, &ssov1.EnrollTOTPRequest{Token: accessToken})
+	require.NoError(t, err)
+	secret := respEnroll.GetSecret()
+	require.NotEmpty(t, secret)
+	assert.Contains(t, respEnroll.GetUri(), "otpauth://totp/")
+	assert.Contains(t, respEnroll.GetUri(), "secret="+secret)
+
+	// Пока подключение не подтверждено, вход по паролю работает как раньше
+	respLogin, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.NoError(t, err)
+	assert.NotEmpty(t, respLogin.GetToken())
+	assert.Empty(t, respLogin.GetMfaToken())
+
+	step := totp.Step(time.Now())
+
+	respConfirm, err := st.AuthClient.ConfirmTOTP(ctx, &ssov1.ConfirmTOTPRequest{Token: accessToken, Code: totpCode(t, secret, step)})
+	require.NoError(t, err)
+	recoveryCodes := respConfirm.GetRecoveryCodes()
+	require.Len(t, recoveryCodes, 10)
+
+	// Теперь пароль только начинает вход
+	mfaToken := loginMFA(ctx, t, st, email, pass)
+
+	// Код, которым подтверждали подключение, второй раз не принимается
+	_, err = st.AuthClient.VerifyMFA(ctx, &ssov1.VerifyMFARequest{MfaToken: mfaToken, Code: totpCode(t, secret, step)})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Неверный код считается неудачной попыткой входа, следующую попытку придется подождать
+	_, err = st.AuthClient.VerifyMFA(ctx, &ssov1.VerifyMFARequest{MfaToken: mfaToken, Code: totpCode(t, secret, step+1)})
+	requireLocked(t, err)
+
+	time.Sleep(st.Cfg.Lockout.BaseDelay)
+
+	respVerify, err := st.AuthClient.VerifyMFA(ctx, &ssov1.VerifyMFARequest{MfaToken: mfaToken, Code: totpCode(t, secret, step+1)})
+	require.NoError(t, err)
+	assert.NotEmpty(t, respVerify.GetRefreshToken())
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, introspectRequest(respVerify.GetToken()))
+	require.NoError(t, err)
+	assert.True(t, respIntrospect.GetActive())
+	assert.Equal(t, email, respIntrospect.GetEmail())
+
+	// Токен входа одноразовый
+	_, err = st.AuthClient.VerifyMFA(ctx, &ssov1.VerifyMFARequest{MfaToken: mfaToken, Code: totpCode(t, secret, step+1)})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Коды восстановления тоже одноразовые, регистр и дефисы не важны
+	_, err = st.AuthClient.VerifyMFA(ctx, &ssov1.VerifyMFARequest{
+		MfaToken:     loginMFA(ctx, t, st, email, pass),
+		RecoveryCode: recoveryCodes[0],
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.VerifyMFA(ctx, &ssov1.VerifyMFARequest{
+		MfaToken:     loginMFA(ctx, t, st, email, pass),
+		RecoveryCode: recoveryCodes[0],
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	time.Sleep(st.Cfg.Lockout.BaseDelay)
+
+	_, err = st.AuthClient.DisableTOTP(ctx, &ssov1.DisableTOTPRequest{Token: accessToken, RecoveryCode: upperNoDashes(recoveryCodes[1])})
+	require.NoError(t, err)
+
+	respLogin, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.NoError(t, err)
+	assert.NotEmpty(t, respLogin.GetToken())
+	assert.Empty(t, respLogin.GetMfaToken())
+}
+
+func TestMFA_FailCases(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respLogin := registerAndLogin(ctx, t, st)
+
+	_, err := st.AuthClient.EnrollTOTP(ctx, &ssov1.EnrollTOTPRequest{Token: "invalid-token"})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = st.AuthClient.ConfirmTOTP(ctx, &ssov1.ConfirmTOTPRequest{Token: respLogin.GetToken(), Code: "123456"})
+	require.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = st.AuthClient.DisableTOTP(ctx, &ssov1.DisableTOTPRequest{Token: respLogin.GetToken(), Code: "123456"})
+	require.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	respEnroll, err := st.AuthClient.EnrollTOTP(ctx, &ssov1.EnrollTOTPRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+
+	// Код далеко от текущего времени не принимается
+	_, err = st.AuthClient.ConfirmTOTP(ctx, &ssov1.ConfirmTOTPRequest{
+		Token: respLogin.GetToken(),
+		Code:  totpCode(t, respEnroll.GetSecret(), totp.Step(time.Now())-10),
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = st.AuthClient.ConfirmTOTP(ctx, &ssov1.ConfirmTOTPRequest{
+		Token: respLogin.GetToken(),
+		Code:  totpCode(t, respEnroll.GetSecret(), totp.Step(time.Now())),
+	})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.EnrollTOTP(ctx, &ssov1.EnrollTOTPRequest{Token: respLogin.GetToken()})
+	require.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	tests := []struct {
+		name        string
+		req         *ssov1.VerifyMFARequest
+		expectedErr string
+	}{
+		{name: "Empty MFA Token", req: &ssov1.VerifyMFARequest{Code: "123456"}, expectedErr: "mfa_token is required"},
+		{name: "Empty Code", req: &ssov1.VerifyMFARequest{MfaToken: "token"}, expectedErr: "code or recovery_code is required"},
+		{name: "Unknown MFA Token", req: &ssov1.VerifyMFARequest{MfaToken: "unknown-token", Code: "123456"}, expectedErr: "invalid or expired mfa token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.VerifyMFA(ctx, tt.req)
+			require.Error(t, err)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+			assert.Contains(t, err.Error(), tt.expectedErr)
+		})
+	}
+}
+
+// loginMFA входит пользователем со вторым фактором и возвращает токен для VerifyMFA
+func loginMFA(ctx context.Context, t *testing.T, st *suite.Suite, email string, pass string) string {
+	t.Helper()
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.NoError(t, err)
+	require.Empty(t, respLogin.GetToken())
+	require.Empty(t, respLogin.GetRefreshToken())
+	require.NotEmpty(t, respLogin.GetMfaToken())
+
+	return respLogin.GetMfaToken()
+}
+
+func totpCode(t *testing.T, secret string, step int64) string {
+	t.Helper()
+
+	code, err := totp.Code(secret, step)
+	require.NoError(t, err)
+
+	return code
+}
+
+func upperNoDashes(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(code, "-", ""))
+}
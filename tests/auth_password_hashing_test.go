@@ -0,0 +1,41 @@
+package tests
+
+import (
+	"sso/tests/suite"
+	"testing"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLogin_LegacyPasswordHashes(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	// Пользователи из tests/migrations с хешами других алгоритмов и параметров
+	tests := []struct {
+		name     string
+		email    string
+		password string
+	}{
+		{name: "Bcrypt", email: "legacy-bcrypt@example.com", password: "legacy-bcrypt-password"},
+		{name: "Scrypt", email: "legacy-scrypt@example.com", password: "legacy-scrypt-password"},
+		{name: "Argon2id Old Params", email: "legacy-argon2id@example.com", password: "legacy-argon2id-password"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Первый вход проверяет старый хеш и заменяет его, дальше пароль проверяется уже новым хешем
+			for i := 0; i < 2; i++ {
+				_, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: tt.email, Password: tt.password, AppId: appID})
+				require.NoError(t, err, "login %d", i+1)
+			}
+
+			_, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: tt.email, Password: tt.password + "-wrong", AppId: appID})
+			require.Error(t, err)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"sso/tests/suite"
+	"strings"
+	"testing"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Ожидания рассчитаны на password_policy из config/local.yaml
+func TestRegister_PasswordPolicy(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	tests := []struct {
+		name     string
+		password func(localPart string, email string) string
+		rules    []string
+	}{
+		{
+			name:     "Too Short And One Class",
+			password: func(string, string) string { return "abc" },
+			rules:    []string{"min_length", "min_character_classes"},
+		},
+		{
+			name:     "Too Long",
+			password: func(string, string) string { return strings.Repeat("aB1", 25) },
+			rules:    []string{"max_length"},
+		},
+		{
+			name:     "Single Character Class",
+			password: func(string, string) string { return "onlylowercase" },
+			rules:    []string{"min_character_classes"},
+		},
+		{
+			name:     "Same As Email",
+			password: func(_ string, email string) string { return strings.ToUpper(email) },
+			rules:    []string{"not_email"},
+		},
+		{
+			name:     "Same As Local Part",
+			password: func(localPart string, _ string) string { return localPart },
+			rules:    []string{"not_email"},
+		},
+		{
+			// Есть в тестовой базе утечек tests/breached
+			name:     "Breached",
+			password: func(string, string) string { return "P@ssw0rd" },
+			rules:    []string{"not_breached"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Свой email на каждый случай: Register ограничен по email
+			localPart, email := randomEmail()
+			_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: tt.password(localPart, email)})
+			require.Error(t, err)
+
+			s := status.Convert(err)
+			require.Equal(t, codes.InvalidArgument, s.Code())
+
+			var (
+				rules      string
+				violations []string
+			)
+			for _, detail := range s.Details() {
+				switch d := detail.(type) {
+				case *errdetails.ErrorInfo:
+					assert.Equal(t, "WEAK_PASSWORD", d.GetReason())
+					rules = d.GetMetadata()["rules"]
+				case *errdetails.BadRequest:
+					for _, v := range d.GetFieldViolations() {
+						assert.Equal(t, "password", v.GetField())
+						violations = append(violations, v.GetDescription())
+					}
+				}
+			}
+			assert.Equal(t, strings.Join(tt.rules, ","), rules)
+			require.Len(t, violations, len(tt.rules))
+			for i, rule := range tt.rules {
+				assert.True(t, strings.HasPrefix(violations[i], rule+":"), violations[i])
+			}
+		})
+	}
+
+	// Подходящий пароль принимается
+	localPart, email := randomEmail()
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: localPart + "-2024"})
+	require.NoError(t, err)
+
+	// В базе утечек есть и фиктивные суффиксы с count 0 (так HIBP дополняет ответы), такой пароль не считается скомпрометированным
+	_, email = randomEmail()
+	_, err = st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: "Zaq12wsx"})
+	require.NoError(t, err)
+}
+
+func randomEmail() (localPart string, email string) {
+	localPart = "user" + strings.ToLower(gofakeit.LetterN(10)) + gofakeit.DigitN(4)
+	return localPart, localPart + "@example.com"
+}
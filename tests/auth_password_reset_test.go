@@ -0,0 +1,256 @@
+package tests
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"sso/tests/suite"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const resetTokenPrefix = "Reset token: "
+
+func TestPasswordReset_HappyPath(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.NoError(t, err)
+
+	// iat в токене с точностью до секунды, токен должен оказаться выпущенным строго до сброса
+	time.Sleep(time.Second)
+
+	_, err = st.AuthClient.RequestPasswordReset(ctx, &ssov1.RequestPasswordResetRequest{Email: email})
+	require.NoError(t, err)
+
+	token := readMailToken(t, st, email, resetTokenPrefix)
+	newPass := randomFakePassword()
+
+	_, err = st.AuthClient.ConfirmPasswordReset(ctx, &ssov1.ConfirmPasswordResetRequest{Token: token, NewPassword: newPass})
+	require.NoError(t, err)
+
+	// Сессии, начатые со старым паролем, завершены
+	respIntrospect, err := st.AuthClient.Introspect(ctx, introspectRequest(respLogin.GetToken()))
+	require.NoError(t, err)
+	assert.False(t, respIntrospect.GetActive())
+
+	_, err = st.AuthClient.Refresh(ctx, &ssov1.RefreshRequest{RefreshToken: respLogin.GetRefreshToken()})
+	require.Error(t, err)
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Неудачный вход со старым паролем дает задержку перед следующей попыткой
+	time.Sleep(st.Cfg.Lockout.BaseDelay)
+
+	respLogin, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: newPass, AppId: appID})
+	require.NoError(t, err)
+
+	respIntrospect, err = st.AuthClient.Introspect(ctx, introspectRequest(respLogin.GetToken()))
+	require.NoError(t, err)
+	assert.True(t, respIntrospect.GetActive())
+
+	// Токен одноразовый
+	_, err = st.AuthClient.ConfirmPasswordReset(ctx, &ssov1.ConfirmPasswordResetRequest{Token: token, NewPassword: randomFakePassword()})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestPasswordReset_NewRequestInvalidatesOldToken(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: randomFakePassword()})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.RequestPasswordReset(ctx, &ssov1.RequestPasswordResetRequest{Email: email})
+	require.NoError(t, err)
+	oldToken := readMailToken(t, st, email, resetTokenPrefix)
+
+	_, err = st.AuthClient.RequestPasswordReset(ctx, &ssov1.RequestPasswordResetRequest{Email: email})
+	require.NoError(t, err)
+	newToken := readMailToken(t, st, email, resetTokenPrefix)
+	require.NotEqual(t, oldToken, newToken)
+
+	_, err = st.AuthClient.ConfirmPasswordReset(ctx, &ssov1.ConfirmPasswordResetRequest{Token: oldToken, NewPassword: randomFakePassword()})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = st.AuthClient.ConfirmPasswordReset(ctx, &ssov1.ConfirmPasswordResetRequest{Token: newToken, NewPassword: randomFakePassword()})
+	require.NoError(t, err)
+}
+
+func TestPasswordReset_UnknownEmail(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+
+	// Ответ такой же, как для зарегистрированного email, но письмо не отправляется
+	_, err := st.AuthClient.RequestPasswordReset(ctx, &ssov1.RequestPasswordResetRequest{Email: email})
+	require.NoError(t, err)
+
+	assert.Empty(t, mailFiles(t, st, email))
+}
+
+func TestPasswordReset_FailCases(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: randomFakePassword()})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.RequestPasswordReset(ctx, &ssov1.RequestPasswordResetRequest{Email: email})
+	require.NoError(t, err)
+	token := readMailToken(t, st, email, resetTokenPrefix)
+
+	tests := []struct {
+		name        string
+		token       string
+		newPassword string
+		expectedErr string
+	}{
+		{name: "Empty Token", token: "", newPassword: randomFakePassword(), expectedErr: "token is required"},
+		{name: "Empty Password", token: token, newPassword: "", expectedErr: "new_password is required"},
+		{name: "Unknown Token", token: "unknown-token", newPassword: randomFakePassword(), expectedErr: "invalid or expired password reset token"},
+		{name: "Weak Password", token: token, newPassword: "P@ssw0rd", expectedErr: "password does not meet policy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.ConfirmPasswordReset(ctx, &ssov1.ConfirmPasswordResetRequest{Token: tt.token, NewPassword: tt.newPassword})
+			require.Error(t, err)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+			assert.Contains(t, err.Error(), tt.expectedErr)
+		})
+	}
+
+	// Слабый пароль токен не тратит
+	_, err = st.AuthClient.ConfirmPasswordReset(ctx, &ssov1.ConfirmPasswordResetRequest{Token: token, NewPassword: randomFakePassword()})
+	require.NoError(t, err)
+}
+
+func TestChangePassword_HappyPath(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.NoError(t, err)
+
+	time.Sleep(time.Second)
+
+	newPass := randomFakePassword()
+
+	_, err = st.AuthClient.ChangePassword(ctx, &ssov1.ChangePasswordRequest{Email: email, OldPassword: pass + "-wrong", NewPassword: newPass})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Неверный старый пароль считается неудачной попыткой входа
+	_, err = st.AuthClient.ChangePassword(ctx, &ssov1.ChangePasswordRequest{Email: email, OldPassword: pass, NewPassword: newPass})
+	requireLocked(t, err)
+
+	time.Sleep(st.Cfg.Lockout.BaseDelay)
+
+	_, err = st.AuthClient.ChangePassword(ctx, &ssov1.ChangePasswordRequest{Email: email, OldPassword: pass, NewPassword: "P@ssw0rd"})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, err.Error(), "password does not meet policy")
+
+	_, err = st.AuthClient.ChangePassword(ctx, &ssov1.ChangePasswordRequest{Email: email, OldPassword: pass, NewPassword: newPass})
+	require.NoError(t, err)
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, introspectRequest(respLogin.GetToken()))
+	require.NoError(t, err)
+	assert.False(t, respIntrospect.GetActive())
+
+	_, err = st.AuthClient.Refresh(ctx, &ssov1.RefreshRequest{RefreshToken: respLogin.GetRefreshToken()})
+	require.Error(t, err)
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: newPass, AppId: appID})
+	require.NoError(t, err)
+}
+
+func TestChangePassword_ClearsForcedReset(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	adminCtx := adminContext(ctx, t, st)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	respReg, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	_, err = st.AdminClient.ForcePasswordReset(adminCtx, &ssov1.ForcePasswordResetRequest{UserId: respReg.GetUserId()})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.Error(t, err)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	newPass := randomFakePassword()
+
+	_, err = st.AuthClient.ChangePassword(ctx, &ssov1.ChangePasswordRequest{Email: email, OldPassword: pass, NewPassword: newPass})
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: newPass, AppId: appID})
+	require.NoError(t, err)
+}
+
+// readMailToken достает токен из последнего письма на email, строка с токеном начинается с prefix.
+// Локально письма складываются файлами, см. mail в конфиге
+func readMailToken(t *testing.T, st *suite.Suite, email string, prefix string) string {
+	t.Helper()
+
+	files := mailFiles(t, st, email)
+	require.NotEmpty(t, files, "no mail for %s", email)
+
+	f, err := os.Open(files[len(files)-1])
+	require.NoError(t, err)
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if token, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), prefix); ok {
+			return token
+		}
+	}
+	require.NoError(t, scanner.Err())
+
+	t.Fatalf("no %q in mail for %s", prefix, email)
+	return ""
+}
+
+// mailFiles возвращает письма на email от старых к новым
+func mailFiles(t *testing.T, st *suite.Suite, email string) []string {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join("..", st.Cfg.Mail.Dir, "*-"+email+".eml"))
+	require.NoError(t, err)
+	sort.Strings(files)
+
+	return files
+}
@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"sso/tests/suite"
+	"testing"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Пользователь с ролями из tests/migrations
+const (
+	rbacUserID   = 1000000
+	rbacEmail    = "rbac-editor@example.com"
+	rbacPassword = "rbac-editor-password"
+)
+
+func TestCheckPermission(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	tests := []struct {
+		name       string
+		appID      int32
+		permission string
+		allowed    bool
+	}{
+		{name: "Granted By Role", appID: appID, permission: "articles:write", allowed: true},
+		{name: "Not Granted", appID: appID, permission: "articles:delete", allowed: false},
+		// Роли одного приложения не дают разрешений в другом
+		{name: "Other App Role", appID: appID, permission: "logs:read", allowed: false},
+		{name: "Other App", appID: rs256AppID, permission: "articles:write", allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := st.AuthClient.CheckPermission(ctx, &ssov1.CheckPermissionRequest{
+				UserId:     rbacUserID,
+				AppId:      tt.appID,
+				Permission: tt.permission,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.allowed, resp.GetAllowed())
+		})
+	}
+}
+
+func TestCheckPermission_FailCases(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	tests := []struct {
+		name string
+		req  *ssov1.CheckPermissionRequest
+		code codes.Code
+	}{
+		{
+			name: "Empty Permission",
+			req:  &ssov1.CheckPermissionRequest{UserId: rbacUserID, AppId: appID},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "Unknown User",
+			req:  &ssov1.CheckPermissionRequest{UserId: rbacUserID - 1, AppId: appID, Permission: "articles:read"},
+			code: codes.NotFound,
+		},
+		{
+			name: "Unknown App",
+			req:  &ssov1.CheckPermissionRequest{UserId: rbacUserID, AppId: 999, Permission: "articles:read"},
+			code: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.CheckPermission(ctx, tt.req)
+			require.Error(t, err)
+			assert.Equal(t, tt.code, status.Code(err))
+		})
+	}
+}
+
+func TestListUserRoles(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	resp, err := st.AuthClient.ListUserRoles(ctx, &ssov1.ListUserRolesRequest{UserId: rbacUserID, AppId: appID})
+	require.NoError(t, err)
+	require.Len(t, resp.GetRoles(), 1)
+	assert.Equal(t, "editor", resp.GetRoles()[0].GetName())
+	assert.Equal(t, []string{"articles:read", "articles:write"}, resp.GetRoles()[0].GetPermissions())
+
+	// У нового пользователя ролей нет
+	respReg, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: gofakeit.Email(), Password: randomFakePassword()})
+	require.NoError(t, err)
+
+	resp, err = st.AuthClient.ListUserRoles(ctx, &ssov1.ListUserRolesRequest{UserId: respReg.GetUserId(), AppId: appID})
+	require.NoError(t, err)
+	assert.Empty(t, resp.GetRoles())
+}
+
+// Роли пользователя в приложении попадают в токен
+func TestLogin_RolesClaim(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: rbacEmail, Password: rbacPassword, AppId: appID})
+	require.NoError(t, err)
+
+	claims := parseHS256Claims(t, respLogin.GetToken(), appSecret)
+	assert.Equal(t, []interface{}{"editor"}, claims["roles"])
+
+	// Приложение не включило роли в свои поля токена
+	respLogin, err = st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: rbacEmail, Password: rbacPassword, AppId: customTokensAppID})
+	require.NoError(t, err)
+
+	claims = parseHS256Claims(t, respLogin.GetToken(), customTokensAppSecret)
+	assert.NotContains(t, claims, "roles")
+}
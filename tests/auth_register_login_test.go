@@ -2,6 +2,7 @@ package tests
 
 import (
 	"sso/tests/suite"
+	"strconv"
 	"testing"
 	"time"
 
@@ -64,6 +65,14 @@ func TestRegisterLogin_Login_HappyPath(t *testing.T)  {
 	createTime := loginTime.Add(st.Cfg.TokenTTL).Unix()
 	expTime := claims["exp"].(float64)
 	assert.InDelta(t, createTime, expTime, deltaSeconds)
+
+	// Стандартные поля, которые ждут сторонние JWT библиотеки
+	assert.Equal(t, st.Cfg.Issuer, claims["iss"])
+	assert.Equal(t, strconv.FormatInt(respReg.GetUserId(), 10), claims["sub"])
+	assert.Equal(t, []interface{}{strconv.Itoa(appID)}, claims["aud"])
+	assert.InDelta(t, loginTime.Unix(), claims["iat"].(float64), deltaSeconds)
+	assert.InDelta(t, loginTime.Unix(), claims["nbf"].(float64), deltaSeconds)
+	assert.NotEmpty(t, claims["jti"])
 }
 
 func TestRegisterLogin_DuplicatedRegistration(t *testing.T) {
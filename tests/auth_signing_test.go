@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"os"
+	"sso/tests/suite"
+	"testing"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Приложения из tests/migrations/2_add_asymmetric_apps.up.sql, токены проверяем только публичным ключом
+func TestLogin_AsymmetricSigning(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	tests := []struct {
+		name      string
+		appID     int32
+		alg       string
+		publicKey string
+		parseKey  func(data []byte) (interface{}, error)
+	}{
+		{
+			name:      "RS256",
+			appID:     2,
+			alg:       "RS256",
+			publicKey: "keys/test-rs256.pub.pem",
+			parseKey:  func(data []byte) (interface{}, error) { return jwt.ParseRSAPublicKeyFromPEM(data) },
+		},
+		{
+			name:      "ES256",
+			appID:     3,
+			alg:       "ES256",
+			publicKey: "keys/test-es256.pub.pem",
+			parseKey:  func(data []byte) (interface{}, error) { return jwt.ParseECPublicKeyFromPEM(data) },
+		},
+		{
+			name:      "EdDSA",
+			appID:     4,
+			alg:       "EdDSA",
+			publicKey: "keys/test-eddsa.pub.pem",
+			parseKey:  func(data []byte) (interface{}, error) { return jwt.ParseEdPublicKeyFromPEM(data) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email := gofakeit.Email()
+			pass := randomFakePassword()
+
+			respReg, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: pass})
+			require.NoError(t, err)
+
+			respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: tt.appID})
+			require.NoError(t, err)
+
+			pem, err := os.ReadFile(tt.publicKey)
+			require.NoError(t, err)
+			publicKey, err := tt.parseKey(pem)
+			require.NoError(t, err)
+
+			// WithValidMethods не дает подсунуть токен, подписанный другим алгоритмом
+			tokenParsed, err := jwt.Parse(respLogin.GetToken(), func(t *jwt.Token) (interface{}, error) {
+				return publicKey, nil
+			}, jwt.WithValidMethods([]string{tt.alg}))
+			require.NoError(t, err)
+
+			claims, ok := tokenParsed.Claims.(jwt.MapClaims)
+			require.True(t, ok)
+			assert.Equal(t, respReg.GetUserId(), int64(claims["uid"].(float64)))
+			assert.Equal(t, int(tt.appID), int(claims["app_id"].(float64)))
+		})
+	}
+}
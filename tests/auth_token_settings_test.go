@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"sso/tests/suite"
+	"testing"
+	"time"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	customTokensAppID     = 6
+	customTokensAppSecret = "test-custom-tokens-secret"
+	customTokensTTL       = 15 * time.Minute
+)
+
+// Приложение со своими настройками получает токены со своим временем жизни и набором полей
+func TestLogin_AppTokenSettings(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: customTokensAppID})
+	require.NoError(t, err)
+	loginTime := time.Now()
+
+	respRefresh, err := st.AuthClient.Refresh(ctx, &ssov1.RefreshRequest{RefreshToken: respLogin.GetRefreshToken()})
+	require.NoError(t, err)
+	refreshTime := time.Now()
+
+	tests := []struct {
+		name     string
+		token    string
+		issuedAt time.Time
+	}{
+		{name: "Login", token: respLogin.GetToken(), issuedAt: loginTime},
+		{name: "Refresh", token: respRefresh.GetToken(), issuedAt: refreshTime},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := parseHS256Claims(t, tt.token, customTokensAppSecret)
+
+			assert.InDelta(t, tt.issuedAt.Add(customTokensTTL).Unix(), claims["exp"].(float64), 1)
+			assert.NotContains(t, claims, "email")
+			assert.Equal(t, false, claims["is_admin"])
+		})
+	}
+}
+
+// Приложение без своих настроек получает токены как раньше: с email и TTL из конфига
+func TestLogin_DefaultTokenSettings(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.NoError(t, err)
+	loginTime := time.Now()
+
+	claims := parseHS256Claims(t, respLogin.GetToken(), appSecret)
+
+	assert.InDelta(t, loginTime.Add(st.Cfg.TokenTTL).Unix(), claims["exp"].(float64), 1)
+	assert.Equal(t, email, claims["email"])
+	assert.NotContains(t, claims, "is_admin")
+}
+
+func parseHS256Claims(t *testing.T, token string, secret string) jwt.MapClaims {
+	t.Helper()
+
+	parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	})
+	require.NoError(t, err)
+
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	require.True(t, ok)
+
+	return claims
+}
@@ -0,0 +1,354 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"sso/internal/lib/cbor"
+	"sso/tests/suite"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Флаги authenticatorData
+const (
+	flagUserPresent        = 0x01
+	flagUserVerified       = 0x04
+	flagAttestedCredential = 0x40
+)
+
+func TestWebAuthn_RegisterAndLogin(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respLogin := registerAndLogin(ctx, t, st)
+	respIntrospect, err := st.AuthClient.Introspect(ctx, introspectRequest(respLogin.GetToken()))
+	require.NoError(t, err)
+	email := respIntrospect.GetEmail()
+
+	key := newSoftAuthenticator(t, st)
+
+	respBegin, err := st.AuthClient.BeginWebAuthnRegistration(ctx, &ssov1.BeginWebAuthnRegistrationRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+	options := respBegin.GetOptions()
+	assert.Equal(t, st.Cfg.WebAuthn.RPID, options.GetRpId())
+	assert.Equal(t, email, options.GetUserName())
+	assert.NotEmpty(t, options.GetUserId())
+	assert.Contains(t, options.GetAlgorithms(), int32(-7))
+	assert.Empty(t, options.GetCredentialIds())
+
+	clientData, attestation := key.create(t, options.GetChallenge(), options.GetUserId())
+	respFinish, err := st.AuthClient.FinishWebAuthnRegistration(ctx, &ssov1.FinishWebAuthnRegistrationRequest{
+		Token:             respLogin.GetToken(),
+		Name:              "laptop",
+		ClientDataJson:    clientData,
+		AttestationObject: attestation,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, key.id, respFinish.GetCredentialId())
+
+	// Зарегистрированный passkey попадает в excludeCredentials, второй раз его не сохранить
+	respBegin, err = st.AuthClient.BeginWebAuthnRegistration(ctx, &ssov1.BeginWebAuthnRegistrationRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{key.id}, respBegin.GetOptions().GetCredentialIds())
+
+	clientData, attestation = key.create(t, respBegin.GetOptions().GetChallenge(), respBegin.GetOptions().GetUserId())
+	_, err = st.AuthClient.FinishWebAuthnRegistration(ctx, &ssov1.FinishWebAuthnRegistrationRequest{
+		Token:             respLogin.GetToken(),
+		ClientDataJson:    clientData,
+		AttestationObject: attestation,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	// Вход по email: allowCredentials содержит passkey пользователя
+	respLoginBegin, err := st.AuthClient.BeginWebAuthnLogin(ctx, &ssov1.BeginWebAuthnLoginRequest{Email: email, AppId: appID})
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{key.id}, respLoginBegin.GetOptions().GetCredentialIds())
+	assert.Equal(t, "required", respLoginBegin.GetOptions().GetUserVerification())
+
+	respWebAuthnLogin, err := st.AuthClient.FinishWebAuthnLogin(ctx, key.get(t, respLoginBegin.GetOptions().GetChallenge(), 1))
+	require.NoError(t, err)
+	assert.NotEmpty(t, respWebAuthnLogin.GetRefreshToken())
+	assert.Empty(t, respWebAuthnLogin.GetMfaToken())
+
+	respIntrospect, err = st.AuthClient.Introspect(ctx, introspectRequest(respWebAuthnLogin.GetToken()))
+	require.NoError(t, err)
+	assert.True(t, respIntrospect.GetActive())
+	assert.Equal(t, email, respIntrospect.GetEmail())
+
+	// Вход без email: пользователя называет аутентификатор
+	respLoginBegin, err = st.AuthClient.BeginWebAuthnLogin(ctx, &ssov1.BeginWebAuthnLoginRequest{AppId: appID})
+	require.NoError(t, err)
+	assert.Empty(t, respLoginBegin.GetOptions().GetCredentialIds())
+
+	respWebAuthnLogin, err = st.AuthClient.FinishWebAuthnLogin(ctx, key.get(t, respLoginBegin.GetOptions().GetChallenge(), 2))
+	require.NoError(t, err)
+
+	respIntrospect, err = st.AuthClient.Introspect(ctx, introspectRequest(respWebAuthnLogin.GetToken()))
+	require.NoError(t, err)
+	assert.Equal(t, email, respIntrospect.GetEmail())
+}
+
+func TestWebAuthn_LoginFailCases(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	respLogin := registerAndLogin(ctx, t, st)
+	respIntrospect, err := st.AuthClient.Introspect(ctx, introspectRequest(respLogin.GetToken()))
+	require.NoError(t, err)
+	email := respIntrospect.GetEmail()
+
+	key := newSoftAuthenticator(t, st)
+	key.register(ctx, t, st, respLogin.GetToken())
+
+	beginLogin := func() []byte {
+		resp, err := st.AuthClient.BeginWebAuthnLogin(ctx, &ssov1.BeginWebAuthnLoginRequest{Email: email, AppId: appID})
+		require.NoError(t, err)
+		return resp.GetOptions().GetChallenge()
+	}
+
+	// Ответ на один вызов принимается один раз
+	challenge := beginLogin()
+	req := key.get(t, challenge, 5)
+	_, err = st.AuthClient.FinishWebAuthnLogin(ctx, req)
+	require.NoError(t, err)
+
+	_, err = st.AuthClient.FinishWebAuthnLogin(ctx, req)
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Счетчик подписей не вырос: аутентификатор мог быть склонирован
+	_, err = st.AuthClient.FinishWebAuthnLogin(ctx, key.get(t, beginLogin(), 5))
+	require.Error(t, err)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// Чужой origin
+	challenge = beginLogin()
+	req = key.get(t, challenge, 6)
+	req.ClientDataJson = clientDataJSON(t, "webauthn.get", challenge, "https://evil.example")
+	req.Signature = key.sign(t, req.GetAuthenticatorData(), req.GetClientDataJson())
+	_, err = st.AuthClient.FinishWebAuthnLogin(ctx, req)
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Неверная подпись
+	req = key.get(t, beginLogin(), 7)
+	req.Signature = key.sign(t, req.GetAuthenticatorData(), []byte("{}"))
+	_, err = st.AuthClient.FinishWebAuthnLogin(ctx, req)
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Без проверки пользователя (PIN, биометрия) вход не принимается
+	key.flags = flagUserPresent
+	_, err = st.AuthClient.FinishWebAuthnLogin(ctx, key.get(t, beginLogin(), 8))
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	key.flags = flagUserPresent | flagUserVerified
+
+	// Вход начат для другого пользователя
+	other := newSoftAuthenticator(t, st)
+	other.register(ctx, t, st, registerAndLogin(ctx, t, st).GetToken())
+
+	_, err = st.AuthClient.FinishWebAuthnLogin(ctx, other.get(t, beginLogin(), 1))
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Неизвестные учетные данные
+	unknown := newSoftAuthenticator(t, st)
+	_, err = st.AuthClient.FinishWebAuthnLogin(ctx, unknown.get(t, beginLogin(), 1))
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// После всех ошибок верный ответ по-прежнему принимается
+	_, err = st.AuthClient.FinishWebAuthnLogin(ctx, key.get(t, beginLogin(), 9))
+	require.NoError(t, err)
+
+	// Неизвестный email не отличить от пользователя без passkey
+	resp, err := st.AuthClient.BeginWebAuthnLogin(ctx, &ssov1.BeginWebAuthnLoginRequest{Email: "unknown-" + email, AppId: appID})
+	require.NoError(t, err)
+	assert.Empty(t, resp.GetOptions().GetCredentialIds())
+
+	_, err = st.AuthClient.BeginWebAuthnLogin(ctx, &ssov1.BeginWebAuthnLoginRequest{Email: email, AppId: 9999})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestWebAuthn_RegistrationFailCases(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	token := registerAndLogin(ctx, t, st).GetToken()
+	key := newSoftAuthenticator(t, st)
+
+	_, err := st.AuthClient.BeginWebAuthnRegistration(ctx, &ssov1.BeginWebAuthnRegistrationRequest{Token: "invalid"})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// Вызов регистрации нельзя использовать для входа
+	respBegin, err := st.AuthClient.BeginWebAuthnRegistration(ctx, &ssov1.BeginWebAuthnRegistrationRequest{Token: token})
+	require.NoError(t, err)
+	_, err = st.AuthClient.FinishWebAuthnLogin(ctx, key.get(t, respBegin.GetOptions().GetChallenge(), 1))
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Регистрацию, начатую одним пользователем, не завершить другому
+	respBegin, err = st.AuthClient.BeginWebAuthnRegistration(ctx, &ssov1.BeginWebAuthnRegistrationRequest{Token: token})
+	require.NoError(t, err)
+	clientData, attestation := key.create(t, respBegin.GetOptions().GetChallenge(), respBegin.GetOptions().GetUserId())
+	_, err = st.AuthClient.FinishWebAuthnRegistration(ctx, &ssov1.FinishWebAuthnRegistrationRequest{
+		Token:             registerAndLogin(ctx, t, st).GetToken(),
+		ClientDataJson:    clientData,
+		AttestationObject: attestation,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Ответ для чужого RP ID
+	respBegin, err = st.AuthClient.BeginWebAuthnRegistration(ctx, &ssov1.BeginWebAuthnRegistrationRequest{Token: token})
+	require.NoError(t, err)
+	key.rpID = "evil.example"
+	clientData, attestation = key.create(t, respBegin.GetOptions().GetChallenge(), respBegin.GetOptions().GetUserId())
+	_, err = st.AuthClient.FinishWebAuthnRegistration(ctx, &ssov1.FinishWebAuthnRegistrationRequest{
+		Token:             token,
+		ClientDataJson:    clientData,
+		AttestationObject: attestation,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// Вызов, которого сервер не выдавал
+	key.rpID = st.Cfg.WebAuthn.RPID
+	challenge := make([]byte, 32)
+	_, err = rand.Read(challenge)
+	require.NoError(t, err)
+	clientData, attestation = key.create(t, challenge, respBegin.GetOptions().GetUserId())
+	_, err = st.AuthClient.FinishWebAuthnRegistration(ctx, &ssov1.FinishWebAuthnRegistrationRequest{
+		Token:             token,
+		ClientDataJson:    clientData,
+		AttestationObject: attestation,
+	})
+	require.Error(t, err)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// softAuthenticator - программный аутентификатор с ключом ES256, отвечает как браузер с passkey
+type softAuthenticator struct {
+	id         []byte
+	key        *ecdsa.PrivateKey
+	userHandle []byte
+	rpID       string
+	origin     string
+	flags      byte
+}
+
+func newSoftAuthenticator(t *testing.T, st *suite.Suite) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	require.NoError(t, err)
+
+	return &softAuthenticator{
+		id:     id,
+		key:    key,
+		rpID:   st.Cfg.WebAuthn.RPID,
+		origin: st.Cfg.WebAuthn.Origins[0],
+		flags:  flagUserPresent | flagUserVerified,
+	}
+}
+
+// register регистрирует passkey владельцу access токена
+func (a *softAuthenticator) register(ctx context.Context, t *testing.T, st *suite.Suite, token string) {
+	respBegin, err := st.AuthClient.BeginWebAuthnRegistration(ctx, &ssov1.BeginWebAuthnRegistrationRequest{Token: token})
+	require.NoError(t, err)
+
+	clientData, attestation := a.create(t, respBegin.GetOptions().GetChallenge(), respBegin.GetOptions().GetUserId())
+	_, err = st.AuthClient.FinishWebAuthnRegistration(ctx, &ssov1.FinishWebAuthnRegistrationRequest{
+		Token:             token,
+		ClientDataJson:    clientData,
+		AttestationObject: attestation,
+	})
+	require.NoError(t, err)
+}
+
+// create отвечает на navigator.credentials.create(): clientDataJSON и attestationObject в формате none
+func (a *softAuthenticator) create(t *testing.T, challenge []byte, userHandle []byte) (clientData []byte, attestationObject []byte) {
+	a.userHandle = userHandle
+
+	publicKey, err := cbor.Encode(map[int]any{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(t, err)
+
+	authData := a.authenticatorData(a.flags|flagAttestedCredential, 0)
+	authData = append(authData, make([]byte, 16)...) // aaguid
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.id)))
+	authData = append(authData, a.id...)
+	authData = append(authData, publicKey...)
+
+	attestationObject, err = cbor.Encode(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	require.NoError(t, err)
+
+	return clientDataJSON(t, "webauthn.create", challenge, a.origin), attestationObject
+}
+
+// get отвечает на navigator.credentials.get() со счетчиком подписей signCount
+func (a *softAuthenticator) get(t *testing.T, challenge []byte, signCount uint32) *ssov1.FinishWebAuthnLoginRequest {
+	clientData := clientDataJSON(t, "webauthn.get", challenge, a.origin)
+	authData := a.authenticatorData(a.flags, signCount)
+
+	return &ssov1.FinishWebAuthnLoginRequest{
+		CredentialId:      a.id,
+		ClientDataJson:    clientData,
+		AuthenticatorData: authData,
+		Signature:         a.sign(t, authData, clientData),
+		UserHandle:        a.userHandle,
+	}
+}
+
+func (a *softAuthenticator) authenticatorData(flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+
+	data := append(rpIDHash[:], flags)
+
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
+
+func (a *softAuthenticator) sign(t *testing.T, authData []byte, clientData []byte) []byte {
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	require.NoError(t, err)
+
+	return sig
+}
+
+func clientDataJSON(t *testing.T, typ string, challenge []byte, origin string) []byte {
+	data, err := json.Marshal(map[string]string{
+		"type":      typ,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    origin,
+	})
+	require.NoError(t, err)
+
+	return data
+}
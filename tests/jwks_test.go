@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"sso/tests/suite"
+	"testing"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	rs256AppID       = 2
+	managedKeysAppID = 5
+)
+
+// Приложению без файла с ключом сервис сам выпускает active и next ключи
+func TestJWKS_ManagedKeys(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: managedKeysAppID})
+	require.NoError(t, err)
+
+	respJWKS, err := st.AuthClient.JWKS(ctx, &ssov1.JWKSRequest{AppId: managedKeysAppID})
+	require.NoError(t, err)
+	// Кроме активного ключа заранее опубликован следующий
+	require.GreaterOrEqual(t, len(respJWKS.GetKeys()), 2)
+
+	keys := make(map[string]*ssov1.JWK)
+	for _, key := range respJWKS.GetKeys() {
+		keys[key.GetKid()] = key
+	}
+
+	// Проверяем токен только по данным из JWKS, как это сделал бы сторонний сервис
+	tokenParsed, err := jwt.Parse(respLogin.GetToken(), func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys[kid]
+		require.True(t, ok, "kid %q not found in JWKS", kid)
+		require.Equal(t, "EC", key.GetKty())
+
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     decodeBigInt(t, key.GetX()),
+			Y:     decodeBigInt(t, key.GetY()),
+		}, nil
+	}, jwt.WithValidMethods([]string{"ES256"}))
+	require.NoError(t, err)
+	assert.True(t, tokenParsed.Valid)
+}
+
+func TestJWKS_HTTP(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	email := gofakeit.Email()
+	pass := randomFakePassword()
+
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: rs256AppID})
+	require.NoError(t, err)
+
+	token, _, err := jwt.NewParser().ParseUnverified(respLogin.GetToken(), jwt.MapClaims{})
+	require.NoError(t, err)
+	kid, _ := token.Header["kid"].(string)
+	require.NotEmpty(t, kid)
+
+	resp, err := http.Get(st.HTTPURL("/.well-known/jwks.json"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Alg string `json:"alg"`
+		} `json:"keys"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&set))
+
+	var found bool
+	for _, key := range set.Keys {
+		if key.Kid == kid {
+			found = true
+			assert.Equal(t, "RSA", key.Kty)
+			assert.Equal(t, "RS256", key.Alg)
+		}
+	}
+	assert.True(t, found, "kid %q not found in JWKS", kid)
+}
+
+func decodeBigInt(t *testing.T, s string) *big.Int {
+	t.Helper()
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	require.NoError(t, err)
+
+	return new(big.Int).SetBytes(b)
+}
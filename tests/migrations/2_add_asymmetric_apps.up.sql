@@ -0,0 +1,6 @@
+-- Приложения с асимметричной подписью, приватные ключи лежат в tests/keys
+INSERT INTO apps (id, name, secret, signing_alg, signing_key)
+VALUES (2, 'test-rs256', 'test-rs256-secret', 'RS256', 'test-rs256.pem'),
+       (3, 'test-es256', 'test-es256-secret', 'ES256', 'test-es256.pem'),
+       (4, 'test-eddsa', 'test-eddsa-secret', 'EdDSA', 'test-eddsa.pem')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+-- Приложение без signing_key, ключи ему генерирует и ротирует сам сервис
+INSERT INTO apps (id, name, secret, signing_alg, signing_key)
+VALUES (5, 'test-managed-keys', 'test-managed-keys-secret', 'ES256', '')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+-- Приложение со своим временем жизни токенов и без email в токене
+INSERT INTO apps (id, name, secret, token_ttl, refresh_token_ttl, claims)
+VALUES (6, 'test-custom-tokens', 'test-custom-tokens-secret', 900, 3600, 'is_admin')
+ON CONFLICT DO NOTHING;
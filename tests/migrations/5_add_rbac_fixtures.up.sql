@@ -0,0 +1,26 @@
+-- Пользователь с ролями, пароль rbac-editor-password
+INSERT INTO users (id, email, pass_hash)
+VALUES (1000000, 'rbac-editor@example.com', '$2a$10$ip0dvQS1XKZ9e4cFeXtoNOaKKCJcOf6TEMYxSoEsua/.5zqtw1Opm')
+ON CONFLICT DO NOTHING;
+
+-- id с запасом: первые роли заводят основные миграции (роль администратора SSO)
+INSERT INTO roles (id, app_id, name)
+VALUES (1001, 1, 'editor'),
+       (1002, 1, 'viewer'),
+       (1003, 2, 'auditor')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission)
+VALUES (1001, 'articles:read'),
+       (1001, 'articles:write'),
+       (1002, 'articles:read'),
+       (1003, 'logs:read')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO user_roles (user_id, role_id)
+VALUES (1000000, 1001),
+       (1000000, 1003)
+ON CONFLICT DO NOTHING;
+
+-- Роли попадают в токен, только если приложение включило их в apps.claims
+UPDATE apps SET claims = 'email,roles' WHERE id = 1;
@@ -0,0 +1,8 @@
+-- Администратор для тестов сервиса Admin, пароль admin-password
+INSERT INTO users (id, email, pass_hash)
+VALUES (1000001, 'admin@example.com', '$2a$10$H7fuk6lCN8nDLqGrUqG/b.5b.VdH/T5Tf.3G3QXj1r8brfyPmv5.S')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO user_roles (user_id, role_id)
+SELECT 1000001, id FROM roles WHERE app_id = 0 AND name = 'admin'
+ON CONFLICT DO NOTHING;
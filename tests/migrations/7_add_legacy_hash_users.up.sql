@@ -0,0 +1,7 @@
+-- Пользователи с хешами не тех алгоритмов и параметров, что в config/local.yaml: при входе пароль перехешируется
+-- Пароли: legacy-bcrypt-password, legacy-scrypt-password, legacy-argon2id-password
+INSERT INTO users (id, email, pass_hash)
+VALUES (1000002, 'legacy-bcrypt@example.com', '$2a$04$6dknKJRaN6pxbL9G3EjrBO0Jp15cHdod5zE33MY5ENasvBcqcH5US'),
+       (1000003, 'legacy-scrypt@example.com', '$scrypt$ln=14,r=8,p=1$lnp0oj/IKluh7FI/KyE8LQ$LGlFHHtlelJ8lVDLii6HOgbYcSRJurWqRarTgxWudLw'),
+       (1000004, 'legacy-argon2id@example.com', '$argon2id$v=19$m=8192,t=1,p=1$FL5GxVEMMM5N68afMQo5DA$Hoz99ax4F4qgH4IDuTTOaEQRFuGj0z5bryKB0qiYV6Q')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,5 @@
+-- Приложение администраторов из config/local.yaml (admin.app_id): через него входят в сервис Admin.
+-- Ключи ES256 генерирует сам сервис, секрет HS256 администраторам не подходит
+INSERT INTO apps (id, name, secret, signing_alg, signing_key)
+VALUES (7, 'test-admin', 'test-admin-secret', 'ES256', '')
+ON CONFLICT DO NOTHING;
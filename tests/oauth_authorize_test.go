@@ -0,0 +1,572 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"sso/internal/lib/totp"
+	"sso/tests/suite"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const oauthRedirectURI = "https://client.example/callback"
+
+var (
+	mfaTokenField  = regexp.MustCompile(`name="mfa_token" value="([^"]+)"`)
+	csrfTokenField = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+)
+
+func TestOAuth_AuthorizationCodeFlow(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	client := newPublicOAuthClient(ctx, t, st, "authorization_code", "refresh_token")
+	email, pass := registerUser(ctx, t, st)
+
+	verifier, challenge := newPKCE(t)
+	params := client.authorizeParams(challenge)
+
+	// Страница входа показывает приложение и запрошенные права
+	resp := oauthGet(t, st, "/authorize?"+params.Encode())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "DENY", resp.Header.Get("X-Frame-Options"))
+	body := readBody(t, resp)
+	assert.Contains(t, body, client.name)
+	assert.Contains(t, body, "profile")
+
+	code := authorizeCode(t, st, params, email, pass)
+
+	// Публичный клиент обменивает код без секрета, его защищает PKCE
+	tokens := exchangeCode(t, st, url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {client.id},
+		"code":          {code},
+		"redirect_uri":  {oauthRedirectURI},
+		"code_verifier": {verifier},
+	})
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.Equal(t, "profile", tokens.Scope)
+	assert.Positive(t, tokens.ExpiresIn)
+	require.NotEmpty(t, tokens.RefreshToken)
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, introspectRequest(tokens.AccessToken))
+	require.NoError(t, err)
+	assert.True(t, respIntrospect.GetActive())
+
+	// Refresh по /token с секретом в HTTP Basic сохраняет права
+	refreshed := postToken(t, st, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens.RefreshToken},
+	}, client.id, client.secret)
+	require.Equal(t, http.StatusOK, refreshed.status)
+	assert.NotEmpty(t, refreshed.AccessToken)
+	assert.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+	assert.Equal(t, "profile", refreshed.Scope)
+
+	// Повторный обмен кода отклоняется и отзывает выданные по нему refresh токены
+	reused := postToken(t, st, url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {client.id},
+		"code":          {code},
+		"redirect_uri":  {oauthRedirectURI},
+		"code_verifier": {verifier},
+	}, "", "")
+	assert.Equal(t, http.StatusBadRequest, reused.status)
+	assert.Equal(t, "invalid_grant", reused.Error)
+
+	revoked := postToken(t, st, url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {client.id},
+		"refresh_token": {refreshed.RefreshToken},
+	}, "", "")
+	assert.Equal(t, "invalid_grant", revoked.Error)
+}
+
+func TestOAuth_AuthorizeWithMFA(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	client := newOAuthClient(ctx, t, st, "authorization_code")
+	email, pass := registerUser(ctx, t, st)
+
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: appID})
+	require.NoError(t, err)
+	respEnroll, err := st.AuthClient.EnrollTOTP(ctx, &ssov1.EnrollTOTPRequest{Token: respLogin.GetToken()})
+	require.NoError(t, err)
+	secret := respEnroll.GetSecret()
+	step := totp.Step(time.Now())
+	_, err = st.AuthClient.ConfirmTOTP(ctx, &ssov1.ConfirmTOTPRequest{Token: respLogin.GetToken(), Code: totpCode(t, secret, step)})
+	require.NoError(t, err)
+
+	verifier, challenge := newPKCE(t)
+	params := client.authorizeParams(challenge)
+
+	// После пароля страница просит код
+	form := cloneValues(params)
+	form.Set("email", email)
+	form.Set("password", pass)
+	resp := oauthPost(t, st, "/authorize", form)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	match := mfaTokenField.FindStringSubmatch(readBody(t, resp))
+	require.Len(t, match, 2)
+
+	form = cloneValues(params)
+	form.Set("mfa_token", match[1])
+	form.Set("code", totpCode(t, secret, step+1))
+	resp = oauthPost(t, st, "/authorize", form)
+	require.Equal(t, http.StatusSeeOther, resp.StatusCode)
+	code := redirectParams(t, resp).Get("code")
+	require.NotEmpty(t, code)
+
+	tokens := exchangeCode(t, st, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {oauthRedirectURI},
+		"code_verifier": {verifier},
+	}, client.id, client.secret)
+	assert.NotEmpty(t, tokens.AccessToken)
+	// Приложению без refresh_token grant refresh токен не выдается
+	assert.Empty(t, tokens.RefreshToken)
+}
+
+func TestOAuth_AuthorizeErrors(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	client := newOAuthClient(ctx, t, st, "authorization_code")
+	email, pass := registerUser(ctx, t, st)
+	_, challenge := newPKCE(t)
+
+	// Ошибки client_id и redirect_uri показываются пользователю: куда его возвращать, неизвестно
+	params := client.authorizeParams(challenge)
+	params.Set("client_id", "999999")
+	resp := oauthGet(t, st, "/authorize?"+params.Encode())
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	params = client.authorizeParams(challenge)
+	params.Set("redirect_uri", "https://evil.example/callback")
+	resp = oauthGet(t, st, "/authorize?"+params.Encode())
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Остальные ошибки возвращаются приложению вместе со state
+	tests := []struct {
+		name     string
+		modify   func(v url.Values)
+		expected string
+	}{
+		{name: "no pkce", modify: func(v url.Values) { v.Del("code_challenge"); v.Del("code_challenge_method") }, expected: "invalid_request"},
+		{name: "plain pkce", modify: func(v url.Values) { v.Set("code_challenge_method", "plain") }, expected: "invalid_request"},
+		{name: "implicit flow", modify: func(v url.Values) { v.Set("response_type", "token") }, expected: "unsupported_response_type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := client.authorizeParams(challenge)
+			tt.modify(params)
+
+			resp := oauthGet(t, st, "/authorize?"+params.Encode())
+			require.Equal(t, http.StatusSeeOther, resp.StatusCode)
+			q := redirectParams(t, resp)
+			assert.Equal(t, tt.expected, q.Get("error"))
+			assert.Equal(t, params.Get("state"), q.Get("state"))
+		})
+	}
+
+	// Приложению без authorization_code grant коды не выдаются
+	passwordOnly := newOAuthClient(ctx, t, st, "password")
+	resp = oauthGet(t, st, "/authorize?"+passwordOnly.authorizeParams(challenge).Encode())
+	require.Equal(t, http.StatusSeeOther, resp.StatusCode)
+	assert.Equal(t, "unauthorized_client", redirectParams(t, resp).Get("error"))
+
+	// Отказ пользователя
+	form := client.authorizeParams(challenge)
+	form.Set("action", "deny")
+	resp = oauthPost(t, st, "/authorize", form)
+	require.Equal(t, http.StatusSeeOther, resp.StatusCode)
+	assert.Equal(t, "access_denied", redirectParams(t, resp).Get("error"))
+
+	// Неверный пароль оставляет пользователя на странице входа
+	form = client.authorizeParams(challenge)
+	form.Set("email", email)
+	form.Set("password", pass+"x")
+	resp = oauthPost(t, st, "/authorize", form)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Contains(t, readBody(t, resp), "Invalid email or password")
+
+	// Неудачная попытка блокирует следующую, как и в Login
+	form.Set("password", pass)
+	resp = oauthPost(t, st, "/authorize", form)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+}
+
+func TestOAuth_AuthorizeRequiresCSRFToken(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	client := newOAuthClient(ctx, t, st, "authorization_code")
+	email, pass := registerUser(ctx, t, st)
+	_, challenge := newPKCE(t)
+
+	form := client.authorizeParams(challenge)
+	form.Set("email", email)
+	form.Set("password", pass)
+
+	// Токен, показанный другому браузеру, не подходит
+	otherToken := formCSRFToken(t, st, newBrowser(t), "/authorize", form)
+	browser := newBrowser(t)
+	formCSRFToken(t, st, browser, "/authorize", form)
+
+	tests := []struct {
+		name   string
+		client *http.Client
+		token  string
+	}{
+		{name: "no token", client: browser, token: ""},
+		{name: "no cookie", client: noRedirects, token: otherToken},
+		{name: "token of another browser", client: browser, token: otherToken},
+		{name: "malformed token", client: browser, token: "invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := cloneValues(form)
+			form.Set("csrf_token", tt.token)
+
+			resp, err := tt.client.PostForm(st.HTTPURL("/authorize"), form)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			// Код не выдан, пользователь снова видит форму
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+			assert.Contains(t, readBody(t, resp), "The page has expired")
+		})
+	}
+
+	// Отказ тоже требует токена: иначе чужой сайт мог бы сорвать вход
+	form.Set("action", "deny")
+	resp, err := browser.PostForm(st.HTTPURL("/authorize"), form)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// Попытки без токена пароль не проверяли и вход не заблокировали
+	form.Del("action")
+	assert.NotEmpty(t, authorizeCode(t, st, form, email, pass))
+}
+
+func TestOAuth_TokenErrors(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	client := newOAuthClient(ctx, t, st, "authorization_code", "refresh_token")
+	other := newOAuthClient(ctx, t, st, "authorization_code", "refresh_token")
+	email, pass := registerUser(ctx, t, st)
+
+	newCode := func() (code string, verifier string) {
+		verifier, challenge := newPKCE(t)
+		return authorizeCode(t, st, client.authorizeParams(challenge), email, pass), verifier
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(v url.Values)
+		clientID string
+		secret   string
+		status   int
+		expected string
+	}{
+		{name: "wrong verifier", modify: func(v url.Values) { v.Set("code_verifier", strings.Repeat("a", 43)) }, status: http.StatusBadRequest, expected: "invalid_grant"},
+		{name: "wrong redirect_uri", modify: func(v url.Values) { v.Set("redirect_uri", oauthRedirectURI+"/other") }, status: http.StatusBadRequest, expected: "invalid_grant"},
+		{name: "no verifier", modify: func(v url.Values) { v.Del("code_verifier") }, status: http.StatusBadRequest, expected: "invalid_request"},
+		{name: "another client", clientID: other.id, secret: other.secret, status: http.StatusBadRequest, expected: "invalid_grant"},
+		{name: "wrong secret", secret: "wrong", status: http.StatusUnauthorized, expected: "invalid_client"},
+		{name: "no secret", clientID: client.id, status: http.StatusUnauthorized, expected: "invalid_client"},
+		{name: "unknown client", clientID: "999999", status: http.StatusUnauthorized, expected: "invalid_client"},
+		{name: "unsupported grant", modify: func(v url.Values) { v.Set("grant_type", "implicit") }, status: http.StatusBadRequest, expected: "unsupported_grant_type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, verifier := newCode()
+			form := url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {code},
+				"redirect_uri":  {oauthRedirectURI},
+				"code_verifier": {verifier},
+			}
+			if tt.modify != nil {
+				tt.modify(form)
+			}
+			clientID, secret := client.id, client.secret
+			if tt.clientID != "" {
+				clientID, secret = tt.clientID, tt.secret
+			} else if tt.secret != "" {
+				secret = tt.secret
+			}
+
+			resp := postToken(t, st, form, clientID, secret)
+			assert.Equal(t, tt.status, resp.status)
+			assert.Equal(t, tt.expected, resp.Error)
+		})
+	}
+
+	// Refresh токен одного приложения не обменять другому
+	code, verifier := newCode()
+	tokens := exchangeCode(t, st, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {oauthRedirectURI},
+		"code_verifier": {verifier},
+	}, client.id, client.secret)
+
+	resp := postToken(t, st, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}}, other.id, other.secret)
+	assert.Equal(t, "invalid_grant", resp.Error)
+
+	resp = postToken(t, st, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}}, client.id, client.secret)
+	assert.Equal(t, http.StatusOK, resp.status)
+}
+
+type oauthClient struct {
+	id     string
+	secret string
+	name   string
+}
+
+// newOAuthClient регистрирует конфиденциальное приложение с oauthRedirectURI и указанными grant types
+func newOAuthClient(ctx context.Context, t *testing.T, st *suite.Suite, grantTypes ...string) oauthClient {
+	t.Helper()
+
+	return createOAuthClient(ctx, t, st, false, grantTypes)
+}
+
+// newPublicOAuthClient регистрирует публичное приложение: на /token ему хватает client_id
+func newPublicOAuthClient(ctx context.Context, t *testing.T, st *suite.Suite, grantTypes ...string) oauthClient {
+	t.Helper()
+
+	return createOAuthClient(ctx, t, st, true, grantTypes)
+}
+
+func createOAuthClient(ctx context.Context, t *testing.T, st *suite.Suite, public bool, grantTypes []string) oauthClient {
+	t.Helper()
+
+	name := "app-" + gofakeit.LetterN(12)
+	respCreate, err := st.AdminClient.CreateApp(adminContext(ctx, t, st), &ssov1.CreateAppRequest{Settings: &ssov1.AppSettings{
+		Name:         name,
+		RedirectUris: []string{oauthRedirectURI},
+		GrantTypes:   grantTypes,
+		Public:       public,
+		Enabled:      true,
+	}})
+	require.NoError(t, err)
+
+	return oauthClient{
+		id:     strconv.Itoa(int(respCreate.GetApp().GetId())),
+		secret: respCreate.GetSecret(),
+		name:   name,
+	}
+}
+
+func (c oauthClient) authorizeParams(codeChallenge string) url.Values {
+	return url.Values{
+		"client_id":             {c.id},
+		"redirect_uri":          {oauthRedirectURI},
+		"response_type":         {"code"},
+		"scope":                 {"profile"},
+		"state":                 {gofakeit.LetterN(16)},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+}
+
+func registerUser(ctx context.Context, t *testing.T, st *suite.Suite) (email string, pass string) {
+	t.Helper()
+
+	email = gofakeit.Email()
+	pass = randomFakePassword()
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: pass})
+	require.NoError(t, err)
+
+	return email, pass
+}
+
+func newPKCE(t *testing.T) (verifier string, challenge string) {
+	t.Helper()
+
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	require.NoError(t, err)
+
+	verifier = base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(verifier))
+
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authorizeCode входит на странице входа и возвращает код из redirect_uri
+func authorizeCode(t *testing.T, st *suite.Suite, params url.Values, email string, pass string) string {
+	t.Helper()
+
+	form := cloneValues(params)
+	form.Set("email", email)
+	form.Set("password", pass)
+	form.Set("action", "allow")
+
+	resp := oauthPost(t, st, "/authorize", form)
+	require.Equal(t, http.StatusSeeOther, resp.StatusCode)
+
+	q := redirectParams(t, resp)
+	assert.Equal(t, params.Get("state"), q.Get("state"))
+	require.NotEmpty(t, q.Get("code"))
+
+	return q.Get("code")
+}
+
+type tokenResult struct {
+	status       int
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	Scope        string `json:"scope"`
+	Error        string `json:"error"`
+}
+
+// exchangeCode обменивает код и проверяет, что токены выданы. clientAuth - client_id и секрет для HTTP Basic
+func exchangeCode(t *testing.T, st *suite.Suite, form url.Values, clientAuth ...string) tokenResult {
+	t.Helper()
+
+	var clientID, secret string
+	if len(clientAuth) == 2 {
+		clientID, secret = clientAuth[0], clientAuth[1]
+	}
+
+	resp := postToken(t, st, form, clientID, secret)
+	require.Equal(t, http.StatusOK, resp.status, resp.Error)
+	require.NotEmpty(t, resp.AccessToken)
+
+	return resp
+}
+
+// postToken отправляет запрос к /token. Если clientID не пустой, приложение передается через HTTP Basic
+func postToken(t *testing.T, st *suite.Suite, form url.Values, clientID string, secret string) tokenResult {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, st.HTTPURL("/token"), strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(secret))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+
+	var result tokenResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	result.status = resp.StatusCode
+
+	return result
+}
+
+// noRedirects не переходит по редиректам: redirect_uri тестового приложения не существует
+var noRedirects = &http.Client{
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+func oauthGet(t *testing.T, st *suite.Suite, path string) *http.Response {
+	t.Helper()
+
+	resp, err := noRedirects.Get(st.HTTPURL(path))
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
+
+// oauthPost отправляет форму, как браузер: сначала открывает страницу и берет с нее cookie и токен формы
+func oauthPost(t *testing.T, st *suite.Suite, path string, form url.Values) *http.Response {
+	t.Helper()
+
+	browser := newBrowser(t)
+	form = cloneValues(form)
+	form.Set("csrf_token", formCSRFToken(t, st, browser, path, form))
+
+	resp, err := browser.PostForm(st.HTTPURL(path), form)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+
+	return resp
+}
+
+// newBrowser возвращает клиента со своими cookie, который не переходит по редиректам
+func newBrowser(t *testing.T) *http.Client {
+	t.Helper()
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+
+	return &http.Client{Jar: jar, CheckRedirect: noRedirects.CheckRedirect}
+}
+
+// formCSRFToken открывает страницу формы path и возвращает токен из нее. Для /authorize передаются параметры запроса из form
+func formCSRFToken(t *testing.T, st *suite.Suite, browser *http.Client, path string, form url.Values) string {
+	t.Helper()
+
+	if path == "/authorize" {
+		params := url.Values{}
+		for _, k := range []string{"client_id", "redirect_uri", "response_type", "scope", "state", "code_challenge", "code_challenge_method", "nonce"} {
+			params.Set(k, form.Get(k))
+		}
+		path += "?" + params.Encode()
+	}
+
+	resp, err := browser.Get(st.HTTPURL(path))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	match := csrfTokenField.FindStringSubmatch(readBody(t, resp))
+	require.Len(t, match, 2)
+
+	return match[1]
+}
+
+func redirectParams(t *testing.T, resp *http.Response) url.Values {
+	t.Helper()
+
+	location, err := resp.Location()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(location.String(), oauthRedirectURI+"?"), location.String())
+
+	return location.Query()
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return string(b)
+}
+
+func cloneValues(v url.Values) url.Values {
+	c := make(url.Values, len(v))
+	for k, vv := range v {
+		c[k] = append([]string(nil), vv...)
+	}
+
+	return c
+}
@@ -0,0 +1,260 @@
+package tests
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"sso/tests/suite"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const jwtBearerAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+var serviceScopes = []string{"billing:read", "billing:write"}
+
+func TestClientLogin_Secret(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	client := newServiceClient(ctx, t, st, nil, "client_credentials")
+	appID := mustAppID(t, client)
+
+	// Без scope приложение получает все свои права
+	respLogin, err := st.AuthClient.ClientLogin(ctx, &ssov1.ClientLoginRequest{AppId: appID, ClientSecret: client.secret})
+	require.NoError(t, err)
+	assert.Equal(t, "billing:read billing:write", respLogin.GetScope())
+	assert.Positive(t, respLogin.GetExpiresIn())
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, introspectRequest(respLogin.GetToken()))
+	require.NoError(t, err)
+	assert.True(t, respIntrospect.GetActive())
+	assert.Equal(t, client.id, respIntrospect.GetSub())
+	assert.Zero(t, respIntrospect.GetUid())
+	assert.Equal(t, appID, respIntrospect.GetAppId())
+	assert.Equal(t, "billing:read billing:write", respIntrospect.GetScope())
+
+	respLogin, err = st.AuthClient.ClientLogin(ctx, &ssov1.ClientLoginRequest{AppId: appID, ClientSecret: client.secret, Scope: "billing:read"})
+	require.NoError(t, err)
+	assert.Equal(t, "billing:read", respLogin.GetScope())
+
+	// Токен приложения не открывает ни Admin, ни /userinfo
+	_, err = st.AdminClient.ListApps(withToken(ctx, respLogin.GetToken()), &ssov1.ListAppsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, http.StatusUnauthorized, getUserInfo(t, st, respLogin.GetToken()).status)
+
+	tests := []struct {
+		name     string
+		req      *ssov1.ClientLoginRequest
+		expected codes.Code
+	}{
+		{name: "not granted scope", req: &ssov1.ClientLoginRequest{AppId: appID, ClientSecret: client.secret, Scope: "billing:read admin"}, expected: codes.InvalidArgument},
+		{name: "wrong secret", req: &ssov1.ClientLoginRequest{AppId: appID, ClientSecret: "wrong"}, expected: codes.Unauthenticated},
+		{name: "unknown app", req: &ssov1.ClientLoginRequest{AppId: 999999, ClientSecret: client.secret}, expected: codes.Unauthenticated},
+		{name: "no credentials", req: &ssov1.ClientLoginRequest{AppId: appID}, expected: codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.ClientLogin(ctx, tt.req)
+			assert.Equal(t, tt.expected, status.Code(err))
+		})
+	}
+
+	// Приложению без client_credentials grant токен не выдается
+	userApp := newServiceClient(ctx, t, st, nil, "password")
+	_, err = st.AuthClient.ClientLogin(ctx, &ssov1.ClientLoginRequest{AppId: mustAppID(t, userApp), ClientSecret: userApp.secret})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestClientLogin_PrivateKeyJWT(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	client := newServiceClient(ctx, t, st, public, "client_credentials")
+	appID := mustAppID(t, client)
+
+	assertion := signAssertion(t, private, client.id, st.Cfg.Issuer, time.Minute)
+	respLogin, err := st.AuthClient.ClientLogin(ctx, &ssov1.ClientLoginRequest{AppId: appID, ClientAssertion: assertion, Scope: "billing:write"})
+	require.NoError(t, err)
+	assert.Equal(t, "billing:write", respLogin.GetScope())
+
+	// assertion одноразовый
+	_, err = st.AuthClient.ClientLogin(ctx, &ssov1.ClientLoginRequest{AppId: appID, ClientAssertion: assertion})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		assertion string
+	}{
+		{name: "wrong key", assertion: signAssertion(t, otherKey, client.id, st.Cfg.Issuer, time.Minute)},
+		{name: "wrong audience", assertion: signAssertion(t, private, client.id, "https://other.example", time.Minute)},
+		{name: "too long", assertion: signAssertion(t, private, client.id, st.Cfg.Issuer, time.Hour)},
+		{name: "expired", assertion: signAssertion(t, private, client.id, st.Cfg.Issuer, -time.Minute)},
+		{name: "another client", assertion: signAssertion(t, private, "999999", st.Cfg.Issuer, time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.ClientLogin(ctx, &ssov1.ClientLoginRequest{AppId: appID, ClientAssertion: tt.assertion})
+			assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		})
+	}
+
+	// Приложение без публичного ключа по assertion не входит
+	noKey := newServiceClient(ctx, t, st, nil, "client_credentials")
+	_, err = st.AuthClient.ClientLogin(ctx, &ssov1.ClientLoginRequest{
+		AppId:           mustAppID(t, noKey),
+		ClientAssertion: signAssertion(t, private, noKey.id, st.Cfg.Issuer, time.Minute),
+	})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestOAuth_ClientCredentialsToken(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	client := newServiceClient(ctx, t, st, public, "client_credentials")
+
+	// Секрет в HTTP Basic
+	tokens := postToken(t, st, url.Values{"grant_type": {"client_credentials"}, "scope": {"billing:read"}}, client.id, client.secret)
+	require.Equal(t, http.StatusOK, tokens.status, tokens.Error)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.Equal(t, "billing:read", tokens.Scope)
+	assert.Empty(t, tokens.RefreshToken)
+
+	// private_key_jwt, client_id берется из assertion
+	tokens = postToken(t, st, url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {jwtBearerAssertionType},
+		"client_assertion":      {signAssertion(t, private, client.id, st.Cfg.Issuer+"/token", time.Minute)},
+	}, "", "")
+	require.Equal(t, http.StatusOK, tokens.status, tokens.Error)
+	assert.Equal(t, "billing:read billing:write", tokens.Scope)
+
+	tests := []struct {
+		name     string
+		form     url.Values
+		clientID string
+		secret   string
+		status   int
+		expected string
+	}{
+		{
+			name:     "not granted scope",
+			form:     url.Values{"grant_type": {"client_credentials"}, "scope": {"admin"}},
+			clientID: client.id, secret: client.secret,
+			status: http.StatusBadRequest, expected: "invalid_scope",
+		},
+		{
+			name:     "public client",
+			form:     url.Values{"grant_type": {"client_credentials"}, "client_id": {client.id}},
+			status:   http.StatusUnauthorized,
+			expected: "invalid_client",
+		},
+		{
+			name: "unknown assertion type",
+			form: url.Values{
+				"grant_type":            {"client_credentials"},
+				"client_assertion_type": {"urn:example"},
+				"client_assertion":      {signAssertion(t, private, client.id, st.Cfg.Issuer, time.Minute)},
+			},
+			status: http.StatusBadRequest, expected: "invalid_request",
+		},
+		{
+			name: "secret and assertion",
+			form: url.Values{
+				"grant_type":            {"client_credentials"},
+				"client_assertion_type": {jwtBearerAssertionType},
+				"client_assertion":      {signAssertion(t, private, client.id, st.Cfg.Issuer, time.Minute)},
+			},
+			clientID: client.id, secret: client.secret,
+			status: http.StatusBadRequest, expected: "invalid_request",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := postToken(t, st, tt.form, tt.clientID, tt.secret)
+			assert.Equal(t, tt.status, resp.status)
+			assert.Equal(t, tt.expected, resp.Error)
+		})
+	}
+
+	// Приложению без client_credentials grant токен не выдается
+	userApp := newServiceClient(ctx, t, st, nil, "authorization_code")
+	resp := postToken(t, st, url.Values{"grant_type": {"client_credentials"}}, userApp.id, userApp.secret)
+	assert.Equal(t, http.StatusBadRequest, resp.status)
+	assert.Equal(t, "unauthorized_client", resp.Error)
+}
+
+// newServiceClient регистрирует приложение с правами serviceScopes. publicKey, если не nil, - ключ для private_key_jwt
+func newServiceClient(ctx context.Context, t *testing.T, st *suite.Suite, publicKey ed25519.PublicKey, grantTypes ...string) oauthClient {
+	t.Helper()
+
+	var publicKeyPEM string
+	if publicKey != nil {
+		der, err := x509.MarshalPKIXPublicKey(publicKey)
+		require.NoError(t, err)
+		publicKeyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	}
+
+	name := "service-" + gofakeit.LetterN(12)
+	respCreate, err := st.AdminClient.CreateApp(adminContext(ctx, t, st), &ssov1.CreateAppRequest{Settings: &ssov1.AppSettings{
+		Name:            name,
+		GrantTypes:      grantTypes,
+		Scopes:          serviceScopes,
+		ClientPublicKey: publicKeyPEM,
+		Enabled:         true,
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, serviceScopes, respCreate.GetApp().GetScopes())
+
+	return oauthClient{
+		id:     strconv.Itoa(int(respCreate.GetApp().GetId())),
+		secret: respCreate.GetSecret(),
+		name:   name,
+	}
+}
+
+// signAssertion подписывает client_assertion, который живет ttl
+func signAssertion(t *testing.T, key ed25519.PrivateKey, clientID string, audience string, ttl time.Duration) string {
+	t.Helper()
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.RegisteredClaims{
+		Issuer:    clientID,
+		Subject:   clientID,
+		Audience:  jwt.ClaimStrings{audience},
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ID:        gofakeit.UUID(),
+	}).SignedString(key)
+	require.NoError(t, err)
+
+	return assertion
+}
+
+func mustAppID(t *testing.T, client oauthClient) int32 {
+	t.Helper()
+
+	id, err := strconv.Atoi(client.id)
+	require.NoError(t, err)
+
+	return int32(id)
+}
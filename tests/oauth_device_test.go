@@ -0,0 +1,264 @@
+package tests
+
+import (
+	"encoding/json"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"sso/tests/suite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+var userCodeFormat = regexp.MustCompile(`^[BCDFGHJKLMNPQRSTVWXZ]{4}-[BCDFGHJKLMNPQRSTVWXZ]{4}$`)
+
+func TestOAuth_DeviceCodeFlow(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	client := newOAuthClient(ctx, t, st, deviceCodeGrantType, "refresh_token")
+	email, pass := registerUser(ctx, t, st)
+
+	device := startDevice(t, st, client, "openid email")
+	require.Equal(t, http.StatusOK, device.status, device.Error)
+	assert.Regexp(t, userCodeFormat, device.UserCode)
+	assert.Equal(t, st.Cfg.Issuer+"/device", device.VerificationURI)
+	assert.Equal(t, st.Cfg.Issuer+"/device?user_code="+device.UserCode, device.VerificationURIComplete)
+	assert.Equal(t, int64(st.Cfg.OAuth.DeviceCodeTTL.Seconds()), device.ExpiresIn)
+	assert.Equal(t, int64(st.Cfg.OAuth.DeviceCodeInterval.Seconds()), device.Interval)
+
+	// Пока пользователь не подтвердил код, устройство ждет
+	tokens := pollDevice(t, st, client, device.DeviceCode)
+	assert.Equal(t, http.StatusBadRequest, tokens.status)
+	assert.Equal(t, "authorization_pending", tokens.Error)
+
+	// Ссылка verification_uri_complete показывает, какое приложение просит доступ
+	resp := oauthGet(t, st, "/device?"+url.Values{"user_code": {device.UserCode}}.Encode())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, readBody(t, resp), client.name)
+
+	// Регистр и дефис в коде не важны
+	resp = oauthPost(t, st, "/device", url.Values{
+		"user_code": {strings.ToLower(strings.ReplaceAll(device.UserCode, "-", ""))},
+		"email":     {email},
+		"password":  {pass},
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, readBody(t, resp), "Your device is connected")
+
+	tokens = pollDevice(t, st, client, device.DeviceCode)
+	require.Equal(t, http.StatusOK, tokens.status, tokens.Error)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	assert.NotEmpty(t, tokens.IDToken)
+	assert.Equal(t, "openid email", tokens.Scope)
+
+	userInfo := getUserInfo(t, st, tokens.AccessToken)
+	require.Equal(t, http.StatusOK, userInfo.status)
+	assert.Equal(t, email, userInfo.Email)
+
+	// Токены по коду выдаются один раз
+	tokens = pollDevice(t, st, client, device.DeviceCode)
+	assert.Equal(t, http.StatusBadRequest, tokens.status)
+	assert.Equal(t, "invalid_grant", tokens.Error)
+}
+
+func TestOAuth_DeviceCodeSlowDown(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	client := newOAuthClient(ctx, t, st, deviceCodeGrantType)
+
+	device := startDevice(t, st, client, "")
+	require.Equal(t, http.StatusOK, device.status, device.Error)
+
+	tokens := pollDevice(t, st, client, device.DeviceCode)
+	assert.Equal(t, "authorization_pending", tokens.Error)
+
+	// Второй запрос раньше interval
+	tokens = pollDevice(t, st, client, device.DeviceCode)
+	assert.Equal(t, http.StatusBadRequest, tokens.status)
+	assert.Equal(t, "slow_down", tokens.Error)
+}
+
+func TestOAuth_DeviceCodeDenied(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	client := newOAuthClient(ctx, t, st, deviceCodeGrantType)
+
+	device := startDevice(t, st, client, "")
+	require.Equal(t, http.StatusOK, device.status, device.Error)
+
+	email, pass := registerUser(ctx, t, st)
+
+	// Без входа отказать нельзя: код остается ждать подтверждения
+	resp := oauthPost(t, st, "/device", url.Values{"user_code": {device.UserCode}, "action": {"deny"}})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	tokens := pollDevice(t, st, client, device.DeviceCode)
+	assert.Equal(t, "authorization_pending", tokens.Error)
+
+	resp = oauthPost(t, st, "/device", url.Values{"user_code": {device.UserCode}, "email": {email}, "password": {pass}, "action": {"deny"}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, readBody(t, resp), "Access denied")
+
+	// Отклоненный код подтвердить уже нельзя
+	resp = oauthPost(t, st, "/device", url.Values{"user_code": {device.UserCode}, "email": {email}, "password": {pass}})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	tokens = pollDevice(t, st, client, device.DeviceCode)
+	assert.Equal(t, http.StatusBadRequest, tokens.status)
+	assert.Equal(t, "access_denied", tokens.Error)
+
+	tokens = pollDevice(t, st, client, device.DeviceCode)
+	assert.Equal(t, "invalid_grant", tokens.Error)
+}
+
+func TestOAuth_DeviceRequiresCSRFToken(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	client := newOAuthClient(ctx, t, st, deviceCodeGrantType)
+	email, pass := registerUser(ctx, t, st)
+
+	device := startDevice(t, st, client, "")
+	require.Equal(t, http.StatusOK, device.status, device.Error)
+
+	form := url.Values{"user_code": {device.UserCode}, "email": {email}, "password": {pass}}
+	otherToken := formCSRFToken(t, st, newBrowser(t), "/device", form)
+	browser := newBrowser(t)
+	formCSRFToken(t, st, browser, "/device", form)
+
+	for _, token := range []string{"", otherToken} {
+		form.Set("csrf_token", token)
+		resp, err := browser.PostForm(st.HTTPURL("/device"), form)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		resp.Body.Close()
+	}
+
+	resp, err := noRedirects.PostForm(st.HTTPURL("/device"), form)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp.Body.Close()
+
+	// Устройство все еще ждет подтверждения
+	tokens := pollDevice(t, st, client, device.DeviceCode)
+	assert.Equal(t, "authorization_pending", tokens.Error)
+}
+
+func TestOAuth_DeviceCodeErrors(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	client := newOAuthClient(ctx, t, st, deviceCodeGrantType)
+	email, _ := registerUser(ctx, t, st)
+
+	device := startDevice(t, st, client, "")
+	require.Equal(t, http.StatusOK, device.status, device.Error)
+
+	resp := oauthGet(t, st, "/device?user_code=BBBB-BBBB")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, readBody(t, resp), "invalid or has expired")
+
+	// Неверный пароль не тратит код
+	resp = oauthPost(t, st, "/device", url.Values{"user_code": {device.UserCode}, "email": {email}, "password": {"wrong-password"}})
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	tokens := pollDevice(t, st, client, device.DeviceCode)
+	assert.Equal(t, "authorization_pending", tokens.Error)
+
+	// device_code выдан другому приложению
+	other := newOAuthClient(ctx, t, st, deviceCodeGrantType)
+	tokens = pollDevice(t, st, other, device.DeviceCode)
+	assert.Equal(t, http.StatusBadRequest, tokens.status)
+	assert.Equal(t, "invalid_grant", tokens.Error)
+
+	tokens = pollDevice(t, st, client, "unknown")
+	assert.Equal(t, "invalid_grant", tokens.Error)
+
+	// Приложению без device_code grant коды не выдаются
+	noGrant := newOAuthClient(ctx, t, st, "authorization_code")
+	device = startDevice(t, st, noGrant, "")
+	assert.Equal(t, http.StatusBadRequest, device.status)
+	assert.Equal(t, "unauthorized_client", device.Error)
+
+	device = startDevice(t, st, oauthClient{id: client.id, secret: "wrong"}, "")
+	assert.Equal(t, http.StatusUnauthorized, device.status)
+	assert.Equal(t, "invalid_client", device.Error)
+}
+
+func TestOAuth_DeviceUserCodeThrottled(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	client := newOAuthClient(ctx, t, st, deviceCodeGrantType)
+
+	device := startDevice(t, st, client, "")
+	require.Equal(t, http.StatusOK, device.status, device.Error)
+
+	// Неверные коды считаются по IP адресу: ходим со своего адреса, чтобы не заблокировать остальные тесты
+	ip := net.IPv4(127, byte(rand.IntN(254)+1), byte(rand.IntN(254)+1), byte(rand.IntN(254)+1))
+	httpClient := &http.Client{Transport: &http.Transport{
+		DialContext: (&net.Dialer{LocalAddr: &net.TCPAddr{IP: ip}}).DialContext,
+	}}
+
+	get := func(userCode string) *http.Response {
+		resp, err := httpClient.Get(st.HTTPURL("/device?" + url.Values{"user_code": {userCode}}.Encode()))
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	for range st.Cfg.OAuth.UserCodeMaxFailures {
+		resp := get("BBBB-BBBB")
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+
+	// Попытки кончились: даже верный код не проверяется, пока не пройдет время
+	resp := get(device.UserCode)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Contains(t, readBody(t, resp), "Too many failed attempts")
+
+	// С другого адреса код по-прежнему вводится
+	resp = oauthGet(t, st, "/device?"+url.Values{"user_code": {device.UserCode}}.Encode())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+type deviceResult struct {
+	status                  int
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+	Error                   string `json:"error"`
+}
+
+// startDevice запрашивает коды в /device_authorization от имени устройства client
+func startDevice(t *testing.T, st *suite.Suite, client oauthClient, scope string) deviceResult {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, st.HTTPURL("/device_authorization"), strings.NewReader(url.Values{"scope": {scope}}.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(client.id), url.QueryEscape(client.secret))
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var result deviceResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	result.status = resp.StatusCode
+
+	return result
+}
+
+func pollDevice(t *testing.T, st *suite.Suite, client oauthClient, deviceCode string) tokenResult {
+	t.Helper()
+
+	return postToken(t, st, url.Values{"grant_type": {deviceCodeGrantType}, "device_code": {deviceCode}}, client.id, client.secret)
+}
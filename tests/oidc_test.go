@@ -0,0 +1,184 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"sso/tests/suite"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOIDC_Discovery(t *testing.T) {
+	_, st := suite.New(t)
+
+	resp, err := http.Get(st.HTTPURL("/.well-known/openid-configuration"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var doc map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&doc))
+
+	issuer := st.Cfg.Issuer
+	assert.Equal(t, issuer, doc["issuer"])
+	assert.Equal(t, issuer+"/authorize", doc["authorization_endpoint"])
+	assert.Equal(t, issuer+"/token", doc["token_endpoint"])
+	assert.Equal(t, issuer+"/userinfo", doc["userinfo_endpoint"])
+	assert.Equal(t, issuer+"/device_authorization", doc["device_authorization_endpoint"])
+	assert.Equal(t, issuer+"/.well-known/jwks.json", doc["jwks_uri"])
+	assert.ElementsMatch(t, []any{"openid", "email", "profile"}, doc["scopes_supported"])
+	assert.Contains(t, doc["grant_types_supported"], "client_credentials")
+	assert.Contains(t, doc["id_token_signing_alg_values_supported"], "RS256")
+	assert.Equal(t, []any{"S256"}, doc["code_challenge_methods_supported"])
+}
+
+func TestOIDC_IDTokenAndUserInfo(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	client := newOAuthClient(ctx, t, st, "authorization_code", "refresh_token")
+	email, pass := registerUser(ctx, t, st)
+
+	verifier, challenge := newPKCE(t)
+	nonce := gofakeit.LetterN(24)
+	params := client.authorizeParams(challenge)
+	// Неизвестные права игнорируются
+	params.Set("scope", "openid email profile unknown")
+	params.Set("nonce", nonce)
+
+	beforeLogin := time.Now().Add(-time.Second)
+	code := authorizeCode(t, st, params, email, pass)
+
+	tokens := exchangeCode(t, st, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {oauthRedirectURI},
+		"code_verifier": {verifier},
+	}, client.id, client.secret)
+	assert.Equal(t, "openid email profile", tokens.Scope)
+	require.NotEmpty(t, tokens.IDToken)
+
+	// Приложение с HS256 проверяет id_token своим секретом
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokens.IDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(client.secret), nil
+	}, jwt.WithIssuer(st.Cfg.Issuer), jwt.WithAudience(client.id), jwt.WithExpirationRequired())
+	require.NoError(t, err)
+
+	assert.Equal(t, nonce, claims["nonce"])
+	assert.Equal(t, email, claims["email"])
+	assert.Equal(t, false, claims["email_verified"])
+	assert.Equal(t, email, claims["preferred_username"])
+	assert.NotEmpty(t, claims["sub"])
+	authTime, ok := claims["auth_time"].(float64)
+	require.True(t, ok)
+	assert.GreaterOrEqual(t, int64(authTime), beforeLogin.Unix())
+
+	sum := sha256.Sum256([]byte(tokens.AccessToken))
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(sum[:16]), claims["at_hash"])
+
+	info := getUserInfo(t, st, tokens.AccessToken)
+	require.Equal(t, http.StatusOK, info.status)
+	assert.Equal(t, claims["sub"], info.Subject)
+	assert.Equal(t, email, info.Email)
+	require.NotNil(t, info.EmailVerified)
+	assert.False(t, *info.EmailVerified)
+	assert.Equal(t, email, info.PreferredUsername)
+
+	// Refresh сохраняет права, /userinfo работает и с новым access токеном
+	refreshed := postToken(t, st, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens.RefreshToken},
+	}, client.id, client.secret)
+	require.Equal(t, http.StatusOK, refreshed.status)
+	assert.Equal(t, "openid email profile", refreshed.Scope)
+	assert.Equal(t, http.StatusOK, getUserInfo(t, st, refreshed.AccessToken).status)
+}
+
+func TestOIDC_UserInfoScopes(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	client := newOAuthClient(ctx, t, st, "authorization_code")
+	email, pass := registerUser(ctx, t, st)
+
+	accessToken := func(scope string) tokenResult {
+		verifier, challenge := newPKCE(t)
+		params := client.authorizeParams(challenge)
+		params.Set("scope", scope)
+
+		return exchangeCode(t, st, url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {authorizeCode(t, st, params, email, pass)},
+			"redirect_uri":  {oauthRedirectURI},
+			"code_verifier": {verifier},
+		}, client.id, client.secret)
+	}
+
+	// Без email и profile /userinfo отдает только sub
+	tokens := accessToken("openid")
+	assert.NotEmpty(t, tokens.IDToken)
+	info := getUserInfo(t, st, tokens.AccessToken)
+	require.Equal(t, http.StatusOK, info.status)
+	assert.NotEmpty(t, info.Subject)
+	assert.Empty(t, info.Email)
+	assert.Nil(t, info.EmailVerified)
+
+	// Без openid нет ни id_token, ни /userinfo
+	tokens = accessToken("email")
+	assert.Empty(t, tokens.IDToken)
+	info = getUserInfo(t, st, tokens.AccessToken)
+	assert.Equal(t, http.StatusForbidden, info.status)
+	assert.Equal(t, "insufficient_scope", info.Error)
+
+	// Access токен из Login выдан без прав OAuth2
+	respLogin := registerAndLogin(ctx, t, st)
+	assert.Equal(t, http.StatusForbidden, getUserInfo(t, st, respLogin.GetToken()).status)
+
+	info = getUserInfo(t, st, "not-a-token")
+	assert.Equal(t, http.StatusUnauthorized, info.status)
+	assert.Equal(t, "invalid_token", info.Error)
+	assert.Contains(t, info.authenticate, `error="invalid_token"`)
+
+	info = getUserInfo(t, st, "")
+	assert.Equal(t, http.StatusUnauthorized, info.status)
+}
+
+type userInfoResult struct {
+	status            int
+	authenticate      string
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     *bool  `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Error             string `json:"error"`
+}
+
+// getUserInfo запрашивает /userinfo, пустой token - запрос без заголовка Authorization
+func getUserInfo(t *testing.T, st *suite.Suite, token string) userInfoResult {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, st.HTTPURL("/userinfo"), nil)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var result userInfoResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	result.status = resp.StatusCode
+	result.authenticate = resp.Header.Get("WWW-Authenticate")
+
+	return result
+}
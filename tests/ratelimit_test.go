@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"sso/tests/suite"
+	"strconv"
+	"strings"
+	"testing"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRateLimit_RegisterByEmail(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	const method = "/auth.Auth/Register"
+	limit := st.Cfg.GRPC.RateLimits[method].Email.Requests
+	require.Positive(t, limit, "config must limit %s by email", method)
+
+	email := gofakeit.Email()
+	for i := 0; i < limit; i++ {
+		_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: email, Password: randomFakePassword()})
+		if i == 0 {
+			require.NoError(t, err)
+			continue
+		}
+		require.Error(t, err)
+		require.Equal(t, codes.AlreadyExists, status.Code(err), "attempt %d", i+1)
+	}
+
+	// Лимит по email не зависит от регистра
+	var header metadata.MD
+	_, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{
+		Email:    strings.ToUpper(email),
+		Password: randomFakePassword(),
+	}, grpc.Header(&header))
+	require.Error(t, err)
+
+	s := status.Convert(err)
+	require.Equal(t, codes.ResourceExhausted, s.Code())
+
+	var reason string
+	for _, detail := range s.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			reason = info.GetReason()
+		}
+	}
+	assert.Equal(t, "RATE_LIMITED", reason)
+
+	require.Len(t, header.Get("retry-after"), 1)
+	retryAfter, err := strconv.Atoi(header.Get("retry-after")[0])
+	require.NoError(t, err)
+	assert.Positive(t, retryAfter)
+
+	// Другие email ограничиваются отдельно
+	_, err = st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: gofakeit.Email(), Password: randomFakePassword()})
+	require.NoError(t, err)
+}
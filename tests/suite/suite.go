@@ -20,6 +20,7 @@ type Suite struct {
 	*testing.T									// Потребуется для вызова метода *testing.T внутри Suite
 	Cfg *config.Config					// Конфигурация приложения
 	AuthClient ssov1.AuthClient // Клиент для взаимодействия с gRPC-сервером
+	AdminClient ssov1.AdminClient // Клиент сервиса Admin, запросы должны нести токен администратора
 }
 
 func New(t *testing.T) (context.Context, *Suite) {
@@ -51,6 +52,7 @@ func New(t *testing.T) (context.Context, *Suite) {
 		T: t,
 		Cfg: cfg,
 		AuthClient: ssov1.NewAuthClient(cc),
+		AdminClient: ssov1.NewAdminClient(cc),
 	}
 }
 
@@ -59,3 +61,8 @@ func grpcAddress(cfg *config.Config) string {
 	return net.JoinHostPort(grpcHost, strconv.Itoa(cfg.GRPC.Port))
 }
 
+// HTTPURL возвращает полный адрес HTTP обработчика сервиса
+func (s *Suite) HTTPURL(path string) string {
+	return "http://" + net.JoinHostPort(grpcHost, strconv.Itoa(s.Cfg.HTTP.Port)) + path
+}
+
@@ -0,0 +1,206 @@
+package tests
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"sso/tests/suite"
+
+	ssov1 "github.com/VladimirKraswov/protos/gen/go/sso"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const impersonationReason = "support ticket #1234"
+
+func TestTokenExchange_Impersonation(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	adminToken := adminLoginToken(ctx, t, st)
+	adminID := tokenUID(ctx, t, st, adminToken)
+	customerID, _ := registerUserID(ctx, t, st)
+
+	respExchange, err := st.AuthClient.TokenExchange(ctx, &ssov1.TokenExchangeRequest{
+		ActorToken: adminToken,
+		UserId:     customerID,
+		AppId:      appID,
+		Reason:     impersonationReason,
+	})
+	require.NoError(t, err)
+	token := respExchange.GetToken()
+	// Токен короче обычного часового
+	assert.Positive(t, respExchange.GetExpiresIn())
+	assert.LessOrEqual(t, respExchange.GetExpiresIn(), int64(st.Cfg.Impersonation.TokenTTL.Seconds()))
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, introspectRequest(token))
+	require.NoError(t, err)
+	require.True(t, respIntrospect.GetActive())
+	assert.Equal(t, customerID, respIntrospect.GetUid())
+	assert.Equal(t, adminID, respIntrospect.GetActUid())
+
+	// В самом токене администратора называет claim act
+	claims := jwt.MapClaims{}
+	_, _, err = jwt.NewParser().ParseUnverified(token, claims)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"sub": strconv.FormatInt(adminID, 10)}, claims["act"])
+
+	// От имени пользователя нельзя менять его второй фактор
+	_, err = st.AuthClient.EnrollTOTP(ctx, &ssov1.EnrollTOTPRequest{Token: token})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// Полученный токен не открывает Admin и не годится для нового обмена
+	_, err = st.AdminClient.ListApps(withToken(ctx, token), &ssov1.ListAppsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	otherID, _ := registerUserID(ctx, t, st)
+	_, err = st.AuthClient.TokenExchange(ctx, &ssov1.TokenExchangeRequest{ActorToken: token, UserId: otherID, AppId: appID, Reason: impersonationReason})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestTokenExchange_Denied(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	adminToken := adminLoginToken(ctx, t, st)
+	adminID := tokenUID(ctx, t, st, adminToken)
+	customerID, _ := registerUserID(ctx, t, st)
+
+	email, pass := registerUser(ctx, t, st)
+	respUser, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: email, Password: pass, AppId: int32(st.Cfg.Admin.AppID)})
+	require.NoError(t, err)
+
+	// Администратор, но токен выдан обычному приложению
+	respOtherApp, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: adminEmail, Password: adminPassword, AppId: appID})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		req      *ssov1.TokenExchangeRequest
+		expected codes.Code
+	}{
+		{
+			name:     "actor is not admin",
+			req:      &ssov1.TokenExchangeRequest{ActorToken: respUser.GetToken(), UserId: customerID, AppId: appID, Reason: impersonationReason},
+			expected: codes.PermissionDenied,
+		},
+		{
+			name:     "actor token of another app",
+			req:      &ssov1.TokenExchangeRequest{ActorToken: respOtherApp.GetToken(), UserId: customerID, AppId: appID, Reason: impersonationReason},
+			expected: codes.Unauthenticated,
+		},
+		{
+			name:     "forged hs256 actor token",
+			req:      &ssov1.TokenExchangeRequest{ActorToken: forgedAdminToken(ctx, t, st), UserId: customerID, AppId: appID, Reason: impersonationReason},
+			expected: codes.Unauthenticated,
+		},
+		{
+			name:     "invalid actor token",
+			req:      &ssov1.TokenExchangeRequest{ActorToken: "invalid", UserId: customerID, AppId: appID, Reason: impersonationReason},
+			expected: codes.Unauthenticated,
+		},
+		{
+			name:     "user is admin",
+			req:      &ssov1.TokenExchangeRequest{ActorToken: adminToken, UserId: adminID, AppId: appID, Reason: impersonationReason},
+			expected: codes.PermissionDenied,
+		},
+		{
+			name:     "unknown user",
+			req:      &ssov1.TokenExchangeRequest{ActorToken: adminToken, UserId: 999999999, AppId: appID, Reason: impersonationReason},
+			expected: codes.NotFound,
+		},
+		{
+			name:     "unknown app",
+			req:      &ssov1.TokenExchangeRequest{ActorToken: adminToken, UserId: customerID, AppId: 999999, Reason: impersonationReason},
+			expected: codes.InvalidArgument,
+		},
+		{
+			name:     "no reason",
+			req:      &ssov1.TokenExchangeRequest{ActorToken: adminToken, UserId: customerID, AppId: appID, Reason: " "},
+			expected: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := st.AuthClient.TokenExchange(ctx, tt.req)
+			assert.Equal(t, tt.expected, status.Code(err))
+		})
+	}
+}
+
+func TestTokenExchange_ActorLosesAdmin(t *testing.T) {
+	ctx, st := suite.New(t)
+
+	adminCtx := adminContext(ctx, t, st)
+	supportID, supportPass := registerUserID(ctx, t, st)
+	_, err := st.AdminClient.SetAdmin(adminCtx, &ssov1.SetAdminRequest{UserId: supportID, IsAdmin: true})
+	require.NoError(t, err)
+
+	respUser, err := st.AdminClient.GetUser(adminCtx, &ssov1.GetUserRequest{UserId: supportID})
+	require.NoError(t, err)
+	respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: respUser.GetUser().GetEmail(), Password: supportPass, AppId: int32(st.Cfg.Admin.AppID)})
+	require.NoError(t, err)
+
+	customerID, _ := registerUserID(ctx, t, st)
+	respExchange, err := st.AuthClient.TokenExchange(ctx, &ssov1.TokenExchangeRequest{
+		ActorToken: respLogin.GetToken(),
+		UserId:     customerID,
+		AppId:      appID,
+		Reason:     impersonationReason,
+	})
+	require.NoError(t, err)
+
+	// Токен живет, пока у администратора есть права
+	_, err = st.AdminClient.SetAdmin(adminCtx, &ssov1.SetAdminRequest{UserId: supportID, IsAdmin: false})
+	require.NoError(t, err)
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, introspectRequest(respExchange.GetToken()))
+	require.NoError(t, err)
+	assert.False(t, respIntrospect.GetActive())
+}
+
+// cachedAdminToken - токен администратора из tests/migrations, один на все тесты: Login ограничен по email
+var cachedAdminToken struct {
+	sync.Mutex
+	token string
+}
+
+// adminLoginToken входит администратором в приложение администраторов из конфига
+func adminLoginToken(ctx context.Context, t *testing.T, st *suite.Suite) string {
+	t.Helper()
+
+	cachedAdminToken.Lock()
+	defer cachedAdminToken.Unlock()
+
+	if cachedAdminToken.token == "" {
+		respLogin, err := st.AuthClient.Login(ctx, &ssov1.LoginRequest{Email: adminEmail, Password: adminPassword, AppId: int32(st.Cfg.Admin.AppID)})
+		require.NoError(t, err)
+		cachedAdminToken.token = respLogin.GetToken()
+	}
+
+	return cachedAdminToken.token
+}
+
+func tokenUID(ctx context.Context, t *testing.T, st *suite.Suite, token string) int64 {
+	t.Helper()
+
+	respIntrospect, err := st.AuthClient.Introspect(ctx, introspectRequest(token))
+	require.NoError(t, err)
+	require.True(t, respIntrospect.GetActive())
+
+	return respIntrospect.GetUid()
+}
+
+func registerUserID(ctx context.Context, t *testing.T, st *suite.Suite) (userID int64, pass string) {
+	t.Helper()
+
+	pass = randomFakePassword()
+	respRegister, err := st.AuthClient.Register(ctx, &ssov1.RegisterRequest{Email: gofakeit.Email(), Password: pass})
+	require.NoError(t, err)
+
+	return respRegister.GetUserId(), pass
+}